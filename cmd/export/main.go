@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sso/internal/config"
+	"sso/internal/lib/email"
+	"sso/internal/lib/fieldcrypt"
+	"sso/internal/services/exporter"
+	"sso/internal/storage"
+	"sso/internal/storage/sqlite"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exports users with their app grants to CSV or JSONL, the format accepted by cmd/import.
+func main() {
+	var configPath, out, format, fields, emailPrefix, createdFrom, createdTo, enabled string
+
+	flag.StringVar(&configPath, "config-path", os.Getenv("CONFIG_PATH"), "path to config file")
+	flag.StringVar(&out, "out", "-", "output file, - for stdout")
+	flag.StringVar(&format, "format", "", "csv or jsonl, by output file extension if empty, csv for stdout")
+	flag.StringVar(&fields, "fields", strings.Join(exporter.DefaultFields, ","),
+		"comma-separated fields: "+strings.Join(exporter.Fields, ", "))
+	flag.StringVar(&emailPrefix, "email-prefix", "", "export only emails starting with the prefix")
+	flag.StringVar(&createdFrom, "created-from", "", "export only users registered since the date, 2006-01-02 or RFC 3339")
+	flag.StringVar(&createdTo, "created-to", "", "export only users registered before the date, 2006-01-02 or RFC 3339")
+	flag.StringVar(&enabled, "enabled", "", "true exports only active users, false only blocked")
+	flag.Parse()
+
+	if configPath == "" {
+		panic("config path is required")
+	}
+
+	selected := strings.Split(fields, ",")
+	for i := range selected {
+		selected[i] = strings.TrimSpace(selected[i])
+	}
+	if err := exporter.CheckFields(selected); err != nil {
+		panic(err)
+	}
+
+	if format == "" {
+		format = exporter.FormatCSV
+		if ext := strings.TrimPrefix(filepath.Ext(out), "."); out != "-" && ext != "" {
+			format = strings.ToLower(ext)
+		}
+	}
+
+	cfg := config.MustLoadPath(configPath)
+
+	filter := storage.UserFilter{
+		EmailPrefix: email.Normalizer{NFC: cfg.EmailNFC}.Normalize(emailPrefix),
+		CreatedFrom: mustParseTime(createdFrom),
+		CreatedTo:   mustParseTime(createdTo),
+	}
+	if enabled != "" {
+		v, err := strconv.ParseBool(enabled)
+		if err != nil {
+			panic("enabled must be true or false")
+		}
+		filter.Enabled = &v
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		// Хэши паролей не должны быть доступны другим пользователям системы
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	buf := bufio.NewWriter(w)
+
+	enc, err := exporter.NewEncoder(format, buf, selected)
+	if err != nil {
+		panic(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	fieldKeys, err := fieldcrypt.Parse(cfg.FieldEncryption.Current, cfg.FieldEncryption.Keys, cfg.FieldEncryption.IndexKey)
+	if err != nil {
+		panic(err)
+	}
+
+	st, err := sqlite.New(cfg.StoragePath, sqlite.PoolOptions{Key: cfg.StorageKey.Key, Fields: fieldKeys}, log)
+	if err != nil {
+		panic(err)
+	}
+	defer st.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	n, err := exporter.New(log, st).Export(ctx, enc, filter)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := buf.Flush(); err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "exported: %d\n", n)
+}
+
+func mustParseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	panic(fmt.Sprintf("invalid date %q, expected 2006-01-02 or RFC 3339", s))
+}
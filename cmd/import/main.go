@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"sso/internal/config"
+	"sso/internal/lib/email"
+	"sso/internal/lib/hasher"
+	"sso/internal/services/auth"
+	"sso/internal/services/importer"
+	"sso/internal/storage/sqlite"
+	"syscall"
+)
+
+// passwords hashes plaintext passwords with the bcrypt cost and pepper of the service config.
+type passwords struct {
+	hasher *hasher.Pool
+	opts   auth.PasswordOptions
+}
+
+func (p passwords) HashPassword(ctx context.Context, password string) ([]byte, string, error) {
+	return auth.HashPassword(ctx, p.hasher, p.opts, password)
+}
+
+// Imports users from a CSV or JSONL file into the database of the service config.
+// Rows that fail validation or have a taken email are reported and skipped, the exit code is 1 if there are any.
+func main() {
+	var configPath, path, format string
+	var batch int
+
+	flag.StringVar(&configPath, "config-path", os.Getenv("CONFIG_PATH"), "path to config file")
+	flag.StringVar(&path, "file", "", "path to CSV or JSONL file")
+	flag.StringVar(&format, "format", "", "csv or jsonl, by file extension if empty")
+	flag.IntVar(&batch, "batch", 500, "users per transaction")
+	flag.Parse()
+
+	if configPath == "" {
+		panic("config path is required")
+	}
+
+	if path == "" {
+		panic("file is required")
+	}
+
+	if format == "" {
+		format = importer.FormatOf(path)
+	}
+
+	cfg := config.MustLoadPath(configPath)
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	dec, err := importer.NewDecoder(format, f)
+	if err != nil {
+		panic(err)
+	}
+
+	storage, err := sqlite.New(cfg.StoragePath, sqlite.PoolOptions{Key: cfg.StorageKey.Key}, log)
+	if err != nil {
+		panic(err)
+	}
+	defer storage.Close()
+
+	peppers := make(map[string][]byte, len(cfg.Pepper.Keys))
+	for id, secret := range cfg.Pepper.Keys {
+		peppers[id] = []byte(secret)
+	}
+
+	parallelism := runtime.GOMAXPROCS(0)
+	imp := importer.New(log, passwords{
+		hasher: hasher.New(parallelism, batch),
+		opts: auth.PasswordOptions{
+			Cost:     cfg.Bcrypt.Cost,
+			Peppers:  peppers,
+			PepperID: cfg.Pepper.Current,
+		},
+	}, storage, email.Normalizer{NFC: cfg.EmailNFC}, batch, parallelism)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report, err := imp.Import(ctx, dec)
+
+	for _, rowErr := range report.Failed {
+		fmt.Println(rowErr)
+	}
+	fmt.Printf("imported: %d, failed: %d\n", report.Imported, len(report.Failed))
+
+	if err != nil {
+		panic(err)
+	}
+
+	if len(report.Failed) > 0 {
+		// os.Exit не выполняет defer
+		_ = storage.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	scenarioRegister = "register"
+	scenarioLogin    = "login"
+	scenarioValidate = "validate"
+	// scenarioFlow registers a user, logs in and validates the token in each iteration.
+	scenarioFlow = "flow"
+
+	loadPassword = "loadgen-password-1"
+)
+
+type options struct {
+	addr        string
+	appCode     string
+	scenario    string
+	rps         int
+	duration    time.Duration
+	concurrency int
+	users       int
+	timeout     time.Duration
+}
+
+// loadgen drives auth calls at a fixed rate against a running server and reports latency percentiles
+// and error rates per method. Iterations are started on schedule regardless of response times,
+// an iteration that finds all workers busy is counted as missed instead of being queued.
+func main() {
+	var opts options
+
+	flag.StringVar(&opts.addr, "addr", "localhost:8080", "address of the sso gRPC server")
+	flag.StringVar(&opts.appCode, "app-code", "test", "app to log in to")
+	flag.StringVar(&opts.scenario, "scenario", scenarioFlow, "register, login, validate or flow")
+	flag.IntVar(&opts.rps, "rps", 50, "iterations started per second")
+	flag.DurationVar(&opts.duration, "duration", 30*time.Second, "duration of the load")
+	flag.IntVar(&opts.concurrency, "concurrency", 64, "max iterations in flight")
+	flag.IntVar(&opts.users, "users", 100, "users registered up front for the login and validate scenarios")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Second, "timeout of a single call")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	if opts.rps <= 0 || opts.concurrency <= 0 || opts.duration <= 0 {
+		return errors.New("rps, concurrency and duration must be positive")
+	}
+
+	cc, err := grpc.NewClient(opts.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer cc.Close()
+
+	g := &generator{
+		opts:   opts,
+		client: ssov1.NewAuthClient(cc),
+		stats:  newStats(),
+		runID:  time.Now().UnixNano(),
+	}
+
+	iteration, err := g.iteration()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("load: %s, %d rps for %s, up to %d in flight against %s\n",
+		opts.scenario, opts.rps, opts.duration, opts.concurrency, opts.addr)
+
+	missed := g.drive(iteration)
+	g.stats.print(os.Stdout, missed)
+
+	return nil
+}
+
+type generator struct {
+	opts   options
+	client ssov1.AuthClient
+	stats  *stats
+	runID  int64
+	seq    atomic.Int64
+
+	// users and tokens are prepared up front for the login and validate scenarios.
+	users  []string
+	tokens []string
+}
+
+// iteration prepares the data of the scenario and returns its iteration.
+func (g *generator) iteration() (func(ctx context.Context), error) {
+	switch g.opts.scenario {
+	case scenarioRegister:
+		return func(ctx context.Context) { g.register(ctx) }, nil
+	case scenarioLogin:
+		if err := g.prepare(false); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) { g.login(ctx, g.users[rand.IntN(len(g.users))]) }, nil
+	case scenarioValidate:
+		if err := g.prepare(true); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) { g.validate(ctx, g.tokens[rand.IntN(len(g.tokens))]) }, nil
+	case scenarioFlow:
+		return func(ctx context.Context) {
+			email, ok := g.register(ctx)
+			if !ok {
+				return
+			}
+			token, ok := g.login(ctx, email)
+			if !ok {
+				return
+			}
+			g.validate(ctx, token)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown scenario %q", g.opts.scenario)
+	}
+}
+
+// prepare registers the users and, if withTokens, logs them in. Setup calls are not counted.
+func (g *generator) prepare(withTokens bool) error {
+	for range g.opts.users {
+		ctx, cancel := context.WithTimeout(context.Background(), g.opts.timeout)
+
+		email := g.nextEmail()
+		_, err := g.client.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: loadPassword})
+		if err == nil && withTokens {
+			var resp *ssov1.LoginResponse
+			resp, err = g.client.Login(ctx, &ssov1.LoginRequest{Email: email, Password: loadPassword, AppCode: g.opts.appCode})
+			if err == nil {
+				g.tokens = append(g.tokens, resp.GetToken())
+			}
+		}
+		cancel()
+
+		if err != nil {
+			return fmt.Errorf("failed to prepare users: %w", err)
+		}
+		g.users = append(g.users, email)
+	}
+
+	if len(g.users) == 0 {
+		return errors.New("users must be positive")
+	}
+
+	return nil
+}
+
+// drive starts iterations at the rate for the duration and waits for those in flight.
+// It returns the number of iterations missed because all workers were busy.
+func (g *generator) drive(iteration func(ctx context.Context)) int64 {
+	slots := make(chan struct{}, g.opts.concurrency)
+	var wg sync.WaitGroup
+	var missed int64
+
+	ticker := time.NewTicker(time.Second / time.Duration(g.opts.rps))
+	defer ticker.Stop()
+
+	deadline := time.After(g.opts.duration)
+	g.stats.start()
+
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+			select {
+			case slots <- struct{}{}:
+			default:
+				missed++
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				ctx, cancel := context.WithTimeout(context.Background(), g.opts.timeout)
+				defer cancel()
+
+				iteration(ctx)
+			}()
+		}
+	}
+
+	wg.Wait()
+	g.stats.stop()
+
+	return missed
+}
+
+func (g *generator) register(ctx context.Context) (string, bool) {
+	email := g.nextEmail()
+
+	start := time.Now()
+	_, err := g.client.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: loadPassword})
+	g.stats.record("Register", time.Since(start), err)
+
+	return email, err == nil
+}
+
+func (g *generator) login(ctx context.Context, email string) (string, bool) {
+	start := time.Now()
+	resp, err := g.client.Login(ctx, &ssov1.LoginRequest{Email: email, Password: loadPassword, AppCode: g.opts.appCode})
+	g.stats.record("Login", time.Since(start), err)
+
+	return resp.GetToken(), err == nil
+}
+
+func (g *generator) validate(ctx context.Context, token string) {
+	start := time.Now()
+	_, err := g.client.Validate(ctx, &ssov1.ValidateTokenRequest{Token: token, AppCode: g.opts.appCode})
+	g.stats.record("Validate", time.Since(start), err)
+}
+
+// nextEmail is unique across runs, so repeated runs against the same database don't collide.
+func (g *generator) nextEmail() string {
+	return fmt.Sprintf("loadgen-%d-%d@example.com", g.runID, g.seq.Add(1))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// stats collects latencies and errors per method. All latencies are kept,
+// which is fine for the volumes a single load generator produces.
+type stats struct {
+	mu      sync.Mutex
+	methods map[string]*methodStats
+
+	startedAt time.Time
+	elapsed   time.Duration
+}
+
+type methodStats struct {
+	latencies []time.Duration
+	// errors counts failed calls by gRPC code.
+	errors map[string]int
+}
+
+func newStats() *stats {
+	return &stats{methods: make(map[string]*methodStats)}
+}
+
+func (s *stats) start() {
+	s.startedAt = time.Now()
+}
+
+func (s *stats) stop() {
+	s.elapsed = time.Since(s.startedAt)
+}
+
+func (s *stats) record(method string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.methods[method]
+	if !ok {
+		m = &methodStats{errors: make(map[string]int)}
+		s.methods[method] = m
+	}
+
+	m.latencies = append(m.latencies, latency)
+	if err != nil {
+		m.errors[status.Code(err).String()]++
+	}
+}
+
+func (s *stats) print(w io.Writer, missed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "method\tcalls\trps\terrors\tp50\tp90\tp99\tmax\t")
+
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := s.methods[name]
+		slices.Sort(m.latencies)
+
+		failed := 0
+		for _, n := range m.errors {
+			failed += n
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.2f%%\t%s\t%s\t%s\t%s\t\n",
+			name,
+			len(m.latencies),
+			float64(len(m.latencies))/s.elapsed.Seconds(),
+			100*float64(failed)/float64(len(m.latencies)),
+			percentile(m.latencies, 0.50),
+			percentile(m.latencies, 0.90),
+			percentile(m.latencies, 0.99),
+			m.latencies[len(m.latencies)-1],
+		)
+	}
+	_ = tw.Flush()
+
+	for _, name := range names {
+		for code, n := range s.methods[name].errors {
+			fmt.Fprintf(w, "%s: %d x %s\n", name, n, code)
+		}
+	}
+
+	if missed > 0 {
+		fmt.Fprintf(w, "missed %d iterations: all workers were busy, raise -concurrency or lower -rps\n", missed)
+	}
+}
+
+// percentile of sorted latencies by the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+
+	return sorted[idx].Round(time.Microsecond)
+}
@@ -0,0 +1,16 @@
+//go:build !sqlcipher
+
+package main
+
+import (
+	"database/sql"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+)
+
+const databaseName = "sqlite3"
+
+func withInstance(db *sql.DB, migrationsTable string) (database.Driver, error) {
+	return sqlite3.WithInstance(db, &sqlite3.Config{MigrationsTable: migrationsTable})
+}
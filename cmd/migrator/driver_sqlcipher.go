@@ -0,0 +1,18 @@
+//go:build sqlcipher
+
+package main
+
+import (
+	"database/sql"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	// Копия драйвера sqlite3 на go-sqlcipher: драйвер sqlite3 тянет mattn/go-sqlite3,
+	// который нельзя собрать вместе с go-sqlcipher
+	"github.com/golang-migrate/migrate/v4/database/sqlcipher"
+)
+
+const databaseName = "sqlcipher"
+
+func withInstance(db *sql.DB, migrationsTable string) (database.Driver, error) {
+	return sqlcipher.WithInstance(db, &sqlcipher.Config{MigrationsTable: migrationsTable})
+}
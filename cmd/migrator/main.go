@@ -4,40 +4,71 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
+
+	"sso/internal/storage/sqlite"
+	"sso/migrations"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
+// Applies the migrations to the database. The key of an encrypted database is taken from
+// STORAGE_KEY or -storage-key-file, as in the service; it needs the binary built with the sqlcipher tag.
 func main() {
-	var storagePath, migrationsPath, migrationsTable string
+	var storagePath, migrationsPath, migrationsTable, keyFile string
 
 	flag.StringVar(&storagePath, "storage-path", "", "path to storage file")
-	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations")
+	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations, the schema migrations built into the binary if empty")
 	flag.StringVar(&migrationsTable, "migrations-table", "migrations", "name of migrations table")
+	flag.StringVar(&keyFile, "storage-key-file", os.Getenv("STORAGE_KEY_FILE"), "path to file with storage key")
 	flag.Parse()
 
 	if storagePath == "" {
 		panic("storage path is required")
 	}
 
-	if migrationsPath == "" {
-		panic("migrations path is required")
-	}
-
 	if migrationsTable == "" {
 		panic("migrations table is required")
 	}
 
-	m, err := migrate.New(
-		"file://"+migrationsPath,
-		fmt.Sprintf("sqlite3://%s?x-migrations-table=%s", storagePath, migrationsTable),
-	)
+	key := os.Getenv("STORAGE_KEY")
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			panic(err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+
+	// База открывается так же, как в сервисе: с ключом на каждом соединении
+	db, err := sqlite.Open(storagePath, key)
+	if err != nil {
+		panic(err)
+	}
+
+	driver, err := withInstance(db, migrationsTable)
+	if err != nil {
+		panic(err)
+	}
+
+	var m *migrate.Migrate
+	if migrationsPath == "" {
+		// Те же файлы, что применяет сервис с auto_migrate
+		source, srcErr := iofs.New(migrations.FS, ".")
+		if srcErr != nil {
+			panic(srcErr)
+		}
+		m, err = migrate.NewWithInstance("iofs", source, databaseName, driver)
+	} else {
+		m, err = migrate.NewWithDatabaseInstance("file://"+migrationsPath, databaseName, driver)
+	}
 	if err != nil {
 		panic(err)
 	}
+	defer m.Close()
 
 	if err := m.Up(); err != nil {
 		if errors.Is(err, migrate.ErrNoChange) {
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"sso/internal/storage/sqlite"
+)
+
+// Restores the database from a snapshot written by the backup job. The service must be stopped.
+// The key of an encrypted database is taken from STORAGE_KEY or -storage-key-file, as in the service.
+func main() {
+	var storagePath, from, keyFile string
+
+	flag.StringVar(&storagePath, "storage-path", "", "path to storage file")
+	flag.StringVar(&from, "from", "", "path to snapshot")
+	flag.StringVar(&keyFile, "storage-key-file", os.Getenv("STORAGE_KEY_FILE"), "path to file with storage key")
+	flag.Parse()
+
+	if storagePath == "" {
+		panic("storage path is required")
+	}
+
+	if from == "" {
+		panic("snapshot path is required")
+	}
+
+	key := os.Getenv("STORAGE_KEY")
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			panic(err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+
+	previous, err := sqlite.Restore(from, storagePath, key)
+	if err != nil {
+		panic(err)
+	}
+
+	if previous != "" {
+		fmt.Printf("restored %s, previous database moved to %s\n", from, previous)
+
+		return
+	}
+
+	fmt.Printf("restored %s\n", from)
+}
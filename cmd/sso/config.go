@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sso/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// runConfig runs `sso config <command>` and returns the exit code.
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: sso config print [-config-path path] [-format yaml|json] [-strict-config] [-env env]")
+		return 2
+	}
+
+	var configPath, format string
+	var opts config.LoadOptions
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags.StringVar(&configPath, "config-path", os.Getenv("CONFIG_PATH"), "path to config file")
+	flags.StringVar(&format, "format", formatYAML, "yaml or json")
+	flags.BoolVar(&opts.Strict, "strict-config", false, "fail on unknown config keys and malformed durations")
+	flags.StringVar(&opts.Env, "env", "", "environment of the config overlay, the env field of the config by default")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "config path is empty")
+		return 2
+	}
+
+	// Проверки те же, что при запуске сервера: невалидный конфиг не печатается
+	cfg, err := config.Load(configPath, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := printConfig(os.Stdout, cfg.Masked(), format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// printConfig writes the config with the keys of the config file.
+func printConfig(w io.Writer, cfg *config.Config, format string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatYAML:
+		_, err = w.Write(data)
+		return err
+	case formatJSON:
+		// Ключи и длительности берутся из YAML, чтобы совпадать с файлом конфигурации
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(values)
+	default:
+		return fmt.Errorf("unknown format %q, expected yaml or json", format)
+	}
+}
@@ -8,11 +8,15 @@ import (
 	"sso/internal/app"
 	"sso/internal/config"
 	"sso/internal/lib/logger"
+	"sso/internal/lib/logger/otlp"
 	"sso/internal/lib/logger/sl"
 	"syscall"
 	"time"
 )
 
+// upgradeTimeout bounds the startup of the new binary on upgrade.
+const upgradeTimeout = 30 * time.Second
+
 const (
 	envLocal = "local"
 	envDev   = "dev"
@@ -20,22 +24,72 @@ const (
 )
 
 func main() {
+	// Подкоманды не запускают сервер
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+
 	cfg := config.MustLoad()
 
-	log := setupLogger(cfg.Env)
+	handler := setupHandler(cfg.Env)
 
-	ssoApplication := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	// Логи уходят в коллектор в дополнение к stdout, ошибки экспорта пишутся только в stdout
+	var exporter *otlp.Exporter
+	if cfg.OTLP.Endpoint != "" {
+		exporter = setupExporter(cfg, slog.New(logger.NewContextHandler(handler)))
+		handler = logger.NewFanoutHandler(handler, exporter.Handler())
+	}
 
-	go func() {
-		ssoApplication.MustRun()
-	}()
+	// Реплики различаются в логах по instance
+	log := slog.New(logger.NewContextHandler(handler)).With(slog.String("instance", cfg.InstanceID))
+
+	ssoApplication := app.New(log, cfg)
+
+	// Ошибка сервера приходит в runErr и завершает процесс той же остановкой, что и сигнал
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+	runErr := make(chan error, 1)
+
+	// Порты занимаются до обработки сигналов: их может понадобиться передать новому процессу
+	if _, err := ssoApplication.Listen(); err != nil {
+		runErr <- err
+	} else {
+		go func() {
+			runErr <- ssoApplication.Run(runCtx)
+		}()
+	}
 
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
-	// Waiting for SIGINT (pkill -2) or SIGTERM
-	<-stop
+	upgrade := make(chan os.Signal, 1)
+	if len(upgradeSignals) > 0 {
+		signal.Notify(upgrade, upgradeSignals...)
+	}
+
+	// Waiting for SIGINT (pkill -2) or SIGTERM, SIGUSR2 to replace the binary or a server failure
+	var runFailure error
+wait:
+	for {
+		select {
+		case <-stop:
+			break wait
+		case runFailure = <-runErr:
+			if runFailure != nil {
+				log.Error("server failed", sl.Err(runFailure))
+			}
+			break wait
+		case <-upgrade:
+			// Новый процесс уже принимает вызовы на тех же портах, этот завершается как по SIGTERM
+			if err := ssoApplication.Upgrade(upgradeTimeout); err != nil {
+				log.Error("failed to upgrade, keep serving", sl.Err(err))
+				continue
+			}
+			break wait
+		}
+	}
+	cancelRun()
 
 	const op = "main.shutdown"
 	shutdownLog := log.With(slog.String("op", op))
@@ -49,37 +103,73 @@ func main() {
 	// Запускаем graceful shutdown в отдельной горутине
 	done := make(chan error, 1)
 	go func() {
-		ssoApplication.Stop()
-		done <- nil
+		done <- ssoApplication.Stop()
 	}()
 
 	// Ждем завершения или таймаута
+	var stopErr error
 	select {
 	case <-ctx.Done():
 		shutdownLog.Error("shutdown timeout exceeded, forcing exit")
 		return
-	case err := <-done:
-		if err != nil {
-			shutdownLog.Error("error during shutdown", sl.Err(err))
-			return
+	case stopErr = <-done:
+		// Логи о незавершённой остановке тоже должны уйти в коллектор
+		if stopErr != nil {
+			shutdownLog.Error("shutdown incomplete", sl.Err(stopErr))
+		} else {
+			shutdownLog.Info("gracefully stopped")
+		}
+	}
+
+	if exporter != nil {
+		if err := exporter.Close(ctx); err != nil {
+			shutdownLog.Error("failed to export remaining logs", sl.Err(err))
 		}
-		shutdownLog.Info("gracefully stopped")
+	}
+
+	// Ненулевой код выхода виден оркестратору и systemd
+	if runFailure != nil || stopErr != nil {
+		os.Exit(1)
 	}
 }
 
-func setupLogger(env string) *slog.Logger {
-	var log *slog.Logger
+func setupHandler(env string) slog.Handler {
+	var handler slog.Handler
 
 	switch env {
 	case envLocal:
-		log = slog.New(logger.NewPrettyHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = logger.NewPrettyHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
 	case envDev:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
 	case envProd:
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
 	default:
-		log = slog.New(slog.NewTextHandler(os.Stdout, nil))
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	}
+
+	return handler
+}
+
+// setupExporter starts the export of logs to the OTLP collector. The resource attributes identify
+// the replica the same way for logs, traces and metrics.
+func setupExporter(cfg *config.Config, errLog *slog.Logger) *otlp.Exporter {
+	level := slog.LevelInfo
+	if cfg.Env == envLocal || cfg.Env == envDev {
+		level = slog.LevelDebug
 	}
 
-	return log
+	return otlp.New(otlp.Options{
+		Endpoint: cfg.OTLP.Endpoint,
+		Headers:  cfg.OTLP.Headers,
+		Resource: map[string]string{
+			"service.name":           cfg.OTLP.ServiceName,
+			"service.instance.id":    cfg.InstanceID,
+			"deployment.environment": cfg.Env,
+		},
+		Level:   level,
+		Timeout: cfg.OTLP.Timeout,
+		OnError: func(err error) {
+			errLog.Error("failed to export logs", sl.Err(err))
+		},
+	})
 }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// upgradeSignals are empty: passing sockets to a new process needs unix.
+var upgradeSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals hand the ports over to a new binary, see app.App.Upgrade.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
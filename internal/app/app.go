@@ -1,54 +1,881 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	debugapp "sso/internal/app/debug"
+	degradationapp "sso/internal/app/degradation"
 	grpcapp "sso/internal/app/grpc"
+	invalidationapp "sso/internal/app/invalidation"
+	opsapp "sso/internal/app/ops"
+	redisapp "sso/internal/app/redis"
 	storageapp "sso/internal/app/storage"
+	vaultapp "sso/internal/app/vault"
+	"sso/internal/config"
+	authgrpc "sso/internal/grpc/auth"
+	"sso/internal/grpc/authz"
+	grpccaptcha "sso/internal/grpc/captcha"
+	grpcdegradation "sso/internal/grpc/degradation"
+	"sso/internal/grpc/idempotency"
+	grpclockout "sso/internal/grpc/lockout"
+	grpcratelimit "sso/internal/grpc/ratelimit"
+	grpcreqctx "sso/internal/grpc/reqctx"
+	"sso/internal/jobs"
+	"sso/internal/lib/audit"
+	"sso/internal/lib/captcha"
+	"sso/internal/lib/email"
+	"sso/internal/lib/fieldcrypt"
+	"sso/internal/lib/geoip"
+	"sso/internal/lib/handoff"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/policy"
+	"sso/internal/lib/ratelimit"
+	"sso/internal/lib/risk"
+	"sso/internal/lib/systemd"
+	"sso/internal/lib/validate"
+	"sso/internal/lib/webhook"
+	"sso/internal/notify"
+	"sso/internal/notify/sms"
+	"sso/internal/notify/smtp"
+	"sso/internal/services/access"
+	"sso/internal/services/admin"
 	"sso/internal/services/auth"
+	"sso/internal/storage/cache"
+	redisstorage "sso/internal/storage/redis"
+	"sso/internal/storage/sqlite"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// debugStopTimeout bounds waiting for in-flight profiles on shutdown.
+const debugStopTimeout = 5 * time.Second
+
 type App struct {
+	log        *slog.Logger
 	gRPCServer *grpcapp.App
 	storageApp *storageapp.App
+	redisApp   *redisapp.App
+	debugApp   *debugapp.App
+	opsApp     *opsapp.App
+	jobs       *jobs.Scheduler
+	// adminServer is nil unless grpc.admin is enabled.
+	adminServer *grpcapp.App
+	// invalidation is nil without Redis or the user cache.
+	invalidation *invalidationapp.App
+	// vault is nil without vault.addr.
+	vault *vaultapp.App
+	// degradation is nil with the degradation policy off.
+	degradation *degradationapp.App
+	// drainDelay is how long the readiness probe reports NOT_READY before the gRPC server stops.
+	drainDelay time.Duration
+	// upgraded is set by Upgrade once a new process serves on the ports.
+	upgraded bool
+	// started is set by Run once the background work is running, Stop waits for it only then.
+	started atomic.Bool
 }
 
 func New(
 	log *slog.Logger,
-	grpcPort int32,
-	storagePath string,
-	tokenTTL time.Duration,
+	cfg *config.Config,
 ) *App {
-	storageApp, err := storageapp.New(storagePath, log)
+	if cfg.MultiInstance {
+		if err := checkMultiInstance(cfg); err != nil {
+			panic("multi-instance mode: " + err.Error())
+		}
+	}
+
+	// Секреты из Vault нужны до подключения к БД и Redis
+	var vaultApp *vaultapp.App
+	if cfg.Vault.Addr != "" {
+		var err error
+		vaultApp, err = vaultapp.New(log, cfg.Vault)
+		if err != nil {
+			panic(err)
+		}
+
+		secrets, err := vaultApp.Secrets()
+		if err != nil {
+			panic(err)
+		}
+
+		if err := cfg.SetVaultSecrets(secrets); err != nil {
+			panic("vault.secrets_path: " + err.Error())
+		}
+	}
+
+	fieldKeys, err := fieldcrypt.Parse(cfg.FieldEncryption.Current, cfg.FieldEncryption.Keys, cfg.FieldEncryption.IndexKey)
+	if err != nil {
+		panic(err)
+	}
+
+	// БД без схемы не появится от повторных попыток
+	storageApp, err := connect(log, "storage", cfg.Startup.Storage, func(err error) bool {
+		return !errors.Is(err, sqlite.ErrNoSchema)
+	}, func() (*storageapp.App, error) {
+		return storageapp.New(cfg.StoragePath, sqlite.PoolOptions{
+			MaxOpenConns:    cfg.StoragePool.MaxOpenConns,
+			MaxIdleConns:    cfg.StoragePool.MaxIdleConns,
+			ConnMaxLifetime: cfg.StoragePool.ConnMaxLifetime,
+			ConnMaxIdleTime: cfg.StoragePool.ConnMaxIdleTime,
+			Key:             cfg.StorageKey.Key,
+			Fields:          fieldKeys,
+			Timeouts: sqlite.Timeouts{
+				Read:  cfg.StorageTimeout.Read,
+				Write: cfg.StorageTimeout.Write,
+			},
+		}, cfg.AutoMigrate, log)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	var redisApp *redisapp.App
+	// redisDegraded is set when Redis never came up and startup.redis_optional lets the service run without it
+	var redisDegraded bool
+	if cfg.Redis.Addr != "" {
+		redisApp, err = connect(log, "redis", cfg.Startup.Redis, nil, func() (*redisapp.App, error) {
+			return redisapp.New(cfg.Redis, log)
+		})
+		if err != nil {
+			if !cfg.Startup.RedisOptional {
+				panic(err)
+			}
+			log.Error("redis is unavailable, starting without it", sl.Err(err))
+			redisDegraded = true
+		}
+	}
+
+	// optionalRedis reports whether a protective feature backed by Redis starts: without Redis
+	// it is off in degraded mode and stops the startup otherwise
+	optionalRedis := func(feature string) bool {
+		if redisApp != nil {
+			return true
+		}
+		if !redisDegraded {
+			panic("redis.addr must be set for " + feature)
+		}
+		log.Warn("feature is off without redis", slog.String("feature", feature))
+		return false
+	}
+
+	// Сессии пошагового входа хранятся в Redis, без него доступен только одношаговый Login
+	var redisStorage *redisstorage.Storage
+	var loginSessions auth.LoginSessionStore
+	if redisApp != nil {
+		redisStorage = redisstorage.New(redisApp.Client, log)
+		loginSessions = redisStorage
+	}
+
+	mailer, err := newMailer(log, cfg.Email)
+	if err != nil {
+		panic(err)
+	}
+
+	geoLocator, err := geoip.Open(cfg.GeoIP.CountryDB, cfg.GeoIP.ASNDB)
 	if err != nil {
 		panic(err)
 	}
 
+	var challenges []auth.Challenge
+	if cfg.NewDevice.StepUp {
+		if redisStorage == nil {
+			panic("new device step-up requires redis.addr to be set")
+		}
+		challenges = append(challenges, auth.NewNewDeviceChallenge(
+			log, storageApp.Storage, redisStorage, mailer, cfg.NewDevice.CodeTTL,
+		))
+	}
+
+	if cfg.GeoIP.StepUp {
+		if redisStorage == nil {
+			panic("new country step-up requires redis.addr to be set")
+		}
+		if cfg.GeoIP.CountryDB == "" {
+			panic("new country step-up requires geoip.country_db to be set")
+		}
+		challenges = append(challenges, auth.NewNewCountryChallenge(
+			log, geoLocator, storageApp.Storage, redisStorage, mailer, cfg.GeoIP.CodeTTL,
+		))
+	}
+
+	var captchaVerifier captcha.Verifier
+	if cfg.Captcha.Provider != "" {
+		captchaVerifier, err = captcha.New(cfg.Captcha.Provider, captcha.Options{
+			Secret:   cfg.Captcha.Secret,
+			MinScore: cfg.Captcha.MinScore,
+			Timeout:  cfg.Captcha.Timeout,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var riskScorer *auth.RiskScorer
+	if cfg.Risk.Enabled {
+		// Без Redis неудачные попытки не учитываются, остальные сигналы работают
+		var failures auth.FailureCounter
+		if redisStorage != nil {
+			failures = redisStorage
+		}
+		riskScorer = auth.NewRiskScorer(log, geoLocator, storageApp.Storage, failures, auth.RiskOptions{
+			Weights: risk.Weights{
+				FailedAttempt:     cfg.Risk.Weights.FailedAttempt,
+				MaxFailedAttempts: cfg.Risk.Weights.MaxFailedAttempts,
+				NewIP:             cfg.Risk.Weights.NewIP,
+				ImpossibleTravel:  cfg.Risk.Weights.ImpossibleTravel,
+				Datacenter:        cfg.Risk.Weights.Datacenter,
+			},
+			FailureWindow:  cfg.Risk.FailureWindow,
+			MaxTravelSpeed: cfg.Risk.MaxTravelSpeed,
+			DatacenterASNs: cfg.Risk.DatacenterASNs,
+		})
+
+		if cfg.Risk.CaptchaThreshold > 0 {
+			if captchaVerifier == nil {
+				panic("risk.captcha_threshold requires captcha.provider to be set")
+			}
+			challenges = append(challenges, auth.NewRiskCaptchaChallenge(riskScorer, captchaVerifier, cfg.Risk.CaptchaThreshold))
+		}
+
+		if cfg.Risk.CodeThreshold > 0 {
+			if redisStorage == nil {
+				panic("risk.code_threshold requires redis.addr to be set")
+			}
+			challenges = append(challenges, auth.NewRiskCodeChallenge(
+				log, riskScorer, cfg.Risk.CodeThreshold, redisStorage, mailer, cfg.Risk.CodeTTL,
+			))
+		}
+	}
+
+	// Согласие запрашивается только для сторонних приложений (apps.third_party)
+	challenges = append(challenges, auth.NewConsentChallenge(log, storageApp.Storage))
+
+	var deviceNotifier auth.Notifier
+	if cfg.NewDevice.Notify {
+		deviceNotifier = mailer
+	}
+
+	peppers := make(map[string][]byte, len(cfg.Pepper.Keys))
+	for id, secret := range cfg.Pepper.Keys {
+		peppers[id] = []byte(secret)
+	}
+
+	emails := email.Normalizer{NFC: cfg.EmailNFC}
+
+	// Восстановление аккаунта хранит сессии и коды в Redis
+	recovery := auth.RecoveryOptions{
+		Notifier: mailer,
+		CodeTTL:  cfg.Recovery.CodeTTL,
+		Auditor:  audit.NewLogger(log),
+	}
+	if redisStorage != nil {
+		recovery.Codes = redisStorage
+	}
+
+	var emailOTP auth.EmailOTPOptions
+	if cfg.EmailOTP.Enabled {
+		if redisStorage == nil {
+			panic("email one-time codes require redis.addr to be set")
+		}
+		emailOTP = auth.EmailOTPOptions{
+			Codes:          redisStorage,
+			Notifier:       mailer,
+			CodeTTL:        cfg.EmailOTP.CodeTTL,
+			ResendInterval: cfg.EmailOTP.ResendInterval,
+		}
+	}
+
+	var emailChecker auth.EmailChecker
+	if cfg.EmailMXCheck {
+		emailChecker = validate.NewMailServerChecker(nil)
+	}
+
+	// Сессии opaque-токенов и отозванные при выходе токены хранятся в Redis, если он настроен, иначе в БД
+	var sessions auth.SessionStore = storageApp.Storage
+	var revokedTokens auth.RevokedTokenStore = storageApp.Storage
+	if redisStorage != nil {
+		sessions, revokedTokens = redisStorage, redisStorage
+	}
+
+	var userProvider auth.UserProvider = storageApp.Storage
+	var userAppProvider auth.UserAppProvider = storageApp.Storage
+	var appProvider auth.AppProvider = storageApp.Storage
+	var userCache *cache.Storage
+	if cfg.UserCache.TTL > 0 || cfg.AppCache.TTL > 0 {
+		userCache = cache.New(storageApp.Storage, storageApp.Storage, storageApp.Storage, cache.Options{
+			TTL:        cfg.UserCache.TTL,
+			AppTTL:     cfg.AppCache.TTL,
+			MaxEntries: cfg.UserCache.MaxEntries,
+		})
+		userProvider, userAppProvider, appProvider = userCache, userCache, userCache
+	}
+
+	// Изменения пользователей и приложений сбрасывают кэш всех реплик через Redis pub/sub
+	var invalidationPublisher cache.Publisher
+	var invalidationApp *invalidationapp.App
+	if redisApp != nil && userCache != nil {
+		invalidations := redisstorage.NewInvalidations(redisApp.Client, cfg.Redis.KeyPrefix+redisstorage.InvalidationChannel, log)
+		invalidationPublisher = invalidations
+		invalidationApp = invalidationapp.New(log, invalidations, userCache)
+	}
+	invalidator := cache.NewInvalidator(log, userCache, invalidationPublisher)
+
+	// Коды по SMS для входа по телефону и подтверждения номера хранятся в Redis
+	var phone auth.PhoneOptions
+	if cfg.SMS.Provider != "" {
+		if redisStorage == nil {
+			panic("sms codes require redis.addr to be set")
+		}
+		texter, err := newTexter(log, cfg.SMS)
+		if err != nil {
+			panic(err)
+		}
+		phone = auth.PhoneOptions{
+			Codes:          redisStorage,
+			Texter:         texter,
+			CodeTTL:        cfg.SMS.CodeTTL,
+			ResendInterval: cfg.SMS.ResendInterval,
+		}
+	}
+
+	// Без настроенных приложений движок политик не используется
+	var policyDecider auth.PolicyDecider
+	if len(cfg.Policy.Apps) > 0 {
+		policyDecider, err = newPolicyEngine(cfg.Policy, audit.NewLogger(log))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var signingKeys auth.SigningKeyProvider = storageApp.Storage
+	if vaultApp != nil {
+		vaultKeys, err := vaultApp.SigningKeys(storageApp.Storage, storageApp.Storage)
+		if err != nil {
+			panic(err)
+		}
+		if vaultKeys != nil {
+			signingKeys = vaultKeys
+		}
+	}
+
 	authService := auth.New(
 		log,
+		hasher.New(cfg.Bcrypt.Parallelism, cfg.Bcrypt.QueueDepth),
+		auth.PasswordOptions{
+			Cost:            cfg.Bcrypt.Cost,
+			Peppers:         peppers,
+			PepperID:        cfg.Pepper.Current,
+			AntiEnumeration: cfg.AntiEnumeration,
+			MinScore:        cfg.PasswordStrength.MinScore,
+		},
 		storageApp.Storage,
+		userProvider,
+		userAppProvider,
+		appProvider,
+		sessions,
+		revokedTokens,
+		loginSessions,
+		challenges,
+		deviceNotifier,
+		cfg.TokenTTL,
+		auth.TokenOptions{
+			MaxSize:        cfg.TokenMaxSize,
+			ClaimsByRef:    cfg.TokenClaimsByRef,
+			Leeway:         cfg.TokenLeeway,
+			DeviceTrustTTL: cfg.NewDevice.TrustTTL,
+			Delegations:    cfg.TokenExchange.Delegations,
+			PurposeTTL: map[jwt.Purpose]time.Duration{
+				jwt.PurposeVerifyEmail:   cfg.PurposeTokenTTL.VerifyEmail,
+				jwt.PurposeResetPassword: cfg.PurposeTokenTTL.ResetPassword,
+				jwt.PurposeMagicLink:     cfg.PurposeTokenTTL.MagicLink,
+			},
+		},
+		cfg.LoginSessionTTL,
+		emails,
+		emailChecker,
+		policyDecider,
 		storageApp.Storage,
+		signingKeys,
+		geoLocator,
+		cfg.Terms.Version,
+		auth.AttributeOptions{
+			MaxSize:    cfg.UserAttributes.MaxSize,
+			Visibility: cfg.UserAttributes.Visibility,
+		},
+		recovery,
+		emailOTP,
+		phone,
+		riskScorer,
+		invalidator,
+	)
+
+	// Общий для лимитера и блокировки входа: оба ходят в один Redis
+	var rateLimitBreaker *ratelimit.Breaker
+	if cfg.RateLimit.Breaker.Threshold > 0 {
+		rateLimitBreaker = ratelimit.NewBreaker(cfg.RateLimit.Breaker.Threshold, cfg.RateLimit.Breaker.Cooldown)
+	}
+
+	var rateLimiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled && optionalRedis("rate limiting") {
+		rateLimiter = ratelimit.New(redisApp.Client, cfg.RateLimit.ClockResync, rateLimitBreaker)
+	}
+
+	var lockout *ratelimit.Lockout
+	if cfg.RateLimit.Lockout.Enabled && optionalRedis("login lockout") {
+		lockout, err = ratelimit.NewLockout(redisApp.Client, rateLimitBreaker, ratelimit.LockoutOptions{
+			Threshold:  cfg.RateLimit.Lockout.Threshold,
+			Steps:      cfg.RateLimit.Lockout.Steps,
+			ResetAfter: cfg.RateLimit.Lockout.ResetAfter,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	rateLimits := authgrpc.RateLimits{
+		Window:        cfg.RateLimit.Window,
+		LoginPerEmail: cfg.RateLimit.LoginPerEmail,
+		LoginPerIP:    cfg.RateLimit.LoginPerIP,
+		RegisterPerIP: cfg.RateLimit.RegisterPerIP,
+		FailClosed:    cfg.RateLimit.FailClosed,
+	}
+
+	// Счётчики, которые администратор может посмотреть и сбросить
+	var rateLimitCounters []admin.RateLimitCounters
+	if rateLimiter != nil {
+		rateLimitCounters = append(rateLimitCounters,
+			grpcratelimit.NewInspector(rateLimiter, authgrpc.RateLimitRules(rateLimits)))
+	}
+	if lockout != nil {
+		rateLimitCounters = append(rateLimitCounters, grpclockout.NewInspector(lockout, authgrpc.LockoutRules()))
+	}
+
+	adminService := admin.New(
+		log,
 		storageApp.Storage,
+		emails,
+		rateLimitCounters,
+		invalidator,
+	)
+
+	var webhooks access.WebhookSender
+	if cfg.Webhooks.Enabled {
+		webhooks = webhook.New(webhook.Options{
+			Timeout:  cfg.Webhooks.Timeout,
+			Attempts: cfg.Webhooks.Attempts,
+			Backoff:  cfg.Webhooks.Backoff,
+		})
+	}
+
+	accessService := access.New(
+		log,
 		storageApp.Storage,
 		storageApp.Storage,
 		storageApp.Storage,
-		tokenTTL)
-	grpcApp := grpcapp.New(log, authService, grpcPort)
+		audit.NewLogger(log),
+		emails,
+		invalidator,
+		webhooks,
+	)
+
+	maintenanceJobs, err := newJobs(log, cfg, storageApp.Storage, adminService)
+	if err != nil {
+		panic(err)
+	}
+	scheduler := jobs.New(log, maintenanceJobs)
+
+	var idempotencyStore idempotency.Store
+	if cfg.Idempotency.Enabled && optionalRedis("idempotency keys") {
+		idempotencyStore = redisStorage
+	}
+
+	var captchaFailures grpccaptcha.FailureStore
+	if cfg.Captcha.Provider != "" && cfg.Captcha.Login && cfg.Captcha.LoginAfterFailures > 0 &&
+		optionalRedis("captcha after failed logins") {
+		captchaFailures = redisStorage
+	}
+
+	trustedProxies, err := grpcreqctx.ParseProxies(cfg.GRPC.RequestContext.TrustedProxies)
+	if err != nil {
+		panic("grpc.request_context.trusted_proxies: " + err.Error())
+	}
+
+	// При БД только на чтение записи отклоняются сразу, а Validate продолжает работать
+	if err := degradationapp.ValidatePolicy(cfg.Degradation.Policy); err != nil {
+		panic(err)
+	}
+	var degradationApp *degradationapp.App
+	var readOnly grpcdegradation.State
+	if cfg.Degradation.Policy != "" && cfg.Degradation.Policy != degradationapp.PolicyOff {
+		degradationApp = degradationapp.New(log, storageApp.Storage.CheckWritable, cfg.Degradation.ProbeInterval)
+		readOnly = degradationApp
+	}
+
+	authn := authz.NewAuthenticator(authService, storageApp.Storage, authz.Options{
+		AdminApp:    cfg.Authz.AdminApp,
+		AdminEmails: cfg.Authz.AdminEmails,
+		AdminApps:   cfg.Authz.AdminApps,
+	})
+	requestContext := grpcreqctx.Options{
+		Headers:        cfg.GRPC.RequestContext.Headers,
+		TrustedProxies: trustedProxies,
+	}
+
+	grpcApp, err := grpcapp.New(log, authService, accessService, cfg.GRPC, rateLimiter, rateLimits, authn,
+		lockout, idempotencyStore, cfg.Idempotency.TTL, captchaVerifier, captchaFailures, authgrpc.CaptchaPolicy{
+			Register:           cfg.Captcha.Register,
+			Login:              cfg.Captcha.Login,
+			LoginAfterFailures: cfg.Captcha.LoginAfterFailures,
+			FailureWindow:      cfg.Captcha.FailureWindow,
+		}, requestContext, readOnly)
+	if err != nil {
+		panic(err)
+	}
+
+	// Управление доступом на отдельном порту, который закрывается от публичной сети
+	var adminApp *grpcapp.App
+	if cfg.GRPC.Admin.Enabled {
+		adminApp, err = grpcapp.NewAdmin(log, authService, accessService, cfg.GRPC, authn,
+			idempotencyStore, cfg.Idempotency.TTL, requestContext, readOnly)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var debugApp *debugapp.App
+	if cfg.Debug.Enabled {
+		debugApp, err = debugapp.New(log, debugapp.Options{
+			Addr:                 cfg.Debug.Addr,
+			BlockProfileRate:     cfg.Debug.BlockProfileRate,
+			MutexProfileFraction: cfg.Debug.MutexProfileFraction,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		expvar.Publish("instance", expvar.Func(func() any { return cfg.InstanceID }))
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+		expvar.Publish("sqlite", expvar.Func(func() any { return storageApp.Storage.Stats() }))
+		expvar.Publish("jobs", expvar.Func(func() any { return scheduler.Stats() }))
+	}
+
+	var opsApp *opsapp.App
+	if cfg.Ops.Enabled {
+		checks := readinessChecks(storageApp, redisApp)
+		if cfg.Degradation.Policy == degradationapp.PolicyUnready {
+			checks = append(checks, opsapp.Check{Name: "storage_writable", Check: degradationApp.Check})
+		}
+		opsApp = opsapp.New(log, cfg.Ops.Addr, checks)
+	}
+
+	if err := inheritListeners(log, grpcApp, adminApp, opsApp, debugApp); err != nil {
+		panic(err)
+	}
 
 	return &App{
-		gRPCServer: grpcApp,
-		storageApp: storageApp,
+		log:          log,
+		gRPCServer:   grpcApp,
+		adminServer:  adminApp,
+		storageApp:   storageApp,
+		redisApp:     redisApp,
+		debugApp:     debugApp,
+		opsApp:       opsApp,
+		jobs:         scheduler,
+		invalidation: invalidationApp,
+		vault:        vaultApp,
+		degradation:  degradationApp,
+		drainDelay:   cfg.Ops.DrainDelay,
+	}
+}
+
+// readinessChecks are the dependencies the service can't serve traffic without.
+func readinessChecks(storageApp *storageapp.App, redisApp *redisapp.App) []opsapp.Check {
+	checks := []opsapp.Check{
+		{Name: "storage", Check: storageApp.Storage.Ping},
+		{Name: "migrations", Check: storageApp.Storage.CheckMigrations},
+	}
+
+	if redisApp != nil {
+		checks = append(checks, opsapp.Check{Name: "redis", Check: redisApp.Ping})
+	}
+
+	return checks
+}
+
+// newMailer creates the mailer of user notifications. Without an SMTP host emails are written to the log.
+func newMailer(log *slog.Logger, cfg config.EmailConfig) (*notify.Mailer, error) {
+	templates, err := notify.DefaultTemplates(cfg.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	var sender notify.EmailSender = notify.NewLogSender(log)
+	if cfg.SMTP.Host != "" {
+		sender, err = smtp.New(smtp.Options{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+			TLSMode:  cfg.SMTP.TLSMode,
+			Timeout:  cfg.SMTP.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return notify.NewMailer(log, sender, templates), nil
+}
+
+func newTexter(log *slog.Logger, cfg config.SMSConfig) (*notify.Texter, error) {
+	templates, err := notify.DefaultTemplates(cfg.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	var sender notify.SMSSender
+	switch cfg.Provider {
+	case sms.ProviderTwilio:
+		sender, err = sms.NewTwilio(sms.TwilioOptions{
+			AccountSID: cfg.Twilio.AccountSID,
+			AuthToken:  cfg.Twilio.AuthToken,
+			From:       cfg.Twilio.From,
+			Timeout:    cfg.Timeout,
+		})
+	case sms.ProviderHTTP:
+		sender, err = sms.NewHTTP(sms.HTTPOptions{
+			URL:     cfg.HTTP.URL,
+			Token:   cfg.HTTP.Token,
+			Timeout: cfg.Timeout,
+		})
+	case sms.ProviderLog:
+		sender = notify.NewLogSMSSender(log)
+	default:
+		err = fmt.Errorf("%w: %q", sms.ErrUnknownProvider, cfg.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.NewTexter(log, sender, templates), nil
+}
+
+// newPolicyEngine creates the policy engine with the decider configured for each app.
+func newPolicyEngine(cfg config.PolicyConfig, auditor policy.Auditor) (*policy.Engine, error) {
+	deciders := make(map[string]policy.Decider, len(cfg.Apps))
+	for appCode, appCfg := range cfg.Apps {
+		switch appCfg.Engine {
+		case config.PolicyEngineCasbin:
+			casbin, err := policy.NewCasbin(appCfg.PolicyFile)
+			if err != nil {
+				return nil, err
+			}
+			deciders[appCode] = casbin
+		case config.PolicyEngineOPA:
+			deciders[appCode] = policy.NewOPA(appCfg.URL, appCfg.Path, appCfg.Timeout)
+		default:
+			return nil, fmt.Errorf("unknown policy engine %q of app %q", appCfg.Engine, appCode)
+		}
 	}
+
+	return policy.New(deciders, auditor, cfg.CacheTTL, cfg.CacheMaxEntries), nil
+}
+
+// Listen binds the ports before MustRun, e.g. to learn the port picked for grpc.port 0.
+// The admin, ops and debug ports are bound too, the address of the admin one is returned by ListenAdmin.
+func (a *App) Listen() (net.Addr, error) {
+	// Серверы проб и отладки необязательны: ошибку повторит и залогирует их Run
+	if a.debugApp != nil {
+		_, _ = a.debugApp.Listen()
+	}
+	if a.opsApp != nil {
+		_, _ = a.opsApp.Listen()
+	}
+
+	if _, err := a.ListenAdmin(); err != nil {
+		return nil, err
+	}
+
+	return a.gRPCServer.Listen()
+}
+
+// ListenAdmin binds the admin gRPC port, nil without the admin listener.
+func (a *App) ListenAdmin() (net.Addr, error) {
+	if a.adminServer == nil {
+		return nil, nil
+	}
+
+	return a.adminServer.Listen()
 }
 
+// MustRun runs the app like Run without a way to cancel it and panics if a gRPC server fails.
 func (a *App) MustRun() {
-	a.gRPCServer.MustRun()
+	if err := a.Run(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// Run binds the ports, starts the servers and the background work and blocks until ctx is done
+// or a gRPC server fails, returning its error. Either way Stop must be called afterwards.
+func (a *App) Run(ctx context.Context) error {
+	const op = "app.Run"
+
+	// systemd с Type=notify считает сервис запущенным, когда порты уже слушаются
+	if _, err := a.Listen(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.started.Store(true)
+
+	// Отладочный сервер необязателен: его ошибка не останавливает приложение
+	if a.debugApp != nil {
+		go func() {
+			_ = a.debugApp.Run()
+		}()
+	}
+
+	if a.opsApp != nil {
+		go func() {
+			_ = a.opsApp.Run()
+		}()
+	}
+
+	go a.jobs.Run()
+
+	if a.invalidation != nil {
+		go a.invalidation.Run()
+	}
+
+	if a.vault != nil {
+		go a.vault.Run()
+	}
+
+	if a.degradation != nil {
+		go a.degradation.Run()
+	}
+
+	// После Upgrade главным процессом сервиса становится этот
+	a.notifySystemd(systemd.MainPID(os.Getpid()) + "\n" + systemd.Ready)
+
+	// Предыдущий процесс, передавший порты, может начинать остановку
+	if err := handoff.Ready(); err != nil {
+		a.log.Error("failed to report readiness to previous process", sl.Err(err))
+	}
+
+	// Сервер, остановленный Stop, возвращает nil
+	errs := make(chan error, 2)
+	go func() {
+		errs <- a.gRPCServer.Run()
+	}()
+	if a.adminServer != nil {
+		go func() {
+			errs <- a.adminServer.Run()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+}
+
+// Stop drains the gRPC servers, then stops the background work and the ops and debug servers,
+// then closes the storage and Redis. The steps of each stage run concurrently. The returned error
+// joins the errors of all the steps that failed, so an incomplete shutdown is not silent.
+func (a *App) Stop() error {
+	const op = "app.Stop"
+
+	// После передачи портов сервис продолжает работать в новом процессе
+	if !a.upgraded {
+		a.notifySystemd(systemd.Stopping)
+	}
+
+	// Балансировщик должен успеть увидеть NOT_READY до того, как сервер перестанет принимать вызовы.
+	// Порты, переданные новому процессу, не закрываются, поэтому после Upgrade ждать нечего
+	if a.opsApp != nil && !a.upgraded && a.started.Load() {
+		a.opsApp.Drain()
+		time.Sleep(a.drainDelay)
+	}
+
+	// Начатые вызовы дорабатывают первыми: им ещё нужны хранилище и Redis
+	grpcSteps := []func() error{stopStep(a.gRPCServer.Stop)}
+	if a.adminServer != nil {
+		grpcSteps = append(grpcSteps, stopStep(a.adminServer.Stop))
+	}
+	_ = concurrently(grpcSteps...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), debugStopTimeout)
+	defer cancel()
+
+	// Фоновые задачи тоже пишут в хранилище, а /readyz его проверяет
+	steps := []func() error{
+		func() error { return a.debugApp.Stop(ctx) },
+		func() error { return a.opsApp.Stop(ctx) },
+	}
+	// Без Run фоновые задачи не запускались, и их Stop ждал бы завершения вечно
+	if a.started.Load() {
+		steps = append(steps,
+			stopStep(a.jobs.Stop),
+			stopStep(a.invalidation.Stop),
+			stopStep(a.vault.Stop),
+			stopStep(a.degradation.Stop),
+		)
+	}
+	err := concurrently(steps...)
+
+	err = errors.Join(err, concurrently(
+		a.storageApp.Storage.Close,
+		a.redisApp.Close,
+	))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// concurrently runs the steps and waits for all of them, joining their errors.
+func concurrently(steps ...func() error) error {
+	errs := make([]error, len(steps))
+
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = step()
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// stopStep adapts a stop method that can't fail to concurrently.
+func stopStep(stop func()) func() error {
+	return func() error {
+		stop()
+		return nil
+	}
 }
 
-func (a *App) Stop() {
-	a.gRPCServer.Stop()
-	if err := a.storageApp.Storage.Close(); err != nil {
-		// Логируем ошибку закрытия storage, но не паникуем
-		// так как приложение уже завершается
+// notifySystemd reports the state to systemd when the service runs with Type=notify.
+func (a *App) notifySystemd(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		a.log.Warn("failed to notify systemd", slog.String("state", state), sl.Err(err))
 	}
 }
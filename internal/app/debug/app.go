@@ -0,0 +1,162 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sso/internal/lib/logger/sl"
+	"time"
+)
+
+var ErrNotLoopback = errors.New("debug server must listen on a loopback address")
+
+const readHeaderTimeout = 5 * time.Second
+
+// Options configures the debug server.
+type Options struct {
+	Addr string
+	// BlockProfileRate is passed to runtime.SetBlockProfileRate, zero disables the block profile.
+	BlockProfileRate int
+	// MutexProfileFraction is passed to runtime.SetMutexProfileFraction, zero disables the mutex profile.
+	MutexProfileFraction int
+}
+
+// App serves pprof, expvar and a goroutine dump over HTTP.
+type App struct {
+	log    *slog.Logger
+	server *http.Server
+	// listener is bound by Listen or inherited, Run binds it itself otherwise.
+	listener net.Listener
+}
+
+// New creates the debug server. The server exposes process internals,
+// so only loopback addresses are accepted.
+func New(log *slog.Logger, opts Options) (*App, error) {
+	const op = "debugapp.New"
+
+	if err := checkLoopback(opts.Addr); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	runtime.SetBlockProfileRate(opts.BlockProfileRate)
+	runtime.SetMutexProfileFraction(opts.MutexProfileFraction)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutines)
+
+	return &App{
+		log: log,
+		server: &http.Server{
+			Addr:              opts.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+	}, nil
+}
+
+// Listen binds the address of the debug server without serving yet, Run serves on it.
+func (a *App) Listen() (net.Addr, error) {
+	if a.listener != nil {
+		return a.listener.Addr(), nil
+	}
+
+	l, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	a.listener = l
+
+	return l.Addr(), nil
+}
+
+// Inherit makes the server serve on the listener passed by the previous process or systemd
+// instead of binding its address.
+func (a *App) Inherit(l net.Listener) {
+	a.listener = l
+}
+
+// Listener returns the bound listener, nil before Listen or Run.
+func (a *App) Listener() net.Listener {
+	return a.listener
+}
+
+// Run runs the debug server until Stop is called.
+func (a *App) Run() error {
+	const op = "debugapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("addr", a.server.Addr),
+	)
+
+	if _, err := a.Listen(); err != nil {
+		log.Error("failed to listen", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("debug server started")
+
+	if err := a.server.Serve(a.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("debug server stopped with error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Stop stops the debug server, aborting in-flight profiles.
+func (a *App) Stop(ctx context.Context) error {
+	const op = "debugapp.Stop"
+
+	if a == nil {
+		return nil
+	}
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("stopping debug server")
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		err = errors.Join(err, a.server.Close())
+		log.Error("failed to stop debug server", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// goroutines writes the stacks of all goroutines in the panic format.
+func goroutines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%w: %q", ErrNotLoopback, addr)
+	}
+
+	return nil
+}
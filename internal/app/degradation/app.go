@@ -0,0 +1,135 @@
+package degradation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"sync/atomic"
+	"time"
+)
+
+// Policies of serving calls while the storage is read-only.
+const (
+	// PolicyOff doesn't probe the storage, writes fail as they come.
+	PolicyOff = "off"
+	// PolicyReadOnly keeps serving reads, e.g. Validate, and rejects writes before they reach the storage.
+	PolicyReadOnly = "read_only"
+	// PolicyUnready also reports the instance not ready, so the balancer moves the traffic to other replicas.
+	PolicyUnready = "unready"
+)
+
+// probeTimeout bounds a single probe of the storage.
+const probeTimeout = 5 * time.Second
+
+// Probe returns storage.ErrReadOnly while the storage doesn't accept writes, see sqlite.Storage.CheckWritable.
+type Probe func(ctx context.Context) error
+
+// App probes whether the storage accepts writes and keeps the result for the degradation policy.
+type App struct {
+	log      *slog.Logger
+	probe    Probe
+	interval time.Duration
+	readOnly atomic.Bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(log *slog.Logger, probe Probe, interval time.Duration) *App {
+	return &App{
+		log:      log,
+		probe:    probe,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// ValidatePolicy returns an error for an unknown policy, an empty one is PolicyOff.
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case "", PolicyOff, PolicyReadOnly, PolicyUnready:
+		return nil
+	default:
+		return fmt.Errorf("unknown degradation policy %q", policy)
+	}
+}
+
+// ReadOnly reports whether the last probe found the storage read-only. A nil App is never read-only.
+func (a *App) ReadOnly() bool {
+	return a != nil && a.readOnly.Load()
+}
+
+// Check returns storage.ErrReadOnly while the storage is read-only, for the readiness probe.
+func (a *App) Check(_ context.Context) error {
+	if a.ReadOnly() {
+		return storage.ErrReadOnly
+	}
+
+	return nil
+}
+
+// Run probes the storage every interval until Stop is called.
+func (a *App) Run() {
+	const op = "degradationapp.Run"
+
+	defer close(a.done)
+
+	a.log.With(slog.String("op", op)).Info("storage write probe started", slog.Duration("interval", a.interval))
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.check()
+
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) check() {
+	const op = "degradationapp.check"
+
+	log := a.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	err := a.probe(ctx)
+	// Прочие ошибки не говорят о режиме только для чтения: состояние не меняется
+	if err != nil && !errors.Is(err, storage.ErrReadOnly) {
+		log.Error("failed to probe storage", sl.Err(err))
+		return
+	}
+
+	readOnly := err != nil
+	if a.readOnly.Swap(readOnly) == readOnly {
+		return
+	}
+
+	if readOnly {
+		log.Error("storage is read-only, writes are rejected")
+	} else {
+		log.Info("storage accepts writes again")
+	}
+}
+
+// Stop stops probing.
+func (a *App) Stop() {
+	const op = "degradationapp.Stop"
+
+	if a == nil {
+		return
+	}
+
+	a.log.With(slog.String("op", op)).Info("stopping storage write probe")
+
+	close(a.stop)
+	<-a.done
+}
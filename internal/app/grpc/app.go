@@ -2,31 +2,180 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"os"
+	"sso/internal/config"
+	"sso/internal/grpc/apierr"
 	authgrpc "sso/internal/grpc/auth"
+	"sso/internal/grpc/authz"
+	grpccaptcha "sso/internal/grpc/captcha"
+	"sso/internal/grpc/deadline"
+	"sso/internal/grpc/degradation"
+	"sso/internal/grpc/idempotency"
+	grpclockout "sso/internal/grpc/lockout"
+	grpcratelimit "sso/internal/grpc/ratelimit"
+	"sso/internal/grpc/reqctx"
+	"sso/internal/grpc/requestid"
+	"sso/internal/grpc/surface"
+	"sso/internal/grpc/validate"
+	"sso/internal/lib/captcha"
 	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/ratelimit"
+	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+)
+
+// Surfaces of the gRPC listeners, logged with their events.
+const (
+	SurfacePublic = "public"
+	SurfaceAdmin  = "admin"
 )
 
 type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
 	port       int32
+	// surface tells the public listener from the admin one in logs.
+	surface    string
+	unixSocket unixSocket
+	// listeners are bound by Listen, Run binds them itself if Listen was not called.
+	// The TCP listener comes first unless the Unix socket is exclusive.
+	listeners []net.Listener
+}
+
+// unixSocket is the parsed config.UnixSocketConfig, an empty path disables the socket.
+type unixSocket struct {
+	path      string
+	mode      os.FileMode
+	exclusive bool
 }
 
-// New creates new gRPC server app.
+// New creates new gRPC server app of the public listener.
+// Rate limiting is enabled only when rateLimiter is not nil, login lockout only when lockout is not nil,
+// idempotency keys only when idempotencyStore is not nil,
+// CAPTCHA verification only when captchaVerifier is not nil, the rejection of writes
+// while the storage is read-only only when readOnly is not nil.
+// With the admin listener enabled the public one doesn't serve the admin methods, see NewAdmin.
 func New(
 	log *slog.Logger,
 	authService authgrpc.Auth,
-	port int32,
-) *App {
+	accessService authgrpc.Access,
+	cfg config.GRPCConfig,
+	rateLimiter *ratelimit.Limiter,
+	rateLimits authgrpc.RateLimits,
+	authn *authz.Authenticator,
+	lockout *ratelimit.Lockout,
+	idempotencyStore idempotency.Store,
+	idempotencyTTL time.Duration,
+	captchaVerifier captcha.Verifier,
+	captchaFailures grpccaptcha.FailureStore,
+	captchaPolicy authgrpc.CaptchaPolicy,
+	requestContext reqctx.Options,
+	readOnly degradation.State,
+) (*App, error) {
+	const op = "grpcapp.New"
+
+	var served grpc.UnaryServerInterceptor
+	if cfg.Admin.Enabled {
+		served = surface.Except(authgrpc.AdminMethods())
+	}
+
+	interceptors := baseInterceptors(log, cfg, served, requestContext, authn)
+
+	// После авторизации: вызов без прав отклоняется как обычно
+	if readOnly != nil {
+		interceptors = append(interceptors, degradation.UnaryServerInterceptor(readOnly, authgrpc.WriteMethods()))
+	}
+
+	if rateLimiter != nil {
+		interceptors = append(interceptors,
+			grpcratelimit.UnaryServerInterceptor(rateLimiter, authgrpc.RateLimitRules(rateLimits), rateLimits.FailClosed, log),
+		)
+	}
+
+	// До CAPTCHA: заблокированный вход отклоняется без обращения к провайдеру
+	if lockout != nil {
+		interceptors = append(interceptors,
+			grpclockout.UnaryServerInterceptor(lockout, authgrpc.LockoutRules(), rateLimits.FailClosed, log),
+		)
+	}
+
+	// После авторизации и rate limiting: сохранённый ответ не отдаётся вызывающему без прав
+	if idempotencyStore != nil {
+		interceptors = append(interceptors,
+			idempotency.UnaryServerInterceptor(idempotencyStore, authgrpc.IdempotentMethods(), idempotencyTTL, log),
+		)
+	}
+
+	// После идемпотентности: повтор сохранённого ответа не требует нового токена CAPTCHA
+	if captchaVerifier != nil {
+		interceptors = append(interceptors,
+			grpccaptcha.UnaryServerInterceptor(captchaVerifier, captchaFailures, authgrpc.CaptchaRules(captchaPolicy), log),
+		)
+	}
+
+	app, err := newApp(log, authService, accessService, cfg, cfg.Port, cfg.TLS, cfg.UnixSocket, SurfacePublic, interceptors)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// NewAdmin creates the gRPC server app of the admin listener serving only the admin methods
+// (access management) with a chain of its own: no rate limiting, lockout or CAPTCHA,
+// which protect the public login and registration.
+func NewAdmin(
+	log *slog.Logger,
+	authService authgrpc.Auth,
+	accessService authgrpc.Access,
+	cfg config.GRPCConfig,
+	authn *authz.Authenticator,
+	idempotencyStore idempotency.Store,
+	idempotencyTTL time.Duration,
+	requestContext reqctx.Options,
+	readOnly degradation.State,
+) (*App, error) {
+	const op = "grpcapp.NewAdmin"
+
+	interceptors := baseInterceptors(log, cfg, surface.Only(authgrpc.AdminMethods()), requestContext, authn)
+
+	if readOnly != nil {
+		interceptors = append(interceptors, degradation.UnaryServerInterceptor(readOnly, authgrpc.WriteMethods()))
+	}
+
+	if idempotencyStore != nil {
+		interceptors = append(interceptors,
+			idempotency.UnaryServerInterceptor(idempotencyStore, authgrpc.IdempotentMethods(), idempotencyTTL, log),
+		)
+	}
+
+	app, err := newApp(log, authService, accessService, cfg, cfg.Admin.Port, cfg.Admin.TLS, cfg.Admin.UnixSocket, SurfaceAdmin, interceptors)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// baseInterceptors returns the head of the chain shared by both listeners, up to authorization.
+// served rejects the methods not served on the listener, nil serves all of them.
+func baseInterceptors(
+	log *slog.Logger,
+	cfg config.GRPCConfig,
+	served grpc.UnaryServerInterceptor,
+	requestContext reqctx.Options,
+	authn *authz.Authenticator,
+) []grpc.UnaryServerInterceptor {
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(
 			logging.PayloadReceived, logging.PayloadSent,
@@ -34,25 +183,106 @@ func New(
 	}
 
 	recoveryOpts := []recovery.Option{
-		recovery.WithRecoveryHandler(func(p interface{}) (err error) {
+		recovery.WithRecoveryHandlerContext(func(ctx context.Context, p interface{}) (err error) {
 			const op = "grpcapp.recovery"
-			log.With(slog.String("op", op)).Error("recovered from panic", slog.Any("panic", p))
-			return status.Errorf(codes.Internal, "internal error")
+			log.With(slog.String("op", op)).ErrorContext(ctx, "recovered from panic", slog.Any("panic", p))
+			return apierr.New(ctx, codes.Internal, apierr.ReasonInternal, "internal error")
 		}),
 	}
 
-	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+	interceptors := []grpc.UnaryServerInterceptor{
+		requestid.UnaryServerInterceptor(),
+		// Сразу после request ID: видит ошибки всех остальных интерцепторов и handler
+		apierr.UnaryServerInterceptor(),
+	}
+
+	// Метод другого листенера отклоняется раньше, чем о вызове что-либо узнают остальные интерцепторы
+	if served != nil {
+		interceptors = append(interceptors, served)
+	}
+
+	return append(interceptors,
+		// До логирования и остальных интерцепторов: им нужен IP клиента
+		reqctx.UnaryServerInterceptor(requestContext),
+		deadline.UnaryServerInterceptor(cfg.Timeout),
 		recovery.UnaryServerInterceptor(recoveryOpts...),
 		logging.UnaryServerInterceptor(InterceptorLogger(log), loggingOpts...),
-	))
+		validate.UnaryServerInterceptor(authgrpc.ValidationRules()),
+		authz.UnaryServerInterceptor(authn, authgrpc.AuthzPolicy(), log),
+	)
+}
 
-	authgrpc.Register(gRPCServer, authService)
+func newApp(
+	log *slog.Logger,
+	authService authgrpc.Auth,
+	accessService authgrpc.Access,
+	cfg config.GRPCConfig,
+	port int32,
+	tlsCfg config.GRPCTLSConfig,
+	unixCfg config.UnixSocketConfig,
+	name string,
+	interceptors []grpc.UnaryServerInterceptor,
+) (*App, error) {
+	opts, err := tlsOptions(tlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s tls: %w", name, err)
+	}
+
+	socket := unixSocket{path: unixCfg.Path, exclusive: unixCfg.Exclusive}
+	if socket.path != "" {
+		if socket.mode, err = parseSocketMode(unixCfg.Mode); err != nil {
+			return nil, fmt.Errorf("%s unix socket: %w", name, err)
+		}
+	}
+	opts = append(opts, serverOptions(cfg)...)
+
+	gRPCServer := grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(interceptors...))...)
+
+	authgrpc.Register(gRPCServer, authService, accessService)
+
+	// Reflection раскрывает схему API, поэтому включается только явно (для grpcurl/Postman в dev)
+	if cfg.Reflection {
+		reflection.Register(gRPCServer)
+	}
 
 	return &App{
 		log:        log,
 		gRPCServer: gRPCServer,
 		port:       port,
+		surface:    name,
+		unixSocket: socket,
+	}, nil
+}
+
+// serverOptions maps connection limits and keepalive settings from config to server options.
+func serverOptions(cfg config.GRPCConfig) []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     cfg.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:      cfg.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.Keepalive.MaxConnectionAgeGrace,
+			Time:                  cfg.Keepalive.Time,
+			Timeout:               cfg.Keepalive.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.Keepalive.MinTime,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}),
 	}
+
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+
+	return opts
 }
 
 func InterceptorLogger(l *slog.Logger) logging.Logger {
@@ -68,26 +298,92 @@ func (a *App) MustRun() {
 	}
 }
 
-// Run runs gRPC server.
+// Inherit makes the app serve on the listeners passed by systemd socket activation
+// instead of binding the port and the Unix socket from config. Empty listeners change nothing.
+func (a *App) Inherit(listeners []net.Listener) {
+	if len(listeners) > 0 {
+		a.listeners = listeners
+	}
+}
+
+// Listeners returns the bound listeners, none before Listen or Run.
+func (a *App) Listeners() []net.Listener {
+	return a.listeners
+}
+
+// Listen binds the gRPC port and the Unix socket, if configured, without serving yet,
+// port 0 picks a free one. It returns the address of the TCP listener, of the socket if it is exclusive.
+// Run serves on the bound listeners.
+func (a *App) Listen() (net.Addr, error) {
+	const op = "grpcapp.Listen"
+
+	if len(a.listeners) > 0 {
+		return a.listeners[0].Addr(), nil
+	}
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("surface", a.surface),
+		slog.Int("port", int(a.port)),
+	)
+
+	var listeners []net.Listener
+
+	if a.unixSocket.path == "" || !a.unixSocket.exclusive {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+		if err != nil {
+			log.Error("failed to listen", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	if a.unixSocket.path != "" {
+		l, err := listenUnix(a.unixSocket.path, a.unixSocket.mode)
+		if err != nil {
+			log.Error("failed to listen on unix socket", slog.String("path", a.unixSocket.path), sl.Err(err))
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	a.listeners = listeners
+
+	return listeners[0].Addr(), nil
+}
+
+// Run runs gRPC server on all its listeners until Stop is called or one of them fails.
 func (a *App) Run() error {
 	const op = "grpcapp.Run"
 
 	log := a.log.With(
 		slog.String("op", op),
+		slog.String("surface", a.surface),
 		slog.Int("port", int(a.port)),
 	)
 
-	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
-	if err != nil {
-		log.Error("failed to listen", sl.Err(err))
+	if _, err := a.Listen(); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("grpc server started", slog.String("addr", l.Addr().String()))
+	errs := make(chan error, len(a.listeners))
+	for _, l := range a.listeners {
+		log.Info("grpc server started", slog.String("addr", l.Addr().String()))
 
-	if err := a.gRPCServer.Serve(l); err != nil {
-		log.Error("grpc server stopped with error", sl.Err(err))
-		return fmt.Errorf("%s: %w", op, err)
+		go func() {
+			errs <- a.gRPCServer.Serve(l)
+		}()
+	}
+
+	for range a.listeners {
+		// Stop до Serve (например, сразу после старта в тестах) — штатная остановка
+		if err := <-errs; err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Error("grpc server stopped with error", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
 	return nil
@@ -97,6 +393,9 @@ func (a *App) Run() error {
 func (a *App) Stop() {
 	const op = "grpcapp.Stop"
 
-	a.log.With(slog.String("op", op)).Info("stopping grpc server", slog.Int("port", int(a.port)))
+	a.log.With(slog.String("op", op)).Info("stopping grpc server",
+		slog.String("surface", a.surface),
+		slog.Int("port", int(a.port)),
+	)
 	a.gRPCServer.GracefulStop()
 }
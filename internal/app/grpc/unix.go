@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// socketProbeTimeout bounds the check whether a socket left at the path is still served.
+const socketProbeTimeout = time.Second
+
+var (
+	ErrInvalidSocketMode = errors.New("invalid unix socket mode")
+	ErrNotSocket         = errors.New("path exists and is not a unix socket")
+	ErrSocketInUse       = errors.New("unix socket is served by another process")
+)
+
+// parseSocketMode parses the octal file mode of the socket, e.g. "0660".
+func parseSocketMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSocketMode, mode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+// listenUnix binds the Unix socket at the path with the file mode. A socket left by a stopped
+// process is replaced, a socket still accepting connections is not.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNotSocket, path)
+		}
+
+		if conn, err := net.DialTimeout("unix", path, socketProbeTimeout); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w: %s", ErrSocketInUse, path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Права задаются после создания: до chmod сокет защищён umask процесса
+	if err := os.Chmod(path, mode); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
@@ -0,0 +1,73 @@
+package invalidation
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/storage/cache"
+)
+
+// Subscriber delivers the cache invalidations published by all instances until ctx is done.
+type Subscriber interface {
+	Subscribe(ctx context.Context, handle func(cache.Invalidation))
+}
+
+// Cache drops invalidated entries of this instance.
+type Cache interface {
+	Invalidate(inv cache.Invalidation)
+}
+
+// App applies the cache invalidations published by other instances to the local cache.
+type App struct {
+	log        *slog.Logger
+	subscriber Subscriber
+	cache      Cache
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func New(log *slog.Logger, subscriber Subscriber, cache Cache) *App {
+	return &App{
+		log:        log,
+		subscriber: subscriber,
+		cache:      cache,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run applies invalidations until Stop is called.
+func (a *App) Run() {
+	const op = "invalidationapp.Run"
+
+	defer close(a.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("cache invalidation started")
+
+	a.subscriber.Subscribe(ctx, func(inv cache.Invalidation) {
+		log.Debug("cache invalidated", slog.String("kind", inv.Kind), slog.String("key", inv.Key))
+		a.cache.Invalidate(inv)
+	})
+}
+
+// Stop stops applying invalidations.
+func (a *App) Stop() {
+	const op = "invalidationapp.Stop"
+
+	if a == nil {
+		return
+	}
+
+	a.log.With(slog.String("op", op)).Info("stopping cache invalidation")
+
+	close(a.stop)
+	<-a.done
+}
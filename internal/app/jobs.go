@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/config"
+	"sso/internal/jobs"
+	"sso/internal/lib/cron"
+	"sso/internal/services/admin"
+	"sso/internal/services/backup"
+	"sso/internal/storage/sqlite"
+)
+
+// rotateFieldKeysBatch is the number of rows re-encrypted in one transaction.
+const rotateFieldKeysBatch = 500
+
+// newJobs returns the maintenance jobs with a schedule in the config.
+func newJobs(log *slog.Logger, cfg *config.Config, storage *sqlite.Storage, adminService *admin.Admin) ([]jobs.Job, error) {
+	const op = "app.newJobs"
+
+	if cfg.Jobs.Backup != "" {
+		if cfg.Backup.Dir == "" {
+			return nil, fmt.Errorf("%s: jobs.backup requires backup.dir to be set", op)
+		}
+		if isMemoryDatabase(cfg.StoragePath) {
+			return nil, fmt.Errorf("%s: backups require storage_path to be a file", op)
+		}
+	}
+
+	tasks := []struct {
+		name     string
+		schedule string
+		run      func(ctx context.Context) error
+	}{
+		{"purge_expired", cfg.Jobs.PurgeExpired, jobs.PurgeExpired(log, storage, adminService, cfg.Retention.ExpiredInvites)},
+		{"anonymize_deleted", cfg.Jobs.AnonymizeDeleted, jobs.AnonymizeDeleted(adminService, cfg.Retention.DeletedUsers, cfg.Retention.Batch)},
+		{"vacuum", cfg.Jobs.Vacuum, jobs.Vacuum(storage)},
+		{"backup", cfg.Jobs.Backup, jobs.Backup(backup.New(log, storage, cfg.Backup.Dir, cfg.Backup.Keep))},
+		{"rotate_field_keys", cfg.Jobs.RotateFieldKeys, jobs.RotateFieldKeys(log, storage, rotateFieldKeysBatch)},
+		{"purge_login_history", cfg.Jobs.PurgeLoginHistory, jobs.PurgeLoginHistory(log, storage, cfg.Retention.LoginHistory)},
+	}
+
+	var list []jobs.Job
+	var errs []error
+	for _, task := range tasks {
+		if task.schedule == "" {
+			continue
+		}
+
+		schedule, err := cron.Parse(task.schedule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("jobs.%s: %w", task.name, err))
+			continue
+		}
+
+		list = append(list, jobs.Job{Name: task.name, Schedule: schedule, Run: task.run})
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	debugapp "sso/internal/app/debug"
+	grpcapp "sso/internal/app/grpc"
+	opsapp "sso/internal/app/ops"
+	"sso/internal/lib/handoff"
+	"sso/internal/lib/systemd"
+	"time"
+)
+
+// Names of the inherited sockets besides the public gRPC ones, see grpcapp.SurfaceAdmin.
+const (
+	listenerOps   = "ops"
+	listenerDebug = "debug"
+)
+
+var ErrAdminDisabled = errors.New("inherited admin socket requires grpc.admin.enabled")
+
+// inheritListeners makes the servers serve on the sockets passed by systemd socket activation
+// or by the previous process on Upgrade instead of binding their ports. Sockets are matched
+// to the servers by name, unnamed ones go to the public gRPC server.
+func inheritListeners(
+	log *slog.Logger,
+	grpcApp *grpcapp.App,
+	adminApp *grpcapp.App,
+	opsApp *opsapp.App,
+	debugApp *debugapp.App,
+) error {
+	source := "systemd"
+	inherited, err := systemd.Listeners()
+	if err != nil {
+		return err
+	}
+	if inherited == nil {
+		source = "handoff"
+		if inherited, err = handoff.Listeners(); err != nil {
+			return err
+		}
+	}
+	if len(inherited) == 0 {
+		return nil
+	}
+
+	if admin := inherited[grpcapp.SurfaceAdmin]; len(admin) > 0 {
+		if adminApp == nil {
+			for _, listeners := range inherited {
+				closeListeners(listeners)
+			}
+			return ErrAdminDisabled
+		}
+		adminApp.Inherit(admin)
+	}
+
+	// Порт проб или отладки, выключенных в новом конфиге, просто закрывается
+	if ops := inherited[listenerOps]; len(ops) > 0 {
+		if opsApp != nil {
+			opsApp.Inherit(ops[0])
+			ops = ops[1:]
+		}
+		closeListeners(ops)
+	}
+	if debug := inherited[listenerDebug]; len(debug) > 0 {
+		if debugApp != nil {
+			debugApp.Inherit(debug[0])
+			debug = debug[1:]
+		}
+		closeListeners(debug)
+	}
+
+	var public []net.Listener
+	for name, listeners := range inherited {
+		switch name {
+		case grpcapp.SurfaceAdmin, listenerOps, listenerDebug:
+			continue
+		}
+		public = append(public, listeners...)
+	}
+	grpcApp.Inherit(public)
+
+	log.Info("serving on inherited sockets",
+		slog.String("source", source),
+		slog.Int("public", len(public)),
+		slog.Int("admin", len(inherited[grpcapp.SurfaceAdmin])),
+	)
+
+	return nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+}
+
+// Upgrade starts the binary of the running executable on the ports of this process and returns
+// once it serves on them, see handoff.Start. Stop then drains the in-flight calls of this process
+// without waiting for load balancers: the ports stay open in the new process.
+// The ports must be bound by Listen.
+func (a *App) Upgrade(timeout time.Duration) error {
+	const op = "app.Upgrade"
+
+	files, err := a.listenerFiles()
+	defer func() {
+		for _, f := range files {
+			_ = f.File.Close()
+		}
+	}()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	pid, err := handoff.Start(files, timeout)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.upgraded = true
+
+	// Файл сокета остаётся новому процессу: при остановке этого он не удаляется
+	for _, l := range a.grpcListeners() {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	a.log.Info("new process serves on the ports", slog.String("op", op), slog.Int("pid", pid))
+
+	return nil
+}
+
+// listenerFiles duplicates the bound sockets of the servers for the new process.
+func (a *App) listenerFiles() ([]handoff.File, error) {
+	var files []handoff.File
+
+	add := func(name string, l net.Listener) error {
+		if l == nil {
+			return nil
+		}
+
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %s of %s can't be passed", l.Addr(), name)
+		}
+
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, handoff.File{Name: name, File: f})
+
+		return nil
+	}
+
+	for _, l := range a.gRPCServer.Listeners() {
+		if err := add(grpcapp.SurfacePublic, l); err != nil {
+			return files, err
+		}
+	}
+	if a.adminServer != nil {
+		for _, l := range a.adminServer.Listeners() {
+			if err := add(grpcapp.SurfaceAdmin, l); err != nil {
+				return files, err
+			}
+		}
+	}
+	if a.opsApp != nil {
+		if err := add(listenerOps, a.opsApp.Listener()); err != nil {
+			return files, err
+		}
+	}
+	if a.debugApp != nil {
+		if err := add(listenerDebug, a.debugApp.Listener()); err != nil {
+			return files, err
+		}
+	}
+
+	return files, nil
+}
+
+// grpcListeners returns the listeners of the public and admin gRPC servers.
+func (a *App) grpcListeners() []net.Listener {
+	listeners := a.gRPCServer.Listeners()
+	if a.adminServer != nil {
+		listeners = append(listeners[:len(listeners):len(listeners)], a.adminServer.Listeners()...)
+	}
+
+	return listeners
+}
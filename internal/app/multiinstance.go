@@ -0,0 +1,43 @@
+package app
+
+import (
+	"errors"
+	"sso/internal/config"
+	"strings"
+)
+
+// checkMultiInstance checks that the state replicas must agree on is shared between them.
+//
+// Shared by all replicas:
+//   - users, apps, access, signing keys and invites live in the database. SQLite is a file, so it is
+//     shared only by replicas on one host with the file on a local disk (WAL); replicas on different
+//     hosts need a server database such as Postgres, which has no driver yet (see TODO);
+//   - login sessions of the multi-step login, rate limit and lockout counters, idempotency keys and
+//     CAPTCHA failure counters live in Redis; opaque-token sessions and revoked tokens live in Redis
+//     or, without it, in the database;
+//   - the user cache is local, changes made by one replica reach the others through Redis pub/sub.
+//
+// Local to a replica on purpose: the bcrypt queue, the policy decision cache bounded by its TTL,
+// the offset to the Redis clock. Maintenance jobs run on every replica: purging and anonymization are
+// idempotent, vacuum and backup should be scheduled on one replica only.
+func checkMultiInstance(cfg *config.Config) error {
+	var errs []error
+
+	if cfg.InstanceID == "" {
+		errs = append(errs, errors.New("instance_id must be set to tell replicas apart"))
+	}
+
+	if cfg.Redis.Addr == "" {
+		errs = append(errs, errors.New("redis.addr must be set: sessions, counters and cache invalidation are shared through Redis"))
+	}
+
+	if isMemoryDatabase(cfg.StoragePath) {
+		errs = append(errs, errors.New("storage_path must not be an in-memory database"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func isMemoryDatabase(path string) bool {
+	return path == ":memory:" || strings.Contains(path, "mode=memory")
+}
@@ -0,0 +1,179 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sso/internal/lib/logger/sl"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	// checkTimeout bounds all readiness checks of a probe.
+	checkTimeout = 2 * time.Second
+)
+
+// Check is a dependency the service needs to serve traffic.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// App serves liveness and readiness probes over HTTP:
+// /healthz reports the process is alive, /readyz that all checks pass and the service is not draining.
+type App struct {
+	log    *slog.Logger
+	server *http.Server
+	checks []Check
+	// listener is bound by Listen or inherited, Run binds it itself otherwise.
+	listener net.Listener
+
+	draining atomic.Bool
+}
+
+func New(log *slog.Logger, addr string, checks []Check) *App {
+	a := &App{
+		log:    log,
+		checks: checks,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", a.healthz)
+	mux.HandleFunc("/readyz", a.readyz)
+
+	a.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return a
+}
+
+// Listen binds the address of the probe server without serving yet, Run serves on it.
+func (a *App) Listen() (net.Addr, error) {
+	if a.listener != nil {
+		return a.listener.Addr(), nil
+	}
+
+	l, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	a.listener = l
+
+	return l.Addr(), nil
+}
+
+// Inherit makes the server serve on the listener passed by the previous process or systemd
+// instead of binding its address.
+func (a *App) Inherit(l net.Listener) {
+	a.listener = l
+}
+
+// Listener returns the bound listener, nil before Listen or Run.
+func (a *App) Listener() net.Listener {
+	return a.listener
+}
+
+// Run runs the probe server until Stop is called.
+func (a *App) Run() error {
+	const op = "opsapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("addr", a.server.Addr),
+	)
+
+	if _, err := a.Listen(); err != nil {
+		log.Error("failed to listen", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("ops server started")
+
+	if err := a.server.Serve(a.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("ops server stopped with error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Drain makes /readyz report NOT_READY, so load balancers stop sending traffic before shutdown.
+func (a *App) Drain() {
+	if a == nil {
+		return
+	}
+
+	a.log.With(slog.String("op", "opsapp.Drain")).Info("draining, readiness probe reports not ready")
+	a.draining.Store(true)
+}
+
+// Stop stops the probe server.
+func (a *App) Stop(ctx context.Context) error {
+	const op = "opsapp.Stop"
+
+	if a == nil {
+		return nil
+	}
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("stopping ops server")
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		err = errors.Join(err, a.server.Close())
+		log.Error("failed to stop ops server", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("OK\n"))
+}
+
+func (a *App) readyz(w http.ResponseWriter, r *http.Request) {
+	const op = "opsapp.readyz"
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if a.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("NOT_READY\ndraining\n"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	var report strings.Builder
+	ready := true
+	for _, c := range a.checks {
+		if err := c.Check(ctx); err != nil {
+			ready = false
+			a.log.With(slog.String("op", op)).WarnContext(ctx, "readiness check failed",
+				slog.String("check", c.Name), sl.Err(err))
+			// Текст ошибки только в логе: пробы доступны без авторизации
+			fmt.Fprintf(&report, "%s: failed\n", c.Name)
+			continue
+		}
+		fmt.Fprintf(&report, "%s: ok\n", c.Name)
+	}
+
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("NOT_READY\n" + report.String()))
+		return
+	}
+
+	_, _ = w.Write([]byte("READY\n" + report.String()))
+}
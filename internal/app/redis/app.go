@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/config"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/redisprefix"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const pingTimeout = 5 * time.Second
+
+type App struct {
+	Client *redis.Client
+	log    *slog.Logger
+}
+
+// New connects to Redis and checks the connection.
+func New(cfg config.RedisConfig, log *slog.Logger) (*App, error) {
+	const op = "redisapp.New"
+	opLog := log.With(slog.String("op", op), slog.String("addr", cfg.Addr))
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if cfg.KeyPrefix != "" {
+		client.AddHook(redisprefix.New(cfg.KeyPrefix))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		opLog.Error("failed to ping redis", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	opLog.Info("redis connected", slog.String("key_prefix", cfg.KeyPrefix))
+
+	return &App{
+		Client: client,
+		log:    log,
+	}, nil
+}
+
+// Ping checks the Redis server is reachable.
+func (a *App) Ping(ctx context.Context) error {
+	const op = "redisapp.Ping"
+
+	if err := a.Client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Close closes the Redis connection pool.
+func (a *App) Close() error {
+	const op = "redisapp.Close"
+
+	if a == nil {
+		return nil
+	}
+
+	if err := a.Client.Close(); err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to close redis", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"log/slog"
+	"sso/internal/config"
+	"sso/internal/lib/logger/sl"
+	"time"
+)
+
+// connect calls open until it succeeds, the attempts of cfg run out or retry reports the error
+// is permanent, e.g. a database without a schema. A nil retry retries every error.
+func connect[T any](
+	log *slog.Logger,
+	dependency string,
+	cfg config.StartupRetryConfig,
+	retry func(error) bool,
+	open func() (T, error),
+) (T, error) {
+	log = log.With(slog.String("dependency", dependency))
+
+	backoff := cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		v, err := open()
+		if err == nil {
+			return v, nil
+		}
+
+		if attempt >= cfg.Attempts || (retry != nil && !retry(err)) {
+			return v, err
+		}
+
+		log.Warn("dependency is unavailable, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			sl.Err(err),
+		)
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if cfg.MaxBackoff > 0 && backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"log/slog"
 	sqlite "sso/internal/storage/sqlite"
 )
@@ -9,10 +10,27 @@ type App struct {
 	Storage *sqlite.Storage
 }
 
-func New(storagePath string, log *slog.Logger) (*App, error) {
-	storage, err := sqlite.New(storagePath, log)
+// New opens the storage. With autoMigrate the pending migrations are applied, otherwise
+// a database without a schema fails with sqlite.ErrNoSchema instead of on the first query.
+func New(storagePath string, pool sqlite.PoolOptions, autoMigrate bool, log *slog.Logger) (*App, error) {
+	storage, err := sqlite.New(storagePath, pool, log)
+	if err != nil {
+		return &App{}, err
+	}
+
+	ctx := context.Background()
+
+	if autoMigrate {
+		_, err = storage.Migrate(ctx)
+	} else {
+		err = storage.CheckSchema(ctx)
+	}
+	if err != nil {
+		_ = storage.Close()
+		return &App{}, err
+	}
 
 	return &App{
 		Storage: storage,
-	}, err
+	}, nil
 }
@@ -0,0 +1,237 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sso/internal/config"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/vault"
+	"strings"
+	"time"
+)
+
+const (
+	// startTimeout bounds the login and the reads at startup.
+	startTimeout = 10 * time.Second
+	// retryDelay is the pause before retrying a failed renewal or refresh.
+	retryDelay = 30 * time.Second
+)
+
+// App holds the Vault session of the service: logs in at startup, reads the secrets
+// and keeps the token renewed and the signing keys refreshed until Stop.
+type App struct {
+	log    *slog.Logger
+	cfg    config.VaultConfig
+	client *vault.Client
+	auth   vault.Auth
+	// keys is nil without vault.signing_keys_path.
+	keys *SigningKeys
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New logs in to Vault with the token or the Kubernetes role of the config.
+func New(log *slog.Logger, cfg config.VaultConfig) (*App, error) {
+	const op = "vaultapp.New"
+	opLog := log.With(slog.String("op", op), slog.String("addr", cfg.Addr))
+
+	if cfg.Token == "" && cfg.KubernetesRole == "" {
+		return nil, fmt.Errorf("%s: vault.token or vault.kubernetes_role must be set", op)
+	}
+
+	a := &App{
+		log:    log,
+		cfg:    cfg,
+		client: vault.New(cfg.Addr, cfg.Namespace, cfg.Timeout),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	if err := a.login(ctx); err != nil {
+		opLog.Error("failed to log in to vault", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	opLog.Info("vault connected", slog.Duration("token_ttl", a.auth.LeaseDuration))
+
+	return a, nil
+}
+
+func (a *App) login(ctx context.Context) error {
+	if a.cfg.KubernetesRole == "" {
+		a.client.SetToken(a.cfg.Token)
+
+		auth, err := a.client.LookupSelf(ctx)
+		if err != nil {
+			return err
+		}
+		a.auth = auth
+
+		return nil
+	}
+
+	jwt, err := os.ReadFile(a.cfg.KubernetesTokenPath)
+	if err != nil {
+		return err
+	}
+
+	auth, err := a.client.LoginKubernetes(ctx, a.cfg.KubernetesMount, a.cfg.KubernetesRole, strings.TrimSpace(string(jwt)))
+	if err != nil {
+		return err
+	}
+	a.auth = auth
+
+	return nil
+}
+
+// Secrets reads the config secrets from vault.secrets_path, none without it.
+func (a *App) Secrets() (map[string]string, error) {
+	const op = "vaultapp.Secrets"
+
+	if a.cfg.SecretsPath == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	values, err := a.client.ReadKV(ctx, a.cfg.KVMount, a.cfg.SecretsPath)
+	if err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to read secrets", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return values, nil
+}
+
+// SigningKeys reads the signing keys from vault.signing_keys_path, they are refreshed while the app runs.
+// Apps without keys in Vault keep using the keys of fallback. Without the path it returns nil.
+func (a *App) SigningKeys(apps AppProvider, fallback Fallback) (*SigningKeys, error) {
+	const op = "vaultapp.SigningKeys"
+
+	if a.cfg.SigningKeysPath == "" {
+		return nil, nil
+	}
+
+	keys := newSigningKeys(apps, fallback)
+
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	if err := a.refreshKeys(ctx, keys); err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to read signing keys", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	a.keys = keys
+
+	return keys, nil
+}
+
+func (a *App) refreshKeys(ctx context.Context, keys *SigningKeys) error {
+	values, err := a.client.ReadKV(ctx, a.cfg.KVMount, a.cfg.SigningKeysPath)
+	if err != nil {
+		return err
+	}
+
+	skipped, err := keys.load(ctx, values)
+	for _, field := range skipped {
+		a.log.Warn("signing key of unknown app skipped", slog.String("field", field))
+	}
+
+	return err
+}
+
+// Run renews the token before it expires and refreshes the signing keys until Stop is called.
+func (a *App) Run() {
+	const op = "vaultapp.Run"
+
+	defer close(a.done)
+
+	log := a.log.With(slog.String("op", op))
+
+	renew := time.NewTimer(renewIn(a.auth))
+	defer renew.Stop()
+
+	refresh := make(<-chan time.Time)
+	if a.keys != nil && a.cfg.RefreshInterval > 0 {
+		ticker := time.NewTicker(a.cfg.RefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-renew.C:
+			ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Timeout)
+			err := a.renew(ctx)
+			cancel()
+			if err != nil {
+				log.Error("failed to renew vault token", sl.Err(err))
+				renew.Reset(retryDelay)
+				continue
+			}
+			renew.Reset(renewIn(a.auth))
+		case <-refresh:
+			ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Timeout)
+			err := a.refreshKeys(ctx, a.keys)
+			cancel()
+			if err != nil {
+				// Остаются ключи последнего успешного чтения
+				log.Error("failed to refresh signing keys", sl.Err(err))
+			}
+		}
+	}
+}
+
+// renew extends the token or, when it can't be renewed any more, logs in again with the Kubernetes role.
+func (a *App) renew(ctx context.Context) error {
+	if a.auth.Renewable {
+		auth, err := a.client.RenewSelf(ctx)
+		if err == nil {
+			a.auth.LeaseDuration = auth.LeaseDuration
+			return nil
+		}
+
+		if a.cfg.KubernetesRole == "" {
+			return err
+		}
+	}
+
+	if a.cfg.KubernetesRole == "" {
+		return errors.New("token is not renewable and expires, set vault.kubernetes_role or a renewable token")
+	}
+
+	return a.login(ctx)
+}
+
+// renewIn is when to renew the token: at two thirds of its lease. Tokens without a lease,
+// e.g. root tokens, are checked once a day.
+func renewIn(auth vault.Auth) time.Duration {
+	if auth.LeaseDuration <= 0 {
+		return 24 * time.Hour
+	}
+
+	return auth.LeaseDuration * 2 / 3
+}
+
+// Stop stops renewing the token and refreshing the keys.
+func (a *App) Stop() {
+	const op = "vaultapp.Stop"
+
+	if a == nil {
+		return
+	}
+
+	a.log.With(slog.String("op", op)).Info("stopping vault session")
+
+	close(a.stop)
+	<-a.done
+}
@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"sso/internal/services/auth"
+	"sso/internal/storage"
+	"strings"
+	"sync"
+)
+
+// AppProvider resolves the app codes of the keys in Vault.
+type AppProvider interface {
+	App(ctx context.Context, appCode string) (models.App, error)
+}
+
+// Fallback is the key ring used for apps without keys in Vault, the database.
+type Fallback = auth.SigningKeyProvider
+
+// SigningKeys is the key ring of app signing keys kept in Vault: fields "<app_code>/<kid>" of one KV secret.
+// The greatest kid of an app signs new tokens, the other keys of the app only validate tokens, a key removed
+// from Vault is retired. Apps without keys in Vault use the fallback ring.
+type SigningKeys struct {
+	apps     AppProvider
+	fallback Fallback
+
+	mu     sync.RWMutex
+	active map[int32]models.SigningKey
+	byKID  map[string]models.SigningKey
+}
+
+func newSigningKeys(apps AppProvider, fallback Fallback) *SigningKeys {
+	return &SigningKeys{
+		apps:     apps,
+		fallback: fallback,
+		active:   make(map[int32]models.SigningKey),
+		byKID:    make(map[string]models.SigningKey),
+	}
+}
+
+// ActiveSigningKey returns the key of the app with the greatest kid in Vault.
+func (k *SigningKeys) ActiveSigningKey(ctx context.Context, appID int32) (models.SigningKey, error) {
+	k.mu.RLock()
+	key, ok := k.active[appID]
+	k.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	return k.fallback.ActiveSigningKey(ctx, appID)
+}
+
+// SigningKey returns the key by its kid from Vault or from the fallback ring.
+func (k *SigningKeys) SigningKey(ctx context.Context, kid string) (models.SigningKey, error) {
+	k.mu.RLock()
+	key, ok := k.byKID[kid]
+	k.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	return k.fallback.SigningKey(ctx, kid)
+}
+
+// load replaces the keys with the fields of the secret and returns the fields of apps that don't exist.
+func (k *SigningKeys) load(ctx context.Context, values map[string]string) ([]string, error) {
+	active := make(map[int32]models.SigningKey)
+	byKID := make(map[string]models.SigningKey, len(values))
+	appIDs := make(map[string]int32)
+
+	var skipped []string
+	for field, secret := range values {
+		appCode, kid, ok := strings.Cut(field, "/")
+		if !ok || appCode == "" || kid == "" || secret == "" {
+			return nil, fmt.Errorf("malformed signing key field %q, expected <app_code>/<kid>", field)
+		}
+
+		appID, ok := appIDs[appCode]
+		if !ok {
+			app, err := k.apps.App(ctx, appCode)
+			if errors.Is(err, storage.ErrAppNotFound) {
+				skipped = append(skipped, field)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			appID = app.ID
+			appIDs[appCode] = appID
+		}
+
+		if _, ok := byKID[kid]; ok {
+			return nil, fmt.Errorf("duplicate signing key id %q", kid)
+		}
+
+		key := models.SigningKey{ID: kid, AppID: appID, Secret: secret}
+		byKID[kid] = key
+
+		if current, ok := active[appID]; !ok || kid > current.ID {
+			active[appID] = key
+		}
+	}
+
+	k.mu.Lock()
+	k.active, k.byKID = active, byKID
+	k.mu.Unlock()
+
+	return skipped, nil
+}
@@ -1,58 +1,923 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/ilyakaznacheev/cleanenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
-	Env            string     `yaml:"env" env-default:"local"`
-	StoragePath    string     `yaml:"storage_path" env-default:"/data/storage"`
-	GRPC           GRPCConfig `yaml:"grpc"`
+	Env string `yaml:"env" env-default:"local"`
+	// InstanceID tells replicas apart in logs and metrics, the hostname by default.
+	InstanceID string `yaml:"instance_id" env:"INSTANCE_ID"`
+	// MultiInstance checks at startup that all state replicas must share is shared, see app.checkMultiInstance.
+	MultiInstance bool `yaml:"multi_instance" env:"MULTI_INSTANCE" env-default:"false"`
+	// Profile is the preset of coordinated defaults: small, medium or large.
+	Profile        string            `yaml:"profile" env:"PROFILE" env-default:"medium"`
+	StoragePath    string            `yaml:"storage_path" env-default:"/data/storage"`
+	StoragePool    StoragePoolConfig `yaml:"storage_pool"`
+	StorageKey     StorageKeyConfig  `yaml:"storage_key"`
+	GRPC           GRPCConfig        `yaml:"grpc"`
 	MigrationsPath string
 	TokenTTL       time.Duration `yaml:"token_ttl" env-default:"1h"`
+	// TokenMaxSize limits the serialized token size in bytes, 0 disables the limit.
+	TokenMaxSize int `yaml:"token_max_size" env-default:"4096"`
+	// TokenLeeway tolerates clock drift between hosts when checking exp, nbf and iat.
+	TokenLeeway time.Duration `yaml:"token_leeway" env-default:"30s"`
+	// TokenClaimsByRef moves extra claims of oversized tokens to storage, resolvable by reference.
+	TokenClaimsByRef bool                  `yaml:"token_claims_by_ref" env-default:"false"`
+	PurposeTokenTTL  PurposeTokenTTLConfig `yaml:"purpose_token_ttl"`
+	// LoginSessionTTL bounds the time to complete all steps of a multi-step login.
+	LoginSessionTTL time.Duration     `yaml:"login_session_ttl" env-default:"5m"`
+	Redis           RedisConfig       `yaml:"redis"`
+	RateLimit       RateLimitConfig   `yaml:"rate_limit"`
+	Idempotency     IdempotencyConfig `yaml:"idempotency"`
+	Captcha         CaptchaConfig     `yaml:"captcha"`
+	Policy          PolicyConfig      `yaml:"policy"`
+	Email           EmailConfig       `yaml:"email"`
+	NewDevice       NewDeviceConfig   `yaml:"new_device"`
+	Debug           DebugConfig       `yaml:"debug"`
+	Ops             OpsConfig         `yaml:"ops"`
+	Bcrypt          BcryptConfig      `yaml:"bcrypt"`
+	Pepper          PepperConfig      `yaml:"pepper"`
+	Retention       RetentionConfig   `yaml:"retention"`
+	Backup          BackupConfig      `yaml:"backup"`
+	Jobs            JobsConfig        `yaml:"jobs"`
+	Authz           AuthzConfig       `yaml:"authz"`
+	UserCache       UserCacheConfig   `yaml:"user_cache"`
+	// EmailNFC applies unicode NFC to emails on top of trimming and lowercasing.
+	EmailNFC bool `yaml:"email_nfc" env-default:"true"`
+	// EmailMXCheck rejects registration with domains that have no MX or A/AAAA records.
+	EmailMXCheck bool `yaml:"email_mx_check" env-default:"false"`
+	// FieldEncryption encrypts sensitive columns (phone numbers), with or without storage_key.
+	FieldEncryption FieldEncryptionConfig `yaml:"field_encryption"`
+	// Vault supplies the secrets and the signing keys of apps, empty vault.addr disables it.
+	Vault VaultConfig `yaml:"vault"`
+	// OTLP ships logs to an OpenTelemetry collector besides stdout.
+	OTLP OTLPConfig `yaml:"otlp"`
+	// GeoIP locates login addresses for the login history and new country checks.
+	GeoIP GeoIPConfig `yaml:"geoip"`
+	// Terms declares the current version of the terms of service users have to accept.
+	Terms TermsConfig `yaml:"terms"`
+	// UserAttributes limits the custom attributes apps store on users.
+	UserAttributes UserAttributesConfig `yaml:"user_attributes"`
+	// Webhooks controls the delivery of access change notifications to apps with apps.webhook_url.
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	// AntiEnumeration makes Register responses not reveal whether an email is registered.
+	AntiEnumeration bool `yaml:"anti_enumeration" env:"ANTI_ENUMERATION" env-default:"false"`
+	// PasswordStrength is the strength policy of passwords of new users.
+	PasswordStrength PasswordStrengthConfig `yaml:"password_strength"`
+	// Recovery configures account recovery with a recovery email and recovery codes, it needs Redis.
+	Recovery RecoveryConfig `yaml:"recovery"`
+	// EmailOTP enables logins with one-time codes sent by email instead of the password.
+	EmailOTP EmailOTPConfig `yaml:"email_otp"`
+	// SMS configures the delivery of one-time codes by SMS: login by phone and phone verification.
+	SMS SMSConfig `yaml:"sms"`
+	// Risk scores logins by suspicious signals and requires a CAPTCHA or an email code from risky ones.
+	Risk RiskConfig `yaml:"risk"`
+	// AppCache caches apps by code for token validation and logins.
+	AppCache AppCacheConfig `yaml:"app_cache"`
+	// AutoMigrate applies the embedded migrations on startup, otherwise a database without a schema fails it.
+	AutoMigrate bool `yaml:"auto_migrate" env:"AUTO_MIGRATE" env-default:"false"`
+	// StorageTimeout bounds single storage operations within the deadline of a call.
+	StorageTimeout StorageTimeoutConfig `yaml:"storage_timeout"`
+	// Degradation decides how calls are served while the storage is read-only.
+	Degradation DegradationConfig `yaml:"degradation"`
+	// Startup retries the storage and Redis unavailable at boot instead of exiting at once.
+	Startup StartupConfig `yaml:"startup"`
+	// TokenExchange lets apps exchange tokens of their users for tokens of other apps.
+	TokenExchange TokenExchangeConfig `yaml:"token_exchange"`
 }
 
-type GRPCConfig struct {
-	Port    int32         `yaml:"port"`
+// TokenExchangeConfig allows apps to exchange tokens, apps not listed can't exchange their tokens.
+type TokenExchangeConfig struct {
+	// Delegations lists the apps an app may exchange its tokens for by app code, e.g. web: [billing, reports].
+	Delegations map[string][]string `yaml:"delegations"`
+}
+
+// IdempotencyConfig controls replaying responses of Register, AllowAccess and GrantAccess by the idempotency-key metadata.
+type IdempotencyConfig struct {
+	// Enabled requires Redis, where the keys are stored.
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	// TTL is how long a key is remembered.
+	TTL time.Duration `yaml:"ttl" env-default:"24h"`
+}
+
+// CaptchaConfig enables CAPTCHA verification of Register and Login, the token is passed in x-captcha-token metadata.
+type CaptchaConfig struct {
+	// Provider is recaptcha, hcaptcha or turnstile, empty disables the verification.
+	Provider string `yaml:"provider"`
+	Secret   string `yaml:"secret" env:"CAPTCHA_SECRET"`
+	// SecretFile is a path to a file with the secret, e.g. a mounted secret, it overrides Secret.
+	SecretFile string `yaml:"secret_file" env:"CAPTCHA_SECRET_FILE"`
+	// MinScore applies to providers returning a score, e.g. reCAPTCHA v3.
+	MinScore float64       `yaml:"min_score" env-default:"0.5"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"5s"`
+	Register bool          `yaml:"register" env-default:"true"`
+	Login    bool          `yaml:"login" env-default:"true"`
+	// LoginAfterFailures requires the CAPTCHA on Login only after that many failed attempts
+	// for the login within FailureWindow, 0 requires it always. Counting failures requires Redis.
+	LoginAfterFailures int64         `yaml:"login_after_failures" env-default:"3"`
+	FailureWindow      time.Duration `yaml:"failure_window" env-default:"15m"`
+}
+
+const (
+	PolicyEngineCasbin = "casbin"
+	PolicyEngineOPA    = "opa"
+)
+
+// PolicyConfig delegates access decisions of apps on login and token validation to a policy engine.
+type PolicyConfig struct {
+	CacheTTL        time.Duration `yaml:"cache_ttl" env-default:"1m"`
+	CacheMaxEntries int           `yaml:"cache_max_entries" env-default:"10000"`
+	// Apps maps an app code to its policy engine, apps without one are not checked.
+	Apps map[string]PolicyAppConfig `yaml:"apps"`
+}
+
+type PolicyAppConfig struct {
+	// Engine is casbin or opa.
+	Engine string `yaml:"engine"`
+	// PolicyFile is the Casbin policy in CSV format.
+	PolicyFile string `yaml:"policy_file"`
+	// URL and Path address the OPA rule, e.g. http://localhost:8181 and sso/authz/allow.
+	URL     string        `yaml:"url"`
+	Path    string        `yaml:"path"`
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+type GRPCConfig struct {
+	Port int32 `yaml:"port"`
+	// Timeout is the per-request deadline applied unless the client sent a shorter one, 0 disables it.
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	// Reflection registers the reflection service for grpcurl and Postman, keep it off in prod.
+	Reflection bool `yaml:"reflection" env-default:"false"`
+	// MaxConcurrentStreams limits streams per connection, 0 leaves the gRPC default.
+	MaxConcurrentStreams uint32 `yaml:"max_concurrent_streams" env-default:"0"`
+	// MaxRecvMsgSize and MaxSendMsgSize are message size limits in bytes, 0 leaves the gRPC defaults.
+	// Auth requests are small, so received messages are limited to 64KB by default.
+	MaxRecvMsgSize int                 `yaml:"max_recv_msg_size" env:"GRPC_MAX_RECV_MSG_SIZE" env-default:"65536"`
+	MaxSendMsgSize int                 `yaml:"max_send_msg_size" env-default:"0"`
+	Keepalive      GRPCKeepaliveConfig `yaml:"keepalive"`
+	// RequestContext selects what is captured about the caller of each request.
+	RequestContext RequestContextConfig `yaml:"request_context"`
+	// TLS of the public listener, plaintext without a certificate.
+	TLS GRPCTLSConfig `yaml:"tls"`
+	// UnixSocket serves the public listener on a Unix socket too.
+	UnixSocket UnixSocketConfig `yaml:"unix_socket"`
+	// Admin moves the access management methods to a listener of their own.
+	Admin GRPCAdminConfig `yaml:"admin"`
+}
+
+// GRPCTLSConfig enables TLS on a gRPC listener when CertFile and KeyFile are set.
+type GRPCTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile requires client certificates signed by one of its CAs (mTLS).
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// GRPCAdminConfig configures the admin listener serving AllowAccess, RevokeAccess and GrantAccess,
+// so it can be firewalled apart from Login and Validate. The connection limits of grpc apply to it too.
+type GRPCAdminConfig struct {
+	Enabled bool  `yaml:"enabled" env:"GRPC_ADMIN_ENABLED" env-default:"false"`
+	Port    int32 `yaml:"port" env:"GRPC_ADMIN_PORT" env-default:"8082"`
+	// TLS is independent of the public listener's, e.g. mTLS for admin tools only.
+	TLS        GRPCTLSConfig    `yaml:"tls"`
+	UnixSocket UnixSocketConfig `yaml:"unix_socket"`
+}
+
+// UnixSocketConfig serves a gRPC listener on a Unix socket in addition to its TCP port,
+// e.g. for a reverse proxy sidecar. A stale socket left at the path by a stopped process is replaced.
+type UnixSocketConfig struct {
+	// Path of the socket, empty disables it.
+	Path string `yaml:"path"`
+	// Mode is the octal file mode of the socket, it decides which local users may connect.
+	Mode string `yaml:"mode" env-default:"0660"`
+	// Exclusive serves only on the socket, without the TCP port.
+	Exclusive bool `yaml:"exclusive" env-default:"false"`
+}
+
+// RequestContextConfig configures the caller information available to the service layer,
+// audit logging, device tracking and rate limiting by IP.
+type RequestContextConfig struct {
+	// Headers are custom metadata keys to capture, e.g. x-app-version.
+	Headers []string `yaml:"headers" env:"REQUEST_CONTEXT_HEADERS" env-separator:","`
+	// TrustedProxies are CIDRs of load balancers whose x-forwarded-for gives the client IP.
+	// Empty takes the peer address as the client IP.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" env-separator:","`
+}
+
+// GRPCKeepaliveConfig maps to keepalive.ServerParameters and keepalive.EnforcementPolicy.
+// Zero durations leave the gRPC defaults.
+type GRPCKeepaliveConfig struct {
+	// Time and Timeout control server pings of idle connections.
+	Time    time.Duration `yaml:"time" env-default:"60s"`
+	Timeout time.Duration `yaml:"timeout" env-default:"20s"`
+	// MaxConnectionIdle closes connections without RPCs for this long.
+	MaxConnectionIdle time.Duration `yaml:"max_connection_idle" env-default:"0"`
+	// MaxConnectionAge closes connections periodically so clients rebalance across instances behind a load balancer.
+	MaxConnectionAge      time.Duration `yaml:"max_connection_age" env-default:"30m"`
+	MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace" env-default:"10s"`
+	// MinTime is the minimum interval of client pings, more frequent pings close the connection.
+	MinTime             time.Duration `yaml:"min_time" env-default:"10s"`
+	PermitWithoutStream bool          `yaml:"permit_without_stream" env-default:"true"`
+}
+
+// PurposeTokenTTLConfig is the lifetime of single-use tokens sent in email and SMS links.
+type PurposeTokenTTLConfig struct {
+	VerifyEmail   time.Duration `yaml:"verify_email" env-default:"24h"`
+	ResetPassword time.Duration `yaml:"reset_password" env-default:"1h"`
+	MagicLink     time.Duration `yaml:"magic_link" env-default:"15m"`
+}
+
+type StoragePoolConfig struct {
+	MaxOpenConns    int           `yaml:"max_open_conns" env-default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env-default:"5"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env-default:"5m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env-default:"10m"`
+}
+
+// StorageTimeoutConfig bounds the storage operations of the service, 0 disables a timeout.
+type StorageTimeoutConfig struct {
+	// Read bounds a query including reading its rows.
+	Read time.Duration `yaml:"read" env-default:"2s"`
+	// Write bounds a change or a transaction, waiting for the SQLite write lock included.
+	Write time.Duration `yaml:"write" env-default:"5s"`
+}
+
+// DegradationConfig is the policy for a read-only storage, e.g. after its volume was remounted read-only.
+type DegradationConfig struct {
+	// Policy is off, read_only to keep serving reads and reject writes, or unready to also fail readiness.
+	Policy string `yaml:"policy" env:"DEGRADATION_POLICY" env-default:"off"`
+	// ProbeInterval is how often the storage is checked for accepting writes.
+	ProbeInterval time.Duration `yaml:"probe_interval" env-default:"10s"`
+}
+
+// StartupConfig retries connecting to the dependencies at boot, in the order storage, then Redis.
+type StartupConfig struct {
+	Storage StartupRetryConfig `yaml:"storage"`
+	Redis   StartupRetryConfig `yaml:"redis"`
+	// RedisOptional starts without Redis once its attempts run out: rate limiting, login lockout,
+	// idempotency keys and CAPTCHA after failed logins are off until a restart. Features that
+	// can't work without Redis still stop the startup.
+	RedisOptional bool `yaml:"redis_optional" env:"STARTUP_REDIS_OPTIONAL" env-default:"false"`
+}
+
+// StartupRetryConfig sets the attempts to connect to a dependency, failed ones are retried
+// after Backoff doubled each time up to MaxBackoff. One attempt disables retries.
+type StartupRetryConfig struct {
+	Attempts   int           `yaml:"attempts" env-default:"5"`
+	Backoff    time.Duration `yaml:"backoff" env-default:"500ms"`
+	MaxBackoff time.Duration `yaml:"max_backoff" env-default:"10s"`
+}
+
+// StorageKeyConfig holds the SQLCipher key encrypting the database file, empty keeps it plaintext.
+// The key is never read from the config file itself.
+type StorageKeyConfig struct {
+	// Key is a passphrase or a raw key written as x'<64 hex digits>'.
+	Key string `yaml:"-" env:"STORAGE_KEY"`
+	// File is a path to a file with the key, e.g. a mounted secret, it overrides Key.
+	File string `yaml:"file" env:"STORAGE_KEY_FILE"`
+}
+
+// FieldEncryptionConfig holds the AES-256 keys of column encryption, empty Current disables it.
+// Keys are never read from the config file itself.
+type FieldEncryptionConfig struct {
+	// Current is the id of the key used for new values, older keys are kept to decrypt old values
+	// until the rotate_field_keys job re-encrypts them.
+	Current string `yaml:"current" env:"FIELD_KEY_ID"`
+	// Keys maps key ids to base64-encoded 32-byte keys, e.g. FIELD_KEYS="v1:<base64>,v2:<base64>".
+	Keys map[string]string `yaml:"-" env:"FIELD_KEYS"`
+	// File is a path to a file with "id:<base64>" lines, e.g. a mounted secret.
+	File string `yaml:"file" env:"FIELD_KEYS_FILE"`
+	// IndexKey is the base64-encoded 32-byte key of the blind index used to look encrypted values up.
+	// It can't be rotated by adding a key: changing it breaks lookups of all stored values.
+	IndexKey string `yaml:"-" env:"FIELD_INDEX_KEY"`
+	// IndexKeyFile is a path to a file with the index key, it overrides IndexKey.
+	IndexKeyFile string `yaml:"index_key_file" env:"FIELD_INDEX_KEY_FILE"`
+}
+
+// VaultConfig reads secrets and signing keys from HashiCorp Vault at startup.
+type VaultConfig struct {
+	// Addr of the Vault server, e.g. https://vault:8200, empty disables Vault.
+	Addr      string `yaml:"addr" env:"VAULT_ADDR"`
+	Namespace string `yaml:"namespace" env:"VAULT_NAMESPACE"`
+	// Token authenticates without a login, it is renewed while the service runs.
+	Token     string `yaml:"-" env:"VAULT_TOKEN"`
+	TokenFile string `yaml:"token_file" env:"VAULT_TOKEN_FILE"`
+	// KubernetesRole logs in with the service account token of the pod instead of Token.
+	KubernetesRole      string `yaml:"kubernetes_role" env:"VAULT_KUBERNETES_ROLE"`
+	KubernetesMount     string `yaml:"kubernetes_mount" env-default:"kubernetes"`
+	KubernetesTokenPath string `yaml:"kubernetes_token_path" env-default:"/var/run/secrets/kubernetes.io/serviceaccount/token"`
+	// KVMount is the mount of the KV v2 engine holding the secrets below.
+	KVMount string `yaml:"kv_mount" env-default:"secret"`
+	// SecretsPath is the secret with config secrets, fields: redis_password, smtp_password,
+	// captcha_secret, storage_key, field_index_key, twilio_auth_token, sms_http_token. Empty reads none.
+	SecretsPath string `yaml:"secrets_path"`
+	// SigningKeysPath is the secret with the signing keys of apps as "<app_code>/<kid>" fields,
+	// the greatest kid of an app signs new tokens. Empty keeps the keys in the database.
+	SigningKeysPath string `yaml:"signing_keys_path"`
+	// RefreshInterval re-reads the signing keys, so keys added in Vault are used without a restart.
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"5m"`
+	Timeout         time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+// OTLPConfig configures the export of logs over OTLP/HTTP, empty Endpoint disables it.
+type OTLPConfig struct {
+	// Endpoint is the base URL of the collector, e.g. http://otel-collector:4318.
+	Endpoint string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// Headers are sent with every export, e.g. OTLP_HEADERS="authorization:Bearer <token>".
+	Headers map[string]string `yaml:"-" env:"OTLP_HEADERS"`
+	// ServiceName is the service.name resource attribute, traces and metrics should use the same one.
+	ServiceName string        `yaml:"service_name" env:"OTEL_SERVICE_NAME" env-default:"sso"`
+	Timeout     time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+// GeoIPConfig points to MaxMind databases (GeoLite2 or GeoIP2), empty paths disable the lookups.
+type GeoIPConfig struct {
+	// CountryDB is a Country or City database, ASNDB an ASN database.
+	CountryDB string `yaml:"country_db" env:"GEOIP_COUNTRY_DB"`
+	ASNDB     string `yaml:"asn_db" env:"GEOIP_ASN_DB"`
+	// StepUp requires a code sent by email to log in from a country not seen in the login history, needs Redis.
+	StepUp  bool          `yaml:"step_up" env-default:"false"`
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"10m"`
+}
+
+type TermsConfig struct {
+	// Version of the terms of service, e.g. "2024-06-01". Logins of users who have not accepted it
+	// report it in x-terms-version. Empty disables the check.
+	Version string `yaml:"version" env:"TERMS_VERSION"`
+}
+
+type UserAttributesConfig struct {
+	// MaxSize of all attributes of a user as JSON, in bytes.
+	MaxSize int `yaml:"max_size" env-default:"4096"`
+	// Visibility lists the attributes an app may read and write by app code, apps not listed see all.
+	Visibility map[string][]string `yaml:"visibility"`
+}
+
+type WebhooksConfig struct {
+	Enabled bool          `yaml:"enabled" env-default:"true"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+	// Attempts of a delivery, failed ones are retried after Backoff doubled each time.
+	Attempts int           `yaml:"attempts" env-default:"3"`
+	Backoff  time.Duration `yaml:"backoff" env-default:"1s"`
+}
+
+// PasswordStrengthConfig sets the least zxcvbn-style score of new passwords.
+type PasswordStrengthConfig struct {
+	// MinScore is from 0 to 4, 0 accepts any password.
+	MinScore int `yaml:"min_score" env:"PASSWORD_MIN_SCORE" env-default:"0"`
+}
+
+type RecoveryConfig struct {
+	// CodeTTL is the lifetime of the code sent to the recovery email and of the recovery session.
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"15m"`
+}
+
+// EmailOTPConfig configures passwordless login with one-time codes, it needs Redis.
+type EmailOTPConfig struct {
+	Enabled bool          `yaml:"enabled" env-default:"false"`
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"5m"`
+	// ResendInterval is the least time between codes for the same email and app.
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+}
+
+// SMSConfig configures the SMS provider, codes by SMS need Redis.
+type SMSConfig struct {
+	// Provider is one of "twilio", "http" or "log", empty disables codes by SMS.
+	Provider      string          `yaml:"provider" env:"SMS_PROVIDER"`
+	DefaultLocale string          `yaml:"default_locale" env-default:"en"`
+	Twilio        SMSTwilioConfig `yaml:"twilio"`
+	HTTP          SMSHTTPConfig   `yaml:"http"`
+	Timeout       time.Duration   `yaml:"timeout" env-default:"10s"`
+	CodeTTL       time.Duration   `yaml:"code_ttl" env-default:"5m"`
+	// ResendInterval is the least time between codes for the same phone number.
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+}
+
+type SMSTwilioConfig struct {
+	AccountSID string `yaml:"account_sid" env:"TWILIO_ACCOUNT_SID"`
+	AuthToken  string `yaml:"auth_token" env:"TWILIO_AUTH_TOKEN"`
+	// AuthTokenFile is a path to a file with the auth token, it overrides AuthToken.
+	AuthTokenFile string `yaml:"auth_token_file" env:"TWILIO_AUTH_TOKEN_FILE"`
+	// From is the sender number or the SID of a messaging service ("MG...").
+	From string `yaml:"from"`
+}
+
+// SMSHTTPConfig configures a generic provider receiving the messages as JSON POST requests.
+type SMSHTTPConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token" env:"SMS_HTTP_TOKEN"`
+	// TokenFile is a path to a file with the token, it overrides Token.
+	TokenFile string `yaml:"token_file" env:"SMS_HTTP_TOKEN_FILE"`
+}
+
+// RiskConfig configures the risk scoring of logins. A login scoring at least a threshold
+// gets the login step of the threshold, a zero threshold disables its step.
+type RiskConfig struct {
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	// CaptchaThreshold requires a CAPTCHA, it needs captcha.provider.
+	CaptchaThreshold int `yaml:"captcha_threshold" env-default:"40"`
+	// CodeThreshold requires a code sent by email, it needs Redis.
+	CodeThreshold int              `yaml:"code_threshold" env-default:"70"`
+	CodeTTL       time.Duration    `yaml:"code_ttl" env-default:"10m"`
+	Weights       RiskWeightConfig `yaml:"weights"`
+	// FailureWindow is how long a failed password attempt counts, counting needs Redis.
+	FailureWindow time.Duration `yaml:"failure_window" env-default:"1h"`
+	// MaxTravelSpeed in km/h makes faster travel between logins impossible, it needs a GeoIP city database.
+	MaxTravelSpeed float64 `yaml:"max_travel_speed" env-default:"1000"`
+	// DatacenterASNs are the autonomous systems of hosting providers, empty uses a built-in list.
+	DatacenterASNs []uint32 `yaml:"datacenter_asns"`
+}
+
+// RiskWeightConfig sets the points each signal adds to the risk score.
+type RiskWeightConfig struct {
+	// FailedAttempt is added for every recent failed password attempt, up to MaxFailedAttempts.
+	FailedAttempt     int `yaml:"failed_attempt" env-default:"10"`
+	MaxFailedAttempts int `yaml:"max_failed_attempts" env-default:"5"`
+	NewIP             int `yaml:"new_ip" env-default:"20"`
+	ImpossibleTravel  int `yaml:"impossible_travel" env-default:"70"`
+	Datacenter        int `yaml:"datacenter" env-default:"30"`
+}
+
+type RedisConfig struct {
+	// Addr of the Redis server, empty disables everything backed by Redis.
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env-default:"0"`
+	// PasswordFile is a path to a file with the password, it overrides Password.
+	PasswordFile string `yaml:"password_file" env:"REDIS_PASSWORD_FILE"`
+	// KeyPrefix is prepended to all keys, e.g. "sso:{env}:", so several environments can share one Redis.
+	// {env} is replaced with the env of the config.
+	KeyPrefix string `yaml:"key_prefix" env:"REDIS_KEY_PREFIX"`
+}
+
+type RateLimitConfig struct {
+	Enabled       bool          `yaml:"enabled" env-default:"false"`
+	Window        time.Duration `yaml:"window" env-default:"1m"`
+	LoginPerEmail int64         `yaml:"login_per_email" env-default:"5"`
+	LoginPerIP    int64         `yaml:"login_per_ip" env-default:"20"`
+	RegisterPerIP int64         `yaml:"register_per_ip" env-default:"10"`
+	// ClockResync is how often the offset to the Redis server clock is refreshed.
+	ClockResync time.Duration `yaml:"clock_resync" env-default:"1m"`
+	// FailClosed rejects rate-limited calls and logins while Redis is unavailable instead of letting them through.
+	FailClosed bool          `yaml:"fail_closed" env-default:"false"`
+	Breaker    BreakerConfig `yaml:"breaker"`
+	Lockout    LockoutConfig `yaml:"lockout"`
+}
+
+// BreakerConfig stops calling Redis for rate limiting after consecutive failures,
+// so an unavailable Redis doesn't add its timeouts to every request.
+type BreakerConfig struct {
+	// Threshold is the number of consecutive failures that opens the breaker, 0 disables it.
+	Threshold int `yaml:"threshold" env-default:"5"`
+	// Cooldown is how long the breaker stays open before a single call probes Redis again.
+	Cooldown time.Duration `yaml:"cooldown" env-default:"10s"`
+}
+
+// LockoutConfig locks out a login after repeated failed attempts for escalating durations.
+// It is independent of rate_limit.enabled and requires Redis.
+type LockoutConfig struct {
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	// Threshold is the number of failed attempts that starts the next lockout.
+	Threshold int64 `yaml:"threshold" env-default:"5"`
+	// Steps are the durations of consecutive lockouts, the last one repeats.
+	Steps []time.Duration `yaml:"steps" env-default:"1m,5m,30m"`
+	// ResetAfter forgets the failed attempts and reached lockouts after this long without failures.
+	ResetAfter time.Duration `yaml:"reset_after" env-default:"24h"`
+}
+
+// AuthzConfig lists admins allowed to call access-management methods.
+type AuthzConfig struct {
+	// AdminApp is the app admin tokens are issued for, empty disables admin tokens.
+	AdminApp    string   `yaml:"admin_app" env:"AUTHZ_ADMIN_APP"`
+	AdminEmails []string `yaml:"admin_emails" env:"AUTHZ_ADMIN_EMAILS" env-separator:","`
+	// AdminApps are app codes whose secret grants admin rights, for backend integrations.
+	AdminApps []string `yaml:"admin_apps" env:"AUTHZ_ADMIN_APPS" env-separator:","`
+}
+
+type EmailConfig struct {
+	From          string     `yaml:"from"`
+	DefaultLocale string     `yaml:"default_locale" env-default:"en"`
+	SMTP          SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	// Host of the SMTP server, empty makes emails be written to the log instead.
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD"`
+	// PasswordFile is a path to a file with the password, it overrides Password.
+	PasswordFile string `yaml:"password_file" env:"SMTP_PASSWORD_FILE"`
+	// TLSMode is one of "starttls", "tls" (implicit) or "none".
+	TLSMode string        `yaml:"tls_mode" env-default:"starttls"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+type NewDeviceConfig struct {
+	// Notify emails the user about logins from devices not seen before.
+	Notify bool `yaml:"notify" env-default:"true"`
+	// StepUp requires a code sent by email to log in from a new device, needs Redis.
+	StepUp  bool          `yaml:"step_up" env-default:"false"`
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"10m"`
+	// TrustTTL is how long a remembered device skips second factors, zero disables remembering.
+	TrustTTL time.Duration `yaml:"trust_ttl" env-default:"720h"`
+}
+
+type BcryptConfig struct {
+	// Cost of new password hashes, hashes with a lower cost are upgraded on successful login.
+	Cost int `yaml:"cost" env-default:"10"`
+	// Parallelism is the number of concurrent hash operations, 0 means the number of CPUs.
+	Parallelism int `yaml:"parallelism" env-default:"0"`
+	// QueueDepth is the number of operations waiting for a worker, beyond it requests are rejected.
+	QueueDepth int `yaml:"queue_depth" env-default:"64"`
+}
+
+// PepperConfig holds the server-side secrets mixed into passwords before hashing.
+// Secrets are never read from the config file itself.
+type PepperConfig struct {
+	// Current is the id of the pepper used for new hashes, empty disables peppering.
+	Current string `yaml:"current" env:"PASSWORD_PEPPER_ID"`
+	// Keys maps pepper ids to secrets, e.g. PASSWORD_PEPPERS="v1:secret1,v2:secret2".
+	Keys map[string]string `yaml:"-" env:"PASSWORD_PEPPERS"`
+	// File is a path to a file with "id:secret" lines, e.g. a mounted secret.
+	File string `yaml:"file" env:"PASSWORD_PEPPERS_FILE"`
+}
+
+type RetentionConfig struct {
+	// DeletedUsers is how long personal data of deleted accounts is kept before anonymization.
+	DeletedUsers time.Duration `yaml:"deleted_users" env-default:"720h"`
+	// ExpiredInvites is how long expired and used invites are kept before deletion.
+	ExpiredInvites time.Duration `yaml:"expired_invites" env-default:"168h"`
+	Batch          int           `yaml:"batch" env-default:"100"`
+	// LoginHistory is how long logins with their IP addresses and locations are kept.
+	LoginHistory time.Duration `yaml:"login_history" env-default:"2160h"`
+}
+
+// BackupConfig controls database snapshots, restored with cmd/restore.
+type BackupConfig struct {
+	// Dir is where snapshots are written, empty disables backups.
+	Dir string `yaml:"dir"`
+	// Keep is the number of latest snapshots kept, 0 keeps all.
+	Keep int `yaml:"keep" env-default:"7"`
+}
+
+// JobsConfig sets cron schedules of the maintenance jobs: five fields "minute hour day month weekday"
+// in local time, @hourly, @daily, @weekly or @every <duration>. Empty disables the job.
+type JobsConfig struct {
+	// PurgeExpired deletes expired sessions, one-time token records, revoked tokens and old invites.
+	PurgeExpired string `yaml:"purge_expired" env-default:"@every 1h"`
+	// AnonymizeDeleted anonymizes accounts deleted more than retention.deleted_users ago.
+	AnonymizeDeleted string `yaml:"anonymize_deleted" env-default:"@every 1h"`
+	// Vacuum compacts the database file, blocking writes while it runs.
+	Vacuum string `yaml:"vacuum" env-default:""`
+	// Backup writes a snapshot to backup.dir.
+	Backup string `yaml:"backup" env-default:""`
+	// RotateFieldKeys re-encrypts columns not encrypted with field_encryption.current, a no-op without keys.
+	RotateFieldKeys string `yaml:"rotate_field_keys" env-default:"@every 1h"`
+	// PurgeLoginHistory deletes logins older than retention.login_history.
+	PurgeLoginHistory string `yaml:"purge_login_history" env-default:"@every 1h"`
+}
+
+// UserCacheConfig controls the in-memory cache of users and user_app rows used by token validation.
+type UserCacheConfig struct {
+	// TTL bounds how late blocking or access revocation made elsewhere is noticed, 0 disables the cache.
+	TTL        time.Duration `yaml:"ttl" env-default:"0"`
+	MaxEntries int           `yaml:"max_entries" env-default:"10000"`
+}
+
+// AppCacheConfig controls the in-memory cache of apps, its size is bounded by user_cache.max_entries.
+type AppCacheConfig struct {
+	// TTL bounds how late app changes made elsewhere are noticed, 0 disables the cache.
+	TTL time.Duration `yaml:"ttl" env-default:"0"`
+}
+
+type DebugConfig struct {
+	// Enabled starts the HTTP server with pprof, expvar and goroutine dump endpoints.
+	Enabled bool `yaml:"enabled" env-default:"false"`
+	// Addr must be a loopback address.
+	Addr                 string `yaml:"addr" env-default:"localhost:6060"`
+	BlockProfileRate     int    `yaml:"block_profile_rate" env-default:"0"`
+	MutexProfileFraction int    `yaml:"mutex_profile_fraction" env-default:"0"`
+}
+
+// OpsConfig controls the HTTP server of liveness and readiness probes.
+type OpsConfig struct {
+	// Enabled starts the server with /healthz and /readyz.
+	Enabled bool   `yaml:"enabled" env-default:"false"`
+	Addr    string `yaml:"addr" env-default:":8081"`
+	// DrainDelay is how long /readyz reports NOT_READY on shutdown before the gRPC server stops,
+	// so load balancers notice it. It counts against the 10s shutdown timeout.
+	DrainDelay time.Duration `yaml:"drain_delay" env-default:"5s"`
+}
+
 func MustLoad() *Config {
-	configPath := fetchConfigPath()
+	configPath, opts := fetchFlags()
 	if configPath == "" {
 		panic("config path is empty")
 	}
 
-	return MustLoadPath(configPath)
+	cfg, err := Load(configPath, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return cfg
 }
 
 func MustLoadPath(configPath string) *Config {
+	cfg, err := Load(configPath, LoadOptions{})
+	if err != nil {
+		panic(err)
+	}
+
+	return cfg
+}
+
+// LoadOptions changes how Load reads the config.
+type LoadOptions struct {
+	// Strict makes unknown keys of the files and malformed durations errors instead of being ignored.
+	Strict bool
+	// Env selects the overlay instead of the env field of the config file and replaces the field.
+	Env string
+}
+
+// Load reads the config file merged with the overlay of its environment, e.g. config.prod.yaml
+// next to config.yaml, with the profile defaults and the environment overrides, reads the secret
+// files and validates the result.
+func Load(configPath string, opts LoadOptions) (*Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		panic("config file does not exist: " + configPath)
+		return nil, errors.New("config file does not exist: " + configPath)
+	}
+
+	files, env, err := readFiles(configPath, opts.Env)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	// Каждый файл проверяется отдельно, чтобы ошибки указывали на его строки
+	if opts.Strict {
+		var errs []error
+		for _, file := range files {
+			errs = append(errs, checkStrict(file, &Config{}))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("cannot read config: %w", err)
+		}
+	}
+
+	data, err := mergeFiles(files)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	// Профиль читается первым: его значения становятся умолчаниями,
+	// которые перекрываются явно заданными в файле и окружении
+	var header struct {
+		Profile string `yaml:"profile" env:"PROFILE" env-default:"medium"`
+	}
+
+	if err := parseConfig(data, &header); err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	cfg, ok := profiles[header.Profile]
+	if !ok {
+		return nil, errors.New("unknown profile: " + header.Profile)
+	}
+
+	if err := parseConfig(data, &cfg); err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	// Оверлей выбран по этому значению, даже если сам задаёт другое
+	cfg.Env = env
+
+	if cfg.InstanceID == "" {
+		// Имя хоста — это имя пода в Kubernetes и ID контейнера в Docker
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get hostname for instance_id: %w", err)
+		}
+		cfg.InstanceID = hostname
+	}
+
+	cfg.Redis.KeyPrefix = strings.ReplaceAll(cfg.Redis.KeyPrefix, "{env}", cfg.Env)
+
+	if err := loadSecretFiles(&cfg); err != nil {
+		return nil, fmt.Errorf("cannot read secrets: %w", err)
+	}
+
+	if err := loadPeppers(&cfg.Pepper); err != nil {
+		return nil, fmt.Errorf("cannot read peppers: %w", err)
+	}
+
+	if err := loadFieldKeys(&cfg.FieldEncryption); err != nil {
+		return nil, fmt.Errorf("cannot read field encryption keys: %w", err)
+	}
+
+	if cfg.Bcrypt.Cost < bcrypt.MinCost || cfg.Bcrypt.Cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt.cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	// Окна считаются в миллисекундах: более короткое окно дало бы деление на ноль
+	if cfg.RateLimit.Enabled && cfg.RateLimit.Window < time.Millisecond {
+		return nil, errors.New("rate_limit.window must be at least 1ms")
+	}
+
+	if cfg.PasswordStrength.MinScore < 0 || cfg.PasswordStrength.MinScore > 4 {
+		return nil, errors.New("password_strength.min_score must be between 0 and 4")
+	}
+
+	return &cfg, nil
+}
+
+// secret is a single-value secret of the config. Besides the config and the environment it can be read
+// from a file, e.g. a Docker or Kubernetes secret, so it appears neither in the config file
+// nor in the environment of the process, or from Vault.
+type secret struct {
+	name  string
+	file  string
+	value *string
+	// vaultKey is the field of the secret in vault.secrets_path.
+	vaultKey string
+}
+
+// secrets lists the single-value secrets of the config. Peppers and field keys are lists,
+// their files are read by loadPeppers and loadFieldKeys.
+func secrets(cfg *Config) []secret {
+	return []secret{
+		{"storage_key.file", cfg.StorageKey.File, &cfg.StorageKey.Key, "storage_key"},
+		{"field_encryption.index_key_file", cfg.FieldEncryption.IndexKeyFile, &cfg.FieldEncryption.IndexKey, "field_index_key"},
+		{"redis.password_file", cfg.Redis.PasswordFile, &cfg.Redis.Password, "redis_password"},
+		{"email.smtp.password_file", cfg.Email.SMTP.PasswordFile, &cfg.Email.SMTP.Password, "smtp_password"},
+		{"captcha.secret_file", cfg.Captcha.SecretFile, &cfg.Captcha.Secret, "captcha_secret"},
+		{"sms.twilio.auth_token_file", cfg.SMS.Twilio.AuthTokenFile, &cfg.SMS.Twilio.AuthToken, "twilio_auth_token"},
+		{"sms.http.token_file", cfg.SMS.HTTP.TokenFile, &cfg.SMS.HTTP.Token, "sms_http_token"},
+		{"vault.token_file", cfg.Vault.TokenFile, &cfg.Vault.Token, ""},
+	}
+}
+
+// loadSecretFiles reads the secrets from their files, a file overrides the value set otherwise.
+func loadSecretFiles(cfg *Config) error {
+	var errs []error
+	for _, secret := range secrets(cfg) {
+		if secret.file == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(secret.file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", secret.name, err))
+			continue
+		}
+
+		// Перевод строки в конце файла — не часть секрета
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s: %s is empty", secret.name, secret.file))
+			continue
+		}
+		*secret.value = value
+	}
+
+	return errors.Join(errs...)
+}
+
+// SetVaultSecrets sets the secrets read from vault.secrets_path by their field names, e.g. redis_password.
+// Values from Vault override the config, the environment and the files.
+func (c *Config) SetVaultSecrets(values map[string]string) error {
+	byKey := make(map[string]*string)
+	for _, secret := range secrets(c) {
+		if secret.vaultKey != "" {
+			byKey[secret.vaultKey] = secret.value
+		}
+	}
+
+	var errs []error
+	for key, value := range values {
+		dst, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown secret %q", key))
+			continue
+		}
+		*dst = value
 	}
 
-	var cfg Config
+	return errors.Join(errs...)
+}
+
+// maskedSecret replaces the values of secrets in Masked.
+const maskedSecret = "******"
 
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		panic("cannot read config: " + err.Error())
+// Masked returns a copy of the config with the secrets replaced, safe to print or log.
+// Secrets that are not set stay empty, so it is still visible which ones are configured.
+func (c *Config) Masked() *Config {
+	masked := *c
+	for _, secret := range secrets(&masked) {
+		if *secret.value != "" {
+			*secret.value = maskedSecret
+		}
 	}
 
-	return &cfg
+	// Карты общие с исходным конфигом, поэтому заменяются копиями
+	masked.Pepper.Keys = maskValues(c.Pepper.Keys)
+	masked.FieldEncryption.Keys = maskValues(c.FieldEncryption.Keys)
+	masked.OTLP.Headers = maskValues(c.OTLP.Headers)
+
+	return &masked
 }
 
-func fetchConfigPath() string {
-	var res string
+func maskValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	masked := make(map[string]string, len(values))
+	for key := range values {
+		masked[key] = maskedSecret
+	}
 
-	flag.StringVar(&res, "config-path", "", "path to config file")
+	return masked
+}
+
+// loadPeppers merges the peppers from Pepper.File into Pepper.Keys and checks the current one exists.
+func loadPeppers(cfg *PepperConfig) error {
+	if cfg.Keys == nil {
+		cfg.Keys = make(map[string]string)
+	}
+
+	if cfg.File != "" {
+		if err := readKeyFile(cfg.File, cfg.Keys); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cfg.Keys[cfg.Current]; cfg.Current != "" && !ok {
+		return fmt.Errorf("current pepper %q is not configured", cfg.Current)
+	}
+
+	return nil
+}
+
+// loadFieldKeys merges the keys from FieldEncryption.File into FieldEncryption.Keys.
+// The keys themselves are checked by fieldcrypt.New.
+func loadFieldKeys(cfg *FieldEncryptionConfig) error {
+	if cfg.Keys == nil {
+		cfg.Keys = make(map[string]string)
+	}
+
+	if cfg.File != "" {
+		if err := readKeyFile(cfg.File, cfg.Keys); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Current == "" && len(cfg.Keys) > 0 {
+		return errors.New("field_encryption.current must be set to use the keys")
+	}
+
+	return nil
+}
+
+// readKeyFile reads "id:secret" lines into keys, skipping empty lines and # comments.
+func readKeyFile(path string, keys map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(line, ":")
+		if !ok || id == "" || secret == "" {
+			return fmt.Errorf("%s: malformed line, expected id:secret", path)
+		}
+		keys[id] = secret
+	}
+
+	return nil
+}
+
+func fetchFlags() (configPath string, opts LoadOptions) {
+	flag.StringVar(&configPath, "config-path", "", "path to config file")
+	flag.BoolVar(&opts.Strict, "strict-config", false, "fail on unknown config keys and malformed durations")
+	flag.StringVar(&opts.Env, "env", "", "environment of the config overlay, the env field of the config by default")
 	flag.Parse()
 
-	if res == "" {
-		res = os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_PATH")
 	}
 
-	return res
+	return configPath, opts
 }
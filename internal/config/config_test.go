@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"sso/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	return path
+}
+
+func TestLoad_Formats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "env: prod\ntoken_ttl: 2h\ngrpc:\n  port: 9000\n",
+		"config.json": `{"env": "prod", "token_ttl": "2h", "grpc": {"port": 9000}}`,
+		"config.toml": "env = \"prod\"\ntoken_ttl = \"2h\"\n\n[grpc]\nport = 9000\n",
+	}
+
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := config.Load(writeConfig(t, name, data), config.LoadOptions{Strict: true})
+			require.NoError(t, err)
+			require.Equal(t, "prod", cfg.Env)
+			require.Equal(t, 2*time.Hour, cfg.TokenTTL)
+			require.Equal(t, int32(9000), cfg.GRPC.Port)
+		})
+	}
+}
+
+func TestLoad_Strict(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "env: prod\ngrpc:\n  tmeout: 10s\ntoken_ttl: 1y\n")
+
+	_, err := config.Load(path, config.LoadOptions{Strict: true})
+	require.ErrorContains(t, err, path+":3: grpc.tmeout: unknown key")
+	require.ErrorContains(t, err, path+`:4: token_ttl: invalid duration "1y"`)
+}
+
+func TestLoad_StrictWithoutLines(t *testing.T) {
+	path := writeConfig(t, "config.json", `{"grpc": {"tmeout": "10s"}}`)
+
+	_, err := config.Load(path, config.LoadOptions{Strict: true})
+	require.ErrorContains(t, err, path+": grpc.tmeout: unknown key")
+}
+
+func TestLoad_NotStrict(t *testing.T) {
+	cfg, err := config.Load(writeConfig(t, "config.yaml", "grpc:\n  tmeout: 1s\n"), config.LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, cfg.GRPC.Timeout)
+}
+
+func TestLoad_Overlay(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(base, []byte(
+		"env: prod\ngrpc:\n  port: 9000\n  timeout: 5s\nauthz:\n  admin_emails: [a@example.com, b@example.com]\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.prod.yaml"), []byte(
+		"grpc:\n  port: 9100\nauthz:\n  admin_emails: [c@example.com]\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.dev.yaml"), []byte("grpc:\n  port: 9200\n"), 0o600))
+
+	cfg, err := config.Load(base, config.LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "prod", cfg.Env)
+	require.Equal(t, int32(9100), cfg.GRPC.Port)
+	require.Equal(t, 5*time.Second, cfg.GRPC.Timeout)
+	require.Equal(t, []string{"c@example.com"}, cfg.Authz.AdminEmails)
+
+	cfg, err = config.Load(base, config.LoadOptions{Env: "dev"})
+	require.NoError(t, err)
+	require.Equal(t, "dev", cfg.Env)
+	require.Equal(t, int32(9200), cfg.GRPC.Port)
+	require.Equal(t, []string{"a@example.com", "b@example.com"}, cfg.Authz.AdminEmails)
+
+	cfg, err = config.Load(base, config.LoadOptions{Env: "staging"})
+	require.Nil(t, cfg)
+	require.ErrorContains(t, err, "overlay of env staging")
+}
+
+func TestLoad_OverlayMissing(t *testing.T) {
+	cfg, err := config.Load(writeConfig(t, "config.yaml", "env: prod\n"), config.LoadOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "prod", cfg.Env)
+}
+
+func TestLoad_RateLimitWindow(t *testing.T) {
+	_, err := config.Load(writeConfig(t, "config.yaml", "rate_limit:\n  enabled: true\n  window: 500us\n"), config.LoadOptions{})
+	require.ErrorContains(t, err, "rate_limit.window must be at least 1ms")
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is a config file converted to YAML.
+type configFile struct {
+	path string
+	data []byte
+	// withLines tells the lines of data are the lines of the file, see checkStrict.
+	withLines bool
+}
+
+// readFile reads the config file. The format is detected by the extension: .yaml, .yml, .json
+// or .toml. All formats use the keys of the yaml tags, so a file converted from YAML to another
+// format reads the same.
+func readFile(path string) (configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configFile{}, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".yaml", ".yml":
+	case ".json":
+		data, err = jsonToYAML(data)
+	case ".toml":
+		data, err = tomlToYAML(data)
+	default:
+		return configFile{}, fmt.Errorf("unsupported config format %q, expected .yaml, .yml, .json or .toml", ext)
+	}
+	if err != nil {
+		return configFile{}, fmt.Errorf("config file parsing error: %s: %w", path, err)
+	}
+
+	// Строки есть только у YAML: у сконвертированного документа они не совпадают с файлом
+	return configFile{path: path, data: data, withLines: ext == ".yaml" || ext == ".yml"}, nil
+}
+
+// parseConfig reads the YAML document into cfg and applies the environment and the defaults on top.
+func parseConfig(data []byte, cfg any) error {
+	if err := cleanenv.ParseYAML(bytes.NewReader(data), cfg); err != nil {
+		return fmt.Errorf("config file parsing error: %w", err)
+	}
+
+	return cleanenv.ReadEnv(cfg)
+}
+
+// jsonToYAML converts a JSON document to YAML keeping the integers integers.
+func jsonToYAML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Без UseNumber целые становятся float64, и большие числа кодируются в YAML как 1e+06
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(jsonNumbers(doc))
+}
+
+// jsonNumbers replaces json.Number values with int64 or float64.
+func jsonNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, value := range v {
+			v[key] = jsonNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = jsonNumbers(value)
+		}
+	}
+
+	return v
+}
+
+// tomlToYAML converts a TOML document to YAML.
+func tomlToYAML(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultEnv is the env of a config without the env field, as in Config.Env.
+const defaultEnv = "local"
+
+// overlayPath returns the overlay of the base config for env: config.yaml and prod give config.prod.yaml.
+func overlayPath(basePath, env string) string {
+	ext := filepath.Ext(basePath)
+	return strings.TrimSuffix(basePath, ext) + "." + env + ext
+}
+
+// readFiles reads the base config file and the overlay of the environment if there is one.
+// The environment is env or, if it is empty, the env field of the base file. The overlay
+// of an environment given explicitly must exist.
+func readFiles(basePath, env string) ([]configFile, string, error) {
+	base, err := readFile(basePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	explicit := env != ""
+	if !explicit {
+		var header struct {
+			Env string `yaml:"env"`
+		}
+		if err := yaml.Unmarshal(base.data, &header); err != nil {
+			return nil, "", fmt.Errorf("config file parsing error: %s: %w", basePath, err)
+		}
+
+		env = header.Env
+		if env == "" {
+			env = defaultEnv
+		}
+	}
+
+	// env становится частью пути и не должен выводить за каталог базового файла
+	if strings.ContainsAny(env, `/\`) || env == "." || env == ".." {
+		return nil, "", fmt.Errorf("invalid env %q", env)
+	}
+
+	path := overlayPath(basePath, env)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && !explicit {
+		return []configFile{base}, env, nil
+	}
+
+	overlay, err := readFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("overlay of env %s: %w", env, err)
+	}
+
+	return []configFile{base, overlay}, env, nil
+}
+
+// mergeFiles merges the files in order into one YAML document. Mappings are merged key by key,
+// any other value of a later file, lists included, replaces the earlier one as a whole.
+func mergeFiles(files []configFile) ([]byte, error) {
+	if len(files) == 1 {
+		return files[0].data, nil
+	}
+
+	var merged *yaml.Node
+	for _, file := range files {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(file.data, &doc); err != nil {
+			return nil, fmt.Errorf("config file parsing error: %s: %w", file.path, err)
+		}
+		// Пустой оверлей ничего не меняет
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		merged = mergeNodes(merged, doc.Content[0])
+	}
+
+	if merged == nil {
+		return files[0].data, nil
+	}
+
+	return yaml.Marshal(merged)
+}
+
+// mergeNodes merges overlay into base and returns the result, base is modified.
+func mergeNodes(base, overlay *yaml.Node) *yaml.Node {
+	if base == nil || base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+
+	// Порядок ключей базового файла сохраняется, новые ключи добавляются в конец
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+
+		found := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if base.Content[j].Value == key.Value {
+				base.Content[j+1] = mergeNodes(base.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+
+	return base
+}
@@ -0,0 +1,61 @@
+package config
+
+// Profiles of coordinated defaults for self-hosted deployments. Values set in the config
+// file or environment take precedence over the profile.
+const (
+	ProfileSmall  = "small"
+	ProfileMedium = "medium"
+	ProfileLarge  = "large"
+)
+
+var profiles = map[string]Config{
+	// small: 1–2 vCPU, до сотен пользователей
+	ProfileSmall: {
+		StoragePool: StoragePoolConfig{
+			MaxOpenConns: 5,
+			MaxIdleConns: 2,
+		},
+		Bcrypt: BcryptConfig{
+			Cost:        10,
+			Parallelism: 1,
+			QueueDepth:  16,
+		},
+		RateLimit: RateLimitConfig{
+			LoginPerEmail: 5,
+			LoginPerIP:    10,
+			RegisterPerIP: 5,
+		},
+	},
+	// medium: 2–4 vCPU, тысячи пользователей, совпадает с умолчаниями без профиля
+	ProfileMedium: {
+		StoragePool: StoragePoolConfig{
+			MaxOpenConns: 25,
+			MaxIdleConns: 5,
+		},
+		Bcrypt: BcryptConfig{
+			Cost:       10,
+			QueueDepth: 64,
+		},
+		RateLimit: RateLimitConfig{
+			LoginPerEmail: 5,
+			LoginPerIP:    20,
+			RegisterPerIP: 10,
+		},
+	},
+	// large: 8+ vCPU, десятки тысяч пользователей, в том числе за NAT
+	ProfileLarge: {
+		StoragePool: StoragePoolConfig{
+			MaxOpenConns: 50,
+			MaxIdleConns: 25,
+		},
+		Bcrypt: BcryptConfig{
+			Cost:       12,
+			QueueDepth: 256,
+		},
+		RateLimit: RateLimitConfig{
+			LoginPerEmail: 10,
+			LoginPerIP:    100,
+			RegisterPerIP: 30,
+		},
+	},
+}
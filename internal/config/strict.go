@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// checkStrict reports the keys of the config file that are not fields of cfg, which are otherwise
+// ignored and leave the defaults in place, and the malformed durations, naming each by its full key.
+// The line of the key is added when the file is YAML.
+func checkStrict(file configFile, cfg any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(file.data, &doc); err != nil {
+		return err
+	}
+	// Пустой файл — не ошибка: все значения берутся из окружения и умолчаний
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	c := strictChecker{path: file.path, withLines: file.withLines}
+	c.check(doc.Content[0], reflect.TypeOf(cfg), "")
+
+	return errors.Join(c.errs...)
+}
+
+type strictChecker struct {
+	path      string
+	withLines bool
+	errs      []error
+}
+
+func (c *strictChecker) check(node *yaml.Node, typ reflect.Type, key string) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	// Несовпадение вида узла и типа поля сообщает сам декодер YAML
+	switch {
+	case typ == durationType:
+		c.checkDuration(node, key)
+	case typ.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+
+			field, ok := fieldByKey(typ, name.Value)
+			if !ok {
+				c.fail(name, joinKey(key, name.Value), "unknown key")
+				continue
+			}
+			c.check(value, field.Type, joinKey(key, name.Value))
+		}
+	case typ.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.check(node.Content[i+1], typ.Elem(), joinKey(key, node.Content[i].Value))
+		}
+	case typ.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			c.check(item, typ.Elem(), fmt.Sprintf("%s[%d]", key, i))
+		}
+	}
+}
+
+func (c *strictChecker) checkDuration(node *yaml.Node, key string) {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return
+	}
+
+	if node.Tag == "!!int" {
+		c.fail(node, key, fmt.Sprintf("duration %s has no unit, e.g. %ss", node.Value, node.Value))
+		return
+	}
+	if _, err := time.ParseDuration(node.Value); err != nil {
+		c.fail(node, key, fmt.Sprintf("invalid duration %q, e.g. 30s, 5m or 1h", node.Value))
+	}
+}
+
+func (c *strictChecker) fail(node *yaml.Node, key, msg string) {
+	if c.withLines {
+		c.errs = append(c.errs, fmt.Errorf("%s:%d: %s: %s", c.path, node.Line, key, msg))
+		return
+	}
+	c.errs = append(c.errs, fmt.Errorf("%s: %s: %s", c.path, key, msg))
+}
+
+// fieldByKey finds the field the YAML decoder fills from the key. Fields tagged yaml:"-"
+// are not read from the file, so their keys are unknown too.
+func fieldByKey(typ reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" {
+			// Так поле без тега называет yaml.v3
+			name = strings.ToLower(field.Name)
+		}
+		if name == key {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -1,7 +1,24 @@
 package models
 
+// Token formats of an app.
+const (
+	// TokenFormatJWT is a self-contained signed JWT.
+	TokenFormatJWT = "jwt"
+	// TokenFormatOpaque is a random token resolved server-side to a session.
+	TokenFormatOpaque = "opaque"
+)
+
 type App struct {
-	ID     int32
-	Code   string
-	Secret string
+	ID          int32
+	Code        string
+	Secret      string
+	TokenFormat string
+	// ThirdParty apps require the user's consent to log in, see Consent.
+	ThirdParty bool
+	// ConsentVersion is the current version of the consent text, consents to older versions are asked again.
+	ConsentVersion int
+	// Claims is the claims template of the app's tokens.
+	Claims ClaimsTemplate
+	// WebhookURL receives signed notifications about access changes, empty disables them.
+	WebhookURL string
 }
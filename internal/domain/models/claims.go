@@ -0,0 +1,22 @@
+package models
+
+// Profile fields a claims template can embed into tokens.
+const (
+	ProfileUsername  = "username"
+	ProfilePhone     = "phone"
+	ProfileCreatedAt = "created_at"
+)
+
+// ClaimsTemplate selects the claims embedded into the tokens of an app on top of the standard ones.
+// The zero template embeds nothing extra.
+type ClaimsTemplate struct {
+	// Profile lists the profile fields of the user to embed, see ProfileUsername and the others.
+	Profile []string `json:"profile,omitempty"`
+	// Roles embeds the roles of the user from the access policy of the app as "roles".
+	Roles bool `json:"roles,omitempty"`
+	// Attributes lists the custom attributes of the user to embed as claims of the same name.
+	Attributes []string `json:"attributes,omitempty"`
+	// Rename maps claim names to the names the app expects, e.g. "username": "preferred_username".
+	// Standard claims (uid, email, exp, ...) can't be renamed.
+	Rename map[string]string `json:"rename,omitempty"`
+}
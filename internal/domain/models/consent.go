@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Consent is the user's permission for a third-party app to receive their identity.
+type Consent struct {
+	UserID int64
+	AppID  int32
+	// Version is the consent version of the app the user agreed to.
+	Version   int
+	GrantedAt time.Time
+}
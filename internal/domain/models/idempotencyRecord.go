@@ -0,0 +1,11 @@
+package models
+
+// IdempotencyRecord is the stored outcome of a call made with an idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint is the hash of the request: a key can't be reused with another request.
+	Fingerprint string
+	// Done is false while the first call is in progress.
+	Done bool
+	// Response is the serialized response of the first call.
+	Response []byte
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Invite allows registering the email; the user is granted access to AppIDs on registration.
+type Invite struct {
+	ID        int64
+	TokenHash string
+	Email     string
+	AppIDs    []int32
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// UsedAt is zero until the invite is consumed.
+	UsedAt time.Time
+}
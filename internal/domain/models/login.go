@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Login is an entry of the login history of a user.
+type Login struct {
+	ID     int64
+	UserID int64
+	AppID  int32
+	// AppCode is filled when the history is read.
+	AppCode   string
+	IP        string
+	UserAgent string
+	// Country is the ISO code and ASN the autonomous system of IP, empty without GeoIP databases.
+	Country string
+	ASN     uint32
+	// Latitude and Longitude are the approximate location of IP, zero without a GeoIP city database.
+	Latitude  float64
+	Longitude float64
+	// NewCountry marks a login from a country the user has not logged in from before.
+	NewCountry bool
+	CreatedAt  time.Time
+}
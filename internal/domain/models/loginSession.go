@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type LoginSession struct {
+	ID        string
+	UserID    int64
+	Email     string
+	AppCode   string
+	Pending   []string
+	ExpiresAt time.Time
+	// RememberDevice issues a device token when the login completes, set when a second factor is passed with it.
+	RememberDevice bool
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type MaintenanceWindow struct {
+	ID       int64
+	AppID    int32
+	StartsAt time.Time
+	EndsAt   time.Time
+	Reason   string
+}
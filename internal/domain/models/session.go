@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Session is the server-side state of an opaque token. ID is the hash of the token.
+type Session struct {
+	ID           string
+	UserID       int64
+	AppID        int32
+	TokenVersion int64
+	Claims       []byte
+	ExpiresAt    time.Time
+}
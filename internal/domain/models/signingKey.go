@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SigningKey is a token signing key of an app, announced in the kid header of tokens.
+type SigningKey struct {
+	ID        string
+	AppID     int32
+	Secret    string
+	CreatedAt time.Time
+	// ExpiresAt is zero for keys that are not retired yet, the newest of them signs new tokens.
+	ExpiresAt time.Time
+}
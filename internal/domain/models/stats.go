@@ -0,0 +1,28 @@
+package models
+
+// Stats are aggregate counts of users and logins for dashboards.
+type Stats struct {
+	TotalUsers int64
+	// ActiveUsers24h and ActiveUsers7d count users who logged in within the last 24 hours and 7 days.
+	ActiveUsers24h int64
+	ActiveUsers7d  int64
+	// Apps are the login counts of each app since the start of the period, by UTC days.
+	Apps []AppLoginStats
+}
+
+type AppLoginStats struct {
+	AppID        int32
+	AppCode      string
+	Logins       int64
+	FailedLogins int64
+}
+
+// FailureRate returns the share of failed attempts among all login attempts, 0 without attempts.
+func (s AppLoginStats) FailureRate() float64 {
+	total := s.Logins + s.FailedLogins
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.FailedLogins) / float64(total)
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// TermsAcceptance records that a user accepted a version of the terms of service.
+type TermsAcceptance struct {
+	UserID     int64
+	Version    string
+	AcceptedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type TokenClaims struct {
+	Ref       string
+	UserID    int64
+	AppID     int32
+	Claims    []byte
+	ExpiresAt time.Time
+}
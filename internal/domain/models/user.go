@@ -1,7 +1,19 @@
 package models
 
+import "time"
+
 type User struct {
-	ID       int64
-	Email    string
+	ID    int64
+	Email string
+	// Username and Phone are optional login identifiers, empty if not set.
+	Username string
+	Phone    string
 	PassHash []byte
+	// PepperID identifies the pepper mixed into the password before hashing, empty if none.
+	PepperID string
+	Blocked  bool
+	// TokenVersion is embedded into issued tokens, bumping it revokes all of them.
+	TokenVersion int64
+	// CreatedAt is zero for users registered before it was recorded.
+	CreatedAt time.Time
 }
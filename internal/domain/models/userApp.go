@@ -5,3 +5,11 @@ type UserApp struct {
 	AppID     int32
 	IsEnabled bool
 }
+
+// AppGrant is a user_app row with the code of its app.
+type AppGrant struct {
+	UserID    int64
+	AppID     int32
+	AppCode   string
+	IsEnabled bool
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type UserDevice struct {
+	ID          int64
+	UserID      int64
+	Fingerprint string
+	UserAgent   string
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	// TrustedUntil is when the device token of a remembered device expires, zero if it is not remembered.
+	TrustedUntil time.Time
+}
+
+// Trusted reports whether the device is remembered at the time.
+func (d UserDevice) Trusted(now time.Time) bool {
+	return !d.TrustedUntil.IsZero() && now.Before(d.TrustedUntil)
+}
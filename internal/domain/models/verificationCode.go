@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type VerificationCode struct {
+	Hash      []byte
+	Attempts  int
+	ExpiresAt time.Time
+}
@@ -0,0 +1,188 @@
+package apierr
+
+import (
+	"context"
+	"sso/internal/lib/requestid"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// Domain is the ErrorInfo domain of all errors returned by the service.
+const Domain = "sso"
+
+// Reason is a machine-readable error code clients can branch on.
+type Reason string
+
+const (
+	ReasonInvalidArgument      Reason = "INVALID_ARGUMENT"
+	ReasonInvalidCredentials   Reason = "INVALID_CREDENTIALS"
+	ReasonUserExists           Reason = "USER_EXISTS"
+	ReasonUserNotFound         Reason = "USER_NOT_FOUND"
+	ReasonAppNotFound          Reason = "APP_NOT_FOUND"
+	ReasonTokenExpired         Reason = "TOKEN_EXPIRED"
+	ReasonTokenInvalid         Reason = "TOKEN_INVALID"
+	ReasonAccessDisabled       Reason = "ACCESS_DISABLED"
+	ReasonTokenTooLarge        Reason = "TOKEN_TOO_LARGE"
+	ReasonRateLimited          Reason = "RATE_LIMITED"
+	ReasonLockedOut            Reason = "LOCKED_OUT"
+	ReasonChallengeRequired    Reason = "CHALLENGE_REQUIRED"
+	ReasonChallengeFailed      Reason = "CHALLENGE_FAILED"
+	ReasonLoginSessionInvalid  Reason = "LOGIN_SESSION_INVALID"
+	ReasonAppMaintenance       Reason = "APP_MAINTENANCE"
+	ReasonOverloaded           Reason = "OVERLOADED"
+	ReasonUserBlocked          Reason = "USER_BLOCKED"
+	ReasonTokenRevoked         Reason = "TOKEN_REVOKED"
+	ReasonUnauthenticated      Reason = "UNAUTHENTICATED"
+	ReasonPermissionDenied     Reason = "PERMISSION_DENIED"
+	ReasonAccessGranted        Reason = "ACCESS_ALREADY_GRANTED"
+	ReasonAccessNotGranted     Reason = "ACCESS_NOT_GRANTED"
+	ReasonDomainNotAllowed     Reason = "EMAIL_DOMAIN_NOT_ALLOWED"
+	ReasonIdempotencyKeyReused Reason = "IDEMPOTENCY_KEY_REUSED"
+	ReasonRequestInProgress    Reason = "REQUEST_IN_PROGRESS"
+	ReasonCaptchaRequired      Reason = "CAPTCHA_REQUIRED"
+	ReasonCaptchaInvalid       Reason = "CAPTCHA_INVALID"
+	ReasonCanceled             Reason = "CANCELED"
+	ReasonDeadlineExceeded     Reason = "DEADLINE_EXCEEDED"
+	ReasonUnimplemented        Reason = "UNIMPLEMENTED"
+	ReasonUnavailable          Reason = "UNAVAILABLE"
+	ReasonStorageReadOnly      Reason = "STORAGE_READ_ONLY"
+	ReasonInternal             Reason = "INTERNAL"
+)
+
+const (
+	defaultLocale     = "en"
+	acceptLanguageKey = "accept-language"
+	// RequestIDKey is the ErrorInfo metadata key holding the request ID to quote to support.
+	RequestIDKey = "request_id"
+)
+
+// localized holds translations of error messages per reason, the English text is the status message itself.
+var localized = map[string]map[Reason]string{
+	"ru": {
+		ReasonInvalidArgument:      "Некорректные параметры запроса",
+		ReasonInvalidCredentials:   "Неверный email или пароль",
+		ReasonUserExists:           "Пользователь уже существует",
+		ReasonUserNotFound:         "Пользователь не найден",
+		ReasonAppNotFound:          "Приложение не найдено",
+		ReasonTokenExpired:         "Срок действия токена истёк",
+		ReasonTokenInvalid:         "Токен недействителен",
+		ReasonAccessDisabled:       "Доступ запрещён",
+		ReasonTokenTooLarge:        "Размер токена превышает допустимый",
+		ReasonRateLimited:          "Слишком много запросов, повторите позже",
+		ReasonLockedOut:            "Слишком много неудачных попыток входа, вход временно заблокирован",
+		ReasonChallengeRequired:    "Для входа требуются дополнительные шаги",
+		ReasonChallengeFailed:      "Шаг входа не пройден",
+		ReasonLoginSessionInvalid:  "Сессия входа недействительна, войдите заново",
+		ReasonAppMaintenance:       "Приложение временно недоступно из-за технических работ",
+		ReasonOverloaded:           "Сервис перегружен, повторите позже",
+		ReasonUserBlocked:          "Пользователь заблокирован",
+		ReasonTokenRevoked:         "Токен отозван",
+		ReasonUnauthenticated:      "Требуется аутентификация",
+		ReasonPermissionDenied:     "Недостаточно прав",
+		ReasonAccessGranted:        "Доступ уже выдан",
+		ReasonAccessNotGranted:     "Доступ не был выдан",
+		ReasonDomainNotAllowed:     "Домен email не разрешён в приложении",
+		ReasonIdempotencyKeyReused: "Ключ идемпотентности уже использован с другим запросом",
+		ReasonRequestInProgress:    "Запрос с этим ключом идемпотентности ещё выполняется",
+		ReasonCaptchaRequired:      "Требуется пройти проверку CAPTCHA",
+		ReasonCaptchaInvalid:       "Проверка CAPTCHA не пройдена",
+		ReasonCanceled:             "Запрос отменён",
+		ReasonDeadlineExceeded:     "Превышено время ожидания ответа",
+		ReasonUnimplemented:        "Метод не поддерживается",
+		ReasonUnavailable:          "Сервис временно недоступен, повторите позже",
+		ReasonStorageReadOnly:      "Сервис временно работает только на чтение, повторите позже",
+		ReasonInternal:             "Внутренняя ошибка сервиса",
+	},
+}
+
+// New builds a status error with ErrorInfo carrying the reason and the request ID, and a LocalizedMessage
+// in the locale requested by the client via the accept-language metadata.
+// Extra details (e.g. BadRequest) are appended after them.
+func New(ctx context.Context, code codes.Code, reason Reason, msg string, details ...protoadapt.MessageV1) error {
+	return NewWithMetadata(ctx, code, reason, msg, nil, details...)
+}
+
+// NewWithMetadata is New with extra ErrorInfo metadata describing the error, e.g. until when it persists.
+func NewWithMetadata(
+	ctx context.Context,
+	code codes.Code,
+	reason Reason,
+	msg string,
+	md map[string]string,
+	details ...protoadapt.MessageV1,
+) error {
+	st := status.New(code, msg)
+
+	all := make([]protoadapt.MessageV1, 0, len(details)+2)
+	info := &errdetails.ErrorInfo{
+		Reason:   string(reason),
+		Domain:   Domain,
+		Metadata: make(map[string]string, len(md)+1),
+	}
+	for k, v := range md {
+		info.Metadata[k] = v
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		info.Metadata[RequestIDKey] = id
+	}
+	all = append(all, info)
+
+	locale, text := localize(ctx, reason, msg)
+	all = append(all, &errdetails.LocalizedMessage{
+		Locale:  locale,
+		Message: text,
+	})
+	all = append(all, details...)
+
+	if withDetails, err := st.WithDetails(all...); err == nil {
+		st = withDetails
+	}
+
+	return st.Err()
+}
+
+// ReasonOf returns the reason of an error built by New, "" for other errors.
+func ReasonOf(err error) Reason {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == Domain {
+			return Reason(info.GetReason())
+		}
+	}
+
+	return ""
+}
+
+// localize picks the first supported locale from accept-language, falling back to English.
+func localize(ctx context.Context, reason Reason, msg string) (locale string, text string) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return defaultLocale, msg
+	}
+
+	for _, header := range md.Get(acceptLanguageKey) {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(strings.SplitN(tag, ";", 2)[0])
+			lang := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+
+			if lang == defaultLocale {
+				return tag, msg
+			}
+
+			if translated, ok := localized[lang][reason]; ok {
+				return tag, translated
+			}
+		}
+	}
+
+	return defaultLocale, msg
+}
@@ -0,0 +1,62 @@
+package apierr
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// msgInternal replaces the message of errors that are not status errors, it may expose internals.
+	msgInternal         = "internal error"
+	msgDeadlineExceeded = "deadline exceeded"
+	msgCanceled         = "request canceled"
+)
+
+// reasonByCode is the reason of errors returned without one, e.g. by gRPC itself or an unmapped path.
+var reasonByCode = map[codes.Code]Reason{
+	codes.Canceled:          ReasonCanceled,
+	codes.DeadlineExceeded:  ReasonDeadlineExceeded,
+	codes.InvalidArgument:   ReasonInvalidArgument,
+	codes.Unauthenticated:   ReasonUnauthenticated,
+	codes.PermissionDenied:  ReasonPermissionDenied,
+	codes.ResourceExhausted: ReasonOverloaded,
+	codes.Unimplemented:     ReasonUnimplemented,
+	codes.Unavailable:       ReasonUnavailable,
+}
+
+// UnaryServerInterceptor guarantees every error carries ErrorInfo with a reason, so clients never need
+// to match messages. Errors built by New pass through, status errors get the reason of their code,
+// other errors become codes.Internal with a generic message.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err == nil || ReasonOf(err) != "" {
+			return resp, err
+		}
+
+		st, ok := status.FromError(err)
+		if !ok || st.Code() == codes.Unknown {
+			// Ошибка без статуса после истечения контекста — это таймаут или отмена, а не сбой сервиса
+			switch {
+			// Таймаут сервера задаётся внутренним интерцептором, его видно только по самой ошибке
+			case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+				return resp, New(ctx, codes.DeadlineExceeded, ReasonDeadlineExceeded, msgDeadlineExceeded)
+			case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+				return resp, New(ctx, codes.Canceled, ReasonCanceled, msgCanceled)
+			}
+
+			return resp, New(ctx, codes.Internal, ReasonInternal, msgInternal)
+		}
+
+		reason, ok := reasonByCode[st.Code()]
+		if !ok {
+			reason = ReasonInternal
+		}
+
+		return resp, New(ctx, st.Code(), reason, st.Message())
+	}
+}
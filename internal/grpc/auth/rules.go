@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"sso/internal/grpc/apierr"
+	"sso/internal/grpc/authz"
+	"sso/internal/grpc/captcha"
+	"sso/internal/grpc/degradation"
+	"sso/internal/grpc/idempotency"
+	"sso/internal/grpc/lockout"
+	"sso/internal/grpc/ratelimit"
+	"sso/internal/grpc/surface"
+	"sso/internal/grpc/validate"
+	"time"
+
+	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	emailMinLen    = 3
+	emailMaxLen    = 254
+	passwordMinLen = 8
+	// passwordMaxLen is the bcrypt limit, longer passwords can't be hashed without a pepper.
+	passwordMaxLen = 72
+	appCodeMaxLen  = 64
+	// tokenMaxLen bounds tokens in requests, issued tokens are limited by token_max_size.
+	tokenMaxLen = 8192
+)
+
+// ValidationRules returns request validation rules for the Auth service methods.
+func ValidationRules() validate.Rules {
+	return validate.Rules{
+		ssov1.Auth_Register_FullMethodName: validate.Message(
+			validate.Field("email", (*ssov1.RegisterRequest).GetEmail,
+				validate.Required(msgEmailRequired),
+				validate.MinLen(emailMinLen, msgInvalidEmail),
+				validate.MaxLen(emailMaxLen, msgInvalidEmail),
+				validate.Email(msgInvalidEmail),
+			),
+			validate.Field("password", (*ssov1.RegisterRequest).GetPassword,
+				validate.Required(msgPasswordRequired),
+				validate.MinLen(passwordMinLen, msgPasswordTooShort),
+				validate.MaxLen(passwordMaxLen, msgPasswordTooLong),
+			),
+		),
+		// Продолжение сессии входа берёт пользователя и приложение из сессии, поля запроса не нужны
+		ssov1.Auth_Login_FullMethodName: validate.Unless(continuesLogin, validate.Message(
+			// Поле email принимает также имя пользователя или номер телефона
+			validate.Field("email", (*ssov1.LoginRequest).GetEmail,
+				validate.Required(msgEmailRequired),
+				validate.MaxLen(emailMaxLen, msgInvalidLogin),
+				validate.Login(msgInvalidLogin),
+			),
+			validate.Field("password", (*ssov1.LoginRequest).GetPassword,
+				validate.Required(msgPasswordRequired),
+				validate.MaxLen(passwordMaxLen, msgPasswordTooLong),
+			),
+			validate.Field("app_code", (*ssov1.LoginRequest).GetAppCode,
+				validate.Required(msgAppCodeRequired),
+				validate.MaxLen(appCodeMaxLen, msgAppCodeTooLong),
+			),
+		)),
+		ssov1.Auth_Logout_FullMethodName: validate.Message(
+			validate.Field("email", (*ssov1.LogoutRequest).GetEmail,
+				validate.Required(msgEmailRequired),
+				validate.MaxLen(emailMaxLen, msgInvalidEmail),
+			),
+			validate.Field("app_code", (*ssov1.LogoutRequest).GetAppCode,
+				validate.Required(msgAppCodeRequired),
+				validate.MaxLen(appCodeMaxLen, msgAppCodeTooLong),
+			),
+		),
+		ssov1.Auth_AllowAccess_FullMethodName: validate.Message(
+			validate.Field("email", (*ssov1.AllowAccessRequest).GetEmail,
+				validate.Required(msgEmailRequired),
+				validate.MaxLen(emailMaxLen, msgInvalidEmail),
+				validate.Email(msgInvalidEmail),
+			),
+			validate.Field("app_code", (*ssov1.AllowAccessRequest).GetAppCode,
+				validate.Required(msgAppCodeRequired),
+				validate.MaxLen(appCodeMaxLen, msgAppCodeTooLong),
+			),
+		),
+		ssov1.Auth_GrantAccess_FullMethodName: validate.Message(
+			validate.Field("email", (*ssov1.GrantAccessRequest).GetEmail,
+				validate.Required(msgEmailRequired),
+				validate.MaxLen(emailMaxLen, msgInvalidEmail),
+				validate.Email(msgInvalidEmail),
+			),
+			validate.Field("app_code", (*ssov1.GrantAccessRequest).GetAppCode,
+				validate.Required(msgAppCodeRequired),
+				validate.MaxLen(appCodeMaxLen, msgAppCodeTooLong),
+			),
+		),
+		ssov1.Auth_RevokeAccess_FullMethodName: validate.Message(
+			validate.Field("email", (*ssov1.RevokeAccessRequest).GetEmail,
+				validate.Required(msgEmailRequired),
+				validate.MaxLen(emailMaxLen, msgInvalidEmail),
+				validate.Email(msgInvalidEmail),
+			),
+			validate.Field("app_code", (*ssov1.RevokeAccessRequest).GetAppCode,
+				validate.Required(msgAppCodeRequired),
+				validate.MaxLen(appCodeMaxLen, msgAppCodeTooLong),
+			),
+		),
+		ssov1.Auth_Validate_FullMethodName: validate.Message(
+			validate.Field("token", (*ssov1.ValidateTokenRequest).GetToken,
+				validate.Required(msgTokenRequired),
+				validate.MaxLen(tokenMaxLen, msgTokenTooLarge),
+			),
+			validate.Field("app_code", (*ssov1.ValidateTokenRequest).GetAppCode,
+				validate.Required(msgAppCodeRequired),
+				validate.MaxLen(appCodeMaxLen, msgAppCodeTooLong),
+			),
+		),
+	}
+}
+
+// continuesLogin reports whether the Login call continues a login session, see serverAPI.Login.
+func continuesLogin(ctx context.Context) bool {
+	return firstValue(ctx, loginSessionKey) != ""
+}
+
+// AuthzPolicy returns the caller requirements of the Auth service methods.
+// Access management is restricted to admins, the rest of the methods are public.
+func AuthzPolicy() authz.Policy {
+	return authz.Policy{
+		ssov1.Auth_GrantAccess_FullMethodName:  authz.RequireAdmin,
+		ssov1.Auth_AllowAccess_FullMethodName:  authz.RequireAdmin,
+		ssov1.Auth_RevokeAccess_FullMethodName: authz.RequireAdmin,
+	}
+}
+
+// AdminMethods returns the Auth service methods served on the admin listener when it is enabled,
+// the public listener doesn't serve them then.
+func AdminMethods() surface.Methods {
+	return surface.Methods{
+		ssov1.Auth_GrantAccess_FullMethodName:  {},
+		ssov1.Auth_AllowAccess_FullMethodName:  {},
+		ssov1.Auth_RevokeAccess_FullMethodName: {},
+	}
+}
+
+// IdempotentMethods returns the Auth service methods whose responses are replayed for repeated idempotency keys.
+func IdempotentMethods() idempotency.Methods {
+	return idempotency.Methods{
+		ssov1.Auth_Register_FullMethodName:    func() proto.Message { return &ssov1.RegisterResponse{} },
+		ssov1.Auth_AllowAccess_FullMethodName: func() proto.Message { return &ssov1.AllowAccessResponse{} },
+		ssov1.Auth_GrantAccess_FullMethodName: func() proto.Message { return &ssov1.GrantAccessResponse{} },
+	}
+}
+
+// WriteMethods returns the Auth service methods that can't be served while the storage is read-only.
+// Validate stays available, Login is let through and fails only if it has to write.
+func WriteMethods() degradation.Methods {
+	return degradation.Methods{
+		ssov1.Auth_Register_FullMethodName:     {},
+		ssov1.Auth_GrantAccess_FullMethodName:  {},
+		ssov1.Auth_AllowAccess_FullMethodName:  {},
+		ssov1.Auth_RevokeAccess_FullMethodName: {},
+	}
+}
+
+// RateLimits are the per-subject call limits of the Auth service.
+type RateLimits struct {
+	Window        time.Duration
+	LoginPerEmail int64
+	LoginPerIP    int64
+	RegisterPerIP int64
+	// FailClosed rejects calls while Redis is unavailable instead of letting them through,
+	// it applies to the login lockout too.
+	FailClosed bool
+}
+
+// RateLimitRules returns rate limiting rules for the Auth service methods.
+func RateLimitRules(limits RateLimits) ratelimit.Rules {
+	return ratelimit.Rules{
+		ssov1.Auth_Login_FullMethodName: {
+			{
+				Name:   "login:email",
+				Limit:  limits.LoginPerEmail,
+				Window: limits.Window,
+				Key:    ratelimit.Field((*ssov1.LoginRequest).GetEmail),
+			},
+			{
+				Name:   "login:ip",
+				Limit:  limits.LoginPerIP,
+				Window: limits.Window,
+				Key:    ratelimit.PeerIP,
+			},
+		},
+		ssov1.Auth_Register_FullMethodName: {
+			{
+				Name:   "register:ip",
+				Limit:  limits.RegisterPerIP,
+				Window: limits.Window,
+				Key:    ratelimit.PeerIP,
+			},
+		},
+	}
+}
+
+// LockoutRules returns the lockout of logins after repeated failed Login calls.
+func LockoutRules() lockout.Rules {
+	return lockout.Rules{
+		ssov1.Auth_Login_FullMethodName: {
+			Name:          "login",
+			Subject:       ratelimit.Field((*ssov1.LoginRequest).GetEmail),
+			FailureReason: apierr.ReasonInvalidCredentials,
+		},
+	}
+}
+
+// CaptchaPolicy tells which Auth service methods require a CAPTCHA.
+type CaptchaPolicy struct {
+	Register bool
+	Login    bool
+	// LoginAfterFailures requires the CAPTCHA on Login only after that many failed attempts
+	// for the login within FailureWindow, 0 requires it always.
+	LoginAfterFailures int64
+	FailureWindow      time.Duration
+}
+
+// CaptchaRules returns CAPTCHA requirements for the Auth service methods.
+func CaptchaRules(policy CaptchaPolicy) captcha.Rules {
+	rules := captcha.Rules{}
+
+	if policy.Register {
+		rules[ssov1.Auth_Register_FullMethodName] = captcha.Rule{}
+	}
+
+	if policy.Login {
+		rules[ssov1.Auth_Login_FullMethodName] = captcha.Rule{
+			AfterFailures: policy.LoginAfterFailures,
+			FailureWindow: policy.FailureWindow,
+			Subject:       ratelimit.Field((*ssov1.LoginRequest).GetEmail),
+			FailureReason: apierr.ReasonInvalidCredentials,
+		}
+	}
+
+	return rules
+}
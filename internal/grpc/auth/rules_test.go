@@ -0,0 +1,22 @@
+package auth_test
+
+import (
+	"context"
+	authgrpc "sso/internal/grpc/auth"
+	"testing"
+
+	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidationRules_LoginSession(t *testing.T) {
+	validator := authgrpc.ValidationRules()[ssov1.Auth_Login_FullMethodName]
+
+	violations := validator(context.Background(), &ssov1.LoginRequest{})
+	require.Len(t, violations, 3)
+
+	// Продолжение сессии входа приходит без полей запроса
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-login-session", "session-token"))
+	require.Empty(t, validator(ctx, &ssov1.LoginRequest{}))
+}
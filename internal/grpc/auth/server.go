@@ -3,14 +3,23 @@ package auth
 import (
 	"context"
 	"errors"
+	"sso/internal/grpc/apierr"
+	"sso/internal/grpc/authz"
+	"sso/internal/grpc/reqctx"
+	"sso/internal/grpc/validate"
+	"sso/internal/lib/hasher"
 	"sso/internal/lib/jwt"
+	"sso/internal/services/access"
 	"sso/internal/services/auth"
 	"sso/internal/storage"
+	"time"
 
 	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
@@ -19,11 +28,14 @@ const (
 	msgAppIDRequired      = "app_id is required"
 	msgAppCodeRequired    = "app_code is required"
 	msgInvalidEmail       = "invalid email format"
+	msgInvalidLogin       = "invalid email, username or phone number format"
 	msgPasswordTooShort   = "password must be at least 8 characters"
+	msgPasswordTooLong    = "password must be at most 72 bytes"
+	msgAppCodeTooLong     = "app_code must be at most 64 characters"
+	msgPasswordTooWeak    = "password is too weak"
 	msgInvalidCredentials = "invalid email or password"
 	msgUserExists         = "user already exists"
 	msgLoginFailed        = "failed to login"
-	msgLogoutFailed       = "failed to logout"
 	msgRegisterFailed     = "failed to register user"
 	msgTokenRequired      = "Token is required"
 	msgTokenExpired       = "Token is expired"
@@ -31,22 +43,65 @@ const (
 	msgUserAppNotEnabled  = "Access denied"
 	msgUserNotFound       = "User not found"
 	msgAppNotFound        = "App not found"
+	msgTokenTooLarge      = "Token exceeds size limit"
+	msgChallengeRequired  = "Login requires additional steps"
+	msgChallengeFailed    = "Login step failed"
+	msgLoginSession       = "Login session is invalid or expired, log in again"
+	msgAppMaintenance     = "App is temporarily unavailable due to maintenance"
+	msgOverloaded         = "Service is overloaded, retry later"
+	msgUserBlocked        = "User is blocked"
+	msgTokenRevoked       = "Token is revoked"
+	msgPermissionDenied   = "Permission denied"
+	msgPolicyDenied       = "Access denied by policy"
+	msgAccessGranted      = "Access is already granted"
+	msgAccessNotGranted   = "Access is not granted"
+	msgAccessFailed       = "failed to change access"
+	msgEmailUndeliverable = "email domain does not accept mail"
+	msgDomainNotAllowed   = "Email domain is not allowed in the app"
+	msgTokenNotRevocable  = "Token can't be revoked, it expires on its own"
+	msgReadOnly           = "Service is read-only, retry later"
+)
+
+// termsVersionKey is the response header with the version of the terms of service the user has to accept.
+const termsVersionKey = "x-terms-version"
+
+// endsAtKey is the ErrorInfo metadata key with the RFC 3339 end time of a maintenance window.
+const endsAtKey = "ends_at"
+
+// The login of an app with additional steps: Login returns CHALLENGE_REQUIRED with the session
+// and the step in ErrorInfo metadata, the client repeats Login with the answer to the step in metadata.
+const (
+	// loginSessionInfoKey and nextStepInfoKey are the ErrorInfo metadata keys of CHALLENGE_REQUIRED.
+	loginSessionInfoKey = "login_session"
+	nextStepInfoKey     = "next_step"
+	// loginSessionKey, loginAnswerKey and rememberDeviceKey are the request metadata keys continuing the login.
+	loginSessionKey   = "x-login-session"
+	loginAnswerKey    = "x-login-answer"
+	rememberDeviceKey = "x-remember-device"
 )
 
 type serverAPI struct {
 	ssov1.UnimplementedAuthServer
-	auth Auth
+	auth   Auth
+	access Access
 }
 
 type Auth interface {
 	Login(
 		ctx context.Context,
-		email string,
+		login string,
 		password string,
 		appCode string,
-	) (token string, err error)
+	) (auth.LoginResult, error)
+	ContinueLogin(
+		ctx context.Context,
+		sessionToken string,
+		answer string,
+		rememberDevice bool,
+	) (auth.LoginResult, error)
 	Logout(
 		ctx context.Context,
+		token string,
 		email string,
 		appCode string,
 	) (isSuccess bool, err error)
@@ -62,117 +117,257 @@ type Auth interface {
 	) (email string, err error)
 }
 
-func Register(gRPCServer *grpc.Server, auth Auth) {
+// Access manages user access to apps, see services/access.
+type Access interface {
+	AllowAccess(ctx context.Context, email string, appCode string) error
+	RevokeAccess(ctx context.Context, email string, appCode string) error
+}
+
+func Register(gRPCServer *grpc.Server, auth Auth, access Access) {
 	ssov1.RegisterAuthServer(gRPCServer, &serverAPI{
-		auth: auth,
+		auth:   auth,
+		access: access,
 	})
 }
 
+// Login authenticates the user. With x-login-session metadata it continues the login session
+// returned in CHALLENGE_REQUIRED instead: x-login-answer carries the answer to its step.
 func (s *serverAPI) Login(ctx context.Context, in *ssov1.LoginRequest) (*ssov1.LoginResponse, error) {
-	if in.Email == "" {
-		return nil, status.Error(codes.InvalidArgument, msgEmailRequired)
+	var res auth.LoginResult
+	var err error
+	if session := firstValue(ctx, loginSessionKey); session != "" {
+		res, err = s.auth.ContinueLogin(ctx, session, firstValue(ctx, loginAnswerKey), firstValue(ctx, rememberDeviceKey) == "true")
+	} else {
+		res, err = s.auth.Login(ctx, in.Email, in.Password, in.GetAppCode())
 	}
+	if err != nil {
+		var challengeErr *auth.ChallengeRequiredError
+		if errors.As(err, &challengeErr) {
+			return nil, apierr.NewWithMetadata(ctx, codes.FailedPrecondition, apierr.ReasonChallengeRequired, msgChallengeRequired,
+				map[string]string{
+					loginSessionInfoKey: challengeErr.SessionToken,
+					nextStepInfoKey:     string(challengeErr.NextStep),
+				},
+			)
+		}
 
-	if in.Password == "" {
-		return nil, status.Error(codes.InvalidArgument, msgPasswordRequired)
-	}
+		if errors.Is(err, auth.ErrInvalidLoginSession) {
+			return nil, apierr.New(ctx, codes.FailedPrecondition, apierr.ReasonLoginSessionInvalid, msgLoginSession)
+		}
 
-	if in.GetAppCode() == "" {
-		return nil, status.Error(codes.InvalidArgument, msgAppCodeRequired)
-	}
+		if errors.Is(err, auth.ErrChallengeFailed) {
+			return nil, apierr.New(ctx, codes.InvalidArgument, apierr.ReasonChallengeFailed, msgChallengeFailed)
+		}
 
-	token, err := s.auth.Login(ctx, in.Email, in.Password, in.GetAppCode())
-	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
-			return nil, status.Error(codes.InvalidArgument, msgInvalidCredentials)
+			return nil, apierr.New(ctx, codes.InvalidArgument, apierr.ReasonInvalidCredentials, msgInvalidCredentials)
 		}
 
-		return nil, status.Error(codes.Internal, msgLoginFailed)
+		if errors.Is(err, auth.ErrUserBlocked) {
+			return nil, apierr.New(ctx, codes.PermissionDenied, apierr.ReasonUserBlocked, msgUserBlocked)
+		}
+
+		if errors.Is(err, auth.ErrEmailDomainNotAllowed) {
+			return nil, apierr.New(ctx, codes.PermissionDenied, apierr.ReasonDomainNotAllowed, msgDomainNotAllowed)
+		}
+
+		if errors.Is(err, auth.ErrPolicyDenied) {
+			return nil, apierr.New(ctx, codes.PermissionDenied, apierr.ReasonPermissionDenied, msgPolicyDenied)
+		}
+
+		if errors.Is(err, auth.ErrChallengeRequired) {
+			return nil, apierr.New(ctx, codes.FailedPrecondition, apierr.ReasonChallengeRequired, msgChallengeRequired)
+		}
+
+		if errors.Is(err, jwt.ErrTokenTooLarge) {
+			return nil, apierr.New(ctx, codes.FailedPrecondition, apierr.ReasonTokenTooLarge, msgTokenTooLarge)
+		}
+
+		if errors.Is(err, hasher.ErrBusy) {
+			return nil, apierr.New(ctx, codes.ResourceExhausted, apierr.ReasonOverloaded, msgOverloaded)
+		}
+
+		if errors.Is(err, storage.ErrReadOnly) {
+			return nil, apierr.New(ctx, codes.Unavailable, apierr.ReasonStorageReadOnly, msgReadOnly)
+		}
+
+		var maintenanceErr *auth.MaintenanceError
+		if errors.As(err, &maintenanceErr) {
+			return nil, apierr.NewWithMetadata(ctx, codes.Unavailable, apierr.ReasonAppMaintenance, msgAppMaintenance,
+				map[string]string{endsAtKey: maintenanceErr.EndsAt.UTC().Format(time.RFC3339)},
+				&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Until(maintenanceErr.EndsAt))},
+			)
+		}
+
+		return nil, apierr.New(ctx, codes.Internal, apierr.ReasonInternal, msgLoginFailed)
 	}
 
-	return &ssov1.LoginResponse{Token: token}, nil
-}
+	// Следующий шаг сессии входа возвращается так же, как первый
+	if res.Token == "" {
+		return nil, apierr.NewWithMetadata(ctx, codes.FailedPrecondition, apierr.ReasonChallengeRequired, msgChallengeRequired,
+			map[string]string{
+				loginSessionInfoKey: res.SessionToken,
+				nextStepInfoKey:     string(res.NextStep),
+			},
+		)
+	}
 
-func (s *serverAPI) Logout(ctx context.Context, in *ssov1.LogoutRequest) (*ssov1.LogoutResponse, error) {
-	if in.Email == "" {
-		return &ssov1.LogoutResponse{
-			Success: false,
-		}, status.Error(codes.InvalidArgument, msgEmailRequired)
+	if res.TermsVersion != "" {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(termsVersionKey, res.TermsVersion))
 	}
+	if res.DeviceToken != "" {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(reqctx.DeviceTokenKey, res.DeviceToken))
+	}
+
+	return &ssov1.LoginResponse{Token: res.Token}, nil
+}
 
-	if in.AppCode == "" {
-		return &ssov1.LogoutResponse{
-			Success: false,
-		}, status.Error(codes.InvalidArgument, msgAppCodeRequired)
+// Logout revokes the token passed as "authorization: Bearer <token>" metadata.
+func (s *serverAPI) Logout(ctx context.Context, in *ssov1.LogoutRequest) (*ssov1.LogoutResponse, error) {
+	token := authz.BearerToken(ctx)
+	if token == "" {
+		return nil, validate.Error(ctx, []validate.Violation{{Field: authz.AuthorizationKey, Description: msgTokenRequired}})
 	}
 
-	isSuccess, err := s.auth.Logout(ctx, in.Email, in.AppCode)
+	isSuccess, err := s.auth.Logout(ctx, token, in.GetEmail(), in.GetAppCode())
 	if err != nil {
-		if errors.Is(err, auth.ErrInvalidCredentials) {
-			return nil, status.Error(codes.InvalidArgument, msgUserNotFound)
+		if errors.Is(err, auth.ErrAppNotFound) {
+			return nil, apierr.New(ctx, codes.InvalidArgument, apierr.ReasonAppNotFound, msgAppNotFound)
 		}
 
-		if errors.Is(err, auth.ErrAppNotFound) {
-			return nil, status.Error(codes.InvalidArgument, msgAppNotFound)
+		if errors.Is(err, auth.ErrTokenNotRevocable) {
+			return nil, apierr.New(ctx, codes.FailedPrecondition, apierr.ReasonTokenInvalid, msgTokenNotRevocable)
 		}
 
-		return nil, status.Error(codes.Internal, msgLogoutFailed)
+		return nil, tokenError(ctx, err)
 	}
 
 	return &ssov1.LogoutResponse{Success: isSuccess}, nil
 }
 
 func (s *serverAPI) Register(ctx context.Context, in *ssov1.RegisterRequest) (*ssov1.RegisterResponse, error) {
-	if in.Email == "" {
-		return nil, status.Error(codes.InvalidArgument, msgEmailRequired)
-	}
+	uid, err := s.auth.RegisterNewUser(ctx, in.GetEmail(), in.GetPassword())
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, apierr.New(ctx, codes.AlreadyExists, apierr.ReasonUserExists, msgUserExists)
+		}
 
-	if in.Password == "" {
-		return nil, status.Error(codes.InvalidArgument, msgPasswordRequired)
-	}
+		if errors.Is(err, hasher.ErrBusy) {
+			return nil, apierr.New(ctx, codes.ResourceExhausted, apierr.ReasonOverloaded, msgOverloaded)
+		}
 
-	if len(in.Email) > 254 || len(in.Email) < 3 {
-		return nil, status.Error(codes.InvalidArgument, msgInvalidEmail)
-	}
+		if errors.Is(err, storage.ErrReadOnly) {
+			return nil, apierr.New(ctx, codes.Unavailable, apierr.ReasonStorageReadOnly, msgReadOnly)
+		}
 
-	if len(in.Password) < 8 {
-		return nil, status.Error(codes.InvalidArgument, msgPasswordTooShort)
-	}
+		if errors.Is(err, auth.ErrEmailUndeliverable) {
+			return nil, validate.Error(ctx, []validate.Violation{{Field: "email", Description: msgEmailUndeliverable}})
+		}
 
-	uid, err := s.auth.RegisterNewUser(ctx, in.GetEmail(), in.GetPassword())
-	if err != nil {
-		if errors.Is(err, storage.ErrUserExists) {
-			return nil, status.Error(codes.AlreadyExists, msgUserExists)
+		var weakErr *auth.WeakPasswordError
+		if errors.As(err, &weakErr) {
+			return nil, validate.Error(ctx, weakPasswordViolations(weakErr))
 		}
 
-		return nil, status.Error(codes.Internal, msgRegisterFailed)
+		return nil, apierr.New(ctx, codes.Internal, apierr.ReasonInternal, msgRegisterFailed)
 	}
 
 	return &ssov1.RegisterResponse{UserId: uid}, nil
 }
 
 func (s *serverAPI) Validate(ctx context.Context, in *ssov1.ValidateTokenRequest) (*ssov1.ValidateTokenResponse, error) {
-	if in.GetToken() == "" {
-		return nil, status.Error(codes.InvalidArgument, msgTokenRequired)
+	email, err := s.auth.ValidateToken(ctx, in.GetToken(), in.GetAppCode())
+	if err != nil {
+		return nil, tokenError(ctx, err)
 	}
 
-	if in.GetAppCode() == "" {
-		return nil, status.Error(codes.InvalidArgument, msgAppCodeRequired)
+	return &ssov1.ValidateTokenResponse{Email: email}, nil
+}
+
+// tokenError maps errors of token validation to gRPC status errors.
+func tokenError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return apierr.New(ctx, codes.Unauthenticated, apierr.ReasonTokenExpired, msgTokenExpired)
+	case errors.Is(err, auth.ErrUserAppNotEnabled):
+		return apierr.New(ctx, codes.Unauthenticated, apierr.ReasonAccessDisabled, msgUserAppNotEnabled)
+	case errors.Is(err, auth.ErrUserBlocked):
+		return apierr.New(ctx, codes.Unauthenticated, apierr.ReasonUserBlocked, msgUserBlocked)
+	case errors.Is(err, auth.ErrTokenRevoked):
+		return apierr.New(ctx, codes.Unauthenticated, apierr.ReasonTokenRevoked, msgTokenRevoked)
+	case errors.Is(err, auth.ErrPolicyDenied):
+		return apierr.New(ctx, codes.PermissionDenied, apierr.ReasonPermissionDenied, msgPolicyDenied)
+	default:
+		return apierr.New(ctx, codes.Unauthenticated, apierr.ReasonTokenInvalid, msgTokenInvalid)
 	}
+}
 
-	email, err := s.auth.ValidateToken(ctx, in.GetToken(), in.GetAppCode())
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, status.Error(codes.Unauthenticated, msgTokenExpired)
-		}
+func (s *serverAPI) AllowAccess(ctx context.Context, in *ssov1.AllowAccessRequest) (*ssov1.AllowAccessResponse, error) {
+	if err := s.access.AllowAccess(ctx, in.GetEmail(), in.GetAppCode()); err != nil {
+		return nil, accessError(ctx, err)
+	}
 
-		if errors.Is(err, auth.ErrUserAppNotEnabled) {
-			return nil, status.Error(codes.Unauthenticated, msgUserAppNotEnabled)
-		}
+	return &ssov1.AllowAccessResponse{AppCode: in.GetAppCode()}, nil
+}
 
-		return nil, status.Error(codes.Unauthenticated, msgTokenInvalid)
+// GrantAccess is the deprecated name of AllowAccess kept for old clients.
+func (s *serverAPI) GrantAccess(ctx context.Context, in *ssov1.GrantAccessRequest) (*ssov1.GrantAccessResponse, error) {
+	if err := s.access.AllowAccess(ctx, in.GetEmail(), in.GetAppCode()); err != nil {
+		return nil, accessError(ctx, err)
+	}
 
+	return &ssov1.GrantAccessResponse{AppCode: in.GetAppCode()}, nil
+}
+
+func (s *serverAPI) RevokeAccess(ctx context.Context, in *ssov1.RevokeAccessRequest) (*ssov1.RevokeAccessResponse, error) {
+	if err := s.access.RevokeAccess(ctx, in.GetEmail(), in.GetAppCode()); err != nil {
+		return nil, accessError(ctx, err)
 	}
 
-	return &ssov1.ValidateTokenResponse{Email: email}, nil
+	return &ssov1.RevokeAccessResponse{AppCode: in.GetAppCode()}, nil
+}
+
+// accessError maps errors of the access service to gRPC status errors.
+func accessError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, access.ErrPermissionDenied):
+		return apierr.New(ctx, codes.PermissionDenied, apierr.ReasonPermissionDenied, msgPermissionDenied)
+	case errors.Is(err, access.ErrUserNotFound):
+		return apierr.New(ctx, codes.NotFound, apierr.ReasonUserNotFound, msgUserNotFound)
+	case errors.Is(err, access.ErrAppNotFound):
+		return apierr.New(ctx, codes.NotFound, apierr.ReasonAppNotFound, msgAppNotFound)
+	case errors.Is(err, access.ErrAlreadyGranted):
+		return apierr.New(ctx, codes.AlreadyExists, apierr.ReasonAccessGranted, msgAccessGranted)
+	case errors.Is(err, access.ErrDomainNotAllowed):
+		return apierr.New(ctx, codes.PermissionDenied, apierr.ReasonDomainNotAllowed, msgDomainNotAllowed)
+	case errors.Is(err, access.ErrNotGranted):
+		return apierr.New(ctx, codes.FailedPrecondition, apierr.ReasonAccessNotGranted, msgAccessNotGranted)
+	case errors.Is(err, storage.ErrReadOnly):
+		return apierr.New(ctx, codes.Unavailable, apierr.ReasonStorageReadOnly, msgReadOnly)
+	default:
+		return apierr.New(ctx, codes.Internal, apierr.ReasonInternal, msgAccessFailed)
+	}
+}
+
+// weakPasswordViolations reports the warning and suggestions of a weak password as violations of the field.
+func weakPasswordViolations(err *auth.WeakPasswordError) []validate.Violation {
+	desc := msgPasswordTooWeak
+	if err.Warning != "" {
+		desc += ": " + err.Warning
+	}
+
+	violations := []validate.Violation{{Field: "password", Description: desc}}
+	for _, s := range err.Suggestions {
+		violations = append(violations, validate.Violation{Field: "password", Description: s})
+	}
+
+	return violations
+}
+
+func firstValue(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
 }
@@ -0,0 +1,193 @@
+package authz
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/grpc/apierr"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/principal"
+	"sso/internal/storage"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// AuthorizationKey carries an admin token as "Bearer <jwt>".
+	AuthorizationKey = "authorization"
+	// AppCodeKey and AppSecretKey authenticate a backend app by its secret.
+	AppCodeKey   = "x-app-code"
+	AppSecretKey = "x-app-secret"
+
+	bearerPrefix = "bearer "
+
+	msgUnauthenticated  = "Caller credentials are required"
+	msgPermissionDenied = "Permission denied"
+)
+
+var errUnauthenticated = errors.New("invalid caller credentials")
+
+// Requirement is what a method demands from the caller.
+type Requirement int
+
+const (
+	// RequireAdmin allows only callers listed as admins in the config.
+	RequireAdmin Requirement = iota + 1
+)
+
+// Policy maps a full gRPC method name to its requirement. Methods missing from the policy are public.
+type Policy map[string]Requirement
+
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string, appCode string) (email string, err error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appCode string) (models.App, error)
+}
+
+// Options lists who is an admin.
+type Options struct {
+	// AdminApp is the app admin tokens are issued for.
+	AdminApp string
+	// AdminEmails are users whose AdminApp tokens grant admin rights.
+	AdminEmails []string
+	// AdminApps are apps whose secret grants admin rights.
+	AdminApps []string
+}
+
+// Authenticator resolves the caller from request metadata.
+type Authenticator struct {
+	tokens TokenValidator
+	apps   AppProvider
+	opts   Options
+}
+
+func NewAuthenticator(tokens TokenValidator, apps AppProvider, opts Options) *Authenticator {
+	emails := make([]string, 0, len(opts.AdminEmails))
+	for _, email := range opts.AdminEmails {
+		emails = append(emails, strings.ToLower(strings.TrimSpace(email)))
+	}
+	opts.AdminEmails = emails
+
+	return &Authenticator{
+		tokens: tokens,
+		apps:   apps,
+		opts:   opts,
+	}
+}
+
+// Authenticate returns the caller identified by an admin token or an app secret.
+func (a *Authenticator) Authenticate(ctx context.Context) (principal.Principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if auth := first(md.Get(AuthorizationKey)); auth != "" {
+		token := bearer(auth)
+		if token == "" {
+			return principal.Principal{}, errUnauthenticated
+		}
+
+		return a.token(ctx, token)
+	}
+
+	if code := first(md.Get(AppCodeKey)); code != "" {
+		return a.app(ctx, code, first(md.Get(AppSecretKey)))
+	}
+
+	return principal.Principal{}, errUnauthenticated
+}
+
+func (a *Authenticator) token(ctx context.Context, token string) (principal.Principal, error) {
+	if a.opts.AdminApp == "" {
+		return principal.Principal{}, errUnauthenticated
+	}
+
+	email, err := a.tokens.ValidateToken(ctx, token, a.opts.AdminApp)
+	if err != nil {
+		return principal.Principal{}, errors.Join(errUnauthenticated, err)
+	}
+
+	return principal.Principal{
+		Subject: "user:" + email,
+		Admin:   slices.Contains(a.opts.AdminEmails, strings.ToLower(email)),
+	}, nil
+}
+
+func (a *Authenticator) app(ctx context.Context, code string, secret string) (principal.Principal, error) {
+	app, err := a.apps.App(ctx, code)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return principal.Principal{}, errUnauthenticated
+		}
+		return principal.Principal{}, err
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(app.Secret), []byte(secret)) != 1 {
+		return principal.Principal{}, errUnauthenticated
+	}
+
+	return principal.Principal{
+		Subject: "app:" + app.Code,
+		Admin:   slices.Contains(a.opts.AdminApps, app.Code),
+	}, nil
+}
+
+// UnaryServerInterceptor authenticates callers of methods listed in the policy and stores them in the context.
+func UnaryServerInterceptor(authn *Authenticator, policy Policy, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		const op = "grpc.authz"
+
+		requirement, ok := policy[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		log := log.With(slog.String("op", op), slog.String("method", info.FullMethod))
+
+		caller, err := authn.Authenticate(ctx)
+		if err != nil {
+			if !errors.Is(err, errUnauthenticated) {
+				log.ErrorContext(ctx, "failed to authenticate caller", sl.Err(err))
+				return nil, apierr.New(ctx, codes.Internal, apierr.ReasonInternal, "internal error")
+			}
+
+			log.WarnContext(ctx, "caller not authenticated", sl.Err(err))
+			return nil, apierr.New(ctx, codes.Unauthenticated, apierr.ReasonUnauthenticated, msgUnauthenticated)
+		}
+
+		if requirement == RequireAdmin && !caller.Admin {
+			log.WarnContext(ctx, "caller is not an admin", slog.String("caller", caller.Subject))
+			return nil, apierr.New(ctx, codes.PermissionDenied, apierr.ReasonPermissionDenied, msgPermissionDenied)
+		}
+
+		return handler(principal.NewContext(ctx, caller), req)
+	}
+}
+
+// BearerToken returns the token of the "authorization: Bearer <token>" metadata, "" if there is none.
+func BearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return bearer(first(md.Get(AuthorizationKey)))
+}
+
+func bearer(auth string) string {
+	if len(auth) <= len(bearerPrefix) || !strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+
+	return auth[len(bearerPrefix):]
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,153 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sso/internal/grpc/apierr"
+	"sso/internal/lib/captcha"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/reqctx"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// TokenKey is the metadata key with the CAPTCHA token solved by the client.
+	TokenKey = "x-captcha-token"
+
+	keyPrefix = "captcha:"
+
+	msgRequired    = "captcha is required"
+	msgInvalid     = "captcha is invalid"
+	msgUnavailable = "captcha verification is unavailable, retry later"
+)
+
+// FailureStore counts failed calls per subject.
+type FailureStore interface {
+	FailedAttempts(ctx context.Context, key string) (int64, error)
+	AddFailedAttempt(ctx context.Context, key string, window time.Duration) error
+	ResetFailedAttempts(ctx context.Context, key string) error
+}
+
+// Rule requires a CAPTCHA token for a method.
+type Rule struct {
+	// AfterFailures requires the token only once the subject has that many failed calls
+	// within FailureWindow, 0 requires it always.
+	AfterFailures int64
+	FailureWindow time.Duration
+	// Subject extracts the key failed calls are counted by, e.g. the login.
+	Subject func(ctx context.Context, req any) string
+	// FailureReason is the error reason counted as a failed call.
+	FailureReason apierr.Reason
+}
+
+// Rules maps a full gRPC method name to its CAPTCHA requirement.
+type Rules map[string]Rule
+
+// UnaryServerInterceptor verifies the CAPTCHA token of the calls the rules require it for.
+// A missing token is rejected with codes.FailedPrecondition and CAPTCHA_REQUIRED, so the client knows
+// to show the challenge. If the failure store is unavailable the token is not required,
+// if the provider is unavailable the call is rejected.
+func UnaryServerInterceptor(
+	verifier captcha.Verifier,
+	failures FailureStore,
+	rules Rules,
+	log *slog.Logger,
+) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		const op = "grpc.captcha"
+
+		rule, ok := rules[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		log := log.With(slog.String("op", op), slog.String("method", info.FullMethod))
+
+		var key string
+		if rule.AfterFailures > 0 {
+			if subject := rule.Subject(ctx, req); subject != "" {
+				key = keyPrefix + info.FullMethod + ":" + subject
+			}
+		}
+
+		if required(ctx, failures, rule, key, log) {
+			if err := verify(ctx, verifier, log); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := handler(ctx, req)
+
+		if key != "" {
+			countAttempt(ctx, failures, rule, key, err, log)
+		}
+
+		return resp, err
+	}
+}
+
+func required(ctx context.Context, failures FailureStore, rule Rule, key string, log *slog.Logger) bool {
+	if rule.AfterFailures == 0 {
+		return true
+	}
+
+	if key == "" {
+		return false
+	}
+
+	n, err := failures.FailedAttempts(ctx, key)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get failed attempts", sl.Err(err))
+		return false
+	}
+
+	return n >= rule.AfterFailures
+}
+
+func verify(ctx context.Context, verifier captcha.Verifier, log *slog.Logger) error {
+	token := first(metadata.ValueFromIncomingContext(ctx, TokenKey))
+	if token == "" {
+		return apierr.New(ctx, codes.FailedPrecondition, apierr.ReasonCaptchaRequired, msgRequired)
+	}
+
+	if err := verifier.Verify(ctx, token, reqctx.FromContext(ctx).IP); err != nil {
+		if errors.Is(err, captcha.ErrInvalid) {
+			log.WarnContext(ctx, "captcha rejected", sl.Err(err))
+			return apierr.New(ctx, codes.InvalidArgument, apierr.ReasonCaptchaInvalid, msgInvalid)
+		}
+
+		log.ErrorContext(ctx, "failed to verify captcha", sl.Err(err))
+		return apierr.New(ctx, codes.Unavailable, apierr.ReasonInternal, msgUnavailable)
+	}
+
+	return nil
+}
+
+// countAttempt counts the failed call, a successful one resets the counter.
+func countAttempt(ctx context.Context, failures FailureStore, rule Rule, key string, callErr error, log *slog.Logger) {
+	var err error
+	switch {
+	case callErr == nil:
+		err = failures.ResetFailedAttempts(ctx, key)
+	case apierr.ReasonOf(callErr) == rule.FailureReason:
+		err = failures.AddFailedAttempt(ctx, key, rule.FailureWindow)
+	default:
+		return
+	}
+
+	if err != nil {
+		log.ErrorContext(ctx, "failed to count attempt", sl.Err(err))
+	}
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
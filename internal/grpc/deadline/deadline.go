@@ -0,0 +1,24 @@
+package deadline
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor bounds every request by timeout so slow storage calls can't pin goroutines forever.
+// A shorter deadline sent by the client is kept. Zero timeout disables the interceptor.
+func UnaryServerInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+
+		// WithTimeout не продлевает дедлайн родителя, поэтому более короткий клиентский дедлайн сохраняется
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,32 @@
+package degradation
+
+import (
+	"context"
+	"sso/internal/grpc/apierr"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const msgReadOnly = "Service is read-only, retry later"
+
+// State tells whether the storage is read-only, see degradationapp.App.
+type State interface {
+	ReadOnly() bool
+}
+
+// Methods is the set of full gRPC method names writing to the storage.
+type Methods map[string]struct{}
+
+// UnaryServerInterceptor rejects the write methods with codes.Unavailable and STORAGE_READ_ONLY
+// while the storage is read-only, so they fail fast instead of on their first write.
+// Other methods are served as usual.
+func UnaryServerInterceptor(state State, writes Methods) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := writes[info.FullMethod]; ok && state.ReadOnly() {
+			return nil, apierr.New(ctx, codes.Unavailable, apierr.ReasonStorageReadOnly, msgReadOnly)
+		}
+
+		return handler(ctx, req)
+	}
+}
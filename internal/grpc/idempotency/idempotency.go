@@ -0,0 +1,184 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/grpc/apierr"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/principal"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// Key is the metadata key with the client-generated idempotency key.
+	Key = "idempotency-key"
+
+	maxKeyLen = 128
+	keyPrefix = "idempotency:"
+	anonymous = "anonymous"
+
+	msgKeyTooLong = "idempotency key is too long"
+	msgKeyReused  = "idempotency key was already used with another request"
+	msgInProgress = "request with this idempotency key is in progress, retry later"
+)
+
+// Store keeps records of idempotency keys for ttl.
+type Store interface {
+	// ReserveIdempotencyKey saves the record unless the key exists, otherwise returns the existing record and false.
+	ReserveIdempotencyKey(
+		ctx context.Context, key string, record models.IdempotencyRecord, ttl time.Duration,
+	) (models.IdempotencyRecord, bool, error)
+	SaveIdempotencyRecord(ctx context.Context, key string, record models.IdempotencyRecord, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+// Methods maps a full gRPC method name to the constructor of its response message.
+type Methods map[string]func() proto.Message
+
+// UnaryServerInterceptor makes calls of the methods carrying an idempotency key run once within ttl:
+// a repeated call with the same key and request returns the stored response of the first one.
+// Failed calls are not stored and can be retried with the same key. If the store is unavailable
+// the call is let through.
+func UnaryServerInterceptor(store Store, methods Methods, ttl time.Duration, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		const op = "grpc.idempotency"
+
+		newResponse, ok := methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		key := first(metadata.ValueFromIncomingContext(ctx, Key))
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		if len(key) > maxKeyLen {
+			return nil, apierr.New(ctx, codes.InvalidArgument, apierr.ReasonInvalidArgument, msgKeyTooLong)
+		}
+
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		log := log.With(slog.String("op", op), slog.String("method", info.FullMethod))
+
+		fingerprint, err := fingerprint(msg)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to fingerprint request", sl.Err(err))
+			return handler(ctx, req)
+		}
+
+		storeKey := storeKey(ctx, info.FullMethod, key)
+
+		record := models.IdempotencyRecord{Fingerprint: fingerprint}
+
+		existing, reserved, err := store.ReserveIdempotencyKey(ctx, storeKey, record, ttl)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to reserve idempotency key", sl.Err(err))
+			return handler(ctx, req)
+		}
+
+		if !reserved {
+			return replay(ctx, existing, fingerprint, newResponse, log)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			// Ошибки не сохраняются: клиент может повторить вызов с тем же ключом
+			if err := store.ReleaseIdempotencyKey(context.WithoutCancel(ctx), storeKey); err != nil {
+				log.ErrorContext(ctx, "failed to release idempotency key", sl.Err(err))
+			}
+			return nil, err
+		}
+
+		if err := save(ctx, store, storeKey, fingerprint, resp, ttl); err != nil {
+			log.ErrorContext(ctx, "failed to save idempotent response", sl.Err(err))
+		}
+
+		return resp, nil
+	}
+}
+
+func replay(
+	ctx context.Context,
+	existing models.IdempotencyRecord,
+	fingerprint string,
+	newResponse func() proto.Message,
+	log *slog.Logger,
+) (any, error) {
+	if existing.Fingerprint != fingerprint {
+		log.WarnContext(ctx, "idempotency key reused with another request")
+		return nil, apierr.New(ctx, codes.InvalidArgument, apierr.ReasonIdempotencyKeyReused, msgKeyReused)
+	}
+
+	if !existing.Done {
+		return nil, apierr.New(ctx, codes.Aborted, apierr.ReasonRequestInProgress, msgInProgress)
+	}
+
+	resp := newResponse()
+	if err := proto.Unmarshal(existing.Response, resp); err != nil {
+		log.ErrorContext(ctx, "failed to decode idempotent response", sl.Err(err))
+		return nil, apierr.New(ctx, codes.Internal, apierr.ReasonInternal, "internal error")
+	}
+
+	log.InfoContext(ctx, "idempotent response replayed")
+
+	return resp, nil
+}
+
+func save(ctx context.Context, store Store, key string, fingerprint string, resp any, ttl time.Duration) error {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return store.ReleaseIdempotencyKey(context.WithoutCancel(ctx), key)
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	record := models.IdempotencyRecord{Fingerprint: fingerprint, Done: true, Response: data}
+
+	return store.SaveIdempotencyRecord(context.WithoutCancel(ctx), key, record, ttl)
+}
+
+// storeKey scopes the idempotency key by the method and the authenticated caller, so the keys
+// of different admins or apps don't collide. Calls without a caller, such as Register, share one scope.
+func storeKey(ctx context.Context, method string, key string) string {
+	caller := anonymous
+	if p, ok := principal.FromContext(ctx); ok {
+		caller = p.Subject
+	}
+
+	// Кавычки отделяют вызывающего от ключа, даже если в них есть двоеточия
+	return keyPrefix + method + ":" + strconv.Quote(caller) + ":" + key
+}
+
+// fingerprint hashes the deterministic serialization of the request.
+func fingerprint(msg proto.Message) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,87 @@
+package idempotency_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/grpc/idempotency"
+	"sso/internal/lib/principal"
+	"sync"
+	"testing"
+	"time"
+
+	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func (s *memoryStore) ReserveIdempotencyKey(
+	_ context.Context, key string, record models.IdempotencyRecord, _ time.Duration,
+) (models.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok {
+		return existing, false, nil
+	}
+	s.records[key] = record
+
+	return record, true, nil
+}
+
+func (s *memoryStore) SaveIdempotencyRecord(
+	_ context.Context, key string, record models.IdempotencyRecord, _ time.Duration,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = record
+	return nil
+}
+
+func (s *memoryStore) ReleaseIdempotencyKey(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+func TestUnaryServerInterceptor_ScopedByCaller(t *testing.T) {
+	store := &memoryStore{records: map[string]models.IdempotencyRecord{}}
+	methods := idempotency.Methods{
+		ssov1.Auth_AllowAccess_FullMethodName: func() proto.Message { return &ssov1.AllowAccessResponse{} },
+	}
+	interceptor := idempotency.UnaryServerInterceptor(store, methods, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	info := &grpc.UnaryServerInfo{FullMethod: ssov1.Auth_AllowAccess_FullMethodName}
+	req := &ssov1.AllowAccessRequest{Email: "user@example.com", AppCode: "app"}
+
+	calls := 0
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return &ssov1.AllowAccessResponse{AppCode: "app"}, nil
+	}
+
+	call := func(subject string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(idempotency.Key, "key"))
+		ctx = principal.NewContext(ctx, principal.Principal{Subject: subject, Admin: true})
+		_, err := interceptor(ctx, req, info, handler)
+		return err
+	}
+
+	require.NoError(t, call("app:first"))
+	require.NoError(t, call("app:first"))
+	require.Equal(t, 1, calls)
+
+	// Тот же ключ другого вызывающего не получает чужой ответ
+	require.NoError(t, call("app:second"))
+	require.Equal(t, 2, calls)
+}
@@ -0,0 +1,150 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/grpc/apierr"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/ratelimit"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	keyPrefix = "lockout:"
+	// LockedUntilKey is the ErrorInfo metadata key with the end of the lockout in RFC 3339.
+	LockedUntilKey = "locked_until"
+
+	msgLocked      = "too many failed attempts, try again later"
+	msgUnavailable = "login lockout is unavailable, try again later"
+)
+
+// Rule locks out a subject of a method after repeated failed calls.
+type Rule struct {
+	// Name becomes a part of the Redis key, e.g. "login".
+	Name string
+	// Subject extracts the locked subject, e.g. the login, "" skips the rule.
+	Subject func(ctx context.Context, req any) string
+	// FailureReason is the error reason counted as a failed call.
+	FailureReason apierr.Reason
+}
+
+// Rules maps a full gRPC method name to its lockout rule.
+type Rules map[string]Rule
+
+// UnaryServerInterceptor rejects calls of locked subjects with codes.ResourceExhausted and LOCKED_OUT,
+// counts failed calls and resets the subject on success. If the lockout store is unavailable
+// the call is let through, or rejected with codes.Unavailable if failClosed.
+func UnaryServerInterceptor(lockout *ratelimit.Lockout, rules Rules, failClosed bool, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		const op = "grpc.lockout"
+
+		rule, ok := rules[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		subject := rule.Subject(ctx, req)
+		if subject == "" {
+			return handler(ctx, req)
+		}
+
+		log := log.With(slog.String("op", op), slog.String("method", info.FullMethod))
+		key := keyPrefix + rule.Name + ":" + subject
+
+		lockedFor, err := lockout.Locked(ctx, key)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to check lockout", sl.Err(err))
+			if failClosed {
+				return nil, apierr.New(ctx, codes.Unavailable, apierr.ReasonUnavailable, msgUnavailable)
+			}
+		} else if lockedFor > 0 {
+			log.WarnContext(ctx, "call of locked out subject rejected", slog.Duration("locked_for", lockedFor))
+			return nil, lockedError(ctx, lockedFor)
+		}
+
+		resp, err := handler(ctx, req)
+
+		switch {
+		case err == nil:
+			if resetErr := lockout.Reset(ctx, key); resetErr != nil {
+				log.ErrorContext(ctx, "failed to reset lockout", sl.Err(resetErr))
+			}
+		case apierr.ReasonOf(err) == rule.FailureReason:
+			lockedFor, failErr := lockout.Fail(ctx, key)
+			if failErr != nil {
+				log.ErrorContext(ctx, "failed to count failure", sl.Err(failErr))
+			} else if lockedFor > 0 {
+				log.WarnContext(ctx, "subject locked out", slog.Duration("locked_for", lockedFor))
+			}
+		}
+
+		return resp, err
+	}
+}
+
+func lockedError(ctx context.Context, lockedFor time.Duration) error {
+	return apierr.NewWithMetadata(ctx, codes.ResourceExhausted, apierr.ReasonLockedOut, msgLocked,
+		map[string]string{LockedUntilKey: time.Now().Add(lockedFor).UTC().Format(time.RFC3339)},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(lockedFor)},
+	)
+}
+
+// Inspector shows and resets the lockouts of a subject in all rules, so support can unblock
+// a legitimate user without touching Redis.
+type Inspector struct {
+	lockout *ratelimit.Lockout
+	names   []string
+}
+
+func NewInspector(lockout *ratelimit.Lockout, rules Rules) *Inspector {
+	i := &Inspector{lockout: lockout}
+	for _, rule := range rules {
+		if !slices.Contains(i.names, rule.Name) {
+			i.names = append(i.names, rule.Name)
+		}
+	}
+	slices.Sort(i.names)
+
+	return i
+}
+
+// Counters returns the lockout state of the subject in the rules with failures or a lockout in effect.
+func (i *Inspector) Counters(ctx context.Context, subject string) ([]ratelimit.Counter, error) {
+	const op = "grpc.lockout.Inspector.Counters"
+
+	var counters []ratelimit.Counter
+	for _, name := range i.names {
+		counter, err := i.lockout.Counter(ctx, keyPrefix+name+":"+subject, "lockout:"+name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if counter.Count == 0 && counter.LockedFor == 0 {
+			continue
+		}
+
+		counters = append(counters, counter)
+	}
+
+	return counters, nil
+}
+
+// Reset lifts the lockouts of the subject and forgets its failures in all rules.
+func (i *Inspector) Reset(ctx context.Context, subject string) error {
+	const op = "grpc.lockout.Inspector.Reset"
+
+	for _, name := range i.names {
+		if err := i.lockout.Reset(ctx, keyPrefix+name+":"+subject); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
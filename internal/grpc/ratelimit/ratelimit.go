@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/grpc/apierr"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/ratelimit"
+	"sso/internal/lib/reqctx"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	keyPrefix          = "rate:"
+	msgTooManyRequests = "too many requests, try again later"
+	msgUnavailable     = "rate limiter is unavailable, try again later"
+)
+
+// KeyFunc extracts the limited subject (email, IP...) from the request, "" skips the rule.
+type KeyFunc func(ctx context.Context, req any) string
+
+// Rule limits the number of calls per subject within a window.
+type Rule struct {
+	// Name becomes a part of the Redis key, e.g. "login:email".
+	Name   string
+	Limit  int64
+	Window time.Duration
+	Key    KeyFunc
+}
+
+// Rules maps a full gRPC method name to its limits.
+type Rules map[string][]Rule
+
+// Field returns a KeyFunc reading a string field of the request message T, case-insensitively.
+func Field[T any](get func(T) string) KeyFunc {
+	return func(_ context.Context, req any) string {
+		msg, ok := req.(T)
+		if !ok {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(get(msg)))
+	}
+}
+
+// PeerIP is a KeyFunc returning the IP address of the caller, see reqctx.Info.IP.
+func PeerIP(ctx context.Context, _ any) string {
+	return reqctx.FromContext(ctx).IP
+}
+
+// UnaryServerInterceptor rejects calls exceeding the rules with codes.ResourceExhausted.
+// If the limiter is unavailable the call is let through, or rejected with codes.Unavailable if failClosed.
+func UnaryServerInterceptor(limiter *ratelimit.Limiter, rules Rules, failClosed bool, log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		const op = "grpc.ratelimit"
+
+		for _, rule := range rules[info.FullMethod] {
+			subject := rule.Key(ctx, req)
+			if subject == "" {
+				continue
+			}
+
+			res, err := limiter.Allow(ctx, keyPrefix+rule.Name+":"+subject, rule.Limit, rule.Window)
+			if err != nil {
+				log.With(slog.String("op", op)).ErrorContext(ctx, "failed to check rate limit",
+					slog.String("rule", rule.Name),
+					sl.Err(err),
+				)
+				if failClosed {
+					return nil, apierr.New(ctx, codes.Unavailable, apierr.ReasonUnavailable, msgUnavailable)
+				}
+				continue
+			}
+
+			if !res.Allowed {
+				log.With(slog.String("op", op)).WarnContext(ctx, "rate limit exceeded",
+					slog.String("method", info.FullMethod),
+					slog.String("rule", rule.Name),
+					slog.Int64("count", res.Count),
+				)
+
+				return nil, apierr.New(ctx, codes.ResourceExhausted, apierr.ReasonRateLimited, msgTooManyRequests,
+					&errdetails.RetryInfo{RetryDelay: durationpb.New(res.RetryAfter)},
+				)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Inspector shows and resets the counters of a subject in all rules, so support can unblock
+// a legitimate user without touching Redis.
+type Inspector struct {
+	limiter *ratelimit.Limiter
+	rules   []Rule
+}
+
+func NewInspector(limiter *ratelimit.Limiter, rules Rules) *Inspector {
+	byName := make(map[string]Rule)
+	for _, methodRules := range rules {
+		for _, rule := range methodRules {
+			byName[rule.Name] = rule
+		}
+	}
+
+	i := &Inspector{limiter: limiter}
+	for _, rule := range byName {
+		i.rules = append(i.rules, rule)
+	}
+	slices.SortFunc(i.rules, func(a, b Rule) int { return strings.Compare(a.Name, b.Name) })
+
+	return i
+}
+
+// Counters returns the counters of the subject with hits in the current window.
+func (i *Inspector) Counters(ctx context.Context, subject string) ([]ratelimit.Counter, error) {
+	const op = "grpc.ratelimit.Inspector.Counters"
+
+	var counters []ratelimit.Counter
+	for _, rule := range i.rules {
+		res, err := i.limiter.Count(ctx, keyPrefix+rule.Name+":"+subject, rule.Window)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if res.Count == 0 {
+			continue
+		}
+
+		counters = append(counters, ratelimit.Counter{
+			Rule:    rule.Name,
+			Count:   res.Count,
+			Limit:   rule.Limit,
+			ResetIn: res.RetryAfter,
+		})
+	}
+
+	return counters, nil
+}
+
+// Reset resets the counters of the subject in all rules.
+func (i *Inspector) Reset(ctx context.Context, subject string) error {
+	const op = "grpc.ratelimit.Inspector.Reset"
+
+	for _, rule := range i.rules {
+		if err := i.limiter.Reset(ctx, keyPrefix+rule.Name+":"+subject, rule.Window); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package reqctx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sso/internal/lib/reqctx"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// DeviceIDKey is the metadata key of the client-provided device identifier.
+	DeviceIDKey = "x-device-id"
+	// DeviceTokenKey is the metadata key of the token of a remembered device.
+	DeviceTokenKey = "x-device-token"
+	// ForwardedForKey lists the client and the proxies a request passed through, the closest one last.
+	ForwardedForKey = "x-forwarded-for"
+	userAgentKey    = "user-agent"
+)
+
+// maxHeaderLen bounds captured header values so they can't bloat logs and audit events.
+const maxHeaderLen = 256
+
+// Options configures what is captured about the caller.
+type Options struct {
+	// Headers are the custom metadata keys to capture, e.g. x-app-version.
+	Headers []string
+	// TrustedProxies are the networks of proxies whose x-forwarded-for is believed.
+	// Without them the peer address is the client address.
+	TrustedProxies []netip.Prefix
+}
+
+// ParseProxies parses the trusted proxies, given as CIDRs or single addresses.
+func ParseProxies(values []string) ([]netip.Prefix, error) {
+	const op = "grpc.reqctx.ParseProxies"
+
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// UnaryServerInterceptor stores the caller of the request in the context, see reqctx.Info.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	headers := make([]string, 0, len(opts.Headers))
+	for _, h := range opts.Headers {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			headers = append(headers, h)
+		}
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(reqctx.NewContext(ctx, fromContext(ctx, headers, opts.TrustedProxies)), req)
+	}
+}
+
+func fromContext(ctx context.Context, headers []string, proxies []netip.Prefix) reqctx.Info {
+	var info reqctx.Info
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	info.DeviceID = first(md.Get(DeviceIDKey))
+	info.DeviceToken = first(md.Get(DeviceTokenKey))
+	info.UserAgent = first(md.Get(userAgentKey))
+
+	for _, h := range headers {
+		v := first(md.Get(h))
+		if v == "" || len(v) > maxHeaderLen {
+			continue
+		}
+		if info.Headers == nil {
+			info.Headers = make(map[string]string, len(headers))
+		}
+		info.Headers[h] = v
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		info.IP = clientIP(host, md.Get(ForwardedForKey), proxies)
+	}
+
+	return info
+}
+
+// clientIP returns the client address of a request from peer. If the peer is a trusted proxy,
+// it is the last address of x-forwarded-for not belonging to a trusted proxy:
+// the addresses before it are set by the client and can be forged.
+func clientIP(peerIP string, forwarded []string, proxies []netip.Prefix) string {
+	if !trusted(peerIP, proxies) {
+		return peerIP
+	}
+
+	// Заголовок может прийти несколькими значениями, каждое — списком через запятую
+	var hops []string
+	for _, v := range forwarded {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	client := peerIP
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// Мусор в цепочке: дальше ей верить нельзя
+			break
+		}
+
+		client = hop
+		if !trusted(hop, proxies) {
+			break
+		}
+	}
+
+	return client
+}
+
+func trusted(ip string, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
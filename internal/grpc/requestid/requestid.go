@@ -0,0 +1,56 @@
+package requestid
+
+import (
+	"context"
+	"sso/internal/lib/requestid"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey is the request and response header carrying the request ID.
+const MetadataKey = "x-request-id"
+
+// maxLen bounds client-provided IDs so they can't bloat logs and error details.
+const maxLen = 128
+
+// UnaryServerInterceptor takes the request ID from the x-request-id header or generates a new one,
+// stores it in the context and returns it to the client in the response header.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id := fromIncoming(ctx)
+		if id == "" {
+			id = requestid.New()
+		}
+
+		ctx = requestid.NewContext(ctx, id)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, id))
+
+		return handler(ctx, req)
+	}
+}
+
+func fromIncoming(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+
+	id := values[0]
+	if len(id) > maxLen {
+		return ""
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return ""
+		}
+	}
+
+	return id
+}
@@ -0,0 +1,40 @@
+package surface
+
+import (
+	"context"
+	"sso/internal/grpc/apierr"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const msgUnimplemented = "Method is not served on this listener"
+
+// Methods is a set of full gRPC method names.
+type Methods map[string]struct{}
+
+// Only serves just the methods, the rest are rejected as if the server didn't implement them.
+func Only(methods Methods) grpc.UnaryServerInterceptor {
+	return filter(func(method string) bool {
+		_, ok := methods[method]
+		return ok
+	})
+}
+
+// Except rejects the methods as if the server didn't implement them, the rest are served.
+func Except(methods Methods) grpc.UnaryServerInterceptor {
+	return filter(func(method string) bool {
+		_, ok := methods[method]
+		return !ok
+	})
+}
+
+func filter(serves func(method string) bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !serves(info.FullMethod) {
+			return nil, apierr.New(ctx, codes.Unimplemented, apierr.ReasonUnimplemented, msgUnimplemented)
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,173 @@
+package validate
+
+import (
+	"context"
+	"sso/internal/grpc/apierr"
+	"sso/internal/lib/identifier"
+	libvalidate "sso/internal/lib/validate"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Violation describes a single invalid request field.
+type Violation struct {
+	Field       string
+	Description string
+}
+
+// Rule checks a field value and returns a description of the problem, or "" if the value is valid.
+type Rule func(value string) string
+
+// Validator returns all field violations found in the request.
+type Validator func(ctx context.Context, req any) []Violation
+
+// Rules maps a full gRPC method name to the validator of its request.
+type Rules map[string]Validator
+
+// FieldRules binds a set of rules to a string field of the request message T.
+type FieldRules[T any] struct {
+	name  string
+	get   func(T) string
+	rules []Rule
+}
+
+// Field declares rules for the field with the given name, read by get.
+func Field[T any](name string, get func(T) string, rules ...Rule) FieldRules[T] {
+	return FieldRules[T]{name: name, get: get, rules: rules}
+}
+
+// Message builds a validator for the request message T from its field rules.
+// Rules of a field are checked in order, only the first failed rule of each field is reported.
+func Message[T any](fields ...FieldRules[T]) Validator {
+	return func(_ context.Context, req any) []Violation {
+		msg, ok := req.(T)
+		if !ok {
+			return nil
+		}
+
+		var violations []Violation
+		for _, f := range fields {
+			value := f.get(msg)
+			for _, rule := range f.rules {
+				if desc := rule(value); desc != "" {
+					violations = append(violations, Violation{Field: f.name, Description: desc})
+					break
+				}
+			}
+		}
+
+		return violations
+	}
+}
+
+// Unless skips the validator for requests whose context satisfies skip.
+func Unless(skip func(ctx context.Context) bool, v Validator) Validator {
+	return func(ctx context.Context, req any) []Violation {
+		if skip(ctx) {
+			return nil
+		}
+		return v(ctx, req)
+	}
+}
+
+// Required fails on an empty value.
+func Required(desc string) Rule {
+	return func(value string) string {
+		if value == "" {
+			return desc
+		}
+		return ""
+	}
+}
+
+// MinLen fails when the value is shorter than n bytes.
+func MinLen(n int, desc string) Rule {
+	return func(value string) string {
+		if len(value) < n {
+			return desc
+		}
+		return ""
+	}
+}
+
+// MaxLen fails when the value is longer than n bytes.
+func MaxLen(n int, desc string) Rule {
+	return func(value string) string {
+		if len(value) > n {
+			return desc
+		}
+		return ""
+	}
+}
+
+// Email fails when the value, ignoring surrounding spaces, is not a valid email address.
+func Email(desc string) Rule {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+		if err := libvalidate.Email(strings.TrimSpace(value)); err != nil {
+			return desc
+		}
+		return ""
+	}
+}
+
+// Login fails when the value is neither a valid email address, nor a username, nor a phone number.
+func Login(desc string) Rule {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+
+		var err error
+		switch id := identifier.Detect(value); id.Kind {
+		case identifier.Email:
+			err = libvalidate.Email(id.Value)
+		case identifier.Username:
+			_, err = identifier.NormalizeUsername(id.Value)
+		case identifier.Phone:
+			_, err = identifier.NormalizePhone(id.Value)
+		}
+
+		if err != nil {
+			return desc
+		}
+		return ""
+	}
+}
+
+// UnaryServerInterceptor rejects requests that violate the rules with codes.InvalidArgument.
+// Methods without rules are passed through unchanged.
+func UnaryServerInterceptor(rules Rules) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		validator, ok := rules[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if violations := validator(ctx, req); len(violations) > 0 {
+			return nil, Error(ctx, violations)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Error converts violations to an InvalidArgument status with BadRequest field details.
+func Error(ctx context.Context, violations []Violation) error {
+	descs := make([]string, 0, len(violations))
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range violations {
+		descs = append(descs, v.Description)
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	return apierr.New(ctx, codes.InvalidArgument, apierr.ReasonInvalidArgument, strings.Join(descs, "; "), badRequest)
+}
@@ -0,0 +1,167 @@
+// Package jobs runs periodic maintenance tasks on cron schedules.
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/lib/cron"
+	"sso/internal/lib/logger/sl"
+	"sync"
+	"time"
+)
+
+// Job is a task run on a schedule. Runs of a job don't overlap: a run that outlasts the interval
+// delays the next one.
+type Job struct {
+	Name     string
+	Schedule cron.Schedule
+	Run      func(ctx context.Context) error
+}
+
+// Stats are the metrics of a job, published by the debug server as expvar "jobs".
+type Stats struct {
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
+}
+
+// Scheduler runs jobs until Stop is called.
+type Scheduler struct {
+	log  *slog.Logger
+	jobs []Job
+	stop chan struct{}
+	done chan struct{}
+
+	mu    sync.Mutex
+	stats map[string]Stats
+}
+
+func New(log *slog.Logger, jobs []Job) *Scheduler {
+	stats := make(map[string]Stats, len(jobs))
+	for _, job := range jobs {
+		stats[job.Name] = Stats{}
+	}
+
+	return &Scheduler{
+		log:   log,
+		jobs:  jobs,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		stats: stats,
+	}
+}
+
+// Run runs every job on its schedule until Stop is called.
+func (s *Scheduler) Run() {
+	const op = "jobs.Run"
+
+	defer close(s.done)
+
+	log := s.log.With(slog.String("op", op))
+	log.Info("job scheduler started", slog.Int("jobs", len(s.jobs)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+// Stop stops the scheduler and waits for the running jobs to finish.
+func (s *Scheduler) Stop() {
+	const op = "jobs.Stop"
+
+	if s == nil {
+		return
+	}
+
+	s.log.With(slog.String("op", op)).Info("stopping job scheduler")
+
+	close(s.stop)
+	<-s.done
+}
+
+// Stats returns the metrics of the jobs by name.
+func (s *Scheduler) Stats() map[string]Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]Stats, len(s.stats))
+	for name, st := range s.stats {
+		stats[name] = st
+	}
+
+	return stats
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	log := s.log.With(slog.String("op", "jobs.loop"), slog.String("job", job.Name))
+
+	for {
+		next := job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Warn("job schedule has no next run, job stopped")
+			return
+		}
+		s.update(job.Name, func(st *Stats) { st.NextRun = next })
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		start := time.Now()
+		err := job.Run(ctx)
+		duration := time.Since(start)
+
+		// Остановка прерывает задачу, это не сбой
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+
+		s.update(job.Name, func(st *Stats) {
+			st.Runs++
+			st.LastRun = start
+			st.LastDuration = duration
+			st.LastError = ""
+			if err != nil {
+				st.Failures++
+				st.LastError = err.Error()
+			}
+		})
+
+		if err != nil {
+			log.Error("job failed", slog.Duration("duration", duration), sl.Err(err))
+			continue
+		}
+
+		log.Info("job finished", slog.Duration("duration", duration))
+	}
+}
+
+func (s *Scheduler) update(name string, fn func(st *Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stats[name]
+	fn(&st)
+	s.stats[name] = st
+}
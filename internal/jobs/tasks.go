@@ -0,0 +1,128 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Anonymizer erases personal data of accounts deleted more than retention ago.
+type Anonymizer interface {
+	AnonymizeDeleted(ctx context.Context, retention time.Duration, batch int) (int, error)
+}
+
+// InviteCleaner deletes invites expired more than retention ago.
+type InviteCleaner interface {
+	DeleteExpiredInvites(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// ExpiredDeleter deletes sessions and one-time token records that expired before the time.
+type ExpiredDeleter interface {
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// LoginHistoryCleaner deletes logins made before the time.
+type LoginHistoryCleaner interface {
+	DeleteLoginHistoryBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Vacuumer compacts the database.
+type Vacuumer interface {
+	Vacuum(ctx context.Context) error
+}
+
+// BackupCreator writes a database snapshot.
+type BackupCreator interface {
+	Create(ctx context.Context) (string, error)
+}
+
+// FieldRotator re-encrypts column values not encrypted with the current field key.
+type FieldRotator interface {
+	RotateFieldKeys(ctx context.Context, limit int) (int, error)
+}
+
+// PurgeExpired deletes expired sessions, one-time token records and revoked tokens,
+// and invites expired more than inviteRetention ago.
+func PurgeExpired(log *slog.Logger, expired ExpiredDeleter, invites InviteCleaner, inviteRetention time.Duration) func(ctx context.Context) error {
+	log = log.With(slog.String("op", "jobs.PurgeExpired"))
+
+	return func(ctx context.Context) error {
+		deleted, err := expired.DeleteExpired(ctx, time.Now())
+		if deleted > 0 {
+			log.Info("expired sessions and tokens deleted", slog.Int64("count", deleted))
+		}
+
+		// Приглашения удаляются, даже если очистка токенов не удалась
+		_, invitesErr := invites.DeleteExpiredInvites(ctx, inviteRetention)
+
+		return errors.Join(err, invitesErr)
+	}
+}
+
+// PurgeLoginHistory deletes logins older than retention.
+func PurgeLoginHistory(log *slog.Logger, c LoginHistoryCleaner, retention time.Duration) func(ctx context.Context) error {
+	log = log.With(slog.String("op", "jobs.PurgeLoginHistory"))
+
+	return func(ctx context.Context) error {
+		deleted, err := c.DeleteLoginHistoryBefore(ctx, time.Now().Add(-retention))
+		if deleted > 0 {
+			log.Info("old logins deleted", slog.Int64("count", deleted))
+		}
+
+		return err
+	}
+}
+
+// AnonymizeDeleted anonymizes accounts deleted more than retention ago in batches until none are left.
+func AnonymizeDeleted(anonymizer Anonymizer, retention time.Duration, batch int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for {
+			n, err := anonymizer.AnonymizeDeleted(ctx, retention, batch)
+			if err != nil {
+				return err
+			}
+			if n < batch {
+				return nil
+			}
+		}
+	}
+}
+
+// Vacuum compacts the database.
+func Vacuum(v Vacuumer) func(ctx context.Context) error {
+	return v.Vacuum
+}
+
+// Backup writes a database snapshot.
+func Backup(b BackupCreator) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := b.Create(ctx)
+		return err
+	}
+}
+
+// RotateFieldKeys re-encrypts column values with the current field key in batches until none are left.
+func RotateFieldKeys(log *slog.Logger, r FieldRotator, batch int) func(ctx context.Context) error {
+	log = log.With(slog.String("op", "jobs.RotateFieldKeys"))
+
+	return func(ctx context.Context) error {
+		total := 0
+		defer func() {
+			if total > 0 {
+				log.Info("column values re-encrypted", slog.Int("count", total))
+			}
+		}()
+
+		for {
+			n, err := r.RotateFieldKeys(ctx, batch)
+			total += n
+			if err != nil {
+				return err
+			}
+			if n < batch {
+				return nil
+			}
+		}
+	}
+}
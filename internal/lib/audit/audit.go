@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/lib/reqctx"
+	"sso/internal/lib/requestid"
+)
+
+const (
+	ActionAccessGranted = "access.granted"
+	ActionAccessRevoked = "access.revoked"
+	ActionPolicyAllowed = "policy.allowed"
+	ActionPolicyDenied  = "policy.denied"
+
+	ActionRecoveryEmailSet    = "recovery.email_set"
+	ActionRecoveryCodesIssued = "recovery.codes_issued"
+	ActionRecoveryStarted     = "recovery.started"
+	ActionRecoveryCompleted   = "recovery.completed"
+	ActionRecoveryFailed      = "recovery.failed"
+)
+
+// Event describes a security-relevant change made by a caller.
+type Event struct {
+	Action  string
+	Actor   string
+	Email   string
+	AppCode string
+	// Detail optionally qualifies the action, e.g. the requested action of a policy decision.
+	Detail string
+}
+
+// Logger writes audit events to a dedicated slog logger.
+type Logger struct {
+	log *slog.Logger
+}
+
+func NewLogger(log *slog.Logger) *Logger {
+	return &Logger{log: log.With(slog.String("component", "audit"))}
+}
+
+// Audit records the event. It never fails, so callers don't have to roll back the change.
+func (l *Logger) Audit(ctx context.Context, e Event) {
+	attrs := []any{
+		slog.String("action", e.Action),
+		slog.String("actor", e.Actor),
+		slog.String("email", e.Email),
+		slog.String("app_code", e.AppCode),
+	}
+
+	if e.Detail != "" {
+		attrs = append(attrs, slog.String("detail", e.Detail))
+	}
+
+	if id, ok := requestid.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+
+	// Вне запроса (фоновые задачи, CLI) вызывающего нет
+	caller := reqctx.FromContext(ctx)
+	if caller.IP != "" || caller.UserAgent != "" {
+		attrs = append(attrs, slog.String("ip", caller.IP), slog.String("user_agent", caller.UserAgent))
+	}
+	if len(caller.Headers) > 0 {
+		attrs = append(attrs, slog.Any("headers", caller.Headers))
+	}
+
+	l.log.InfoContext(ctx, "audit event", attrs...)
+}
@@ -0,0 +1,122 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxResponseSize bounds the siteverify response read from the provider.
+const maxResponseSize = 64 << 10
+
+const (
+	ProviderRecaptcha = "recaptcha"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+)
+
+// Все провайдеры реализуют один и тот же протокол siteverify
+var verifyURLs = map[string]string{
+	ProviderRecaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+var (
+	// ErrInvalid is returned when the provider rejects the token: it is expired, reused or forged,
+	// or the score is too low.
+	ErrInvalid         = errors.New("captcha token is invalid")
+	ErrUnknownProvider = errors.New("unknown captcha provider")
+)
+
+// Verifier checks a CAPTCHA token solved by the client.
+type Verifier interface {
+	Verify(ctx context.Context, token string, remoteIP string) error
+}
+
+// Options configures the verifier of a provider.
+type Options struct {
+	Secret string
+	// MinScore rejects tokens scored lower, for providers returning a score (reCAPTCHA v3, hCaptcha Enterprise).
+	MinScore float64
+	Timeout  time.Duration
+}
+
+type siteVerifier struct {
+	url      string
+	secret   string
+	minScore float64
+	client   *http.Client
+}
+
+// New returns the verifier of the provider: recaptcha, hcaptcha or turnstile.
+func New(provider string, opts Options) (Verifier, error) {
+	verifyURL, ok := verifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, provider)
+	}
+
+	return &siteVerifier{
+		url:      verifyURL,
+		secret:   opts.Secret,
+		minScore: opts.MinScore,
+		client:   &http.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+type verifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify sends the token to the siteverify endpoint of the provider.
+// ErrInvalid means the token is rejected, other errors mean the provider is unavailable.
+func (v *siteVerifier) Verify(ctx context.Context, token string, remoteIP string) error {
+	const op = "captcha.Verify"
+
+	form := url.Values{
+		"secret":   {v.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	var res verifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&res); err != nil {
+		return fmt.Errorf("%s: failed to decode response: %w", op, err)
+	}
+
+	if !res.Success {
+		return fmt.Errorf("%s: %w: %s", op, ErrInvalid, strings.Join(res.ErrorCodes, ","))
+	}
+
+	if res.Score != nil && *res.Score < v.minScore {
+		return fmt.Errorf("%s: %w: score %.2f is below %.2f", op, ErrInvalid, *res.Score, v.minScore)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package cron parses schedules in the five-field cron format "minute hour day-of-month month day-of-week"
+// and the descriptors @hourly, @daily, @weekly, @monthly, @yearly and @every <duration>.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next activation time after t.
+type Schedule interface {
+	// Next returns the first activation strictly after t, zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression, fields are numbers with "*", lists "1,15", ranges "1-5" and steps "*/10".
+// Days of week are 0-7, both 0 and 7 are Sunday. As in Vixie cron, if both days of month and days of week
+// are restricted, a day matching either of them matches.
+func Parse(expr string) (Schedule, error) {
+	const op = "cron.Parse"
+
+	expr = strings.TrimSpace(expr)
+
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("%s: interval %s is shorter than a second", op, every)
+		}
+		return interval(every), nil
+	}
+
+	if spec, ok := descriptors[expr]; ok {
+		expr = spec
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%s: expected 5 fields, got %d in %q", op, len(fields), expr)
+	}
+
+	var s spec
+	var err error
+	parsers := []struct {
+		dst      *bits
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, p := range parsers {
+		if *p.dst, err = parseField(fields[i], p.min, p.max); err != nil {
+			return nil, fmt.Errorf("%s: field %q: %w", op, fields[i], err)
+		}
+	}
+
+	// Воскресенье может быть записано как 7
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+
+	return &s, nil
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// bits holds allowed values of a field, bit n is value n.
+type bits uint64
+
+func (b bits) has(n int) bool {
+	return b&(1<<uint(n)) != 0
+}
+
+type spec struct {
+	minute, hour, dom, month, dow bits
+	domAny, dowAny                bool
+}
+
+// maxYears bounds the search of schedules that never fire, e.g. February 30.
+const maxYears = 5
+
+func (s *spec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + maxYears
+
+	for t.Year() <= limit {
+		y, m, d := t.Date()
+		switch {
+		case !s.month.has(int(m)):
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case !s.hour.has(t.Hour()):
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case !s.minute.has(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *spec) dayMatches(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func parseField(field string, min, max int) (bits, error) {
+	var b bits
+
+	for _, item := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+
+			var err error
+			if lo, err = parseValue(loStr, min, max); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseValue(hiStr, min, max); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" означает "5-max/15"
+				hi = max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+
+	return b, nil
+}
+
+func parseValue(s string, min, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New("invalid value " + strconv.Quote(s))
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, min, max)
+	}
+
+	return v, nil
+}
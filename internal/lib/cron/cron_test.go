@@ -0,0 +1,65 @@
+package cron_test
+
+import (
+	"sso/internal/lib/cron"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// Среда, 2024-01-10 10:30:15 UTC
+	from := time.Date(2024, 1, 10, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 4 * * *", time.Date(2024, 1, 11, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 0", time.Date(2024, 1, 14, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 7", time.Date(2024, 1, 14, 4, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * 1-5", time.Date(2024, 1, 10, 13, 30, 0, 0, time.UTC)},
+		// День месяца или день недели: ближайшая пятница раньше 20-го
+		{"0 0 20 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", from.Add(90 * time.Minute)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := cron.Parse(tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, s.Next(from))
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 1ms",
+		"@every soon",
+		"@fortnightly",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := cron.Parse(expr)
+			require.Error(t, err)
+		})
+	}
+}
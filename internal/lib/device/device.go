@@ -0,0 +1,29 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Info describes the client device a request came from.
+type Info struct {
+	// ID is a stable device identifier sent by the client, if any.
+	ID        string
+	UserAgent string
+	IP        string
+}
+
+// Fingerprint identifies the device: by its ID when the client sends one, by the user agent otherwise.
+// The IP address is not a part of the fingerprint, as it changes too often for mobile clients.
+func (i Info) Fingerprint() string {
+	var src string
+	if i.ID != "" {
+		src = "id:" + i.ID
+	} else {
+		src = "ua:" + i.UserAgent
+	}
+
+	sum := sha256.Sum256([]byte(src))
+
+	return hex.EncodeToString(sum[:])
+}
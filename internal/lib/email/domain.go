@@ -0,0 +1,17 @@
+package email
+
+import (
+	"slices"
+	"strings"
+)
+
+// Domain returns the part of a normalized address after the last "@".
+func Domain(addr string) string {
+	return addr[strings.LastIndexByte(addr, '@')+1:]
+}
+
+// DomainAllowed reports whether the domain of a normalized address is in the allowed list.
+// An empty list allows any domain. Subdomains must be listed separately.
+func DomainAllowed(addr string, allowed []string) bool {
+	return len(allowed) == 0 || slices.Contains(allowed, Domain(addr))
+}
@@ -0,0 +1,25 @@
+package email
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer brings email addresses to the canonical form users are stored and looked up by.
+type Normalizer struct {
+	// NFC composes unicode characters, so visually equal internationalized addresses match.
+	NFC bool
+}
+
+// Normalize trims spaces and lowercases the address, the local part included:
+// Foo@Bar.com and foo@bar.com are the same user.
+func (n Normalizer) Normalize(addr string) string {
+	addr = strings.TrimSpace(addr)
+
+	if n.NFC {
+		addr = norm.NFC.String(addr)
+	}
+
+	return strings.ToLower(addr)
+}
@@ -0,0 +1,185 @@
+// Package fieldcrypt encrypts single columns of the database with AES-256-GCM,
+// so a leaked database file or backup does not expose them without the keys.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of field and index keys in bytes.
+const KeySize = 32
+
+// prefix marks encrypted values: "enc:<key id>:<base64 nonce and ciphertext>".
+// Values without it were written before encryption was enabled and are returned as is.
+const prefix = "enc:"
+
+var (
+	ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+	ErrMalformed  = errors.New("malformed encrypted value")
+	ErrNoKeys     = errors.New("value is encrypted but field encryption is not configured")
+)
+
+// Keyring encrypts new values with the current key and decrypts values written with any of its keys,
+// so keys are rotated by adding a new current key and re-encrypting the stored values.
+// A nil *Keyring stores values as is.
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+	index   []byte
+}
+
+// New returns a keyring encrypting with keys[current]. indexKey keys the blind index, see Index.
+func New(current string, keys map[string][]byte, indexKey []byte) (*Keyring, error) {
+	const op = "fieldcrypt.New"
+
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%s: current key %q is not configured", op, current)
+	}
+
+	if len(indexKey) != KeySize {
+		return nil, fmt.Errorf("%s: index key must be %d bytes", op, KeySize)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%s: invalid key id %q", op, id)
+		}
+
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("%s: key %q must be %d bytes", op, id, KeySize)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		aeads[id] = aead
+	}
+
+	return &Keyring{
+		current: current,
+		aeads:   aeads,
+		index:   indexKey,
+	}, nil
+}
+
+// Parse returns a keyring of base64-encoded keys as they are configured, nil if current is empty.
+func Parse(current string, keys map[string]string, indexKey string) (*Keyring, error) {
+	const op = "fieldcrypt.Parse"
+
+	if current == "" {
+		return nil, nil
+	}
+
+	decoded := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", op, id, err)
+		}
+		decoded[id] = b
+	}
+
+	index, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: index key: %w", op, err)
+	}
+
+	return New(current, decoded, index)
+}
+
+// Encrypt encrypts the value of the column with the current key. The column name is authenticated,
+// so a value copied into another column does not decrypt. Empty values stay empty.
+func (k *Keyring) Encrypt(column string, value string) (string, error) {
+	if k == nil || value == "" {
+		return value, nil
+	}
+
+	aead := k.aeads[k.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("fieldcrypt.Encrypt: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(column))
+
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the value of the column, values stored before encryption are returned as is.
+func (k *Keyring) Decrypt(column string, value string) (string, error) {
+	const op = "fieldcrypt.Decrypt"
+
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+
+	if k == nil {
+		return "", fmt.Errorf("%s: %w", op, ErrNoKeys)
+	}
+
+	id, data, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, ErrMalformed)
+	}
+
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%s: %w: %q", op, ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%s: %w", op, ErrMalformed)
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %w", op, ErrMalformed, err)
+	}
+
+	return string(plain), nil
+}
+
+// Index returns the blind index of the value for equality lookups and unique constraints
+// on an encrypted column: an HMAC keyed separately from the field keys, which is not rotated with them.
+// Without keys the value itself is the index.
+func (k *Keyring) Index(column string, value string) string {
+	if k == nil || value == "" {
+		return value
+	}
+
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CurrentPrefix is the prefix of values encrypted with the current key, values without it need re-encryption.
+// It is empty without keys.
+func (k *Keyring) CurrentPrefix() string {
+	if k == nil {
+		return ""
+	}
+
+	return prefix + k.current + ":"
+}
@@ -0,0 +1,83 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	old, err := New("v1", map[string][]byte{"v1": testKey(1)}, testKey(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := New("v2", map[string][]byte{"v1": testKey(1), "v2": testKey(2)}, testKey(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := old.Encrypt("users.phone", "+15550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(enc, "15550100") || !strings.HasPrefix(enc, old.CurrentPrefix()) {
+		t.Fatalf("unexpected encrypted value %q", enc)
+	}
+
+	// Старый ключ остаётся в связке после ротации
+	got, err := rotated.Decrypt("users.phone", enc)
+	if err != nil || got != "+15550100" {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+
+	if strings.HasPrefix(enc, rotated.CurrentPrefix()) {
+		t.Fatal("value encrypted with the old key must need re-encryption")
+	}
+
+	if _, err := old.Decrypt("users.email", enc); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("Decrypt() with another column: %v, want ErrMalformed", err)
+	}
+
+	newer, err := rotated.Encrypt("users.phone", "+15550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := old.Decrypt("users.phone", newer); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Decrypt() with unknown key: %v, want ErrUnknownKey", err)
+	}
+
+	var none *Keyring
+	if _, err := none.Decrypt("users.phone", enc); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("Decrypt() without keys: %v, want ErrNoKeys", err)
+	}
+
+	if got, err := old.Decrypt("users.phone", "+15550100"); err != nil || got != "+15550100" {
+		t.Fatalf("Decrypt() of plaintext = %q, %v", got, err)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	k1, _ := New("v1", map[string][]byte{"v1": testKey(1)}, testKey(9))
+	k2, _ := New("v2", map[string][]byte{"v2": testKey(2)}, testKey(9))
+
+	if k1.Index("users.phone", "+15550100") != k2.Index("users.phone", "+15550100") {
+		t.Fatal("index must not depend on the field keys")
+	}
+
+	if k1.Index("users.phone", "+15550100") == k1.Index("users.phone", "+15550101") {
+		t.Fatal("different values must have different indexes")
+	}
+
+	var none *Keyring
+	if none.Index("users.phone", "+15550100") != "+15550100" {
+		t.Fatal("without keys the value is the index")
+	}
+}
@@ -0,0 +1,110 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Location is where an IP address is registered. Fields are empty when the address is unknown
+// or the database with them is not configured.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code, e.g. "DE".
+	Country string
+	// ASN is the autonomous system number and ASOrg its organization, e.g. 15169 "Google LLC".
+	ASN   uint32
+	ASOrg string
+	// Latitude and Longitude are the approximate coordinates, known with a city database only.
+	// Both are zero when unknown.
+	Latitude  float64
+	Longitude float64
+}
+
+// Locator resolves IP addresses with MaxMind databases: a country one (GeoLite2-Country or -City)
+// and an ASN one (GeoLite2-ASN). A nil *Locator resolves nothing.
+type Locator struct {
+	country *Reader
+	asn     *Reader
+}
+
+// Open reads the databases, an empty path skips the database.
+func Open(countryPath string, asnPath string) (*Locator, error) {
+	const op = "geoip.Open"
+
+	l := &Locator{}
+
+	if countryPath != "" {
+		r, err := OpenReader(countryPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		l.country = r
+	}
+
+	if asnPath != "" {
+		r, err := OpenReader(asnPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		l.asn = r
+	}
+
+	return l, nil
+}
+
+// Lookup returns the location of the IP address, the zero Location if it is invalid or unknown.
+func (l *Locator) Lookup(ip string) Location {
+	var loc Location
+
+	if l == nil {
+		return loc
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return loc
+	}
+
+	if l.country != nil {
+		// Ошибка поиска — повреждённая база, адрес считается неизвестным
+		if rec, err := l.country.Lookup(addr); err == nil {
+			loc.Country = countryCode(rec)
+			loc.Latitude, loc.Longitude = coordinates(rec)
+		}
+	}
+
+	if l.asn != nil {
+		if rec, err := l.asn.Lookup(addr); err == nil {
+			m, _ := rec.(map[string]any)
+			loc.ASN = uint32(toUint(m["autonomous_system_number"]))
+			loc.ASOrg, _ = m["autonomous_system_organization"].(string)
+		}
+	}
+
+	return loc
+}
+
+// countryCode returns the country of a country or city record,
+// the registered country for addresses without one, e.g. anonymous proxies.
+func countryCode(rec any) string {
+	m, _ := rec.(map[string]any)
+
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := m[key].(map[string]any)
+		if code, _ := country["iso_code"].(string); code != "" {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// coordinates returns the location of a city record, zeros for country records.
+func coordinates(rec any) (float64, float64) {
+	m, _ := rec.(map[string]any)
+	location, _ := m["location"].(map[string]any)
+
+	lat, _ := location["latitude"].(float64)
+	lon, _ := location["longitude"].(float64)
+
+	return lat, lon
+}
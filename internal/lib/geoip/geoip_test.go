@@ -0,0 +1,207 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testDB builds an IPv6 MaxMind DB with the records of the networks.
+type testDB struct {
+	nodes [][2]int
+	refs  map[[2]int]int
+	data  []byte
+}
+
+const (
+	emptyRecord = -1
+	dataRecord  = -2
+)
+
+func newTestDB() *testDB {
+	return &testDB{nodes: [][2]int{{emptyRecord, emptyRecord}}, refs: map[[2]int]int{}}
+}
+
+// insert maps the network to a record encoded in data at offset.
+func (db *testDB) insert(prefix netip.Prefix, offset int) {
+	bits := prefix.Bits()
+	addr := prefix.Addr()
+	ip := addr.As16()
+	if addr.Is4() {
+		// As16 возвращает ::ffff:a.b.c.d, а база хранит IPv4 в ::a.b.c.d
+		ip[10], ip[11] = 0, 0
+		bits += 96
+	}
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			db.nodes[node][bit] = dataRecord
+			db.refs[[2]int{node, bit}] = offset
+			return
+		}
+		if db.nodes[node][bit] < 0 {
+			db.nodes = append(db.nodes, [2]int{emptyRecord, emptyRecord})
+			db.nodes[node][bit] = len(db.nodes) - 1
+		}
+		node = db.nodes[node][bit]
+	}
+}
+
+func (db *testDB) bytes(recordSize int) []byte {
+	count := len(db.nodes)
+
+	value := func(node, bit int) uint32 {
+		switch r := db.nodes[node][bit]; r {
+		case emptyRecord:
+			return uint32(count)
+		case dataRecord:
+			return uint32(count + dataSeparatorSize + db.refs[[2]int{node, bit}])
+		default:
+			return uint32(r)
+		}
+	}
+
+	var out []byte
+	for n := range db.nodes {
+		l, r := value(n, 0), value(n, 1)
+		switch recordSize {
+		case 24:
+			out = append(out, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			out = append(out, byte(l>>16), byte(l>>8), byte(l), byte(l>>24)<<4|byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+
+	out = append(out, make([]byte, dataSeparatorSize)...)
+	out = append(out, db.data...)
+	out = append(out, metadataMarker...)
+	out = append(out, encodeMap(map[string][]byte{
+		"node_count":    encodeUint(typeUint32, uint64(count)),
+		"record_size":   encodeUint(typeUint16, uint64(recordSize)),
+		"ip_version":    encodeUint(typeUint16, 6),
+		"database_type": encodeString("Test"),
+	})...)
+
+	return out
+}
+
+func encodeString(s string) []byte {
+	if len(s) >= 29 {
+		return append([]byte{typeString<<5 | 29, byte(len(s) - 29)}, s...)
+	}
+	return append([]byte{typeString<<5 | byte(len(s))}, s...)
+}
+
+func encodeUint(typ byte, v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return append([]byte{typ<<5 | byte(len(b))}, b...)
+}
+
+func encodeDouble(v float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	return append([]byte{typeDouble<<5 | 8}, b...)
+}
+
+func encodeMap(m map[string][]byte) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := []byte{typeMap<<5 | byte(len(m))}
+	for _, k := range keys {
+		out = append(out, encodeString(k)...)
+		out = append(out, m[k]...)
+	}
+	return out
+}
+
+func writeDB(t *testing.T, b []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLocatorLookup(t *testing.T) {
+	for _, recordSize := range []int{24, 28} {
+		countries := newTestDB()
+		countries.data = encodeMap(map[string][]byte{"iso_code": encodeString("DE")})
+		// Запись без country ссылается на страну указателем
+		registered := len(countries.data)
+		countries.data = append(countries.data, encodeMap(map[string][]byte{
+			"registered_country": {typePointer << 5, 0},
+		})...)
+		nl := len(countries.data)
+		countries.data = append(countries.data, encodeMap(map[string][]byte{
+			"country": encodeMap(map[string][]byte{"iso_code": encodeString("NL")}),
+			"location": encodeMap(map[string][]byte{
+				"latitude":  encodeDouble(52.37),
+				"longitude": encodeDouble(4.89),
+			}),
+		})...)
+		countries.insert(netip.MustParsePrefix("1.2.3.0/24"), nl)
+		countries.insert(netip.MustParsePrefix("5.0.0.0/8"), registered)
+		countries.insert(netip.MustParsePrefix("2001:db8::/32"), nl)
+
+		asns := newTestDB()
+		asns.data = encodeMap(map[string][]byte{
+			"autonomous_system_number":       encodeUint(typeUint32, 64500),
+			"autonomous_system_organization": encodeString("Example"),
+		})
+		asns.insert(netip.MustParsePrefix("1.2.0.0/16"), 0)
+
+		l, err := Open(writeDB(t, countries.bytes(recordSize)), writeDB(t, asns.bytes(recordSize)))
+		if err != nil {
+			t.Fatalf("record size %d: %v", recordSize, err)
+		}
+
+		tests := []struct {
+			ip   string
+			want Location
+		}{
+			{"1.2.3.4", Location{Country: "NL", ASN: 64500, ASOrg: "Example", Latitude: 52.37, Longitude: 4.89}},
+			{"1.2.4.4", Location{ASN: 64500, ASOrg: "Example"}},
+			{"5.6.7.8", Location{Country: "DE"}},
+			{"::ffff:5.6.7.8", Location{Country: "DE"}},
+			{"2001:db8::1", Location{Country: "NL", Latitude: 52.37, Longitude: 4.89}},
+			{"9.9.9.9", Location{}},
+			{"not an ip", Location{}},
+		}
+
+		for _, tt := range tests {
+			if got := l.Lookup(tt.ip); got != tt.want {
+				t.Errorf("record size %d: Lookup(%q) = %+v, want %+v", recordSize, tt.ip, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLocatorNil(t *testing.T) {
+	var l *Locator
+	if got := l.Lookup("1.2.3.4"); got != (Location{}) {
+		t.Fatalf("Lookup() = %+v", got)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	_, err := Open(writeDB(t, []byte("not a database")), "")
+	if !errors.Is(err, ErrInvalidDatabase) {
+		t.Fatalf("Open() error = %v, want ErrInvalidDatabase", err)
+	}
+}
@@ -0,0 +1,370 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// ErrInvalidDatabase is returned for files that are not MaxMind DB databases.
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB file")
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparatorSize is the zero gap between the search tree and the data section.
+const dataSeparatorSize = 16
+
+// Data section types, see the MaxMind DB format specification.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Reader looks up records of a MaxMind DB file (.mmdb), e.g. GeoLite2-Country or GeoLite2-ASN.
+// The file is read into memory once, the Reader is safe for concurrent use.
+type Reader struct {
+	buf  []byte
+	data []byte
+
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node of ::/96 in IPv6 databases, where IPv4 addresses are looked up.
+	ipv4Start uint
+
+	DatabaseType string
+}
+
+// OpenReader reads the database file.
+func OpenReader(path string) (*Reader, error) {
+	const op = "geoip.OpenReader"
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r, err := newReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, path, err)
+	}
+
+	return r, nil
+}
+
+func newReader(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	start += len(metadataMarker)
+
+	d := decoder{buf: buf[start:]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  uint(toUint(meta["node_count"])),
+		recordSize: uint(toUint(meta["record_size"])),
+		ipVersion:  uint(toUint(meta["ip_version"])),
+	}
+	r.DatabaseType, _ = meta["database_type"].(string)
+
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", ErrInvalidDatabase, r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSeparatorSize > uint(start) {
+		return nil, ErrInvalidDatabase
+	}
+	r.data = buf[treeSize+dataSeparatorSize : start-len(metadataMarker)]
+
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// Lookup returns the record of the network containing the address, nil if there is none.
+// Maps are map[string]any, arrays []any, integers uint64 or int64.
+func (r *Reader) Lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+
+	node := uint(0)
+	bits := 128
+	if addr.Is4() {
+		bits = 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		// В IPv4-базе нет IPv6-адресов
+		return nil, nil
+	}
+
+	ip := addr.As16()
+	offset := 16 - bits/8
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[offset+i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, ErrInvalidDatabase
+	}
+
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(node - r.nodeCount - dataSeparatorSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of the node.
+func (r *Reader) record(node uint, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// decoder decodes values of the data section, offsets and pointers are relative to buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset after it.
+func (d decoder) decode(offset uint) (any, uint, error) {
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		ptr, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr)
+		return v, next, err
+	}
+
+	return d.value(typ, size, offset)
+}
+
+// control reads the control byte at offset and returns the type, the payload size and its offset.
+// For pointers size is the control byte itself.
+func (d decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		return typ, uint(ctrl), offset, nil
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, ErrInvalidDatabase
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, ErrInvalidDatabase
+		}
+		ext := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			ext = ext<<8 | uint(b)
+		}
+		offset += n
+
+		switch size {
+		case 29:
+			size = 29 + ext
+		case 30:
+			size = 285 + ext
+		default:
+			size = 65821 + ext
+		}
+	}
+
+	return typ, size, offset, nil
+}
+
+// pointer returns the offset the pointer with the control byte ctrl points to and the offset after it.
+func (d decoder) pointer(ctrl uint, offset uint) (uint, uint, error) {
+	n := (ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+
+	v := uint(0)
+	if n < 4 {
+		v = ctrl & 0x7
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+
+	return v, offset + n, nil
+}
+
+func (d decoder) value(typ int, size uint, offset uint) (any, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		v := uint64(0)
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		v := uint32(0)
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown type %d", ErrInvalidDatabase, typ)
+	}
+}
+
+func toUint(v any) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	}
+	return 0
+}
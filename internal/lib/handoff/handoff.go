@@ -0,0 +1,192 @@
+// Package handoff replaces the running binary without refusing connections: the process starts
+// the new binary with its listening sockets, waits until it serves on them and then drains.
+// The sockets are passed as inherited file descriptors starting at 3, as with systemd socket activation.
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// envNames lists the names of the passed sockets separated by ':', one per descriptor.
+	envNames = "SSO_HANDOFF_FDS"
+	// envReadyFD is the descriptor the new process reports readiness to.
+	envReadyFD = "SSO_HANDOFF_READY_FD"
+
+	fdsStart = 3
+)
+
+var (
+	ErrNotReady  = errors.New("new process exited before it was ready")
+	ErrTimeout   = errors.New("new process is not ready in time")
+	ErrInvalidFD = errors.New("invalid handoff file descriptor")
+)
+
+// File is a listening socket passed to the new process under the name.
+type File struct {
+	Name string
+	File *os.File
+}
+
+// Start starts the executable of the running process with its arguments and the files,
+// and waits until the new process calls Ready. A new process not ready within timeout is killed.
+// It returns the pid of the new process.
+func Start(files []File, timeout time.Duration) (int, error) {
+	const op = "handoff.Start"
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer r.Close()
+
+	names := make([]string, 0, len(files))
+	extra := make([]*os.File, 0, len(files)+1)
+	for _, f := range files {
+		names = append(names, f.Name)
+		extra = append(extra, f.File)
+	}
+	extra = append(extra, w)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extra
+	cmd.Env = append(environ(),
+		envNames+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(fdsStart+len(files)),
+	)
+
+	err = cmd.Start()
+	// Пишущий конец остаётся только у нового процесса: его выход без Ready даёт EOF
+	_ = w.Close()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := waitReady(r, timeout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pid := cmd.Process.Pid
+	// Новый процесс переживёт этот, ждать его завершения некому
+	_ = cmd.Process.Release()
+
+	return pid, nil
+}
+
+func waitReady(r *os.File, timeout time.Duration) error {
+	if err := r.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrNotReady
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return ErrTimeout
+		}
+		return err
+	}
+
+	return nil
+}
+
+// environ returns the environment of the new process without the handoff and
+// socket activation variables of this one.
+func environ() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case envNames, envReadyFD, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	return env
+}
+
+// Listeners returns the sockets passed by the previous process keyed by their names, nil if
+// the process was not started by Start. The variables are unset, so child processes don't
+// take the sockets for theirs.
+func Listeners() (map[string][]net.Listener, error) {
+	const op = "handoff.Listeners"
+
+	v, ok := os.LookupEnv(envNames)
+	if !ok {
+		return nil, nil
+	}
+	_ = os.Unsetenv(envNames)
+
+	if v == "" {
+		return nil, nil
+	}
+
+	names := strings.Split(v, ":")
+	listeners := make(map[string][]net.Listener, len(names))
+	for i, name := range names {
+		f := os.NewFile(uintptr(fdsStart+i), name)
+
+		// FileListener дублирует дескриптор с close-on-exec, исходный больше не нужен
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, ls := range listeners {
+				for _, l := range ls {
+					_ = l.Close()
+				}
+			}
+			return nil, fmt.Errorf("%s: socket %d (%s): %w", op, fdsStart+i, name, err)
+		}
+
+		listeners[name] = append(listeners[name], l)
+	}
+
+	return listeners, nil
+}
+
+// Ready tells the previous process that this one serves on the passed sockets,
+// so it can drain. It does nothing if the process was not started by Start.
+func Ready() error {
+	const op = "handoff.Ready"
+
+	v, ok := os.LookupEnv(envReadyFD)
+	if !ok {
+		return nil
+	}
+	_ = os.Unsetenv(envReadyFD)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil || fd < fdsStart {
+		return fmt.Errorf("%s: %w: %q", op, ErrInvalidFD, v)
+	}
+
+	f := os.NewFile(uintptr(fd), "handoff-ready")
+	defer f.Close()
+
+	if _, err := f.Write([]byte{1}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package handoff_test
+
+import (
+	"os"
+	"sso/internal/lib/handoff"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+
+	t.Setenv("SSO_HANDOFF_READY_FD", strconv.Itoa(int(w.Fd())))
+
+	require.NoError(t, handoff.Ready())
+	// Ready уже закрыл дескриптор, повторное закрытие только помечает w закрытым
+	_ = w.Close()
+
+	buf := make([]byte, 1)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// Второй вызов ничего не делает: переменная сброшена
+	require.NoError(t, handoff.Ready())
+}
+
+func TestReady_NotStarted(t *testing.T) {
+	require.NoError(t, handoff.Ready())
+}
+
+func TestListeners_NotStarted(t *testing.T) {
+	listeners, err := handoff.Listeners()
+	require.NoError(t, err)
+	require.Nil(t, listeners)
+}
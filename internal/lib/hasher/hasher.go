@@ -0,0 +1,77 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"runtime"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrBusy is returned when all workers are busy and the wait queue is full.
+var ErrBusy = errors.New("password hasher is busy")
+
+// Pool runs bcrypt operations on a bounded number of workers, so a burst of logins
+// queues up instead of saturating the CPU. Operations that don't fit into the queue
+// are rejected with ErrBusy right away.
+type Pool struct {
+	// admitted bounds running and queued operations together
+	admitted chan struct{}
+	// workers bounds running operations
+	workers chan struct{}
+}
+
+// New creates a pool of parallelism workers with a queue of queueDepth waiting operations.
+// Non-positive parallelism means GOMAXPROCS.
+func New(parallelism int, queueDepth int) *Pool {
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+
+	return &Pool{
+		admitted: make(chan struct{}, parallelism+queueDepth),
+		workers:  make(chan struct{}, parallelism),
+	}
+}
+
+// Hash returns the bcrypt hash of the password with the given cost.
+func (p *Pool) Hash(ctx context.Context, password []byte, cost int) ([]byte, error) {
+	var hash []byte
+
+	err := p.do(ctx, func() error {
+		var err error
+		hash, err = bcrypt.GenerateFromPassword(password, cost)
+		return err
+	})
+
+	return hash, err
+}
+
+// Compare compares the bcrypt hash with the password, it returns
+// bcrypt.ErrMismatchedHashAndPassword if they don't match.
+func (p *Pool) Compare(ctx context.Context, hash []byte, password []byte) error {
+	return p.do(ctx, func() error {
+		return bcrypt.CompareHashAndPassword(hash, password)
+	})
+}
+
+func (p *Pool) do(ctx context.Context, fn func() error) error {
+	select {
+	case p.admitted <- struct{}{}:
+	default:
+		return ErrBusy
+	}
+	defer func() { <-p.admitted }()
+
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.workers }()
+
+	return fn()
+}
@@ -0,0 +1,118 @@
+package identifier
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	usernameMinLen = 3
+	usernameMaxLen = 32
+	// Длина номера в формате E.164 без ведущего "+"
+	phoneMinDigits = 7
+	phoneMaxDigits = 15
+)
+
+var (
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrInvalidPhone    = errors.New("invalid phone number")
+)
+
+// Kind is the type of the login identifier.
+type Kind string
+
+const (
+	Email    Kind = "email"
+	Username Kind = "username"
+	Phone    Kind = "phone"
+)
+
+// Identifier is a login identifier with its detected kind and value in the stored form.
+type Identifier struct {
+	Kind  Kind
+	Value string
+}
+
+// Detect determines the kind of the login identifier: anything with "@" is an email,
+// digits with an optional leading "+" and separators are a phone number, the rest is a username.
+// Phone numbers are brought to E.164 form, usernames are lowercased, emails are returned trimmed.
+func Detect(login string) Identifier {
+	login = strings.TrimSpace(login)
+
+	switch {
+	case strings.Contains(login, "@"):
+		return Identifier{Kind: Email, Value: login}
+	case isPhone(login):
+		return Identifier{Kind: Phone, Value: "+" + digits(login)}
+	default:
+		return Identifier{Kind: Username, Value: strings.ToLower(login)}
+	}
+}
+
+// NormalizeUsername lowercases the username and checks it: 3-32 characters of latin letters,
+// digits, ".", "_" and "-", starting with a letter, so it is never taken for a phone number.
+func NormalizeUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	if len(username) < usernameMinLen || len(username) > usernameMaxLen {
+		return "", ErrInvalidUsername
+	}
+
+	if username[0] < 'a' || username[0] > 'z' {
+		return "", ErrInvalidUsername
+	}
+
+	for _, r := range username {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '.' && r != '_' && r != '-' {
+			return "", ErrInvalidUsername
+		}
+	}
+
+	return username, nil
+}
+
+// NormalizePhone brings the phone number to E.164 form: "+" followed by 7-15 digits.
+// The number is expected with the country code, separators are dropped.
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+
+	if !isPhone(phone) {
+		return "", ErrInvalidPhone
+	}
+
+	d := digits(phone)
+	if len(d) < phoneMinDigits || len(d) > phoneMaxDigits {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + d, nil
+}
+
+// isPhone reports whether s consists of digits, separators and an optional leading "+".
+func isPhone(s string) bool {
+	s = strings.TrimPrefix(s, "+")
+
+	hasDigit := false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return false
+		}
+	}
+
+	return hasDigit
+}
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,28 @@
+package invite
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// tokenBytes is the length of random invite tokens.
+const tokenBytes = 32
+
+// NewToken generates an invite token and returns it with its hash. Only the hash is stored.
+func NewToken() (token string, hash string, err error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = hex.EncodeToString(b)
+
+	return token, Hash(token), nil
+}
+
+// Hash returns the storage key of the invite token.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,8 +1,11 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"sso/internal/domain/models"
 	"time"
 
@@ -10,20 +13,100 @@ import (
 )
 
 var (
-	ErrTokenExpired = errors.New("token expired")
-	ErrTokenInvalid = errors.New("token invalid")
+	ErrTokenExpired  = errors.New("token expired")
+	ErrTokenInvalid  = errors.New("token invalid")
+	ErrTokenTooLarge = errors.New("token too large")
 )
 
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
+// ClaimsRefKey is the claim that references a claim set stored server-side instead of embedded in the token.
+const ClaimsRefKey = "claims_ref"
+
+// reservedClaims are set by NewToken and can't be overridden by extra claims.
+var reservedClaims = map[string]struct{}{
+	"uid":      {},
+	"email":    {},
+	"exp":      {},
+	"iat":      {},
+	"nbf":      {},
+	"jti":      {},
+	"app_code": {},
+	"purpose":  {},
+	"tv":       {},
+}
+
+// tokenIDBytes is the length of random jti of access tokens.
+const tokenIDBytes = 16
+
+const (
+	// maxParseSize bounds tokens accepted for parsing regardless of the configured issuance limit,
+	// so a client can't make the server decode arbitrarily large input.
+	maxParseSize = 64 << 10
+	// maxClaims bounds the number of claims of a parsed token.
+	maxClaims = 64
+	// maxSafeInt is the largest integer a JSON number decoded to float64 holds exactly.
+	maxSafeInt = 1<<53 - 1
+)
+
+// Key is a token signing key. A key with an ID is announced in the kid header,
+// the key without an ID is the legacy app secret.
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// KeyFunc returns the secret to validate a token signed with the key kid, "" for tokens without kid.
+type KeyFunc func(kid string) (string, error)
+
+// Claims are the claims of a validated token.
+type Claims struct {
+	// ID is the jti, empty for tokens issued before it was added.
+	ID        string
+	UID       int64
+	Email     string
+	AppCode   string
+	ExpiresAt time.Time
+	// TokenVersion is the user's token version at issuance.
+	TokenVersion int64
+	Extra        map[string]any
+}
+
+// NewToken issues a token for the user and app signed with the key. Extra claims are embedded as is,
+// except the reserved ones which are always set from user and app. The claims template of the app
+// adds the profile fields of the user and renames the non-reserved claims.
+func NewToken(user models.User, app models.App, key Key, duration time.Duration, extra map[string]any) (string, error) {
+	id := make([]byte, tokenIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
 	token := jwt.New(jwt.SigningMethodHS256)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
 
 	claims := token.Claims.(jwt.MapClaims)
+	for k, v := range profileClaims(user, app.Claims.Profile) {
+		claims[k] = v
+	}
+	for k, v := range extra {
+		if _, ok := reservedClaims[k]; ok {
+			continue
+		}
+		claims[k] = v
+	}
+	renameClaims(claims, app.Claims.Rename)
+	now := time.Now()
+
+	claims["jti"] = hex.EncodeToString(id)
 	claims["uid"] = user.ID
 	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(duration).Unix()
 	claims["app_code"] = app.Code
+	claims["tv"] = user.TokenVersion
 
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	tokenString, err := token.SignedString([]byte(key.Secret))
 	if err != nil {
 		return "", err
 	}
@@ -31,41 +114,201 @@ func NewToken(user models.User, app models.App, duration time.Duration) (string,
 	return tokenString, nil
 }
 
-func ValidateToken(token string, secretApp string) (email string, err error) {
+// profileClaims returns the profile fields of the user, empty ones are omitted.
+func profileClaims(user models.User, fields []string) map[string]any {
+	claims := make(map[string]any, len(fields))
+
+	for _, field := range fields {
+		switch field {
+		case models.ProfileUsername:
+			if user.Username != "" {
+				claims[field] = user.Username
+			}
+		case models.ProfilePhone:
+			if user.Phone != "" {
+				claims[field] = user.Phone
+			}
+		case models.ProfileCreatedAt:
+			if !user.CreatedAt.IsZero() {
+				claims[field] = user.CreatedAt.Unix()
+			}
+		}
+	}
+
+	return claims
+}
+
+// renameClaims renames the claims by the mapping, reserved claims are neither renamed nor overwritten.
+func renameClaims(claims jwt.MapClaims, rename map[string]string) {
+	renamed := make(map[string]any, len(rename))
+
+	for from, to := range rename {
+		if _, ok := reservedClaims[from]; ok {
+			continue
+		}
+		if _, ok := reservedClaims[to]; ok {
+			continue
+		}
+
+		v, ok := claims[from]
+		if !ok {
+			continue
+		}
+		delete(claims, from)
+		renamed[to] = v
+	}
+
+	// Переименованные claims добавляются после удаления исходных, чтобы обмен имён a↔b работал
+	for k, v := range renamed {
+		claims[k] = v
+	}
+}
+
+// CheckSize returns ErrTokenTooLarge if the serialized token exceeds maxSize bytes.
+// Zero maxSize disables the check.
+func CheckSize(token string, maxSize int) error {
+	if maxSize > 0 && len(token) > maxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrTokenTooLarge, len(token), maxSize)
+	}
+
+	return nil
+}
+
+func ValidateToken(token string, keys KeyFunc, leeway time.Duration) (email string, err error) {
+	claims, err := Parse(token, keys, leeway)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.Email, nil
+}
+
+// Parse validates the token signature and its exp, nbf and iat claims and returns its claims.
+// The secret is resolved by keys from the kid header. The leeway tolerates clock drift
+// between the issuing and the validating hosts.
+func Parse(token string, keys KeyFunc, leeway time.Duration) (Claims, error) {
+	if err := CheckSize(token, maxParseSize); err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+
 	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secretApp), nil
-	})
+
+		kid, _ := token.Header["kid"].(string)
+		secret, err := keys(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(secret), nil
+	}, parserOptions(leeway)...)
 
 	if err != nil {
-		return "", fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return Claims{}, ErrTokenExpired
+		}
+		return Claims{}, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
 	}
 
 	if !parsedToken.Valid {
-		return "", ErrTokenInvalid
+		return Claims{}, ErrTokenInvalid
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	mapClaims, ok := parsedToken.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", ErrTokenInvalid
+		return Claims{}, ErrTokenInvalid
+	}
+
+	if len(mapClaims) > maxClaims {
+		return Claims{}, fmt.Errorf("%w: too many claims", ErrTokenInvalid)
 	}
 
-	emailClaim, ok := claims["email"].(string)
+	emailClaim, ok := mapClaims["email"].(string)
 	if !ok {
-		return "", fmt.Errorf("%w: email claim is missing or invalid", ErrTokenInvalid)
+		return Claims{}, fmt.Errorf("%w: email claim is missing or invalid", ErrTokenInvalid)
 	}
 
-	expClaim, ok := claims["exp"].(float64)
+	expClaim, ok := mapClaims["exp"].(float64)
 	if !ok {
-		return "", fmt.Errorf("%w: exp claim is missing or invalid", ErrTokenInvalid)
+		return Claims{}, fmt.Errorf("%w: exp claim is missing or invalid", ErrTokenInvalid)
 	}
 
 	expTime := time.Unix(int64(expClaim), 0)
-	if time.Now().After(expTime) {
-		return "", ErrTokenExpired
+
+	claims := Claims{
+		Email:     emailClaim,
+		ExpiresAt: expTime,
+		Extra:     make(map[string]any),
+	}
+
+	// Необязательные claims могут отсутствовать, но не иметь чужой тип
+	if claims.ID, err = stringClaim(mapClaims, "jti"); err != nil {
+		return Claims{}, err
+	}
+
+	if claims.UID, err = intClaim(mapClaims, "uid"); err != nil {
+		return Claims{}, err
 	}
 
-	return emailClaim, nil
+	if claims.AppCode, err = stringClaim(mapClaims, "app_code"); err != nil {
+		return Claims{}, err
+	}
+
+	// Токены, выпущенные до появления версии, считаются версией 0
+	if claims.TokenVersion, err = intClaim(mapClaims, "tv"); err != nil {
+		return Claims{}, err
+	}
+
+	for k, v := range mapClaims {
+		if _, ok := reservedClaims[k]; !ok {
+			claims.Extra[k] = v
+		}
+	}
+
+	return claims, nil
+}
+
+// stringClaim returns the optional string claim, "" if it is absent.
+func stringClaim(claims jwt.MapClaims, name string) (string, error) {
+	v, ok := claims[name]
+	if !ok {
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s claim is not a string", ErrTokenInvalid, name)
+	}
+
+	return s, nil
+}
+
+// intClaim returns the optional integer claim, 0 if it is absent. Fractions and numbers
+// beyond the exact float64 range are rejected instead of being silently truncated.
+func intClaim(claims jwt.MapClaims, name string) (int64, error) {
+	v, ok := claims[name]
+	if !ok {
+		return 0, nil
+	}
+
+	f, ok := v.(float64)
+	if !ok || f != math.Trunc(f) || math.Abs(f) > maxSafeInt {
+		return 0, fmt.Errorf("%w: %s claim is not an integer", ErrTokenInvalid, name)
+	}
+
+	return int64(f), nil
+}
+
+// parserOptions checks iat in addition to exp and nbf, all with the leeway.
+// Tokens issued before iat and nbf were added have neither and are accepted.
+// Only HS256 is accepted: tokens are never issued with other algorithms,
+// so "none" and algorithm confusion are rejected before the key is looked up.
+func parserOptions(leeway time.Duration) []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithLeeway(leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+	}
 }
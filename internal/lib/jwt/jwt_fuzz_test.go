@@ -0,0 +1,148 @@
+package jwt_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"strings"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func keys(kid string) (string, error) {
+	if kid != "" {
+		return "", errors.New("unknown kid")
+	}
+	return testSecret, nil
+}
+
+func validToken(t testing.TB, extra map[string]any) string {
+	t.Helper()
+
+	token, err := jwt.NewToken(
+		models.User{ID: 42, Email: "user@example.com"},
+		models.App{ID: 1, Code: "web", Secret: testSecret},
+		jwt.Key{Secret: testSecret},
+		time.Hour,
+		extra,
+	)
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+
+	return token
+}
+
+// signed builds a token with arbitrary header and claims, signed with the test secret where the alg allows it.
+func signed(t testing.TB, method gojwt.SigningMethod, key any, claims gojwt.MapClaims) string {
+	t.Helper()
+
+	token, err := gojwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return token
+}
+
+func baseClaims() gojwt.MapClaims {
+	now := time.Now()
+
+	return gojwt.MapClaims{
+		"uid":      42,
+		"email":    "user@example.com",
+		"app_code": "web",
+		"iat":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(validToken(f, nil))
+	f.Add(validToken(f, map[string]any{"roles": []string{"admin"}}))
+	f.Add(signed(f, gojwt.SigningMethodNone, gojwt.UnsafeAllowNoneSignatureType, baseClaims()))
+	f.Add(signed(f, gojwt.SigningMethodHS512, []byte(testSecret), baseClaims()))
+	f.Add("")
+	f.Add("..")
+	f.Add("a.b.c")
+	f.Add(strings.Repeat("A", 1<<10) + "." + strings.Repeat("B", 1<<10) + ".")
+	f.Add(base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"email":{"a":1},"exp":1e308,"uid":1.5}`)) + ".sig")
+
+	f.Fuzz(func(t *testing.T, token string) {
+		claims, err := jwt.Parse(token, keys, time.Minute)
+		if err != nil {
+			if !errors.Is(err, jwt.ErrTokenInvalid) && !errors.Is(err, jwt.ErrTokenExpired) {
+				t.Fatalf("unexpected error kind: %v", err)
+			}
+			return
+		}
+
+		// Принятый токен обязан быть подписан HS256 тестовым секретом
+		parsed, _, err := gojwt.NewParser().ParseUnverified(token, gojwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("accepted token is not a JWT: %v", err)
+		}
+		if parsed.Method.Alg() != gojwt.SigningMethodHS256.Alg() {
+			t.Fatalf("accepted token with alg %q", parsed.Method.Alg())
+		}
+		if claims.Email == "" {
+			t.Fatalf("accepted token without email")
+		}
+	})
+}
+
+func TestParse_Rejects(t *testing.T) {
+	withClaims := func(set map[string]any) gojwt.MapClaims {
+		claims := baseClaims()
+		for k, v := range set {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	manyClaims := baseClaims()
+	for i := range 100 {
+		manyClaims[strings.Repeat("x", i+1)] = i
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"alg none", signed(t, gojwt.SigningMethodNone, gojwt.UnsafeAllowNoneSignatureType, baseClaims())},
+		{"other hmac alg", signed(t, gojwt.SigningMethodHS512, []byte(testSecret), baseClaims())},
+		{"fractional uid", signed(t, gojwt.SigningMethodHS256, []byte(testSecret), withClaims(map[string]any{"uid": 1.5}))},
+		{"uid beyond float precision", signed(t, gojwt.SigningMethodHS256, []byte(testSecret), withClaims(map[string]any{"uid": 1e300}))},
+		{"string uid", signed(t, gojwt.SigningMethodHS256, []byte(testSecret), withClaims(map[string]any{"uid": "42"}))},
+		{"numeric app_code", signed(t, gojwt.SigningMethodHS256, []byte(testSecret), withClaims(map[string]any{"app_code": 1}))},
+		{"object email", signed(t, gojwt.SigningMethodHS256, []byte(testSecret), withClaims(map[string]any{"email": map[string]any{}}))},
+		{"too many claims", signed(t, gojwt.SigningMethodHS256, []byte(testSecret), manyClaims)},
+		{"oversized", validToken(t, map[string]any{"blob": strings.Repeat("x", 70<<10)})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, keys, time.Minute)
+			if !errors.Is(err, jwt.ErrTokenInvalid) {
+				t.Fatalf("expected ErrTokenInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParse_Valid(t *testing.T) {
+	claims, err := jwt.Parse(validToken(t, map[string]any{"roles": []any{"admin"}}), keys, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if claims.UID != 42 || claims.Email != "user@example.com" || claims.AppCode != "web" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
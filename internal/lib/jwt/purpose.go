@@ -0,0 +1,146 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sso/internal/domain/models"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrWrongPurpose = errors.New("token issued for another purpose")
+
+// Purpose is the single action a purpose token authorizes.
+type Purpose string
+
+const (
+	PurposeVerifyEmail   Purpose = "verify_email"
+	PurposeResetPassword Purpose = "reset_password"
+	PurposeMagicLink     Purpose = "magic_link"
+)
+
+// purposeIDBytes is the length of random purpose token ids.
+const purposeIDBytes = 16
+
+// PurposeClaims are the claims of a validated purpose token.
+type PurposeClaims struct {
+	ID        string
+	UID       int64
+	Email     string
+	AppCode   string
+	Purpose   Purpose
+	ExpiresAt time.Time
+}
+
+// NewPurposeToken issues a short-lived token authorizing a single action of the user,
+// e.g. following an email verification link. Purpose tokens are signed with a key derived
+// from the app secret and the purpose, so they are never accepted as access tokens
+// or as tokens of another purpose.
+func NewPurposeToken(user models.User, app models.App, purpose Purpose, duration time.Duration) (string, PurposeClaims, error) {
+	id := make([]byte, purposeIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", PurposeClaims{}, err
+	}
+
+	now := time.Now()
+
+	claims := PurposeClaims{
+		ID:        hex.EncodeToString(id),
+		UID:       user.ID,
+		Email:     user.Email,
+		AppCode:   app.Code,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(duration),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti":      claims.ID,
+		"uid":      claims.UID,
+		"email":    claims.Email,
+		"app_code": claims.AppCode,
+		"purpose":  string(purpose),
+		"iat":      now.Unix(),
+		"nbf":      now.Unix(),
+		"exp":      claims.ExpiresAt.Unix(),
+	})
+
+	tokenString, err := token.SignedString(purposeKey(app.Secret, purpose))
+	if err != nil {
+		return "", PurposeClaims{}, err
+	}
+
+	return tokenString, claims, nil
+}
+
+// ParsePurpose validates a purpose token for the purpose and returns its claims.
+func ParsePurpose(token string, secretApp string, purpose Purpose, leeway time.Duration) (PurposeClaims, error) {
+	if err := CheckSize(token, maxParseSize); err != nil {
+		return PurposeClaims{}, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+
+	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return purposeKey(secretApp, purpose), nil
+	}, parserOptions(leeway)...)
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return PurposeClaims{}, ErrTokenExpired
+		}
+		return PurposeClaims{}, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+
+	mapClaims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || !parsedToken.Valid {
+		return PurposeClaims{}, ErrTokenInvalid
+	}
+
+	if len(mapClaims) > maxClaims {
+		return PurposeClaims{}, fmt.Errorf("%w: too many claims", ErrTokenInvalid)
+	}
+
+	// Ключ уже привязан к назначению, проверка claim — защита от ошибок выпуска
+	if p, _ := mapClaims["purpose"].(string); Purpose(p) != purpose {
+		return PurposeClaims{}, ErrWrongPurpose
+	}
+
+	id, _ := mapClaims["jti"].(string)
+	email, _ := mapClaims["email"].(string)
+	exp, _ := mapClaims["exp"].(float64)
+	if id == "" || email == "" || exp == 0 {
+		return PurposeClaims{}, fmt.Errorf("%w: required claims are missing", ErrTokenInvalid)
+	}
+
+	uid, err := intClaim(mapClaims, "uid")
+	if err != nil {
+		return PurposeClaims{}, err
+	}
+
+	appCode, err := stringClaim(mapClaims, "app_code")
+	if err != nil {
+		return PurposeClaims{}, err
+	}
+
+	return PurposeClaims{
+		ID:        id,
+		UID:       uid,
+		Email:     email,
+		AppCode:   appCode,
+		Purpose:   purpose,
+		ExpiresAt: time.Unix(int64(exp), 0),
+	}, nil
+}
+
+// purposeKey derives the signing key of purpose tokens from the app secret.
+func purposeKey(secretApp string, purpose Purpose) []byte {
+	mac := hmac.New(sha256.New, []byte(secretApp))
+	mac.Write([]byte("purpose:" + string(purpose)))
+	return mac.Sum(nil)
+}
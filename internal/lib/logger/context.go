@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/lib/requestid"
+)
+
+// contextHandler adds request-scoped values from the context (request ID) to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler wraps h so that records logged with a context carry its request ID.
+func NewContextHandler(h slog.Handler) slog.Handler {
+	return &contextHandler{Handler: h}
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, ok := requestid.FromContext(ctx); ok {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
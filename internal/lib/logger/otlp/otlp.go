@@ -0,0 +1,375 @@
+// Package otlp ships slog records to an OpenTelemetry collector over OTLP/HTTP with JSON encoding.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 512
+	defaultQueueSize     = 4096
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 5 * time.Second
+)
+
+// Options configures the exporter.
+type Options struct {
+	// Endpoint is the base URL of the collector, e.g. http://otel-collector:4318, records are posted to /v1/logs.
+	Endpoint string
+	// Headers are added to every request, e.g. an authorization header of a hosted collector.
+	Headers map[string]string
+	// Resource describes the process, e.g. service.name and service.instance.id. Traces and metrics of the
+	// process should use the same attributes, so the backend links them to the logs.
+	Resource map[string]string
+	Level    slog.Leveler
+	Timeout  time.Duration
+	// BatchSize records are sent in one request, at least every FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize bounds the records waiting for export, records beyond it are dropped, see Exporter.Dropped.
+	QueueSize int
+	// OnError reports failed exports: the exporter can't log them through itself.
+	OnError func(error)
+}
+
+// Exporter batches the records of its handlers and sends them in the background, so logging never waits for the collector.
+type Exporter struct {
+	url      string
+	opts     Options
+	client   *http.Client
+	resource []keyValue
+
+	queue   chan logRecord
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// New starts an exporter to the collector at opts.Endpoint.
+func New(opts Options) *Exporter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+
+	resource := make([]keyValue, 0, len(opts.Resource))
+	for k, v := range opts.Resource {
+		resource = append(resource, keyValue{Key: k, Value: stringValue(v)})
+	}
+
+	e := &Exporter{
+		url:      strings.TrimRight(opts.Endpoint, "/") + "/v1/logs",
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		resource: resource,
+		queue:    make(chan logRecord, opts.QueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e
+}
+
+// Handler returns the slog handler of the exporter.
+func (e *Exporter) Handler() slog.Handler {
+	return &handler{exporter: e}
+}
+
+// Dropped is the number of records dropped because the queue was full.
+func (e *Exporter) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// Close sends the queued records and stops the exporter. Records logged after Close are dropped.
+func (e *Exporter) Close(ctx context.Context) error {
+	const op = "otlp.Close"
+
+	e.once.Do(func() { close(e.stop) })
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+}
+
+func (e *Exporter) enqueue(r logRecord) {
+	select {
+	case <-e.stop:
+		e.dropped.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case e.queue <- r:
+	default:
+		// Коллектор не успевает: запись теряется, а не тормозит обработку запросов
+		e.dropped.Add(1)
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]logRecord, 0, e.opts.BatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil && e.opts.OnError != nil {
+			e.opts.OnError(err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case r := <-e.queue:
+			batch = append(batch, r)
+			if len(batch) >= e.opts.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-e.stop:
+			// Дописываем то, что успело попасть в очередь
+			for {
+				select {
+				case r := <-e.queue:
+					batch = append(batch, r)
+					if len(batch) >= e.opts.BatchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Exporter) send(batch []logRecord) error {
+	const op = "otlp.send"
+
+	body, err := json.Marshal(exportRequest{ResourceLogs: []resourceLogs{{
+		Resource:  resource{Attributes: e.resource},
+		ScopeLogs: []scopeLogs{{Scope: scope{Name: "sso"}, LogRecords: batch}},
+	}}})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %d records lost: %w", op, len(batch), err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %d records lost: unexpected status %d", op, len(batch), resp.StatusCode)
+	}
+
+	return nil
+}
+
+// handler converts records to OTLP log records, groups are flattened into dotted attribute keys.
+type handler struct {
+	exporter *Exporter
+	attrs    []keyValue
+	groups   []string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.exporter.opts.Level.Level()
+}
+
+func (h *handler) Handle(_ context.Context, record slog.Record) error {
+	attrs := make([]keyValue, len(h.attrs), len(h.attrs)+record.NumAttrs())
+	copy(attrs, h.attrs)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttr(attrs, h.groups, a)
+		return true
+	})
+
+	h.exporter.enqueue(logRecord{
+		TimeUnixNano:   strconv.FormatInt(record.Time.UnixNano(), 10),
+		SeverityNumber: severity(record.Level),
+		SeverityText:   record.Level.String(),
+		Body:           stringValue(record.Message),
+		Attributes:     attrs,
+	})
+
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := h.clone()
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, h.groups, a)
+	}
+
+	return h2
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+
+	return h2
+}
+
+func (h *handler) clone() *handler {
+	return &handler{
+		exporter: h.exporter,
+		attrs:    append([]keyValue(nil), h.attrs...),
+		groups:   append([]string(nil), h.groups...),
+	}
+}
+
+func appendAttr(dst []keyValue, groups []string, a slog.Attr) []keyValue {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return dst
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, m := range a.Value.Group() {
+			dst = appendAttr(dst, groups, m)
+		}
+		return dst
+	}
+
+	key := a.Key
+	if len(groups) > 0 {
+		key = strings.Join(groups, ".") + "." + key
+	}
+
+	return append(dst, keyValue{Key: key, Value: valueOf(a.Value)})
+}
+
+// severity maps slog levels to OTLP severity numbers: DEBUG 5, INFO 9, WARN 13, ERROR 17,
+// levels between them to the numbers between.
+func severity(level slog.Level) int {
+	n := int(level) + 9
+	return min(max(n, 1), 24)
+}
+
+func valueOf(v slog.Value) anyValue {
+	switch v.Kind() {
+	case slog.KindBool:
+		b := v.Bool()
+		return anyValue{BoolValue: &b}
+	case slog.KindInt64:
+		s := strconv.FormatInt(v.Int64(), 10)
+		return anyValue{IntValue: &s}
+	case slog.KindUint64:
+		s := strconv.FormatUint(v.Uint64(), 10)
+		return anyValue{IntValue: &s}
+	case slog.KindFloat64:
+		f := v.Float64()
+		return anyValue{DoubleValue: &f}
+	default:
+		return stringValue(v.String())
+	}
+}
+
+func stringValue(s string) anyValue {
+	return anyValue{StringValue: &s}
+}
+
+// Типы ниже — JSON-представление ExportLogsServiceRequest из opentelemetry-proto
+
+type exportRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano   string     `json:"timeUnixNano"`
+	SeverityNumber int        `json:"severityNumber"`
+	SeverityText   string     `json:"severityText"`
+	Body           anyValue   `json:"body"`
+	Attributes     []keyValue `json:"attributes,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue sets exactly one of the fields, int64 values are strings in the JSON mapping of OTLP.
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
@@ -2,14 +2,20 @@ package logger
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
 )
 
 type prettyHandler struct {
-	opts  *slog.HandlerOptions
-	w     io.Writer
-	attrs []slog.Attr // атрибуты из With()
+	opts   *slog.HandlerOptions
+	w      io.Writer
+	mu     *sync.Mutex // общий для всех копий из With()/WithGroup()
+	attrs  []string    // уже отформатированные атрибуты из With()
+	groups []string    // открытые группы из WithGroup()
 }
 
 func NewPrettyHandler(w io.Writer, opts *slog.HandlerOptions) *prettyHandler {
@@ -19,6 +25,7 @@ func NewPrettyHandler(w io.Writer, opts *slog.HandlerOptions) *prettyHandler {
 	return &prettyHandler{
 		opts: opts,
 		w:    w,
+		mu:   &sync.Mutex{},
 	}
 }
 
@@ -43,65 +50,178 @@ func (h *prettyHandler) Enabled(ctx context.Context, level slog.Level) bool {
 
 func (h *prettyHandler) Handle(ctx context.Context, record slog.Record) error {
 	var levelColor, levelIcon string
-	switch record.Level {
-	case slog.LevelDebug:
-		levelColor = gray
-		levelIcon = "🔍"
-	case slog.LevelInfo:
-		levelColor = cyan
-		levelIcon = "ℹ️ "
-	case slog.LevelWarn:
-		levelColor = yellow
-		levelIcon = "⚠️ "
-	case slog.LevelError:
+	switch {
+	case record.Level >= slog.LevelError:
 		levelColor = red
 		levelIcon = "❌"
+	case record.Level >= slog.LevelWarn:
+		levelColor = yellow
+		levelIcon = "⚠️ "
+	case record.Level >= slog.LevelInfo:
+		levelColor = cyan
+		levelIcon = "ℹ️ "
 	default:
-		levelColor = reset
-		levelIcon = "  "
+		levelColor = gray
+		levelIcon = "🔍"
 	}
 
-	timeStr := record.Time.Format("15:04:05")
+	// Встроенные поля проходят через ReplaceAttr так же, как в JSONHandler
+	timeStr, ok := h.timeField(record)
 
-	formatAttr := func(a slog.Attr) string {
-		return blue + a.Key + reset + "=" + gray + a.Value.String() + reset
+	levelStr, levelOK := h.builtin(slog.Any(slog.LevelKey, record.Level))
+	if len(levelStr) < 5 {
+		levelStr += " "
 	}
 
-	var attrs []string
-	for _, a := range h.attrs {
-		attrs = append(attrs, formatAttr(a))
+	message, msgOK := h.builtin(slog.String(slog.MessageKey, record.Message))
+
+	var b strings.Builder
+	if ok {
+		b.WriteString(gray + timeStr + reset + " ")
+	}
+	if levelOK {
+		b.WriteString(levelColor + bold + levelStr + levelIcon + reset + " ")
+	}
+	if msgOK {
+		b.WriteString(bold + message + reset + " ")
 	}
-	record.Attrs(func(a slog.Attr) bool {
-		attrs = append(attrs, formatAttr(a))
-		return true
-	})
 
-	levelStr := record.Level.String()
-	if len(levelStr) < 5 {
-		levelStr += " "
+	if h.opts.AddSource && record.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{record.PC})
+		frame, _ := frames.Next()
+		if source, ok := h.builtin(slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", frame.File, frame.Line))); ok {
+			b.WriteString(formatAttr(slog.SourceKey, source) + " ")
+		}
 	}
 
-	msg := gray + timeStr + reset + " " +
-		levelColor + bold + levelStr + levelIcon + reset + " " +
-		bold + record.Message + reset + " "
+	for _, attr := range h.attrs {
+		b.WriteString(attr + " ")
+	}
 
+	var attrs []string
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = h.appendAttr(attrs, h.groups, a)
+		return true
+	})
 	for _, attr := range attrs {
-		msg += attr + " "
+		b.WriteString(attr + " ")
 	}
 
-	msg += "\n"
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	_, err := h.w.Write([]byte(msg))
+	_, err := io.WriteString(h.w, b.String())
 	return err
 }
 
 func (h *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	newAttrs := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
-	newAttrs = append(newAttrs, h.attrs...)
-	newAttrs = append(newAttrs, attrs...)
-	return &prettyHandler{opts: h.opts, w: h.w, attrs: newAttrs}
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := h.clone()
+	for _, a := range attrs {
+		h2.attrs = h.appendAttr(h2.attrs, h.groups, a)
+	}
+
+	return h2
 }
 
 func (h *prettyHandler) WithGroup(name string) slog.Handler {
-	return h
+	if name == "" {
+		return h
+	}
+
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+
+	return h2
+}
+
+func (h *prettyHandler) clone() *prettyHandler {
+	return &prettyHandler{
+		opts:   h.opts,
+		w:      h.w,
+		mu:     h.mu,
+		attrs:  append([]string(nil), h.attrs...),
+		groups: append([]string(nil), h.groups...),
+	}
+}
+
+// appendAttr formats the attribute as group.key=value, flattening nested groups.
+func (h *prettyHandler) appendAttr(dst []string, groups []string, a slog.Attr) []string {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() != slog.KindGroup && h.opts.ReplaceAttr != nil {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
+	}
+
+	if a.Equal(slog.Attr{}) {
+		return dst
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		members := a.Value.Group()
+		if len(members) == 0 {
+			return dst
+		}
+
+		// Группа без ключа встраивает атрибуты в текущий уровень
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, m := range members {
+			dst = h.appendAttr(dst, groups, m)
+		}
+
+		return dst
+	}
+
+	key := a.Key
+	if len(groups) > 0 {
+		key = strings.Join(groups, ".") + "." + key
+	}
+
+	return append(dst, formatAttr(key, a.Value.String()))
+}
+
+// timeField applies ReplaceAttr to the record time, keeping the short format unless it was replaced with a non-time value.
+func (h *prettyHandler) timeField(record slog.Record) (string, bool) {
+	if record.Time.IsZero() {
+		return "", false
+	}
+
+	a := slog.Time(slog.TimeKey, record.Time)
+	if h.opts.ReplaceAttr != nil {
+		a = h.opts.ReplaceAttr(nil, a)
+		if a.Key == "" {
+			return "", false
+		}
+	}
+
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindTime {
+		return v.Time().Format("15:04:05"), true
+	}
+
+	return v.String(), true
+}
+
+// builtin applies ReplaceAttr to a built-in field and reports whether it should be printed.
+func (h *prettyHandler) builtin(a slog.Attr) (string, bool) {
+	if h.opts.ReplaceAttr != nil {
+		a = h.opts.ReplaceAttr(nil, a)
+		if a.Key == "" {
+			return "", false
+		}
+	}
+
+	return a.Value.Resolve().String(), true
+}
+
+func formatAttr(key string, value string) string {
+	return blue + key + reset + "=" + gray + value + reset
 }
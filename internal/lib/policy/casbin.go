@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Casbin evaluates a Casbin policy file against the RBAC model with wildcards:
+//
+//	[request_definition]  r = sub, obj, act
+//	[policy_definition]   p = sub, obj, act
+//	[role_definition]     g = _, _
+//	[policy_effect]       e = some(where (p.eft == allow))
+//	[matchers]            m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && keyMatch(r.act, p.act)
+//
+// The subject is the user email, the object is the app code and the action is the requested action.
+// Only this model is supported, the policy is loaded once on start.
+type Casbin struct {
+	policies []casbinPolicy
+	// roles maps a subject to the roles assigned to it by "g" lines.
+	roles map[string][]string
+}
+
+type casbinPolicy struct {
+	sub, obj, act string
+}
+
+// NewCasbin loads the policy file in the Casbin CSV format:
+//
+//	p, admin, *, *
+//	p, alice@example.com, web, login
+//	g, alice@example.com, admin
+func NewCasbin(path string) (*Casbin, error) {
+	const op = "policy.NewCasbin"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	c, err := parseCasbin(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, path, err)
+	}
+
+	return c, nil
+}
+
+func parseCasbin(r io.Reader) (*Casbin, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	c := &Casbin{roles: make(map[string][]string)}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+		}
+
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+
+		switch {
+		case record[0] == "p" && len(record) == 4:
+			c.policies = append(c.policies, casbinPolicy{sub: record[1], obj: record[2], act: record[3]})
+		case record[0] == "g" && len(record) == 3:
+			c.roles[record[1]] = append(c.roles[record[1]], record[2])
+		default:
+			return nil, fmt.Errorf("%w: unsupported line %q", ErrInvalidPolicy, strings.Join(record, ", "))
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Casbin) Decide(_ context.Context, req Request) (bool, error) {
+	subjects := c.subjects(req.Subject)
+
+	for _, p := range c.policies {
+		if subjects[p.sub] && keyMatch(req.App, p.obj) && keyMatch(req.Action, p.act) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Roles returns the roles of the subject, direct and inherited through other roles, sorted.
+func (c *Casbin) Roles(_ context.Context, subject string) ([]string, error) {
+	var roles []string
+	for sub := range c.subjects(subject) {
+		if sub != subject {
+			roles = append(roles, sub)
+		}
+	}
+	sort.Strings(roles)
+
+	return roles, nil
+}
+
+// subjects returns the subject and all roles it has, directly or through other roles.
+func (c *Casbin) subjects(sub string) map[string]bool {
+	seen := map[string]bool{sub: true}
+	queue := []string{sub}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for _, role := range c.roles[cur] {
+			if !seen[role] {
+				seen[role] = true
+				queue = append(queue, role)
+			}
+		}
+	}
+
+	return seen
+}
+
+// keyMatch is Casbin's keyMatch: "*" in the pattern matches any sequence of characters.
+func keyMatch(key string, pattern string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return key == pattern
+	}
+
+	if !strings.HasPrefix(key, parts[0]) {
+		return false
+	}
+	key = key[len(parts[0]):]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(key, part)
+		if i < 0 {
+			return false
+		}
+		key = key[i+len(part):]
+	}
+
+	return strings.HasSuffix(key, parts[len(parts)-1])
+}
@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// maxOPAResponseSize bounds the decision response read from OPA.
+	maxOPAResponseSize = 64 << 10
+	defaultOPATimeout  = 2 * time.Second
+)
+
+// OPA queries a decision of an Open Policy Agent server through its Data API.
+// The policy gets the request as input: {"subject", "user_id", "app", "action"},
+// and must evaluate the rule at the path to a boolean. An undefined rule is a denial.
+type OPA struct {
+	url    string
+	client *http.Client
+}
+
+// NewOPA returns the decider querying the rule at path, e.g. "sso/authz/allow",
+// of the OPA server at addr, e.g. "http://localhost:8181". A zero timeout defaults to 2s.
+func NewOPA(addr string, path string, timeout time.Duration) *OPA {
+	if timeout <= 0 {
+		timeout = defaultOPATimeout
+	}
+
+	return &OPA{
+		url:    strings.TrimRight(addr, "/") + "/v1/data/" + strings.Trim(path, "/"),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type opaInput struct {
+	Subject string `json:"subject"`
+	UserID  int64  `json:"user_id"`
+	App     string `json:"app"`
+	Action  string `json:"action"`
+}
+
+type opaResponse struct {
+	Result *bool `json:"result"`
+}
+
+func (o *OPA) Decide(ctx context.Context, req Request) (bool, error) {
+	const op = "policy.OPA.Decide"
+
+	body, err := json.Marshal(map[string]opaInput{
+		"input": {
+			Subject: req.Subject,
+			UserID:  req.UserID,
+			App:     req.App,
+			Action:  req.Action,
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(httpReq)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s: unexpected status %d", op, resp.StatusCode)
+	}
+
+	var res opaResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOPAResponseSize)).Decode(&res); err != nil {
+		return false, fmt.Errorf("%s: failed to decode response: %w", op, err)
+	}
+
+	// Неопределённое правило (нет result) — отказ
+	return res.Result != nil && *res.Result, nil
+}
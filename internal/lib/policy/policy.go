@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sso/internal/lib/audit"
+	"sync"
+	"time"
+)
+
+const (
+	ActionLogin    = "login"
+	ActionValidate = "validate"
+)
+
+// Request describes an access decision: may the user perform the action in the app.
+type Request struct {
+	// Subject is the email of the user.
+	Subject string
+	UserID  int64
+	App     string
+	Action  string
+}
+
+// Decider makes access decisions, e.g. by a Casbin model or an OPA policy.
+type Decider interface {
+	Decide(ctx context.Context, req Request) (bool, error)
+}
+
+// RoleProvider is implemented by deciders that assign roles to subjects, e.g. Casbin.
+type RoleProvider interface {
+	Roles(ctx context.Context, subject string) ([]string, error)
+}
+
+type Auditor interface {
+	Audit(ctx context.Context, e audit.Event)
+}
+
+type decision struct {
+	allowed   bool
+	expiresAt time.Time
+}
+
+// Engine delegates access decisions to the decider configured for the app.
+// Apps without a decider are allowed everything. Decisions are cached for a TTL
+// and every decision is audited, errors are neither cached nor treated as allowed.
+type Engine struct {
+	deciders map[string]Decider
+	auditor  Auditor
+	ttl      time.Duration
+	// maxEntries bounds the cache, expired entries are swept when it is reached.
+	maxEntries int
+
+	mu    sync.Mutex
+	cache map[Request]decision
+}
+
+func New(deciders map[string]Decider, auditor Auditor, ttl time.Duration, maxEntries int) *Engine {
+	return &Engine{
+		deciders:   deciders,
+		auditor:    auditor,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		cache:      make(map[Request]decision),
+	}
+}
+
+// Decide reports whether the request is allowed by the policy of its app.
+func (e *Engine) Decide(ctx context.Context, req Request) (bool, error) {
+	const op = "policy.Decide"
+
+	decider, ok := e.deciders[req.App]
+	if !ok {
+		return true, nil
+	}
+
+	allowed, cached := e.cached(req)
+	if !cached {
+		var err error
+		allowed, err = decider.Decide(ctx, req)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		e.put(req, allowed)
+	}
+
+	action := audit.ActionPolicyAllowed
+	if !allowed {
+		action = audit.ActionPolicyDenied
+	}
+	e.auditor.Audit(ctx, audit.Event{
+		Action:  action,
+		Actor:   "policy",
+		Email:   req.Subject,
+		AppCode: req.App,
+		Detail:  req.Action,
+	})
+
+	return allowed, nil
+}
+
+// Roles returns the roles of the subject in the policy of the app,
+// nil for apps without a decider or with a decider that has no roles.
+func (e *Engine) Roles(ctx context.Context, app string, subject string) ([]string, error) {
+	const op = "policy.Roles"
+
+	provider, ok := e.deciders[app].(RoleProvider)
+	if !ok {
+		return nil, nil
+	}
+
+	roles, err := provider.Roles(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (e *Engine) cached(req Request) (bool, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	d, ok := e.cache[req]
+	if !ok || time.Now().After(d.expiresAt) {
+		return false, false
+	}
+
+	return d.allowed, true
+}
+
+func (e *Engine) put(req Request, allowed bool) {
+	if e.ttl <= 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	if len(e.cache) >= e.maxEntries {
+		for k, d := range e.cache {
+			if now.After(d.expiresAt) {
+				delete(e.cache, k)
+			}
+		}
+
+		// Все решения ещё действуют: кэш не растёт, следующий запрос снова уйдёт в движок
+		if len(e.cache) >= e.maxEntries {
+			return
+		}
+	}
+
+	e.cache[req] = decision{allowed: allowed, expiresAt: now.Add(e.ttl)}
+}
@@ -0,0 +1,23 @@
+package principal
+
+import "context"
+
+// Principal is the authenticated caller of an RPC.
+type Principal struct {
+	// Subject identifies the caller in logs and audit events.
+	Subject string
+	Admin   bool
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the caller.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the caller stored in ctx.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
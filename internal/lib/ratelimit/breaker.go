@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling Redis while the breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Breaker stops calling Redis after Threshold consecutive failures for Cooldown,
+// so a dead Redis fails requests at once instead of adding its timeouts to each of them.
+// After the cooldown a single call probes Redis: success closes the breaker, failure opens it again.
+// A nil *Breaker lets all calls through.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu          sync.Mutex
+	failures    int
+	openedUntil time.Time
+	probing     bool
+}
+
+// NewBreaker returns a breaker opening after threshold consecutive failures, threshold must be positive.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Do calls fn unless the breaker is open and records its outcome.
+// Context cancellation and deadlines of the caller are not counted as Redis failures.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b == nil {
+		return fn(ctx)
+	}
+
+	probe, err := b.acquire()
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx)
+	switch {
+	case err == nil:
+		b.record(probe, false)
+	case ctx.Err() != nil:
+		// Об исправности Redis ничего не известно: состояние не меняется
+		b.release(probe)
+	default:
+		b.record(probe, true)
+	}
+
+	return err
+}
+
+func (b *Breaker) acquire() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false, nil
+	}
+
+	// Открыт: до конца паузы и пока идёт пробный вызов остальные отклоняются
+	if b.probing || time.Now().Before(b.openedUntil) {
+		return false, ErrCircuitOpen
+	}
+
+	b.probing = true
+
+	return true, nil
+}
+
+func (b *Breaker) release(probe bool) {
+	if !probe {
+		return
+	}
+
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *Breaker) record(probe bool, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Clock reports the current time of the Redis server, so every replica derives
+// the same window buckets regardless of its local clock drift.
+// The offset to the Redis clock is refreshed every resync interval instead of on each call.
+type Clock struct {
+	client redis.Cmdable
+	resync time.Duration
+
+	mu       sync.Mutex
+	offset   time.Duration
+	syncedAt time.Time
+	synced   bool
+}
+
+func NewClock(client redis.Cmdable, resync time.Duration) *Clock {
+	return &Clock{
+		client: client,
+		resync: resync,
+	}
+}
+
+// Now returns the local time adjusted to the Redis server clock.
+// If a resync fails, the previously measured offset keeps being used.
+func (c *Clock) Now(ctx context.Context) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.synced || time.Since(c.syncedAt) >= c.resync {
+		if err := c.sync(ctx); err != nil && !c.synced {
+			return time.Time{}, err
+		}
+	}
+
+	return time.Now().Add(c.offset), nil
+}
+
+func (c *Clock) sync(ctx context.Context) error {
+	before := time.Now()
+	serverTime, err := c.client.Time(ctx).Result()
+	if err != nil {
+		return err
+	}
+	after := time.Now()
+
+	// Время сервера соответствует середине запроса
+	local := before.Add(after.Sub(before) / 2)
+
+	c.offset = serverTime.Sub(local)
+	c.syncedAt = after
+	c.synced = true
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// failScript counts a failure of the key and starts the next lockout step once Threshold failures are reached.
+// The state is a hash: failures since the last lockout, the reached step and the lockout end in Redis time (ms).
+// KEYS[1] — state key; ARGV[1] — threshold, ARGV[2] — state TTL (ms), ARGV[3..] — step durations (ms).
+// Returns the lockout left in ms, 0 if the key is not locked.
+var failScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local lockedUntil = tonumber(redis.call('HGET', KEYS[1], 'until') or '0')
+if lockedUntil > now then
+	return lockedUntil - now
+end
+local lockedFor = 0
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+if failures >= tonumber(ARGV[1]) then
+	local step = redis.call('HINCRBY', KEYS[1], 'step', 1)
+	local steps = #ARGV - 2
+	if step > steps then
+		step = steps
+	end
+	lockedFor = tonumber(ARGV[2 + step])
+	redis.call('HSET', KEYS[1], 'failures', 0, 'until', now + lockedFor)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return lockedFor
+`)
+
+// lockedScript returns the lockout left of the key in ms, 0 if it is not locked. KEYS[1] — state key.
+var lockedScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local lockedUntil = tonumber(redis.call('HGET', KEYS[1], 'until') or '0')
+if lockedUntil > now then
+	return lockedUntil - now
+end
+return 0
+`)
+
+// stateScript returns the failures, the lockout left (ms) and the state TTL (ms) of the key. KEYS[1] — state key.
+var stateScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local state = redis.call('HMGET', KEYS[1], 'failures', 'until')
+local failures = tonumber(state[1] or '0')
+local lockedFor = tonumber(state[2] or '0') - now
+if lockedFor < 0 then
+	lockedFor = 0
+end
+return {failures, lockedFor, redis.call('PTTL', KEYS[1])}
+`)
+
+// LockoutOptions configures escalating lockouts.
+type LockoutOptions struct {
+	// Threshold is the number of failures that starts the next lockout step.
+	Threshold int64
+	// Steps are the lockout durations of consecutive lockouts, the last one repeats, e.g. 1m, 5m, 30m.
+	Steps []time.Duration
+	// ResetAfter forgets the failures and the reached step after this long without failures.
+	ResetAfter time.Duration
+}
+
+// Lockout blocks a key with exponentially growing durations after repeated failures,
+// unlike Limiter which counts all hits in fixed windows. The per-key state lives in Redis
+// and is measured by the Redis clock, so all replicas see the same lockouts.
+type Lockout struct {
+	client  redis.Cmdable
+	breaker *Breaker
+	opts    LockoutOptions
+	// ttl keeps the state until ResetAfter passes after the longest lockout ends.
+	ttl time.Duration
+}
+
+// NewLockout returns a lockout calling Redis through breaker, nil disables the breaker.
+func NewLockout(client redis.Cmdable, breaker *Breaker, opts LockoutOptions) (*Lockout, error) {
+	const op = "ratelimit.NewLockout"
+
+	if opts.Threshold <= 0 || len(opts.Steps) == 0 || opts.ResetAfter <= 0 {
+		return nil, fmt.Errorf("%s: threshold, steps and reset period must be positive", op)
+	}
+
+	for _, step := range opts.Steps {
+		if step < time.Millisecond {
+			return nil, fmt.Errorf("%s: lockout step %s is too short", op, step)
+		}
+	}
+
+	return &Lockout{
+		client:  client,
+		breaker: breaker,
+		opts:    opts,
+		ttl:     slices.Max(opts.Steps) + opts.ResetAfter,
+	}, nil
+}
+
+// Locked returns how long the key stays locked, 0 if it is not.
+func (l *Lockout) Locked(ctx context.Context, key string) (time.Duration, error) {
+	const op = "ratelimit.Lockout.Locked"
+
+	var ms int64
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		ms, err = lockedScript.Run(ctx, l.client, []string{key}).Int64()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Fail counts a failure of the key and returns the lockout in effect after it, 0 if none.
+// Failures while the key is locked are not counted.
+func (l *Lockout) Fail(ctx context.Context, key string) (time.Duration, error) {
+	const op = "ratelimit.Lockout.Fail"
+
+	args := make([]any, 0, len(l.opts.Steps)+2)
+	args = append(args, l.opts.Threshold, l.ttl.Milliseconds())
+	for _, step := range l.opts.Steps {
+		args = append(args, step.Milliseconds())
+	}
+
+	var ms int64
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		ms, err = failScript.Run(ctx, l.client, []string{key}, args...).Int64()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Counter returns the state of the key named rule, e.g. for support to see why a login is locked.
+func (l *Lockout) Counter(ctx context.Context, key string, rule string) (Counter, error) {
+	const op = "ratelimit.Lockout.Counter"
+
+	var state []int64
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		state, err = stateScript.Run(ctx, l.client, []string{key}).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return Counter{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return Counter{
+		Rule:      rule,
+		Count:     state[0],
+		Limit:     l.opts.Threshold,
+		ResetIn:   max(time.Duration(state[2])*time.Millisecond, 0),
+		LockedFor: time.Duration(state[1]) * time.Millisecond,
+	}, nil
+}
+
+// Reset forgets the failures and lockouts of the key, e.g. after a successful login.
+func (l *Lockout) Reset(ctx context.Context, key string) error {
+	const op = "ratelimit.Lockout.Reset"
+
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		return l.client.Del(ctx, key).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidWindow is returned for windows shorter than a millisecond, the precision of the buckets.
+var ErrInvalidWindow = errors.New("rate limit window must be at least 1ms")
+
+// expireSlack keeps a window counter alive a bit longer than the window itself,
+// covering replicas whose offset to the Redis clock is slightly behind.
+const expireSlack = time.Second
+
+// Result is the outcome of counting a hit.
+type Result struct {
+	Allowed bool
+	// Count is the number of hits in the current window, including this one.
+	Count int64
+	// RetryAfter is the time left until the current window ends.
+	RetryAfter time.Duration
+}
+
+// Counter is the state of a limit or a lockout of a subject, as shown to admins.
+type Counter struct {
+	// Rule is the name of the limit, e.g. "login:email".
+	Rule string
+	// Count is the number of hits in the current window, for lockouts the failures since the last lockout.
+	Count int64
+	// Limit is the count at which the subject is limited.
+	Limit int64
+	// ResetIn is the time left until the counter resets by itself.
+	ResetIn time.Duration
+	// LockedFor is the time left of the lockout in effect, lockouts only.
+	LockedFor time.Duration
+}
+
+// Limiter is a fixed-window rate limiter backed by Redis.
+// Windows are aligned to the Redis server clock, so all replicas share the same buckets.
+type Limiter struct {
+	client  redis.Cmdable
+	clock   *Clock
+	breaker *Breaker
+}
+
+// New returns a limiter calling Redis through breaker, nil disables the breaker.
+func New(client redis.Cmdable, clockResync time.Duration, breaker *Breaker) *Limiter {
+	return &Limiter{
+		client:  client,
+		clock:   NewClock(client, clockResync),
+		breaker: breaker,
+	}
+}
+
+// Allow counts a hit for key in the current window and reports whether it is within limit.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	const op = "ratelimit.Allow"
+
+	// Ошибка конфигурации, а не Redis: она не должна открывать breaker
+	if window < time.Millisecond {
+		return Result{}, fmt.Errorf("%s: %w", op, ErrInvalidWindow)
+	}
+
+	var res Result
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = l.allow(ctx, key, limit, window)
+		return err
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res, nil
+}
+
+func (l *Limiter) allow(ctx context.Context, key string, limit int64, window time.Duration) (Result, error) {
+	now, err := l.clock.Now(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	bucketKey, windowEnd := bucketOf(key, now, window)
+
+	pipe := l.client.TxPipeline()
+	incr := pipe.Incr(ctx, bucketKey)
+	pipe.PExpireAt(ctx, bucketKey, windowEnd.Add(expireSlack))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Result{}, err
+	}
+
+	count := incr.Val()
+
+	return Result{
+		Allowed:    count <= limit,
+		Count:      count,
+		RetryAfter: windowEnd.Sub(now),
+	}, nil
+}
+
+// Count returns the hits of key in the current window without counting a new one.
+func (l *Limiter) Count(ctx context.Context, key string, window time.Duration) (Result, error) {
+	const op = "ratelimit.Count"
+
+	if window < time.Millisecond {
+		return Result{}, fmt.Errorf("%s: %w", op, ErrInvalidWindow)
+	}
+
+	var res Result
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		now, err := l.clock.Now(ctx)
+		if err != nil {
+			return err
+		}
+
+		bucketKey, windowEnd := bucketOf(key, now, window)
+
+		count, err := l.client.Get(ctx, bucketKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		res = Result{
+			Count:      count,
+			RetryAfter: windowEnd.Sub(now),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res, nil
+}
+
+// Reset forgets the hits of key in the current window.
+func (l *Limiter) Reset(ctx context.Context, key string, window time.Duration) error {
+	const op = "ratelimit.Reset"
+
+	if window < time.Millisecond {
+		return fmt.Errorf("%s: %w", op, ErrInvalidWindow)
+	}
+
+	err := l.breaker.Do(ctx, func(ctx context.Context) error {
+		now, err := l.clock.Now(ctx)
+		if err != nil {
+			return err
+		}
+
+		bucketKey, _ := bucketOf(key, now, window)
+
+		return l.client.Del(ctx, bucketKey).Err()
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// bucketOf returns the counter key of the window containing now and the end of that window.
+// The window must be at least a millisecond.
+func bucketOf(key string, now time.Time, window time.Duration) (string, time.Time) {
+	bucket := now.UnixMilli() / window.Milliseconds()
+
+	return fmt.Sprintf("%s:%d", key, bucket), time.UnixMilli((bucket + 1) * window.Milliseconds())
+}
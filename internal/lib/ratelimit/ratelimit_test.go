@@ -0,0 +1,25 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sso/internal/lib/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_InvalidWindow(t *testing.T) {
+	// Redis не нужен: окно проверяется до первого запроса
+	limiter := ratelimit.New(nil, time.Minute, nil)
+
+	for _, window := range []time.Duration{0, time.Microsecond, -time.Second} {
+		_, err := limiter.Allow(context.Background(), "login:email:a", 5, window)
+		require.ErrorIs(t, err, ratelimit.ErrInvalidWindow)
+
+		_, err = limiter.Count(context.Background(), "login:email:a", window)
+		require.ErrorIs(t, err, ratelimit.ErrInvalidWindow)
+
+		require.ErrorIs(t, limiter.Reset(context.Background(), "login:email:a", window), ratelimit.ErrInvalidWindow)
+	}
+}
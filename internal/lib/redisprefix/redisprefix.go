@@ -0,0 +1,111 @@
+package redisprefix
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keys tells where a command takes its keys.
+type keys int
+
+const (
+	// firstKey — the first argument is the only key.
+	firstKey keys = iota + 1
+	// allKeys — all arguments are keys.
+	allKeys
+	// scriptKeys — EVAL-like: the number of keys, then the keys.
+	scriptKeys
+)
+
+// commands lists the commands with keys. Other commands are sent as is,
+// so a new command with keys must be added here to get the prefix.
+// Pub/sub channels are not keys: SUBSCRIBE bypasses hooks, so publishers and subscribers prefix them themselves.
+var commands = map[string]keys{
+	"get": firstKey, "set": firstKey, "setnx": firstKey, "setex": firstKey, "psetex": firstKey,
+	"getdel": firstKey, "getex": firstKey, "getset": firstKey, "append": firstKey, "strlen": firstKey,
+	"incr": firstKey, "incrby": firstKey, "decr": firstKey, "decrby": firstKey,
+	"expire": firstKey, "pexpire": firstKey, "expireat": firstKey, "pexpireat": firstKey,
+	"ttl": firstKey, "pttl": firstKey, "persist": firstKey, "type": firstKey,
+	"hget": firstKey, "hset": firstKey, "hsetnx": firstKey, "hmget": firstKey, "hmset": firstKey,
+	"hgetall": firstKey, "hdel": firstKey, "hincrby": firstKey, "hexists": firstKey, "hlen": firstKey,
+	"sadd": firstKey, "srem": firstKey, "smembers": firstKey, "sismember": firstKey, "scard": firstKey,
+	"zadd": firstKey, "zrem": firstKey, "zrange": firstKey, "zrangebyscore": firstKey,
+	"zremrangebyscore": firstKey, "zcard": firstKey, "zscore": firstKey,
+	"lpush": firstKey, "rpush": firstKey, "lrange": firstKey, "ltrim": firstKey, "llen": firstKey,
+
+	"del": allKeys, "unlink": allKeys, "exists": allKeys, "touch": allKeys, "mget": allKeys, "watch": allKeys,
+
+	"eval": scriptKeys, "evalsha": scriptKeys, "eval_ro": scriptKeys, "evalsha_ro": scriptKeys,
+}
+
+// Hook prepends a prefix to the keys of every command, e.g. "sso:prod:",
+// so several environments can share one Redis without their keys colliding.
+// Keys built by the storage and the limiters stay unaware of the prefix.
+type Hook struct {
+	prefix string
+}
+
+var _ redis.Hook = (*Hook)(nil)
+
+func New(prefix string) *Hook {
+	return &Hook{prefix: prefix}
+}
+
+func (h *Hook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *Hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.apply(cmd)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *Hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			h.apply(cmd)
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// apply rewrites the keys of cmd in place.
+func (h *Hook) apply(cmd redis.Cmder) {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return
+	}
+
+	name, _ := args[0].(string)
+
+	switch commands[strings.ToLower(name)] {
+	case firstKey:
+		h.prefixArg(args, 1)
+	case allKeys:
+		for i := 1; i < len(args); i++ {
+			h.prefixArg(args, i)
+		}
+	case scriptKeys:
+		// EVAL script numkeys key... arg...
+		if len(args) < 3 {
+			return
+		}
+		n, ok := args[2].(int)
+		if !ok {
+			return
+		}
+		for i := 3; i < 3+n && i < len(args); i++ {
+			h.prefixArg(args, i)
+		}
+	}
+}
+
+func (h *Hook) prefixArg(args []any, i int) {
+	if key, ok := args[i].(string); ok {
+		args[i] = h.prefix + key
+	}
+}
@@ -0,0 +1,46 @@
+package reqctx
+
+import (
+	"context"
+	"sso/internal/lib/device"
+)
+
+// Info is what is known about the caller of a request: it is captured once at the transport
+// and read by the service layer for audit logging, device tracking and geo checks.
+type Info struct {
+	// IP is the client address: the peer address, or the address forwarded by a trusted proxy.
+	IP        string
+	UserAgent string
+	// DeviceID is a stable device identifier sent by the client, if any.
+	DeviceID string
+	// DeviceToken is the token of a remembered device sent by the client, if any. It is a secret.
+	DeviceToken string
+	// Headers are the values of the captured custom headers by lower-case name.
+	Headers map[string]string
+}
+
+type ctxKey struct{}
+
+// Device returns the device the request came from.
+func (i Info) Device() device.Info {
+	return device.Info{
+		ID:        i.DeviceID,
+		UserAgent: i.UserAgent,
+		IP:        i.IP,
+	}
+}
+
+// Header returns the value of a captured custom header, empty if it was not sent or not captured.
+func (i Info) Header(name string) string {
+	return i.Headers[name]
+}
+
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+// FromContext returns the caller of the request, the zero Info outside of a request.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(ctxKey{}).(Info)
+	return info
+}
@@ -0,0 +1,132 @@
+// Package risk scores logins by the signals of account takeover.
+package risk
+
+import (
+	"math"
+	"time"
+)
+
+// Signals are what is suspicious about a login.
+type Signals struct {
+	// FailedAttempts is the number of recent failed password attempts for the user.
+	FailedAttempts int
+	// NewIP marks an address the user has not logged in from before.
+	NewIP bool
+	// ImpossibleTravel marks a login too far from the previous one for the time between them.
+	ImpossibleTravel bool
+	// Datacenter marks an address of a hosting or cloud provider rather than an ISP.
+	Datacenter bool
+}
+
+// Weights are the points each signal adds to the score.
+type Weights struct {
+	// FailedAttempt is added for every failed attempt, up to MaxFailedAttempts of them.
+	FailedAttempt     int
+	MaxFailedAttempts int
+	NewIP             int
+	ImpossibleTravel  int
+	Datacenter        int
+}
+
+// Score sums the weights of the raised signals.
+func Score(s Signals, w Weights) int {
+	score := min(s.FailedAttempts, w.MaxFailedAttempts) * w.FailedAttempt
+
+	if s.NewIP {
+		score += w.NewIP
+	}
+	if s.ImpossibleTravel {
+		score += w.ImpossibleTravel
+	}
+	if s.Datacenter {
+		score += w.Datacenter
+	}
+
+	return score
+}
+
+// Names lists the raised signals, for logs and audit.
+func (s Signals) Names() []string {
+	var names []string
+	if s.FailedAttempts > 0 {
+		names = append(names, "failed_attempts")
+	}
+	if s.NewIP {
+		names = append(names, "new_ip")
+	}
+	if s.ImpossibleTravel {
+		names = append(names, "impossible_travel")
+	}
+	if s.Datacenter {
+		names = append(names, "datacenter")
+	}
+	return names
+}
+
+const (
+	earthRadiusKm = 6371
+	// travelSlackKm is ignored as the error of IP geolocation: neighbouring cities often swap.
+	travelSlackKm = 100
+)
+
+// Point is a location on Earth in degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Known reports whether the point is set: GeoIP gives zero coordinates for unknown addresses.
+func (p Point) Known() bool {
+	return p.Latitude != 0 || p.Longitude != 0
+}
+
+// Distance returns the great-circle distance between the points in kilometers.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ImpossibleTravel reports whether getting from one point to the other within elapsed
+// takes a speed above maxSpeed km/h. Unknown points are never impossible.
+func ImpossibleTravel(from, to Point, elapsed time.Duration, maxSpeed float64) bool {
+	if !from.Known() || !to.Known() || maxSpeed <= 0 {
+		return false
+	}
+
+	distance := Distance(from, to) - travelSlackKm
+	if distance <= 0 {
+		return false
+	}
+
+	return distance/elapsed.Hours() > maxSpeed
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// DatacenterASNs are the autonomous systems of large hosting and cloud providers,
+// used when no list is configured.
+var DatacenterASNs = []uint32{
+	16509, 14618, // Amazon
+	15169, 396982, // Google
+	8075,   // Microsoft
+	14061,  // DigitalOcean
+	24940,  // Hetzner
+	16276,  // OVH
+	63949,  // Akamai Linode
+	20473,  // Vultr
+	31898,  // Oracle
+	45102,  // Alibaba
+	132203, // Tencent
+	12876,  // Scaleway
+	51167,  // Contabo
+	49505,  // Selectel
+	200350, // Yandex Cloud
+	9123,   // Timeweb
+}
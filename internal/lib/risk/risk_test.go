@@ -0,0 +1,62 @@
+package risk
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	w := Weights{FailedAttempt: 10, MaxFailedAttempts: 3, NewIP: 20, ImpossibleTravel: 60, Datacenter: 30}
+
+	tests := []struct {
+		name string
+		s    Signals
+		want int
+	}{
+		{"none", Signals{}, 0},
+		{"failures", Signals{FailedAttempts: 2}, 20},
+		{"failures capped", Signals{FailedAttempts: 10}, 30},
+		{"all", Signals{FailedAttempts: 1, NewIP: true, ImpossibleTravel: true, Datacenter: true}, 120},
+	}
+
+	for _, tt := range tests {
+		if got := Score(tt.s, w); got != tt.want {
+			t.Errorf("%s: Score() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	moscow := Point{Latitude: 55.75, Longitude: 37.62}
+	berlin := Point{Latitude: 52.52, Longitude: 13.40}
+
+	// Около 1600 км по большому кругу
+	if got := Distance(moscow, berlin); math.Abs(got-1608) > 10 {
+		t.Fatalf("Distance() = %.0f km", got)
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	moscow := Point{Latitude: 55.75, Longitude: 37.62}
+	berlin := Point{Latitude: 52.52, Longitude: 13.40}
+	nearMoscow := Point{Latitude: 55.9, Longitude: 37.9}
+
+	tests := []struct {
+		name     string
+		from, to Point
+		elapsed  time.Duration
+		want     bool
+	}{
+		{"flight too fast", moscow, berlin, 30 * time.Minute, true},
+		{"flight", moscow, berlin, 3 * time.Hour, false},
+		{"within geolocation error", moscow, nearMoscow, time.Minute, false},
+		{"unknown point", Point{}, berlin, time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		if got := ImpossibleTravel(tt.from, tt.to, tt.elapsed, 1000); got != tt.want {
+			t.Errorf("%s: ImpossibleTravel() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
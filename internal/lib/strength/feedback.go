@@ -0,0 +1,122 @@
+package strength
+
+import "strings"
+
+// Warnings and suggestions follow the wording of zxcvbn, so frontends using it show the same texts.
+const (
+	warnTop10        = "This is a top-10 common password"
+	warnTop100       = "This is a very common password"
+	warnCommon       = "This is similar to a commonly used password"
+	warnUserInput    = "Passwords based on your name or email are easy to guess"
+	warnSequence     = "Sequences like abc or 6543 are easy to guess"
+	warnRepeatChar   = `Repeats like "aaa" are easy to guess`
+	warnRepeat       = `Repeats like "abcabcabc" are only slightly harder to guess than "abc"`
+	warnKeyboard     = "Straight rows of keys are easy to guess"
+	warnYear         = "Recent years are easy to guess"
+	suggestWords     = "Use a few words, avoid common phrases"
+	suggestNoSymbols = "No need for symbols, digits, or uppercase letters"
+	suggestAddWord   = "Add another word or two. Uncommon words are better."
+	suggestCaps      = "Capitalization doesn't help very much"
+	suggestReversed  = "Reversed words aren't much harder to guess"
+	suggestL33t      = "Predictable substitutions like '@' instead of 'a' don't help very much"
+	suggestSequence  = "Avoid sequences"
+	suggestRepeat    = "Avoid repeated words and characters"
+	suggestKeyboard  = "Use a longer keyboard pattern with more turns"
+	suggestYear      = "Avoid recent years and years that are associated with you"
+	suggestPersonal  = "Avoid your name, email and other personal information"
+)
+
+// strongEnoughScore is the score from which passwords get no feedback.
+const strongEnoughScore = 3
+
+// feedback explains the score by the longest pattern of the password.
+func feedback(score int, seq []match) (string, []string) {
+	if score >= strongEnoughScore {
+		return "", nil
+	}
+
+	var longest *match
+	for k := range seq {
+		if seq[k].pattern == bruteforce {
+			continue
+		}
+		if longest == nil || seq[k].j-seq[k].i > longest.j-longest.i {
+			longest = &seq[k]
+		}
+	}
+
+	suggestions := []string{suggestAddWord}
+	if longest == nil {
+		return "", suggestions
+	}
+
+	switch longest.pattern {
+	case dictionary:
+		var warning string
+		switch {
+		case longest.user:
+			warning = warnUserInput
+			suggestions = append(suggestions, suggestPersonal)
+		case len(seq) == 1 && !longest.l33t && !longest.reversed && longest.rank <= 10:
+			warning = warnTop10
+		case len(seq) == 1 && !longest.l33t && !longest.reversed && longest.rank <= 100:
+			warning = warnTop100
+		default:
+			warning = warnCommon
+		}
+
+		if longest.upper {
+			suggestions = append(suggestions, suggestCaps)
+		}
+		if longest.reversed {
+			suggestions = append(suggestions, suggestReversed)
+		}
+		if longest.l33t {
+			suggestions = append(suggestions, suggestL33t)
+		}
+		return warning, suggestions
+	case sequence:
+		return warnSequence, append(suggestions, suggestSequence)
+	case repeat:
+		warning := warnRepeat
+		if longest.unit == 1 {
+			warning = warnRepeatChar
+		}
+		return warning, append(suggestions, suggestRepeat)
+	case keyboard:
+		return warnKeyboard, append(suggestions, suggestKeyboard)
+	case year:
+		return warnYear, append(suggestions, suggestYear)
+	}
+
+	return "", suggestions
+}
+
+// commonPasswords are the most used passwords from public breach corpora, most common first.
+const commonPasswords = `123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon
+123123 baseball abc123 football monkey letmein 696969 shadow master 666666
+qwertyuiop 123321 mustang 1234567890 michael 654321 superman 1qaz2wsx 7777777 121212
+000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm asdfgh hunter
+buster soccer harley batman andrew tigger sunshine iloveyou 2000 charlie
+robert thomas hockey ranger daniel starwars klaster 112233 george computer
+michelle jessica pepper 1111 zxcvbn 555555 11111111 131313 freedom 777777
+pass maggie 159753 aaaaaa ginger princess joshua cheese amanda summer
+love ashley nicole chelsea biteme matthew access yankees 987654321 dallas
+austin thunder taylor matrix william corvette merlin diamond cookie orange
+welcome admin login secret passw0rd qwerty123 password1 administrator root changeme
+hello hello123 whatever qwertyu 1q2w3e4r 1q2w3e 1q2w3e4r5t zaq12wsx default guest
+test test123 user sample example temp temp123 demo letmein123 welcome1 p@ssword
+parol parol123 privet qwe123 ytrewq 1qazxsw2 marina natasha olga sergey
+dmitry andrey alexander vladimir elena svetlana tatiana irina spartak zenit`
+
+// commonRanks maps the common passwords to their rank, the number of guesses to reach them.
+var commonRanks = func() map[string]int {
+	words := strings.Fields(commonPasswords)
+	ranks := make(map[string]int, len(words))
+	for k, w := range words {
+		if _, ok := ranks[w]; !ok {
+			ranks[w] = k + 1
+		}
+	}
+	return ranks
+}()
@@ -0,0 +1,500 @@
+package strength
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Result is the estimated strength of a password in the terms of zxcvbn.
+type Result struct {
+	// Score is from 0 (guessed instantly) to 4 (very unguessable).
+	Score int
+	// Guesses is the estimated number of guesses needed to crack the password.
+	Guesses float64
+	// Warning explains what makes the password weak, empty for strong passwords.
+	Warning string
+	// Suggestions tell how to make the password stronger.
+	Suggestions []string
+}
+
+// MaxScore is the score of the strongest passwords.
+const MaxScore = 4
+
+// scoreGuesses are the upper bounds of guesses of scores 0 to 3.
+var scoreGuesses = [MaxScore]float64{1e3, 1e6, 1e8, 1e10}
+
+// maxLen bounds the analyzed part of the password, longer passwords are strong enough anyway.
+const maxLen = 128
+
+// bruteforceCardinality is the number of guesses per character not covered by patterns.
+const bruteforceCardinality = 10
+
+const (
+	minGuessesSingleChar = 10
+	minGuessesMultiChar  = 50
+)
+
+// Estimate estimates how hard the password is to guess. User inputs, e.g. the email
+// and the name of the user, are treated as known to an attacker.
+func Estimate(password string, userInputs ...string) Result {
+	runes := []rune(password)
+	if len(runes) > maxLen {
+		runes = runes[:maxLen]
+	}
+
+	if len(runes) == 0 {
+		return Result{Suggestions: []string{suggestWords, suggestNoSymbols}}
+	}
+
+	seq := mostGuessable(runes, findMatches(runes, userDictionary(userInputs)))
+
+	guesses := 1.0
+	for _, m := range seq {
+		guesses *= m.guesses
+	}
+	// Порядок шаблонов тоже приходится перебирать
+	guesses *= factorial(len(seq))
+
+	res := Result{Score: score(guesses), Guesses: guesses}
+	res.Warning, res.Suggestions = feedback(res.Score, seq)
+
+	return res
+}
+
+func score(guesses float64) int {
+	for s, bound := range scoreGuesses {
+		if guesses < bound+5 {
+			return s
+		}
+	}
+	return MaxScore
+}
+
+// match is a part of the password, runes [i, j], guessable with a pattern.
+type match struct {
+	i, j    int
+	pattern pattern
+	guesses float64
+
+	rank     int
+	reversed bool
+	l33t     bool
+	upper    bool
+	user     bool
+	// unit is the length of the repeated part of a repeat match.
+	unit int
+}
+
+type pattern int
+
+const (
+	bruteforce pattern = iota
+	dictionary
+	sequence
+	repeat
+	keyboard
+	year
+)
+
+// mostGuessable returns the sequence of matches covering the password with the fewest guesses,
+// gaps between matches are guessed by brute force.
+func mostGuessable(runes []rune, matches []match) []match {
+	n := len(runes)
+
+	byEnd := make([][]match, n)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// best[k][l] — минимум произведения попыток для первых k символов из l шаблонов
+	best := make([][]float64, n+1)
+	prev := make([][]match, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		prev[k] = make([]match, n+1)
+		for l := range best[k] {
+			best[k][l] = math.Inf(1)
+		}
+	}
+	best[0][0] = 1
+
+	for j := 0; j < n; j++ {
+		candidates := byEnd[j]
+		for i := 0; i <= j; i++ {
+			candidates = append(candidates, match{i: i, j: j, pattern: bruteforce, guesses: bruteforceGuesses(j - i + 1)})
+		}
+
+		for _, m := range candidates {
+			for l := 0; l < n; l++ {
+				if math.IsInf(best[m.i][l], 1) {
+					continue
+				}
+				// Подряд идущий перебор выгоднее считать одним куском
+				if m.pattern == bruteforce && l > 0 && prev[m.i][l].pattern == bruteforce {
+					continue
+				}
+				if g := best[m.i][l] * m.guesses; g < best[j+1][l+1] {
+					best[j+1][l+1] = g
+					prev[j+1][l+1] = m
+				}
+			}
+		}
+	}
+
+	bestLen := 0
+	bestGuesses := math.Inf(1)
+	for l := 1; l <= n; l++ {
+		if g := best[n][l] * factorial(l); g < bestGuesses {
+			bestGuesses = g
+			bestLen = l
+		}
+	}
+
+	seq := make([]match, bestLen)
+	for k, l := n, bestLen; l > 0; l-- {
+		m := prev[k][l]
+		seq[l-1] = m
+		k = m.i
+	}
+
+	return seq
+}
+
+func bruteforceGuesses(length int) float64 {
+	guesses := math.Pow(bruteforceCardinality, float64(length))
+	if length == 1 {
+		return math.Max(guesses, minGuessesSingleChar+1)
+	}
+	return math.Max(guesses, minGuessesMultiChar+1)
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+	return f
+}
+
+func findMatches(runes []rune, user map[string]int) []match {
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, user)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	for k := range matches {
+		least := float64(minGuessesMultiChar)
+		if matches[k].i == matches[k].j {
+			least = minGuessesSingleChar
+		}
+		matches[k].guesses = math.Max(matches[k].guesses, least)
+	}
+
+	return matches
+}
+
+// l33t maps common substitutions back to letters.
+var l33t = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// wordVariant is a form of a part of the password looked up in the dictionaries.
+type wordVariant struct {
+	word     string
+	reversed bool
+	l33t     bool
+}
+
+func dictionaryMatches(runes []rune, user map[string]int) []match {
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		// Смена регистра изменила длину: совпадения по словарю не ищутся
+		return nil
+	}
+
+	unl33ted := make([]rune, len(lower))
+	for k, r := range lower {
+		if sub, ok := l33t[r]; ok {
+			unl33ted[k] = sub
+		} else {
+			unl33ted[k] = r
+		}
+	}
+
+	var matches []match
+	for i := range lower {
+		for j := i + 1; j < len(lower); j++ {
+			word := string(lower[i : j+1])
+
+			variants := []wordVariant{{word: word}, {word: reverse(word), reversed: true}}
+			if sub := string(unl33ted[i : j+1]); sub != word {
+				variants = append(variants, wordVariant{word: sub, l33t: true})
+			}
+
+			upper := uppercaseVariations(runes[i : j+1])
+			for _, v := range variants {
+				rank, isUser := lookup(v.word, user)
+				if rank == 0 {
+					continue
+				}
+
+				m := match{i: i, j: j, pattern: dictionary, rank: rank, reversed: v.reversed, l33t: v.l33t, upper: upper > 1, user: isUser}
+				m.guesses = float64(rank) * upper
+				if v.reversed {
+					m.guesses *= 2
+				}
+				if v.l33t {
+					m.guesses *= l33tVariations(lower[i : j+1])
+				}
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	return matches
+}
+
+func lookup(word string, user map[string]int) (int, bool) {
+	if rank, ok := user[word]; ok {
+		return rank, true
+	}
+	if rank, ok := commonRanks[word]; ok {
+		return rank, false
+	}
+	return 0, false
+}
+
+// userDictionary splits the user inputs into lowercase words ranked by their order.
+func userDictionary(inputs []string) map[string]int {
+	words := make(map[string]int)
+	rank := 1
+	add := func(w string) {
+		if len([]rune(w)) < 3 {
+			return
+		}
+		if _, ok := words[w]; !ok {
+			words[w] = rank
+			rank++
+		}
+	}
+
+	for _, in := range inputs {
+		in = strings.ToLower(strings.TrimSpace(in))
+		// Из email важна локальная часть
+		if at := strings.LastIndexByte(in, '@'); at > 0 {
+			in = in[:at]
+		}
+		add(in)
+
+		parts := strings.FieldsFunc(in, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(parts) > 1 {
+			add(strings.Join(parts, ""))
+		}
+		for _, p := range parts {
+			add(p)
+		}
+	}
+
+	return words
+}
+
+// uppercaseVariations is the number of ways to capitalize the word as it is,
+// all lowercase words have one.
+func uppercaseVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && unicode.IsUpper(word[0]), upper == 1 && unicode.IsUpper(word[len(word)-1]):
+		// Всё заглавными, первая или последняя заглавная — перебираются первыми
+		return 2
+	}
+
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+func l33tVariations(word []rune) float64 {
+	subs := 0
+	for _, r := range word {
+		if _, ok := l33t[r]; ok {
+			subs++
+		}
+	}
+	return math.Max(2, math.Pow(2, float64(subs)))
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n - k + d)
+		r /= float64(d)
+	}
+	return r
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// sequenceMatches finds runs of at least three characters with a step of one, e.g. abc or 9876.
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i < len(runes)-2; {
+		delta := runes[i+1] - runes[i]
+		if delta != 1 && delta != -1 {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta {
+			j++
+		}
+		if j-i+1 < 3 {
+			i = j
+			continue
+		}
+
+		var base float64
+		switch first := unicode.ToLower(runes[i]); {
+		case first == 'a' || first == 'z' || first == '0' || first == '1' || first == '9':
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		default:
+			base = 26
+		}
+		guesses := base * float64(j-i+1)
+		if delta < 0 {
+			guesses *= 2
+		}
+
+		matches = append(matches, match{i: i, j: j, pattern: sequence, guesses: guesses})
+		i = j + 1
+	}
+
+	return matches
+}
+
+// repeatMatches finds substrings repeated at least twice in a row, e.g. aaa or abcabc.
+// At each position the repeat covering the most characters is taken.
+func repeatMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i < len(runes); {
+		bestUnit, bestCount := 0, 0
+		for unit := 1; i+2*unit <= len(runes); unit++ {
+			count := 1
+			for i+(count+1)*unit <= len(runes) && string(runes[i+count*unit:i+(count+1)*unit]) == string(runes[i:i+unit]) {
+				count++
+			}
+			if count >= 2 && count*unit >= 3 && count*unit > bestCount*bestUnit {
+				bestUnit, bestCount = unit, count
+			}
+		}
+		if bestCount == 0 {
+			i++
+			continue
+		}
+
+		// Повторяемая часть оценивается как отдельный пароль
+		base := Estimate(string(runes[i : i+bestUnit])).Guesses
+		end := i + bestCount*bestUnit
+		matches = append(matches, match{i: i, j: end - 1, pattern: repeat, guesses: base * float64(bestCount), unit: bestUnit})
+		i = end
+	}
+
+	return matches
+}
+
+// keyboardRows are the rows of the QWERTY and ЙЦУКЕН layouts.
+var keyboardRows = []string{
+	"1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./",
+	"йцукенгшщзхъ", "фывапролджэ", "ячсмитьбю",
+}
+
+// keyboardStarts approximates the number of keys a keyboard pattern can start from.
+const keyboardStarts = 47
+
+// keyboardMatches finds at least four adjacent keys of a row typed in order, e.g. qwer or lkjh.
+func keyboardMatches(runes []rune) []match {
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		return nil
+	}
+
+	var matches []match
+	for _, row := range keyboardRows {
+		for _, keys := range []string{row, reverse(row)} {
+			for i := 0; i < len(lower); i++ {
+				j := i
+				for j+1 < len(lower) && strings.Contains(keys, string(lower[i:j+2])) {
+					j++
+				}
+				if j-i+1 < 4 {
+					continue
+				}
+
+				guesses := keyboardStarts * float64(j-i+1) * uppercaseVariations(runes[i:j+1])
+				matches = append(matches, match{i: i, j: j, pattern: keyboard, guesses: guesses})
+				i = j
+			}
+		}
+	}
+
+	return matches
+}
+
+// referenceYear is the year recent years are counted from.
+const referenceYear = 2020
+
+// minYearSpace is the least number of years guessed for a year match.
+const minYearSpace = 20
+
+// yearMatches finds years from 1900 to 2099.
+func yearMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i+4 <= len(runes); i++ {
+		y := 0
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				y = -1
+				break
+			}
+			y = y*10 + int(r-'0')
+		}
+		if y < 1900 || y > 2099 {
+			continue
+		}
+
+		space := math.Max(math.Abs(float64(y-referenceYear)), minYearSpace)
+		matches = append(matches, match{i: i, j: i + 3, pattern: year, guesses: space})
+	}
+
+	return matches
+}
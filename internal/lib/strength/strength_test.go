@@ -0,0 +1,71 @@
+package strength
+
+import "testing"
+
+func TestEstimateScore(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+		maxScore   int
+		minScore   int
+	}{
+		{password: "", maxScore: 0},
+		{password: "password", maxScore: 0},
+		{password: "Password1", maxScore: 1},
+		{password: "p@ssw0rd", maxScore: 1},
+		{password: "drowssap", maxScore: 1},
+		{password: "qwertyuiop", maxScore: 0},
+		{password: "asdfghjkl", maxScore: 1},
+		{password: "abcdefgh", maxScore: 1},
+		{password: "aaaaaaaaaaaa", maxScore: 1},
+		{password: "abcabcabcabc", maxScore: 1},
+		{password: "1987", maxScore: 0},
+		{password: "john.smith1987", userInputs: []string{"john.smith@example.com"}, maxScore: 2},
+		{password: "correct horse battery staple", minScore: 4, maxScore: 4},
+		{password: "x7$Qm!p2Lr#9vK", minScore: 4, maxScore: 4},
+	}
+
+	for _, tt := range tests {
+		res := Estimate(tt.password, tt.userInputs...)
+		if res.Score < tt.minScore || res.Score > tt.maxScore {
+			t.Errorf("Estimate(%q).Score = %d (guesses %g), want %d..%d", tt.password, res.Score, res.Guesses, tt.minScore, tt.maxScore)
+		}
+	}
+}
+
+func TestEstimateFeedback(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+		warning    string
+	}{
+		{password: "password", warning: warnTop10},
+		{password: "qwerty", warning: warnTop10},
+		{password: "sdfghjkl", warning: warnKeyboard},
+		{password: "ghijklmn", warning: warnSequence},
+		{password: "zzzzzzzzz", warning: warnRepeatChar},
+		{password: "johnsmith", userInputs: []string{"john.smith@example.com"}, warning: warnUserInput},
+		{password: "x7$Qm!p2Lr#9vK"},
+	}
+
+	for _, tt := range tests {
+		res := Estimate(tt.password, tt.userInputs...)
+		if res.Warning != tt.warning {
+			t.Errorf("Estimate(%q).Warning = %q, want %q", tt.password, res.Warning, tt.warning)
+		}
+		if tt.warning != "" && len(res.Suggestions) == 0 {
+			t.Errorf("Estimate(%q) has no suggestions", tt.password)
+		}
+	}
+}
+
+func TestEstimateLong(t *testing.T) {
+	long := make([]byte, 10000)
+	for k := range long {
+		long[k] = 'a'
+	}
+
+	if res := Estimate(string(long)); res.Score > 1 {
+		t.Fatalf("Estimate(a * 10000).Score = %d", res.Score)
+	}
+}
@@ -0,0 +1,116 @@
+// Package systemd implements the parts of the systemd service protocol the server needs without
+// linking libsystemd: sockets passed by socket activation (sd_listen_fds) and state notifications
+// (sd_notify).
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation, SD_LISTEN_FDS_START.
+const listenFDsStart = 3
+
+// States sent by Notify.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+)
+
+// DefaultName is the name systemd gives to sockets without FileDescriptorName.
+const DefaultName = "unknown"
+
+// MainPID is the state telling systemd the main process of the service changed to pid,
+// systemd accepts it from another process only with NotifyAccess=all.
+func MainPID(pid int) string {
+	return "MAINPID=" + strconv.Itoa(pid)
+}
+
+var ErrInvalidListenFDs = errors.New("invalid LISTEN_FDS")
+
+// Listeners returns the sockets passed by systemd socket activation keyed by their
+// FileDescriptorName, nil if the process was not activated by a socket. The activation
+// variables are unset, so child processes don't take the sockets for theirs.
+func Listeners() (map[string][]net.Listener, error) {
+	const op = "systemd.Listeners"
+
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	// Переменные могли достаться по наследству от родителя, которому сокеты и предназначались
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrInvalidListenFDs, os.Getenv("LISTEN_FDS"))
+	}
+
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	listeners := make(map[string][]net.Listener, n)
+	for i := 0; i < n; i++ {
+		name := DefaultName
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+
+		// FileListener дублирует дескриптор с close-on-exec, исходный больше не нужен
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, ls := range listeners {
+				for _, l := range ls {
+					_ = l.Close()
+				}
+			}
+			return nil, fmt.Errorf("%s: socket %d (%s): %w", op, listenFDsStart+i, name, err)
+		}
+
+		listeners[name] = append(listeners[name], l)
+	}
+
+	return listeners, nil
+}
+
+// Notify sends the state to the service manager, see sd_notify(3). It reports false without
+// an error when the service is not run by systemd with Type=notify.
+func Notify(state string) (bool, error) {
+	const op = "systemd.Notify"
+
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	// Имя с @ — сокет в абстрактном пространстве имён Linux
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,57 @@
+package systemd_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sso/internal/lib/systemd"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	sent, err := systemd.Notify(systemd.Ready)
+	require.NoError(t, err)
+	require.True(t, sent)
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, systemd.Ready, string(buf[:n]))
+}
+
+func TestNotify_NotSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	sent, err := systemd.Notify(systemd.Ready)
+	require.NoError(t, err)
+	require.False(t, sent)
+}
+
+func TestListeners_OtherProcess(t *testing.T) {
+	// Сокеты, переданные другому процессу, не берутся, а переменные сбрасываются
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := systemd.Listeners()
+	require.NoError(t, err)
+	require.Nil(t, listeners)
+	require.Empty(t, os.Getenv("LISTEN_FDS"))
+}
+
+func TestListeners_InvalidFDs(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "x")
+
+	_, err := systemd.Listeners()
+	require.ErrorIs(t, err, systemd.ErrInvalidListenFDs)
+}
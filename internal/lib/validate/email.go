@@ -0,0 +1,125 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+)
+
+const (
+	emailMaxLen     = 254
+	localPartMaxLen = 64
+	domainLabelMax  = 63
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email format")
+	ErrNoMailServer = errors.New("email domain has no mail server")
+)
+
+// Email checks the address syntax per RFC 5322 addr-spec, rejecting display names and comments,
+// and the domain per RFC 1035 hostname rules. Quoted local parts and dotless domains are rejected,
+// as most mail providers do.
+func Email(addr string) error {
+	if len(addr) > emailMaxLen {
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidEmail, emailMaxLen)
+	}
+
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Name != "" || parsed.Address != addr {
+		return ErrInvalidEmail
+	}
+
+	at := strings.LastIndexByte(addr, '@')
+	local, domain := addr[:at], addr[at+1:]
+
+	if len(local) > localPartMaxLen {
+		return fmt.Errorf("%w: local part longer than %d bytes", ErrInvalidEmail, localPartMaxLen)
+	}
+
+	if !validDomain(domain) {
+		return fmt.Errorf("%w: invalid domain", ErrInvalidEmail)
+	}
+
+	return nil
+}
+
+// Domain checks the email domain per RFC 1035 hostname rules, at least two labels are required.
+func Domain(domain string) error {
+	if !validDomain(domain) {
+		return fmt.Errorf("%w: invalid domain", ErrInvalidEmail)
+	}
+
+	return nil
+}
+
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > domainLabelMax || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			// Не-ASCII допускаем для интернациональных доменов (IDN)
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c > 127) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// MailServerChecker checks that the email domain can receive mail.
+type MailServerChecker struct {
+	resolver *net.Resolver
+}
+
+func NewMailServerChecker(resolver *net.Resolver) *MailServerChecker {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &MailServerChecker{resolver: resolver}
+}
+
+// Check looks up MX records of the domain, falling back to A/AAAA records as RFC 5321 allows.
+// Resolver failures other than "not found" are returned as is, so callers can let the address through.
+func (c *MailServerChecker) Check(ctx context.Context, addr string) error {
+	domain := addr[strings.LastIndexByte(addr, '@')+1:]
+
+	mxs, err := c.resolver.LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		// Null MX (RFC 7505): домен явно не принимает почту
+		if len(mxs) == 1 && mxs[0].Host == "." {
+			return ErrNoMailServer
+		}
+		return nil
+	}
+
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	if _, err := c.resolver.LookupHost(ctx, domain); err != nil {
+		if isNotFound(err) {
+			return ErrNoMailServer
+		}
+		return err
+	}
+
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,258 @@
+// Package vault is a minimal client of the HashiCorp Vault HTTP API: token and Kubernetes auth,
+// KV v2 secrets, dynamic secrets with leases and their renewal.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxResponseSize bounds the response read from Vault.
+const maxResponseSize = 1 << 20
+
+// ErrNotFound is returned for a path without a secret.
+var ErrNotFound = errors.New("secret not found")
+
+// Secret is a secret read from Vault. Dynamic secrets, e.g. database credentials, have a lease
+// that must be renewed before LeaseDuration passes, static KV secrets have none.
+type Secret struct {
+	Data          map[string]any
+	LeaseID       string
+	LeaseDuration time.Duration
+	Renewable     bool
+}
+
+// Auth is the token of a login and its lease.
+type Auth struct {
+	Token         string
+	LeaseDuration time.Duration
+	Renewable     bool
+}
+
+type response struct {
+	Data          json.RawMessage `json:"data"`
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int64           `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// Client calls the Vault API at addr with the token set by SetToken or a login.
+type Client struct {
+	addr      string
+	namespace string
+	http      *http.Client
+
+	mu    sync.RWMutex
+	token string
+}
+
+// New returns a client of the Vault at addr, e.g. https://vault:8200. namespace is for Vault Enterprise, empty otherwise.
+func New(addr string, namespace string, timeout time.Duration) *Client {
+	return &Client{
+		addr:      strings.TrimRight(addr, "/"),
+		namespace: namespace,
+		http:      &http.Client{Timeout: timeout},
+	}
+}
+
+// SetToken sets the token of the following calls.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// LoginKubernetes logs in with the service account token of the pod and sets the token of the client.
+func (c *Client) LoginKubernetes(ctx context.Context, mount string, role string, jwt string) (Auth, error) {
+	const op = "vault.LoginKubernetes"
+
+	res, err := c.do(ctx, http.MethodPost, "auth/"+mount+"/login", map[string]string{"role": role, "jwt": jwt})
+	if err != nil {
+		return Auth{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auth, err := authOf(res)
+	if err != nil {
+		return Auth{}, fmt.Errorf("%s: %w", op, err)
+	}
+	c.SetToken(auth.Token)
+
+	return auth, nil
+}
+
+// RenewSelf extends the lease of the token of the client.
+func (c *Client) RenewSelf(ctx context.Context) (Auth, error) {
+	const op = "vault.RenewSelf"
+
+	res, err := c.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{})
+	if err != nil {
+		return Auth{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auth, err := authOf(res)
+	if err != nil {
+		return Auth{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return auth, nil
+}
+
+// LookupSelf returns the lease of the token of the client, e.g. of a token set by SetToken.
+func (c *Client) LookupSelf(ctx context.Context) (Auth, error) {
+	const op = "vault.LookupSelf"
+
+	res, err := c.do(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return Auth{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var data struct {
+		TTL       int64 `json:"ttl"`
+		Renewable bool  `json:"renewable"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		return Auth{}, fmt.Errorf("%s: failed to decode response: %w", op, err)
+	}
+
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	return Auth{Token: token, LeaseDuration: time.Duration(data.TTL) * time.Second, Renewable: data.Renewable}, nil
+}
+
+// Read reads the secret at path, e.g. database/creds/sso for dynamic database credentials.
+func (c *Client) Read(ctx context.Context, path string) (Secret, error) {
+	const op = "vault.Read"
+
+	res, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return Secret{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		return Secret{}, fmt.Errorf("%s: failed to decode response: %w", op, err)
+	}
+
+	return Secret{
+		Data:          data,
+		LeaseID:       res.LeaseID,
+		LeaseDuration: time.Duration(res.LeaseDuration) * time.Second,
+		Renewable:     res.Renewable,
+	}, nil
+}
+
+// ReadKV reads the latest version of the KV v2 secret at path of the engine mounted at mount.
+// All values must be strings.
+func (c *Client) ReadKV(ctx context.Context, mount string, path string) (map[string]string, error) {
+	const op = "vault.ReadKV"
+
+	secret, err := c.Read(ctx, mount+"/data/"+strings.TrimLeft(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// KV v2 вкладывает сами значения в data.data рядом с метаданными версии
+	inner, _ := secret.Data["data"].(map[string]any)
+	values := make(map[string]string, len(inner))
+	for k, v := range inner {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: value of %q is not a string", op, path, k)
+		}
+		values[k] = s
+	}
+
+	return values, nil
+}
+
+// RenewLease extends the lease of a dynamic secret and returns its new duration.
+func (c *Client) RenewLease(ctx context.Context, leaseID string) (time.Duration, error) {
+	const op = "vault.RenewLease"
+
+	res, err := c.do(ctx, http.MethodPut, "sys/leases/renew", map[string]string{"lease_id": leaseID})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return time.Duration(res.LeaseDuration) * time.Second, nil
+}
+
+func authOf(res response) (Auth, error) {
+	if res.Auth == nil || res.Auth.ClientToken == "" {
+		return Auth{}, errors.New("response has no token")
+	}
+
+	return Auth{
+		Token:         res.Auth.ClientToken,
+		LeaseDuration: time.Duration(res.Auth.LeaseDuration) * time.Second,
+		Renewable:     res.Auth.Renewable,
+	}, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body any) (response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return response{}, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+"/v1/"+path, reader)
+	if err != nil {
+		return response{}, err
+	}
+
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return response{}, err
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&res); err != nil && !errors.Is(err, io.EOF) {
+			return response{}, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return response{}, fmt.Errorf("%s: %w", path, ErrNotFound)
+	case resp.StatusCode >= 300:
+		return response{}, fmt.Errorf("%s: unexpected status %d: %s", path, resp.StatusCode, strings.Join(res.Errors, "; "))
+	}
+
+	return res, nil
+}
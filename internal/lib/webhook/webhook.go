@@ -0,0 +1,179 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Headers of webhook requests.
+const (
+	// SignatureHeader is "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>" with the app secret.
+	SignatureHeader = "X-SSO-Signature"
+	// TimestampHeader is the unix time of the request, receivers should reject stale ones.
+	TimestampHeader = "X-SSO-Timestamp"
+	EventHeader     = "X-SSO-Event"
+)
+
+// Event types.
+const (
+	EventAccessGranted = "access.granted"
+	EventAccessRevoked = "access.revoked"
+)
+
+var ErrInvalidURL = errors.New("invalid webhook url")
+
+const (
+	eventIDBytes = 16
+	// maxResponseSize bounds the response body drained from receivers.
+	maxResponseSize = 4 << 10
+	defaultTimeout  = 5 * time.Second
+	defaultBackoff  = time.Second
+)
+
+// Event is the JSON body of a webhook request.
+type Event struct {
+	// ID is unique per event and repeated on retries, receivers can deduplicate by it.
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	UserID     int64     `json:"user_id"`
+	Email      string    `json:"email"`
+	AppCode    string    `json:"app_code"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// NewEvent returns an event of the type with a random ID, occurred now.
+func NewEvent(typ string, userID int64, email string, appCode string) (Event, error) {
+	id := make([]byte, eventIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		ID:         hex.EncodeToString(id),
+		Type:       typ,
+		UserID:     userID,
+		Email:      email,
+		AppCode:    appCode,
+		OccurredAt: time.Now().UTC(),
+	}, nil
+}
+
+type Options struct {
+	// Timeout of a single request, zero defaults to 5s.
+	Timeout time.Duration
+	// Attempts is the number of tries of a delivery, at least one.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for every next one. Zero defaults to 1s.
+	Backoff time.Duration
+}
+
+// Sender delivers signed webhook requests.
+type Sender struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+func New(opts Options) *Sender {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Attempts < 1 {
+		opts.Attempts = 1
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+
+	return &Sender{
+		client:   &http.Client{Timeout: opts.Timeout},
+		attempts: opts.Attempts,
+		backoff:  opts.Backoff,
+	}
+}
+
+// Send POSTs the event to the URL signed with the secret. Network errors, 5xx and 429 responses
+// are retried with exponential backoff until the attempts or ctx run out.
+func (s *Sender) Send(ctx context.Context, rawURL string, secret string, e Event) error {
+	const op = "webhook.Send"
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s: %w: %q", op, ErrInvalidURL, rawURL)
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, u.String(), secret, e.Type, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= s.attempts {
+			return fmt.Errorf("%s: attempt %d: %w", op, attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: attempt %d: %w", op, attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one request and reports whether a failure is worth retrying.
+func (s *Sender) post(ctx context.Context, url string, secret string, typ string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, typ)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(secret, ts, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	// Тело дочитывается, чтобы соединение вернулось в пул
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Первая попытка падает, вторая доставляется
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if got, want := r.Header.Get(SignatureHeader), "sha256="+Sign("secret", ts, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if got := r.Header.Get(EventHeader); got != EventAccessRevoked {
+			t.Errorf("event header = %q", got)
+		}
+
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil || e.Email != "user@example.com" {
+			t.Errorf("event = %+v, %v", e, err)
+		}
+	}))
+	defer srv.Close()
+
+	e, err := NewEvent(EventAccessRevoked, 1, "user@example.com", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(Options{Attempts: 3, Backoff: time.Millisecond})
+	if err := s.Send(context.Background(), srv.URL, "secret", e); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("calls = %d, want 2", got)
+	}
+}
+
+func TestSendNoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	s := New(Options{Attempts: 3, Backoff: time.Millisecond})
+	if err := s.Send(context.Background(), srv.URL, "secret", Event{}); err == nil {
+		t.Fatal("Send() error = nil")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("calls = %d, want 1", got)
+	}
+}
+
+func TestSendInvalidURL(t *testing.T) {
+	for _, u := range []string{"", "ftp://example.com", "http://"} {
+		if err := New(Options{}).Send(context.Background(), u, "secret", Event{}); err == nil {
+			t.Errorf("Send(%q) error = nil", u)
+		}
+	}
+}
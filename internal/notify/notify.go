@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"strings"
+	"time"
+)
+
+// Event identifies a kind of notification, each event has its own templates.
+type Event string
+
+const (
+	EventVerifyEmail   Event = "verify_email"
+	EventPasswordReset Event = "password_reset"
+	EventMagicLink     Event = "magic_link"
+	EventNewDevice     Event = "new_device"
+	EventNewDeviceCode Event = "new_device_code"
+	// EventNewCountryCode confirms a login from a country the user has not logged in from before.
+	EventNewCountryCode Event = "new_country_code"
+	// EventRecoveryCode delivers the code of an account recovery to the recovery email.
+	EventRecoveryCode Event = "recovery_code"
+	// EventLoginCode delivers a one-time code logging in without the password.
+	EventLoginCode Event = "login_code"
+	// EventPhoneLoginCode delivers a one-time login code by SMS.
+	EventPhoneLoginCode Event = "phone_login_code"
+	// EventPhoneVerifyCode confirms a phone number being added to the account, sent by SMS.
+	EventPhoneVerifyCode Event = "phone_verify_code"
+	// EventRiskCode confirms a login that looks suspicious, e.g. from a new address far from the previous one.
+	EventRiskCode Event = "risk_code"
+)
+
+// NewDeviceData is the template data of EventNewDevice.
+type NewDeviceData struct {
+	AppCode   string
+	UserAgent string
+	IP        string
+	Time      time.Time
+}
+
+// CodeData is the template data of events delivering a one-time code.
+type CodeData struct {
+	AppCode    string
+	Code       string
+	TTLMinutes int
+	// Country is the ISO code of the login country in EventNewCountryCode.
+	Country string
+}
+
+// Email is a rendered email message.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailSender delivers rendered emails.
+type EmailSender interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// SMS is a rendered text message.
+type SMS struct {
+	To   string
+	Text string
+}
+
+// SMSSender delivers text messages to phone numbers in E.164 form.
+type SMSSender interface {
+	Send(ctx context.Context, sms SMS) error
+}
+
+// Mailer renders event templates and sends them via the configured sender.
+type Mailer struct {
+	log       *slog.Logger
+	sender    EmailSender
+	templates *Templates
+}
+
+func NewMailer(log *slog.Logger, sender EmailSender, templates *Templates) *Mailer {
+	return &Mailer{
+		log:       log,
+		sender:    sender,
+		templates: templates,
+	}
+}
+
+// Notify renders the event templates for the locale with data and sends the result to the recipient.
+func (m *Mailer) Notify(ctx context.Context, event Event, locale string, to string, data any) error {
+	const op = "notify.Mailer.Notify"
+
+	log := m.log.With(
+		slog.String("op", op),
+		slog.String("event", string(event)),
+		slog.String("locale", locale),
+	)
+
+	subject, body, err := m.templates.Render(event, locale, data)
+	if err != nil {
+		log.Error("failed to render email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.sender.Send(ctx, Email{To: to, Subject: subject, Body: body}); err != nil {
+		log.Error("failed to send email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email sent")
+
+	return nil
+}
+
+// LogSender writes emails to the log instead of delivering them, for local development.
+type LogSender struct {
+	log *slog.Logger
+}
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log}
+}
+
+func (s *LogSender) Send(_ context.Context, email Email) error {
+	s.log.Info("email",
+		slog.String("to", email.To),
+		slog.String("subject", email.Subject),
+		slog.String("body", email.Body),
+	)
+
+	return nil
+}
+
+// Texter renders event templates and sends them by SMS. Only the body is sent, the subject is unused.
+type Texter struct {
+	log       *slog.Logger
+	sender    SMSSender
+	templates *Templates
+}
+
+func NewTexter(log *slog.Logger, sender SMSSender, templates *Templates) *Texter {
+	return &Texter{
+		log:       log,
+		sender:    sender,
+		templates: templates,
+	}
+}
+
+// Notify renders the event body for the locale with data and sends it to the phone number.
+func (t *Texter) Notify(ctx context.Context, event Event, locale string, to string, data any) error {
+	const op = "notify.Texter.Notify"
+
+	log := t.log.With(
+		slog.String("op", op),
+		slog.String("event", string(event)),
+		slog.String("locale", locale),
+	)
+
+	_, body, err := t.templates.Render(event, locale, data)
+	if err != nil {
+		log.Error("failed to render sms", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.sender.Send(ctx, SMS{To: to, Text: strings.TrimSpace(body)}); err != nil {
+		log.Error("failed to send sms", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("sms sent")
+
+	return nil
+}
+
+// LogSMSSender writes text messages to the log instead of delivering them, for local development.
+type LogSMSSender struct {
+	log *slog.Logger
+}
+
+func NewLogSMSSender(log *slog.Logger) *LogSMSSender {
+	return &LogSMSSender{log: log}
+}
+
+func (s *LogSMSSender) Send(_ context.Context, sms SMS) error {
+	s.log.Info("sms",
+		slog.String("to", sms.To),
+		slog.String("text", sms.Text),
+	)
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sso/internal/notify"
+	"time"
+)
+
+type HTTPOptions struct {
+	URL string
+	// Token is sent as "Authorization: Bearer <token>", empty sends no authorization.
+	Token   string
+	Timeout time.Duration
+}
+
+// HTTP sends messages to a gateway as JSON POST requests {"to": "+79990000000", "text": "..."}.
+// Any 2xx response means the message is accepted.
+type HTTP struct {
+	opts   HTTPOptions
+	client *http.Client
+}
+
+type httpMessage struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func NewHTTP(opts HTTPOptions) (*HTTP, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid http url %q", ErrNotConfigured, opts.URL)
+	}
+
+	return &HTTP{
+		opts:   opts,
+		client: newClient(opts.Timeout),
+	}, nil
+}
+
+func (h *HTTP) Send(ctx context.Context, sms notify.SMS) error {
+	const op = "notify.sms.HTTP.Send"
+
+	body, err := json.Marshal(httpMessage{To: sms.To, Text: sms.Text})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.opts.Token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package sms delivers text messages via SMS providers, see notify.SMSSender.
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Providers of text messages.
+const (
+	ProviderTwilio = "twilio"
+	ProviderHTTP   = "http"
+	// ProviderLog writes messages to the log, see notify.LogSMSSender.
+	ProviderLog = "log"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown sms provider")
+	ErrNotConfigured   = errors.New("sms provider is not configured")
+	ErrRejected        = errors.New("sms rejected by provider")
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxResponseSize bounds the response body read from providers.
+	maxResponseSize = 4 << 10
+)
+
+func newClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &http.Client{Timeout: timeout}
+}
+
+// checkResponse drains the response and turns a non-2xx status into ErrRejected
+// with the beginning of the body, providers explain the rejection there.
+func checkResponse(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: status %d: %s", ErrRejected, resp.StatusCode, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sso/internal/notify"
+	"testing"
+)
+
+func TestTwilioSend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "AC1" || pass != "token" {
+			t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.PostForm.Get("To"); got != "+79990000000" {
+			t.Errorf("To = %q", got)
+		}
+		if got := r.PostForm.Get("From"); got != "+15550000000" {
+			t.Errorf("From = %q", got)
+		}
+		if got := r.PostForm.Get("Body"); got != "123456" {
+			t.Errorf("Body = %q", got)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	s, err := NewTwilio(TwilioOptions{AccountSID: "AC1", AuthToken: "token", From: "+15550000000", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send(context.Background(), notify.SMS{To: "+79990000000", Text: "123456"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestTwilioSendRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code": 21211, "message": "Invalid 'To' Phone Number"}`))
+	}))
+	defer srv.Close()
+
+	s, err := NewTwilio(TwilioOptions{AccountSID: "AC1", AuthToken: "token", From: "MG1", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Send(context.Background(), notify.SMS{To: "+1", Text: "123456"})
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("Send() error = %v, want ErrRejected", err)
+	}
+}
+
+func TestHTTPSend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		var msg httpMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.To != "+79990000000" || msg.Text != "123456" {
+			t.Errorf("message = %+v, %v", msg, err)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewHTTP(HTTPOptions{URL: srv.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send(context.Background(), notify.SMS{To: "+79990000000", Text: "123456"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+}
+
+func TestNewNotConfigured(t *testing.T) {
+	if _, err := NewTwilio(TwilioOptions{AccountSID: "AC1"}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("NewTwilio() error = %v", err)
+	}
+	if _, err := NewHTTP(HTTPOptions{URL: "ftp://example.com"}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("NewHTTP() error = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sso/internal/notify"
+	"strings"
+	"time"
+)
+
+const twilioBaseURL = "https://api.twilio.com"
+
+type TwilioOptions struct {
+	AccountSID string
+	AuthToken  string
+	// From is the sender number or the SID of a messaging service, which starts with "MG".
+	From    string
+	Timeout time.Duration
+	// BaseURL of the API, empty defaults to https://api.twilio.com.
+	BaseURL string
+}
+
+// Twilio sends messages via the Twilio Messages API.
+type Twilio struct {
+	opts   TwilioOptions
+	client *http.Client
+}
+
+func NewTwilio(opts TwilioOptions) (*Twilio, error) {
+	if opts.AccountSID == "" || opts.AuthToken == "" || opts.From == "" {
+		return nil, fmt.Errorf("%w: twilio needs account_sid, auth_token and from", ErrNotConfigured)
+	}
+
+	if opts.BaseURL == "" {
+		opts.BaseURL = twilioBaseURL
+	}
+
+	return &Twilio{
+		opts:   opts,
+		client: newClient(opts.Timeout),
+	}, nil
+}
+
+func (t *Twilio) Send(ctx context.Context, sms notify.SMS) error {
+	const op = "notify.sms.Twilio.Send"
+
+	form := url.Values{}
+	form.Set("To", sms.To)
+	form.Set("Body", sms.Text)
+	if strings.HasPrefix(t.opts.From, "MG") {
+		form.Set("MessagingServiceSid", t.opts.From)
+	} else {
+		form.Set("From", t.opts.From)
+	}
+
+	endpoint := t.opts.BaseURL + "/2010-04-01/Accounts/" + url.PathEscape(t.opts.AccountSID) + "/Messages.json"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.opts.AccountSID, t.opts.AuthToken)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
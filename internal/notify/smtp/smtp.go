@@ -0,0 +1,139 @@
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sso/internal/notify"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS modes of the SMTP connection.
+const (
+	TLSModeStartTLS = "starttls"
+	TLSModeImplicit = "tls"
+	TLSModeNone     = "none"
+)
+
+var ErrUnknownTLSMode = errors.New("unknown smtp tls mode")
+
+type Options struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLSMode  string
+	Timeout  time.Duration
+}
+
+// Sender delivers emails via an SMTP server.
+type Sender struct {
+	opts Options
+}
+
+func New(opts Options) (*Sender, error) {
+	switch opts.TLSMode {
+	case TLSModeStartTLS, TLSModeImplicit, TLSModeNone:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTLSMode, opts.TLSMode)
+	}
+
+	return &Sender{opts: opts}, nil
+}
+
+func (s *Sender) Send(ctx context.Context, email notify.Email) error {
+	const op = "notify.smtp.Send"
+
+	if s.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Timeout)
+		defer cancel()
+	}
+
+	addr := net.JoinHostPort(s.opts.Host, strconv.Itoa(s.opts.Port))
+	tlsConfig := &tls.Config{ServerName: s.opts.Host}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.opts.TLSMode == TLSModeImplicit {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: dial: %w", op, err)
+	}
+
+	// net/smtp не поддерживает context, поэтому ограничиваем весь обмен дедлайном соединения
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer client.Close()
+
+	if s.opts.TLSMode == TLSModeStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("%s: starttls: %w", op, err)
+		}
+	}
+
+	if s.opts.Username != "" {
+		auth := smtp.PlainAuth("", s.opts.Username, s.opts.Password, s.opts.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("%s: auth: %w", op, err)
+		}
+	}
+
+	if err := client.Mail(s.opts.From); err != nil {
+		return fmt.Errorf("%s: mail from: %w", op, err)
+	}
+
+	if err := client.Rcpt(email.To); err != nil {
+		return fmt.Errorf("%s: rcpt to: %w", op, err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("%s: data: %w", op, err)
+	}
+
+	if _, err := w.Write(buildMessage(s.opts.From, email)); err != nil {
+		return fmt.Errorf("%s: write: %w", op, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%s: data close: %w", op, err)
+	}
+
+	return client.Quit()
+}
+
+func buildMessage(from string, email notify.Email) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + email.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", email.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Templates holds subject and body templates per event and locale.
+// A template file is named "<event>.<locale>.tmpl" and defines the "subject" and "body" templates.
+type Templates struct {
+	byKey         map[string]*template.Template
+	defaultLocale string
+}
+
+// DefaultTemplates loads the templates shipped with the service.
+func DefaultTemplates(defaultLocale string) (*Templates, error) {
+	sub, err := fs.Sub(defaultTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadTemplates(sub, defaultLocale)
+}
+
+// LoadTemplates parses all "*.tmpl" files in the root of fsys.
+func LoadTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	const op = "notify.LoadTemplates"
+
+	files, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	t := &Templates{
+		byKey:         make(map[string]*template.Template, len(files)),
+		defaultLocale: defaultLocale,
+	}
+
+	for _, file := range files {
+		key := strings.TrimSuffix(path.Base(file), ".tmpl")
+
+		tmpl, err := template.ParseFS(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", op, file, err)
+		}
+
+		if tmpl.Lookup("subject") == nil || tmpl.Lookup("body") == nil {
+			return nil, fmt.Errorf("%s: %s: subject and body templates must be defined", op, file)
+		}
+
+		t.byKey[key] = tmpl
+	}
+
+	return t, nil
+}
+
+// Render executes the event templates for the locale, falling back to the default locale.
+func (t *Templates) Render(event Event, locale string, data any) (subject string, body string, err error) {
+	tmpl, ok := t.byKey[string(event)+"."+locale]
+	if !ok {
+		tmpl, ok = t.byKey[string(event)+"."+t.defaultLocale]
+	}
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrTemplateNotFound, event)
+	}
+
+	var subjectBuf, bodyBuf bytes.Buffer
+
+	if err := tmpl.ExecuteTemplate(&subjectBuf, "subject", data); err != nil {
+		return "", "", err
+	}
+
+	if err := tmpl.ExecuteTemplate(&bodyBuf, "body", data); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(subjectBuf.String()), bodyBuf.String(), nil
+}
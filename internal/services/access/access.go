@@ -0,0 +1,297 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/audit"
+	"sso/internal/lib/email"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/principal"
+	"sso/internal/lib/webhook"
+	"sso/internal/storage"
+	"time"
+)
+
+var (
+	ErrPermissionDenied = errors.New("caller is not an admin")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrAppNotFound      = errors.New("app not found")
+	ErrAlreadyGranted   = errors.New("access already granted")
+	ErrNotGranted       = errors.New("access not granted")
+	ErrDomainNotAllowed = errors.New("email domain is not allowed in the app")
+)
+
+// webhookTimeout bounds the background delivery of a webhook with all its retries.
+const webhookTimeout = time.Minute
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (models.User, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appCode string) (models.App, error)
+	AppDomains(ctx context.Context, appID int32) ([]string, error)
+}
+
+type UserAppStorage interface {
+	UserApp(ctx context.Context, userID int64, appID int32) (models.UserApp, error)
+	SaveUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) (int64, error)
+	UpdateUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) error
+}
+
+// CacheInvalidator drops the cached entries of a changed user on all instances.
+type CacheInvalidator interface {
+	InvalidateUser(ctx context.Context, userID int64, email string)
+}
+
+// WebhookSender delivers signed notifications to apps, see webhook.Sender.
+type WebhookSender interface {
+	Send(ctx context.Context, url string, secret string, e webhook.Event) error
+}
+
+type Auditor interface {
+	Audit(ctx context.Context, e audit.Event)
+}
+
+// Access manages user access to apps on behalf of admins.
+type Access struct {
+	log          *slog.Logger
+	userProvider UserProvider
+	appProvider  AppProvider
+	userApps     UserAppStorage
+	auditor      Auditor
+	emails       email.Normalizer
+	invalidator  CacheInvalidator
+	webhooks     WebhookSender
+}
+
+func New(
+	log *slog.Logger,
+	userProvider UserProvider,
+	appProvider AppProvider,
+	userApps UserAppStorage,
+	auditor Auditor,
+	emails email.Normalizer,
+	invalidator CacheInvalidator,
+	webhooks WebhookSender,
+) *Access {
+	return &Access{
+		log:          log,
+		userProvider: userProvider,
+		appProvider:  appProvider,
+		userApps:     userApps,
+		auditor:      auditor,
+		emails:       emails,
+		invalidator:  invalidator,
+		webhooks:     webhooks,
+	}
+}
+
+// AllowAccess grants the user access to the app. It returns ErrAlreadyGranted if the access is already enabled.
+func (a *Access) AllowAccess(ctx context.Context, email string, appCode string) error {
+	const op = "Access.AllowAccess"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.String("app_code", appCode),
+	)
+
+	caller, err := a.authorize(ctx, log, op)
+	if err != nil {
+		return err
+	}
+
+	user, app, err := a.userAndApp(ctx, email, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.checkDomain(ctx, user, app, log, op); err != nil {
+		return err
+	}
+
+	userApp, err := a.userApps.UserApp(ctx, user.ID, app.ID)
+	switch {
+	case errors.Is(err, storage.ErrUserAppNotFound):
+		_, err = a.userApps.SaveUserApp(ctx, user.ID, app.ID, true)
+	case err != nil:
+		log.ErrorContext(ctx, "failed to get user app", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	case userApp.IsEnabled:
+		log.WarnContext(ctx, "access already granted")
+		return fmt.Errorf("%s: %w", op, ErrAlreadyGranted)
+	default:
+		err = a.userApps.UpdateUserApp(ctx, user.ID, app.ID, true)
+	}
+
+	// Параллельный запрос успел создать запись
+	if errors.Is(err, storage.ErrUserAppExists) {
+		log.WarnContext(ctx, "access already granted")
+		return fmt.Errorf("%s: %w", op, ErrAlreadyGranted)
+	}
+
+	if err != nil {
+		log.ErrorContext(ctx, "failed to grant access", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+	a.notifyApp(ctx, user, app, webhook.EventAccessGranted, log)
+
+	log.InfoContext(ctx, "access granted", slog.String("actor", caller.Subject))
+
+	a.auditor.Audit(ctx, audit.Event{
+		Action:  audit.ActionAccessGranted,
+		Actor:   caller.Subject,
+		Email:   email,
+		AppCode: appCode,
+	})
+
+	return nil
+}
+
+// RevokeAccess revokes the user access to the app, tokens issued for it stop validating.
+// It returns ErrNotGranted if the user has no enabled access.
+func (a *Access) RevokeAccess(ctx context.Context, email string, appCode string) error {
+	const op = "Access.RevokeAccess"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.String("app_code", appCode),
+	)
+
+	caller, err := a.authorize(ctx, log, op)
+	if err != nil {
+		return err
+	}
+
+	user, app, err := a.userAndApp(ctx, email, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	userApp, err := a.userApps.UserApp(ctx, user.ID, app.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserAppNotFound) {
+			log.WarnContext(ctx, "access not granted")
+			return fmt.Errorf("%s: %w", op, ErrNotGranted)
+		}
+
+		log.ErrorContext(ctx, "failed to get user app", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !userApp.IsEnabled {
+		log.WarnContext(ctx, "access not granted")
+		return fmt.Errorf("%s: %w", op, ErrNotGranted)
+	}
+
+	if err := a.userApps.UpdateUserApp(ctx, user.ID, app.ID, false); err != nil {
+		log.ErrorContext(ctx, "failed to revoke access", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+	a.notifyApp(ctx, user, app, webhook.EventAccessRevoked, log)
+
+	log.InfoContext(ctx, "access revoked", slog.String("actor", caller.Subject))
+
+	a.auditor.Audit(ctx, audit.Event{
+		Action:  audit.ActionAccessRevoked,
+		Actor:   caller.Subject,
+		Email:   email,
+		AppCode: appCode,
+	})
+
+	return nil
+}
+
+// notifyApp sends the access change to the webhook of the app, if it has one, in the background.
+// Failures are logged and do not fail the change.
+func (a *Access) notifyApp(ctx context.Context, user models.User, app models.App, typ string, log *slog.Logger) {
+	if a.webhooks == nil || app.WebhookURL == "" {
+		return
+	}
+
+	e, err := webhook.NewEvent(typ, user.ID, user.Email, app.Code)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to create webhook event", sl.Err(err))
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+		defer cancel()
+
+		if err := a.webhooks.Send(ctx, app.WebhookURL, app.Secret, e); err != nil {
+			log.ErrorContext(ctx, "failed to send webhook", slog.String("event", typ), slog.String("event_id", e.ID), sl.Err(err))
+			return
+		}
+
+		log.InfoContext(ctx, "webhook sent", slog.String("event", typ), slog.String("event_id", e.ID))
+	}()
+}
+
+// authorize returns the caller if it is an admin.
+func (a *Access) authorize(ctx context.Context, log *slog.Logger, op string) (principal.Principal, error) {
+	caller, ok := principal.FromContext(ctx)
+	if !ok || !caller.Admin {
+		log.WarnContext(ctx, "access management denied", slog.String("actor", caller.Subject))
+		return principal.Principal{}, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	return caller, nil
+}
+
+// checkDomain rejects users whose email domain is not in the app's allowed list.
+func (a *Access) checkDomain(ctx context.Context, user models.User, app models.App, log *slog.Logger, op string) error {
+	domains, err := a.appProvider.AppDomains(ctx, app.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get app domains", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !email.DomainAllowed(user.Email, domains) {
+		log.WarnContext(ctx, "email domain is not allowed in the app")
+		return fmt.Errorf("%s: %w", op, ErrDomainNotAllowed)
+	}
+
+	return nil
+}
+
+func (a *Access) userAndApp(
+	ctx context.Context,
+	email string,
+	appCode string,
+	log *slog.Logger,
+	op string,
+) (models.User, models.App, error) {
+	user, err := a.userProvider.User(ctx, a.emails.Normalize(email))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.WarnContext(ctx, "user not found")
+			return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to get user", sl.Err(err))
+		return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.appProvider.App(ctx, appCode)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.WarnContext(ctx, "app not found")
+			return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to get app", sl.Err(err))
+		return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, app, nil
+}
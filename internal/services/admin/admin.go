@@ -0,0 +1,333 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+var (
+	ErrAppNotFound         = errors.New("app not found")
+	ErrInvalidWindow       = errors.New("maintenance window must end after it starts and in the future")
+	ErrMaintenanceNotFound = errors.New("maintenance window not found")
+	ErrUserNotFound        = errors.New("user not found")
+)
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (models.User, error)
+}
+
+type UserBlocker interface {
+	SetUserBlocked(ctx context.Context, userID int64, blocked bool) error
+}
+
+type UserEraser interface {
+	SoftDeleteUser(ctx context.Context, userID int64, at time.Time) error
+	DeletedUsersBefore(ctx context.Context, before time.Time, limit int) ([]int64, error)
+	AnonymizeUser(ctx context.Context, userID int64, at time.Time) error
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appCode string) (models.App, error)
+}
+
+type MaintenanceStorage interface {
+	SaveMaintenanceWindow(ctx context.Context, window models.MaintenanceWindow) (int64, error)
+	DeleteMaintenanceWindow(ctx context.Context, id int64) error
+	MaintenanceWindows(ctx context.Context, appID int32, now time.Time) ([]models.MaintenanceWindow, error)
+}
+
+// Storage is the database of the admin service.
+type Storage interface {
+	UserProvider
+	UserBlocker
+	UserEraser
+	AppProvider
+	MaintenanceStorage
+	AppDomainStorage
+	KeyRotator
+	InviteStorage
+	UserIdentifierSetter
+	StatsProvider
+	LoginHistoryProvider
+}
+
+// CacheInvalidator drops the cached entries of changed users and apps on all instances.
+type CacheInvalidator interface {
+	InvalidateUser(ctx context.Context, userID int64, email string)
+	InvalidateApp(ctx context.Context, appCode string)
+}
+
+// Admin implements administrative operations on apps.
+type Admin struct {
+	log          *slog.Logger
+	userProvider UserProvider
+	userBlocker  UserBlocker
+	userEraser   UserEraser
+	appProvider  AppProvider
+	maintenance  MaintenanceStorage
+	appDomains   AppDomainStorage
+	keyRotator   KeyRotator
+	invites      InviteStorage
+	identifiers  UserIdentifierSetter
+	stats        StatsProvider
+	loginHistory LoginHistoryProvider
+	emails       email.Normalizer
+	rateLimits   []RateLimitCounters
+	invalidator  CacheInvalidator
+}
+
+// New creates the admin service. rateLimits are empty when neither rate limiting nor login lockout is enabled.
+func New(
+	log *slog.Logger,
+	storage Storage,
+	emails email.Normalizer,
+	rateLimits []RateLimitCounters,
+	invalidator CacheInvalidator,
+) *Admin {
+	return &Admin{
+		log:          log,
+		userProvider: storage,
+		userBlocker:  storage,
+		userEraser:   storage,
+		appProvider:  storage,
+		maintenance:  storage,
+		appDomains:   storage,
+		keyRotator:   storage,
+		invites:      storage,
+		identifiers:  storage,
+		stats:        storage,
+		loginHistory: storage,
+		emails:       emails,
+		rateLimits:   rateLimits,
+		invalidator:  invalidator,
+	}
+}
+
+// BlockUser blocks the user: logins are rejected and already issued tokens stop validating.
+func (a *Admin) BlockUser(ctx context.Context, email string) error {
+	return a.setUserBlocked(ctx, "Admin.BlockUser", email, true)
+}
+
+// UnblockUser unblocks the user. Tokens issued before blocking stay invalid.
+func (a *Admin) UnblockUser(ctx context.Context, email string) error {
+	return a.setUserBlocked(ctx, "Admin.UnblockUser", email, false)
+}
+
+func (a *Admin) setUserBlocked(ctx context.Context, op string, email string, blocked bool) error {
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	user, err := a.user(ctx, email, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.userBlocker.SetUserBlocked(ctx, user.ID, blocked); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to update user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	log.InfoContext(ctx, "user block status changed", slog.Bool("blocked", blocked))
+
+	return nil
+}
+
+// PurgeUser deletes the user and erases personal data right away, without the retention window.
+func (a *Admin) PurgeUser(ctx context.Context, email string) error {
+	const op = "Admin.PurgeUser"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	user, err := a.user(ctx, email, log, op)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if err := a.userEraser.SoftDeleteUser(ctx, user.ID, now); err != nil {
+		log.ErrorContext(ctx, "failed to delete user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.userEraser.AnonymizeUser(ctx, user.ID, now); err != nil {
+		log.ErrorContext(ctx, "failed to anonymize user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	log.InfoContext(ctx, "user purged", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+// AnonymizeDeleted erases personal data of up to batch users deleted more than retention ago
+// and returns the number of anonymized users.
+func (a *Admin) AnonymizeDeleted(ctx context.Context, retention time.Duration, batch int) (int, error) {
+	const op = "Admin.AnonymizeDeleted"
+
+	log := a.log.With(slog.String("op", op))
+
+	now := time.Now()
+
+	ids, err := a.userEraser.DeletedUsersBefore(ctx, now.Add(-retention), batch)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get deleted users", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, id := range ids {
+		if err := a.userEraser.AnonymizeUser(ctx, id, now); err != nil {
+			log.ErrorContext(ctx, "failed to anonymize user", slog.Int64("user_id", id), sl.Err(err))
+			return i, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if len(ids) > 0 {
+		log.InfoContext(ctx, "deleted users anonymized", slog.Int("count", len(ids)))
+	}
+
+	return len(ids), nil
+}
+
+// ScheduleMaintenance suspends logins to the app from startsAt till endsAt.
+// Other apps are not affected.
+func (a *Admin) ScheduleMaintenance(
+	ctx context.Context,
+	appCode string,
+	startsAt time.Time,
+	endsAt time.Time,
+	reason string,
+) (int64, error) {
+	const op = "Admin.ScheduleMaintenance"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.Time("starts_at", startsAt),
+		slog.Time("ends_at", endsAt),
+	)
+
+	if !endsAt.After(startsAt) || !endsAt.After(time.Now()) {
+		log.WarnContext(ctx, "invalid maintenance window")
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidWindow)
+	}
+
+	app, err := a.app(ctx, appCode, log, op)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := a.maintenance.SaveMaintenanceWindow(ctx, models.MaintenanceWindow{
+		AppID:    app.ID,
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+		Reason:   reason,
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save maintenance window", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateApp(ctx, app.Code)
+
+	log.InfoContext(ctx, "maintenance window scheduled", slog.Int64("id", id))
+
+	return id, nil
+}
+
+// CancelMaintenance removes a scheduled or ongoing maintenance window.
+func (a *Admin) CancelMaintenance(ctx context.Context, id int64) error {
+	const op = "Admin.CancelMaintenance"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("id", id),
+	)
+
+	if err := a.maintenance.DeleteMaintenanceWindow(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrMaintenanceNotFound) {
+			log.WarnContext(ctx, "maintenance window not found")
+			return fmt.Errorf("%s: %w", op, ErrMaintenanceNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to delete maintenance window", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "maintenance window cancelled")
+
+	return nil
+}
+
+// MaintenanceWindows returns the ongoing and upcoming maintenance windows of the app.
+func (a *Admin) MaintenanceWindows(ctx context.Context, appCode string) ([]models.MaintenanceWindow, error) {
+	const op = "Admin.MaintenanceWindows"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	app, err := a.app(ctx, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	windows, err := a.maintenance.MaintenanceWindows(ctx, app.ID, time.Now())
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get maintenance windows", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return windows, nil
+}
+
+func (a *Admin) app(ctx context.Context, appCode string, log *slog.Logger, op string) (models.App, error) {
+	app, err := a.appProvider.App(ctx, appCode)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.WarnContext(ctx, "app not found", sl.Err(err))
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to get app", sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+func (a *Admin) user(ctx context.Context, email string, log *slog.Logger, op string) (models.User, error) {
+	user, err := a.userProvider.User(ctx, a.emails.Normalize(email))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.WarnContext(ctx, "user not found", sl.Err(err))
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to get user", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
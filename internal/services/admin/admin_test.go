@@ -0,0 +1,184 @@
+package admin_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/services/admin"
+	"sso/internal/services/admin/mocks"
+	"sso/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var _ admin.Storage = (*mocks.Storage)(nil)
+
+var testApp = models.App{ID: 1, Code: "web"}
+
+// invalidations records the users and apps the service dropped from the cache.
+type invalidations struct {
+	users []int64
+	apps  []string
+}
+
+func (i *invalidations) InvalidateUser(_ context.Context, userID int64, _ string) {
+	i.users = append(i.users, userID)
+}
+
+func (i *invalidations) InvalidateApp(_ context.Context, appCode string) {
+	i.apps = append(i.apps, appCode)
+}
+
+func newAdmin(t *testing.T, st *mocks.Storage) (*admin.Admin, *invalidations) {
+	t.Helper()
+
+	inv := &invalidations{}
+
+	return admin.New(slog.New(slog.NewTextHandler(io.Discard, nil)), st, email.Normalizer{}, nil, inv), inv
+}
+
+func TestScheduleMaintenance(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	a, inv := newAdmin(t, st)
+
+	startsAt := time.Now()
+	endsAt := startsAt.Add(time.Hour)
+
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("SaveMaintenanceWindow", mock.Anything, models.MaintenanceWindow{
+		AppID:    testApp.ID,
+		StartsAt: startsAt,
+		EndsAt:   endsAt,
+		Reason:   "upgrade",
+	}).Return(int64(7), nil)
+
+	id, err := a.ScheduleMaintenance(ctx, testApp.Code, startsAt, endsAt, "upgrade")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), id)
+	require.Equal(t, []string{testApp.Code}, inv.apps)
+}
+
+func TestScheduleMaintenance_InvalidWindow(t *testing.T) {
+	st := mocks.NewStorage(t)
+	a, _ := newAdmin(t, st)
+
+	startsAt := time.Now()
+
+	// Хранилище не трогается: мок упадёт на любом вызове
+	_, err := a.ScheduleMaintenance(context.Background(), testApp.Code, startsAt, startsAt.Add(-time.Minute), "")
+	require.ErrorIs(t, err, admin.ErrInvalidWindow)
+}
+
+func TestPurgeUser(t *testing.T) {
+	st := mocks.NewStorage(t)
+	a, inv := newAdmin(t, st)
+
+	user := models.User{ID: 42, Email: "user@example.com"}
+
+	st.On("User", mock.Anything, user.Email).Return(user, nil)
+	st.On("SoftDeleteUser", mock.Anything, user.ID, mock.Anything).Return(nil)
+	st.On("AnonymizeUser", mock.Anything, user.ID, mock.Anything).Return(nil)
+
+	require.NoError(t, a.PurgeUser(context.Background(), "User@Example.com"))
+	require.Equal(t, []int64{user.ID}, inv.users)
+}
+
+func TestPurgeUser_NotFound(t *testing.T) {
+	st := mocks.NewStorage(t)
+	a, inv := newAdmin(t, st)
+
+	st.On("User", mock.Anything, "user@example.com").Return(models.User{}, storage.ErrUserNotFound)
+
+	require.ErrorIs(t, a.PurgeUser(context.Background(), "user@example.com"), admin.ErrUserNotFound)
+	require.Empty(t, inv.users)
+}
+
+func TestAnonymizeDeleted(t *testing.T) {
+	st := mocks.NewStorage(t)
+	a, _ := newAdmin(t, st)
+
+	retention := 30 * 24 * time.Hour
+	start := time.Now()
+
+	// Анонимизируются только удалённые раньше срока хранения
+	st.On("DeletedUsersBefore", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+		cutoff := before.Add(retention)
+		return !cutoff.Before(start) && !cutoff.After(time.Now())
+	}), 100).Return([]int64{1, 2}, nil)
+	st.On("AnonymizeUser", mock.Anything, int64(1), mock.Anything).Return(nil)
+	st.On("AnonymizeUser", mock.Anything, int64(2), mock.Anything).Return(errors.New("disk full"))
+
+	n, err := a.AnonymizeDeleted(context.Background(), retention, 100)
+	require.Error(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestBlockUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocked bool
+		call    func(a *admin.Admin, ctx context.Context, email string) error
+	}{
+		{name: "block", blocked: true, call: (*admin.Admin).BlockUser},
+		{name: "unblock", blocked: false, call: (*admin.Admin).UnblockUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := mocks.NewStorage(t)
+			a, inv := newAdmin(t, st)
+
+			user := models.User{ID: 42, Email: "user@example.com"}
+
+			st.On("User", mock.Anything, user.Email).Return(user, nil)
+			st.On("SetUserBlocked", mock.Anything, user.ID, tt.blocked).Return(nil)
+
+			require.NoError(t, tt.call(a, context.Background(), "User@Example.com"))
+			require.Equal(t, []int64{user.ID}, inv.users)
+		})
+	}
+}
+
+func TestBlockUser_FailCases(t *testing.T) {
+	user := models.User{ID: 42, Email: "user@example.com"}
+
+	tests := []struct {
+		name        string
+		setup       func(st *mocks.Storage)
+		expectedErr error
+	}{
+		{
+			name: "user not found",
+			setup: func(st *mocks.Storage) {
+				st.On("User", mock.Anything, user.Email).Return(models.User{}, storage.ErrUserNotFound)
+			},
+			expectedErr: admin.ErrUserNotFound,
+		},
+		{
+			name: "user deleted meanwhile",
+			setup: func(st *mocks.Storage) {
+				st.On("User", mock.Anything, user.Email).Return(user, nil)
+				st.On("SetUserBlocked", mock.Anything, user.ID, true).Return(storage.ErrUserNotFound)
+			},
+			expectedErr: admin.ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := mocks.NewStorage(t)
+			tt.setup(st)
+			a, inv := newAdmin(t, st)
+
+			require.ErrorIs(t, a.BlockUser(context.Background(), user.Email), tt.expectedErr)
+			require.Empty(t, inv.users)
+		})
+	}
+}
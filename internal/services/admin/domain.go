@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/validate"
+	"sso/internal/storage"
+	"strings"
+)
+
+var (
+	ErrInvalidDomain  = errors.New("invalid email domain")
+	ErrDomainExists   = errors.New("email domain is already allowed")
+	ErrDomainNotFound = errors.New("email domain is not in the allowed list")
+)
+
+type AppDomainStorage interface {
+	AppDomains(ctx context.Context, appID int32) ([]string, error)
+	SaveAppDomain(ctx context.Context, appID int32, domain string) error
+	DeleteAppDomain(ctx context.Context, appID int32, domain string) error
+}
+
+// AppDomains returns the email domains allowed in the app, empty if any domain is allowed.
+func (a *Admin) AppDomains(ctx context.Context, appCode string) ([]string, error) {
+	const op = "Admin.AppDomains"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	app, err := a.app(ctx, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	domains, err := a.appDomains.AppDomains(ctx, app.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get app domains", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return domains, nil
+}
+
+// AllowAppDomain adds the domain to the app's allowed list. Once the list is not empty,
+// users with other domains can't log in to the app or be granted access to it.
+func (a *Admin) AllowAppDomain(ctx context.Context, appCode string, domain string) error {
+	const op = "Admin.AllowAppDomain"
+
+	domain = normalizeDomain(domain)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.String("domain", domain),
+	)
+
+	if err := validate.Domain(domain); err != nil {
+		log.WarnContext(ctx, "invalid domain", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidDomain)
+	}
+
+	app, err := a.app(ctx, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.appDomains.SaveAppDomain(ctx, app.ID, domain); err != nil {
+		if errors.Is(err, storage.ErrAppDomainExists) {
+			return fmt.Errorf("%s: %w", op, ErrDomainExists)
+		}
+
+		log.ErrorContext(ctx, "failed to save app domain", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateApp(ctx, app.Code)
+
+	log.InfoContext(ctx, "app domain allowed")
+
+	return nil
+}
+
+// DisallowAppDomain removes the domain from the app's allowed list.
+// Removing the last domain lifts the restriction.
+func (a *Admin) DisallowAppDomain(ctx context.Context, appCode string, domain string) error {
+	const op = "Admin.DisallowAppDomain"
+
+	domain = normalizeDomain(domain)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.String("domain", domain),
+	)
+
+	app, err := a.app(ctx, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.appDomains.DeleteAppDomain(ctx, app.ID, domain); err != nil {
+		if errors.Is(err, storage.ErrAppDomainNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrDomainNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to delete app domain", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateApp(ctx, app.Code)
+
+	log.InfoContext(ctx, "app domain disallowed")
+
+	return nil
+}
+
+// normalizeDomain brings the domain to the form emails are normalized to, "@corp.com" is accepted too.
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+)
+
+// MaxLoginHistory bounds the number of logins LoginHistory returns.
+const MaxLoginHistory = 100
+
+type LoginHistoryProvider interface {
+	LoginHistory(ctx context.Context, userID int64, limit int) ([]models.Login, error)
+}
+
+// LoginHistory returns the latest logins of the user, newest first, with their IP addresses, devices
+// and locations. limit is capped at MaxLoginHistory, a non-positive limit returns MaxLoginHistory logins.
+func (a *Admin) LoginHistory(ctx context.Context, email string, limit int) ([]models.Login, error) {
+	const op = "Admin.LoginHistory"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	if limit <= 0 || limit > MaxLoginHistory {
+		limit = MaxLoginHistory
+	}
+
+	user, err := a.user(ctx, email, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	logins, err := a.loginHistory.LoginHistory(ctx, user.ID, limit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get login history", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return logins, nil
+}
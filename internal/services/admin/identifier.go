@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/identifier"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+var (
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrInvalidPhone    = errors.New("invalid phone number")
+	ErrIdentifierTaken = errors.New("identifier is taken by another user")
+)
+
+type UserIdentifierSetter interface {
+	SetUserIdentifier(ctx context.Context, userID int64, kind identifier.Kind, value string) error
+}
+
+// SetUsername sets the username the user can log in with instead of the email.
+// An empty username removes it.
+func (a *Admin) SetUsername(ctx context.Context, email string, username string) error {
+	const op = "Admin.SetUsername"
+
+	if username != "" {
+		normalized, err := identifier.NormalizeUsername(username)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, ErrInvalidUsername)
+		}
+		username = normalized
+	}
+
+	return a.setUserIdentifier(ctx, op, email, identifier.Username, username)
+}
+
+// SetPhone sets the phone number the user can log in with instead of the email.
+// The number is stored in E.164 form, an empty number removes it.
+func (a *Admin) SetPhone(ctx context.Context, email string, phone string) error {
+	const op = "Admin.SetPhone"
+
+	if phone != "" {
+		normalized, err := identifier.NormalizePhone(phone)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, ErrInvalidPhone)
+		}
+		phone = normalized
+	}
+
+	return a.setUserIdentifier(ctx, op, email, identifier.Phone, phone)
+}
+
+func (a *Admin) setUserIdentifier(ctx context.Context, op string, email string, kind identifier.Kind, value string) error {
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	user, err := a.user(ctx, email, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.identifiers.SetUserIdentifier(ctx, user.ID, kind, value); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+
+		if errors.Is(err, storage.ErrIdentifierTaken) {
+			log.WarnContext(ctx, "identifier is taken", slog.String("kind", string(kind)))
+			return fmt.Errorf("%s: %w", op, ErrIdentifierTaken)
+		}
+
+		log.ErrorContext(ctx, "failed to set identifier", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	log.InfoContext(ctx, "user identifier changed", slog.String("kind", string(kind)), slog.Bool("cleared", value == ""))
+
+	return nil
+}
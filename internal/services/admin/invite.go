@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/invite"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/validate"
+	"sso/internal/storage"
+	"time"
+)
+
+var (
+	ErrInvalidEmail          = errors.New("invalid email")
+	ErrInvalidInviteTTL      = errors.New("invite ttl must be positive")
+	ErrUserExists            = errors.New("user already exists")
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed in the app")
+)
+
+type InviteStorage interface {
+	SaveInvite(ctx context.Context, invite models.Invite) (int64, error)
+	DeleteInvitesExpiredBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// CreateInvite creates an invite to register the email, valid for ttl. The user registered
+// with it is granted access to the apps. The returned token is shown only once, only its hash is stored.
+func (a *Admin) CreateInvite(ctx context.Context, addr string, appCodes []string, ttl time.Duration) (string, error) {
+	const op = "Admin.CreateInvite"
+
+	addr = a.emails.Normalize(addr)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", addr),
+		slog.Any("app_codes", appCodes),
+	)
+
+	if err := validate.Email(addr); err != nil {
+		log.WarnContext(ctx, "invalid email", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidEmail)
+	}
+
+	if ttl <= 0 {
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidInviteTTL)
+	}
+
+	if _, err := a.userProvider.User(ctx, addr); err == nil {
+		log.WarnContext(ctx, "user already exists")
+		return "", fmt.Errorf("%s: %w", op, ErrUserExists)
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		log.ErrorContext(ctx, "failed to get user", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	appIDs := make([]int32, 0, len(appCodes))
+	for _, appCode := range appCodes {
+		app, err := a.app(ctx, appCode, log, op)
+		if err != nil {
+			return "", err
+		}
+
+		if err := a.checkInviteDomain(ctx, addr, app, log, op); err != nil {
+			return "", err
+		}
+
+		appIDs = append(appIDs, app.ID)
+	}
+
+	token, hash, err := invite.NewToken()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate invite token", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	id, err := a.invites.SaveInvite(ctx, models.Invite{
+		TokenHash: hash,
+		Email:     addr,
+		AppIDs:    appIDs,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save invite", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "invite created", slog.Int64("invite_id", id))
+
+	return token, nil
+}
+
+// DeleteExpiredInvites deletes invites that expired more than retention ago
+// and returns the number of deleted invites.
+func (a *Admin) DeleteExpiredInvites(ctx context.Context, retention time.Duration) (int64, error) {
+	const op = "Admin.DeleteExpiredInvites"
+
+	log := a.log.With(slog.String("op", op))
+
+	deleted, err := a.invites.DeleteInvitesExpiredBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.ErrorContext(ctx, "failed to delete expired invites", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if deleted > 0 {
+		log.InfoContext(ctx, "expired invites deleted", slog.Int64("count", deleted))
+	}
+
+	return deleted, nil
+}
+
+// checkInviteDomain rejects invites to apps that don't allow the domain of the email.
+func (a *Admin) checkInviteDomain(ctx context.Context, addr string, app models.App, log *slog.Logger, op string) error {
+	domains, err := a.appDomains.AppDomains(ctx, app.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get app domains", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !email.DomainAllowed(addr, domains) {
+		log.WarnContext(ctx, "email domain is not allowed in the app", slog.String("app_code", app.Code))
+		return fmt.Errorf("%s: %w", op, ErrEmailDomainNotAllowed)
+	}
+
+	return nil
+}
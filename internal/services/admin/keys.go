@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"time"
+)
+
+var ErrInvalidOverlap = errors.New("key overlap must be positive")
+
+type KeyRotator interface {
+	RotateSigningKey(ctx context.Context, key models.SigningKey, retireAt time.Time) error
+}
+
+// RotateSigningKey generates a new signing key for the app and makes it active. Previous keys
+// keep validating tokens for overlap, which should be not less than the token TTL.
+func (a *Admin) RotateSigningKey(ctx context.Context, appCode string, overlap time.Duration) (string, error) {
+	const op = "Admin.RotateSigningKey"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.Duration("overlap", overlap),
+	)
+
+	if overlap <= 0 {
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidOverlap)
+	}
+
+	app, err := a.app(ctx, appCode, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	kid, err := randomHex(8)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate key id", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate key secret", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	key := models.SigningKey{
+		ID:        kid,
+		AppID:     app.ID,
+		Secret:    secret,
+		CreatedAt: now,
+	}
+
+	if err := a.keyRotator.RotateSigningKey(ctx, key, now.Add(overlap)); err != nil {
+		log.ErrorContext(ctx, "failed to rotate signing key", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateApp(ctx, app.Code)
+
+	log.InfoContext(ctx, "signing key rotated", slog.String("kid", kid))
+
+	return kid, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/ratelimit"
+	"strings"
+)
+
+var ErrRateLimitingDisabled = errors.New("rate limiting is not enabled")
+
+// RateLimitCounters shows and resets the rate limiting state of a subject, e.g. rate limits or login lockouts.
+type RateLimitCounters interface {
+	Counters(ctx context.Context, subject string) ([]ratelimit.Counter, error)
+	Reset(ctx context.Context, subject string) error
+}
+
+// RateLimits returns the attempt counters and lockouts of the subject, an email or an IP address,
+// with their time left until reset. Counters without attempts are omitted.
+func (a *Admin) RateLimits(ctx context.Context, subject string) ([]ratelimit.Counter, error) {
+	const op = "Admin.RateLimits"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("subject", subject),
+	)
+
+	if len(a.rateLimits) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrRateLimitingDisabled)
+	}
+
+	var counters []ratelimit.Counter
+	for _, rl := range a.rateLimits {
+		c, err := rl.Counters(ctx, normalizeSubject(subject))
+		if err != nil {
+			log.ErrorContext(ctx, "failed to get rate limit counters", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		counters = append(counters, c...)
+	}
+
+	return counters, nil
+}
+
+// ResetRateLimits resets the attempt counters and lifts the lockouts of the subject,
+// so a legitimate user blocked by the limiter can log in again.
+func (a *Admin) ResetRateLimits(ctx context.Context, subject string) error {
+	const op = "Admin.ResetRateLimits"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("subject", subject),
+	)
+
+	if len(a.rateLimits) == 0 {
+		return fmt.Errorf("%s: %w", op, ErrRateLimitingDisabled)
+	}
+
+	for _, rl := range a.rateLimits {
+		if err := rl.Reset(ctx, normalizeSubject(subject)); err != nil {
+			log.ErrorContext(ctx, "failed to reset rate limits", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.InfoContext(ctx, "rate limits reset")
+
+	return nil
+}
+
+// normalizeSubject matches the subjects the interceptors count, see ratelimit.Field.
+func normalizeSubject(subject string) string {
+	return strings.ToLower(strings.TrimSpace(subject))
+}
@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"time"
+)
+
+// StatsDays is the number of UTC days, today included, the login counts of Stats cover.
+const StatsDays = 7
+
+type StatsProvider interface {
+	UsageStats(ctx context.Context, now time.Time, since time.Time) (models.Stats, error)
+}
+
+// Stats returns the number of users, of users active in the last 24 hours and 7 days,
+// and the successful and failed logins of each app over the last StatsDays days.
+func (a *Admin) Stats(ctx context.Context) (models.Stats, error) {
+	const op = "Admin.Stats"
+
+	log := a.log.With(slog.String("op", op))
+
+	now := time.Now()
+
+	stats, err := a.stats.UsageStats(ctx, now, now.UTC().AddDate(0, 0, -(StatsDays-1)))
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get stats", sl.Err(err))
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
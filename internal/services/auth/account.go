@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserDeleter interface {
+	SoftDeleteUser(ctx context.Context, userID int64, at time.Time) error
+}
+
+// DeleteAccount deletes the user's own account after checking the password. The account
+// becomes unusable immediately, personal data is erased after the retention window.
+func (a *Auth) DeleteAccount(ctx context.Context, email string, password string) error {
+	const op = "Auth.DeleteAccount"
+
+	email = a.emails.Normalize(email)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	log.InfoContext(ctx, "deleting account")
+
+	user, err := getUser(ctx, a.userProvider, email, log, op)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.dummyCompare(ctx, password, log)
+		}
+		return err
+	}
+
+	if err := a.comparePassword(ctx, user, password); err != nil {
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			log.ErrorContext(ctx, "failed to compare password hash", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.WarnContext(ctx, "invalid credentials", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if err := a.userDeleter.SoftDeleteUser(ctx, user.ID, time.Now()); err != nil {
+		log.ErrorContext(ctx, "failed to delete user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Иначе реплики принимают токены удалённого пользователя до конца TTL кэша
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	log.InfoContext(ctx, "account deleted", slog.Int64("user_id", user.ID))
+
+	return nil
+}
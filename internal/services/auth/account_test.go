@@ -0,0 +1,58 @@
+package auth_test
+
+import (
+	"context"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/services/auth"
+	"sso/internal/services/auth/mocks"
+	"sso/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAccount_CachedUser(t *testing.T) {
+	ctx := context.Background()
+	user := newUser(t)
+
+	token, err := jwt.NewToken(user, testApp, jwt.Key{Secret: testApp.Secret}, time.Hour, nil)
+	require.NoError(t, err)
+
+	st := mocks.NewStorage(t)
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+
+	a, _ := newCachedAuth(t, st)
+
+	// Проверка кладёт пользователя в кэш
+	_, err = a.ValidateToken(ctx, token, testApp.Code)
+	require.NoError(t, err)
+
+	st.On("User", mock.Anything, testEmail).Return(user, nil).Once()
+	st.On("SoftDeleteUser", mock.Anything, user.ID, mock.Anything).Return(nil)
+
+	require.NoError(t, a.DeleteAccount(ctx, testEmail, testPassword))
+
+	// Удалённые пользователи не находятся ни по ID, ни по идентификатору
+	st.On("UserByID", mock.Anything, user.ID).Return(models.User{}, storage.ErrUserNotFound)
+	st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(models.User{}, storage.ErrUserNotFound)
+
+	_, err = a.ValidateToken(ctx, token, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = a.Login(ctx, testEmail, testPassword, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestDeleteAccount_WrongPassword(t *testing.T) {
+	st := mocks.NewStorage(t)
+	st.On("User", mock.Anything, testEmail).Return(newUser(t), nil)
+
+	err := newAuth(t, st).DeleteAccount(context.Background(), testEmail, "wrong-password")
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+var (
+	ErrInvalidAttributes   = errors.New("invalid user attributes")
+	ErrAttributesTooLarge  = errors.New("user attributes too large")
+	ErrAttributeNotVisible = errors.New("user attribute is not visible to the app")
+)
+
+// attributeKeyRe limits attribute keys to short identifiers.
+var attributeKeyRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// AttributeStorage keeps custom attributes of users as a JSON object.
+type AttributeStorage interface {
+	UserAttributes(ctx context.Context, userID int64) (map[string]json.RawMessage, error)
+	PatchUserAttributes(
+		ctx context.Context,
+		userID int64,
+		patch map[string]json.RawMessage,
+		maxSize int,
+	) (map[string]json.RawMessage, error)
+}
+
+// AttributeOptions controls custom user attributes.
+type AttributeOptions struct {
+	// MaxSize is the maximum size of all attributes of a user as JSON, in bytes.
+	MaxSize int
+	// Visibility lists the attributes an app may read and write by app code.
+	// Apps not listed see all attributes.
+	Visibility map[string][]string
+}
+
+// UserAttributes returns the custom attributes of the token's user visible to the app.
+func (a *Auth) UserAttributes(ctx context.Context, token string, appCode string) (map[string]json.RawMessage, error) {
+	const op = "Auth.UserAttributes"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := a.attributes.UserAttributes(ctx, user.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get user attributes", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return a.visibleAttributes(appCode, attrs), nil
+}
+
+// SetUserAttributes merges attrs into the custom attributes of the token's user and returns
+// the attributes visible to the app. A null value deletes the attribute, nested objects are merged.
+func (a *Auth) SetUserAttributes(
+	ctx context.Context,
+	token string,
+	appCode string,
+	attrs map[string]json.RawMessage,
+) (map[string]json.RawMessage, error) {
+	const op = "Auth.SetUserAttributes"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	for key, value := range attrs {
+		if !attributeKeyRe.MatchString(key) || !json.Valid(value) {
+			log.WarnContext(ctx, "invalid user attribute", slog.String("key", key))
+			return nil, fmt.Errorf("%s: %w: %q", op, ErrInvalidAttributes, key)
+		}
+
+		if !a.attributeVisible(appCode, key) {
+			log.WarnContext(ctx, "user attribute is not visible to the app", slog.String("key", key))
+			return nil, fmt.Errorf("%s: %w: %q", op, ErrAttributeNotVisible, key)
+		}
+	}
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attrs) == 0 {
+		return a.UserAttributes(ctx, token, appCode)
+	}
+
+	merged, err := a.attributes.PatchUserAttributes(ctx, user.ID, attrs, a.attrOpts.MaxSize)
+	if err != nil {
+		if errors.Is(err, storage.ErrAttributesTooLarge) {
+			log.WarnContext(ctx, "user attributes too large", slog.Int("max_size", a.attrOpts.MaxSize))
+			return nil, fmt.Errorf("%s: %w", op, ErrAttributesTooLarge)
+		}
+
+		log.ErrorContext(ctx, "failed to set user attributes", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "user attributes set", slog.Int64("user_id", user.ID))
+
+	return a.visibleAttributes(appCode, merged), nil
+}
+
+func (a *Auth) attributeVisible(appCode string, key string) bool {
+	keys, ok := a.attrOpts.Visibility[appCode]
+	return !ok || slices.Contains(keys, key)
+}
+
+func (a *Auth) visibleAttributes(appCode string, attrs map[string]json.RawMessage) map[string]json.RawMessage {
+	if _, ok := a.attrOpts.Visibility[appCode]; !ok {
+		return attrs
+	}
+
+	visible := make(map[string]json.RawMessage, len(attrs))
+	for key, value := range attrs {
+		if a.attributeVisible(appCode, key) {
+			visible[key] = value
+		}
+	}
+
+	return visible
+}
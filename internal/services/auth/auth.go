@@ -2,31 +2,55 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/identifier"
 	"sso/internal/lib/jwt"
 	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/policy"
+	"sso/internal/lib/validate"
 	"sso/internal/storage"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// emailCheckTimeout bounds the DNS lookup of the email domain on registration.
+const emailCheckTimeout = 3 * time.Second
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserAppNotEnabled  = errors.New("user not have access")
 	ErrInvalidToken       = errors.New("invalide token")
 	ErrAppNotFound        = errors.New("App not found")
+	ErrClaimsNotFound     = errors.New("claims not found")
+	ErrUserBlocked        = errors.New("user is blocked")
+	ErrTokenRevoked       = errors.New("token revoked")
+	ErrEmailUndeliverable = errors.New("email domain does not accept mail")
 )
 
+// claimsRefBytes is the length of random reference ids of server-side claim sets.
+const claimsRefBytes = 16
+
 type UserSaver interface {
-	SaveUser(ctx context.Context, email string, passHash []byte) (int64, error)
+	SaveUser(ctx context.Context, email string, passHash []byte, pepperID string) (int64, error)
+}
+
+type UserPassHashUpdater interface {
+	UpdateUserPassHash(ctx context.Context, userID int64, passHash []byte, pepperID string) error
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	UserByIdentifier(ctx context.Context, id identifier.Identifier) (models.User, error)
 }
 
 type AppProvider interface {
@@ -37,166 +61,438 @@ type UserAppProvider interface {
 	UserApp(ctx context.Context, userID int64, appID int32) (models.UserApp, error)
 }
 
-type UserAppSaver interface {
-	SaveUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) (int64, error)
+type UserAppUpserter interface {
+	UpsertUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) (models.UserApp, error)
+}
+
+// EmailChecker checks that an email address can receive mail, e.g. by MX lookup.
+type EmailChecker interface {
+	Check(ctx context.Context, addr string) error
+}
+
+// PasswordHasher hashes and compares passwords, possibly rejecting work under load.
+type PasswordHasher interface {
+	Hash(ctx context.Context, password []byte, cost int) ([]byte, error)
+	Compare(ctx context.Context, hash []byte, password []byte) error
+}
+
+type ClaimsSaver interface {
+	SaveTokenClaims(ctx context.Context, claims models.TokenClaims) error
+}
+
+type ClaimsProvider interface {
+	TokenClaims(ctx context.Context, ref string) (models.TokenClaims, error)
+}
+
+// Storage is the database of the service.
+type Storage interface {
+	UserSaver
+	UserProvider
+	UserPassHashUpdater
+	UserDeleter
+	AppProvider
+	UserAppProvider
+	UserAppUpserter
+	ClaimsSaver
+	ClaimsProvider
+	TokenUseStorage
+	MaintenanceProvider
+	DeviceStorage
+	AppDomainProvider
+	SigningKeyProvider
+	TokenRevoker
+	InviteProvider
+	ConsentStorage
+	TermsStorage
+	AttributeStorage
+	RecoveryStorage
+	PhoneSetter
+}
+
+// PasswordOptions controls password hashing.
+type PasswordOptions struct {
+	// Cost is the bcrypt cost of new hashes. Hashes with a lower cost are upgraded on login.
+	Cost int
+	// Peppers are the server-side secrets mixed into passwords by id. Old peppers are kept
+	// to verify existing hashes until they are upgraded to PepperID on login.
+	Peppers map[string][]byte
+	// PepperID is the pepper of new hashes, empty disables peppering.
+	PepperID string
+	// AntiEnumeration hides whether an account exists: registration with a taken email succeeds
+	// without creating a user. Logins of unknown users take as long as wrong passwords regardless.
+	AntiEnumeration bool
+	// MinScore is the least strength score, from 0 to 4, of passwords of new users. 0 accepts any password.
+	MinScore int
 }
 
-type UserAppUpdater interface {
-	UpdateUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) error
+// TokenOptions controls the size of issued tokens.
+type TokenOptions struct {
+	// MaxSize is the maximum serialized token size in bytes, zero means unlimited.
+	MaxSize int
+	// ClaimsByRef replaces extra claims of an oversized token with a reference claim
+	// resolvable via Claims instead of failing the issuance.
+	ClaimsByRef bool
+	// PurposeTTL is the lifetime of purpose tokens, purposes without a TTL can't be issued.
+	PurposeTTL map[jwt.Purpose]time.Duration
+	// Leeway tolerates clock drift when checking exp, nbf and iat of tokens.
+	Leeway time.Duration
+	// DeviceTrustTTL is the lifetime of device tokens of remembered devices, zero disables remembering.
+	DeviceTrustTTL time.Duration
+	// Delegations lists the apps whose tokens an app may get for its tokens by app code, see ExchangeToken.
+	Delegations map[string][]string
 }
 
 type Auth struct {
 	log             *slog.Logger
+	hasher          PasswordHasher
+	passOpts        PasswordOptions
 	userSaver       UserSaver
 	userProvider    UserProvider
+	passHashUpdater UserPassHashUpdater
+	userDeleter     UserDeleter
 	appProvider     AppProvider
 	userAppProvider UserAppProvider
-	userAppSaver    UserAppSaver
-	userAppUpdater  UserAppUpdater
+	userAppUpserter UserAppUpserter
+	claimsSaver     ClaimsSaver
+	claimsProvider  ClaimsProvider
+	tokenUses       TokenUseStorage
+	maintenance     MaintenanceProvider
+	loginSessions   LoginSessionStore
+	challenges      []Challenge
+	devices         DeviceStorage
+	notifier        Notifier
 	tokenTTL        time.Duration
+	tokenOpts       TokenOptions
+	loginSessionTTL time.Duration
+	emails          email.Normalizer
+	emailChecker    EmailChecker
+	appDomains      AppDomainProvider
+	signingKeys     SigningKeyProvider
+	sessions        SessionStore
+	tokenRevoker    TokenRevoker
+	revokedTokens   RevokedTokenStore
+	invites         InviteProvider
+	policy          PolicyDecider
+	loginStats      LoginRecorder
+	geo             GeoLocator
+	consents        ConsentStorage
+	terms           TermsStorage
+	termsVersion    string
+	attributes      AttributeStorage
+	attrOpts        AttributeOptions
+	recoveryStore   RecoveryStorage
+	recovery        RecoveryOptions
+	emailOTP        EmailOTPOptions
+	phoneSetter     PhoneSetter
+	phone           PhoneOptions
+	risk            *RiskScorer
+	invalidator     UserInvalidator
+
+	// dummyHash is compared against on logins of unknown users, see dummyCompare.
+	dummyOnce sync.Once
+	dummyHash []byte
 }
 
+// New creates the auth service. userProvider, userAppProvider and appProvider serve the lookups
+// of users, user_app rows and apps, e.g. through a cache in front of storage; sessions and revokedTokens keep
+// short-lived state, e.g. in Redis. Pass storage for any of them to use the database.
+// loginStats may be nil to not count logins, geo may be nil to record logins without their location.
+// termsVersion is the current version of the terms of service, empty disables the acceptance check.
+// risk may be nil when logins are not scored, otherwise it counts failed password attempts.
+// invalidator drops the cached users whose tokens or credentials the service changes, on all instances.
 func New(
 	log *slog.Logger,
-	userSaver UserSaver,
+	hasher PasswordHasher,
+	passOpts PasswordOptions,
+	storage Storage,
 	userProvider UserProvider,
-	appProvider AppProvider,
 	userAppProvider UserAppProvider,
-	userAppSaver UserAppSaver,
-	userAppUpdater UserAppUpdater,
+	appProvider AppProvider,
+	sessions SessionStore,
+	revokedTokens RevokedTokenStore,
+	loginSessions LoginSessionStore,
+	challenges []Challenge,
+	notifier Notifier,
 	ttl time.Duration,
+	tokenOpts TokenOptions,
+	loginSessionTTL time.Duration,
+	emails email.Normalizer,
+	emailChecker EmailChecker,
+	policy PolicyDecider,
+	loginStats LoginRecorder,
+	signingKeys SigningKeyProvider,
+	geo GeoLocator,
+	termsVersion string,
+	attrOpts AttributeOptions,
+	recovery RecoveryOptions,
+	emailOTP EmailOTPOptions,
+	phone PhoneOptions,
+	risk *RiskScorer,
+	invalidator UserInvalidator,
 ) *Auth {
 	return &Auth{
 		log:             log,
-		userSaver:       userSaver,
+		hasher:          hasher,
+		passOpts:        passOpts,
+		userSaver:       storage,
 		userProvider:    userProvider,
+		passHashUpdater: storage,
+		userDeleter:     storage,
 		appProvider:     appProvider,
 		userAppProvider: userAppProvider,
-		userAppSaver:    userAppSaver,
-		userAppUpdater:  userAppUpdater,
+		userAppUpserter: storage,
+		claimsSaver:     storage,
+		claimsProvider:  storage,
+		tokenUses:       storage,
+		maintenance:     storage,
+		loginSessions:   loginSessions,
+		challenges:      challenges,
+		devices:         storage,
+		notifier:        notifier,
 		tokenTTL:        ttl,
+		tokenOpts:       tokenOpts,
+		loginSessionTTL: loginSessionTTL,
+		emails:          emails,
+		emailChecker:    emailChecker,
+		appDomains:      storage,
+		signingKeys:     signingKeys,
+		sessions:        sessions,
+		tokenRevoker:    storage,
+		revokedTokens:   revokedTokens,
+		invites:         storage,
+		policy:          policy,
+		loginStats:      loginStats,
+		geo:             geo,
+		consents:        storage,
+		terms:           storage,
+		termsVersion:    termsVersion,
+		attributes:      storage,
+		attrOpts:        attrOpts,
+		recoveryStore:   storage,
+		recovery:        recovery,
+		emailOTP:        emailOTP,
+		phoneSetter:     storage,
+		phone:           phone,
+		risk:            risk,
+		invalidator:     invalidator,
 	}
 }
 
 func (a *Auth) RegisterNewUser(ctx context.Context, email string, password string) (userID int64, err error) {
 	const op = "Auth.RegisterNewUser"
 
+	email = a.emails.Normalize(email)
+
 	log := a.log.With(
 		slog.String("op", op),
 		slog.String("email", email),
 	)
-	log.Info("registering user")
+	log.InfoContext(ctx, "registering user")
+
+	if err := a.checkEmail(ctx, email, log); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkPasswordStrength(ctx, password, email, log); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
 
 	// Генерация хэша от пароля
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passHash, pepperID, err := a.hashPassword(ctx, password)
 	if err != nil {
-		log.Error("failed to generate password hash", sl.Err(err))
+		log.ErrorContext(ctx, "failed to generate password hash", sl.Err(err))
 
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Сохранение User в БД
-	id, err := a.userSaver.SaveUser(ctx, email, passHash)
+	id, err := a.userSaver.SaveUser(ctx, email, passHash, pepperID)
 	if err != nil {
-		log.Error("failed to save user", sl.Err(err))
+		// Ответ на занятый email не отличается от успешной регистрации
+		if a.passOpts.AntiEnumeration && errors.Is(err, storage.ErrUserExists) {
+			log.WarnContext(ctx, "email is already registered, reporting success")
+			return 0, nil
+		}
+
+		log.ErrorContext(ctx, "failed to save user", sl.Err(err))
 
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("user registered is successfully")
+	log.InfoContext(ctx, "user registered is successfully")
 
 	return id, nil
 }
 
-func (a *Auth) Login(ctx context.Context, email string, password string, appCode string) (token string, err error) {
+// checkEmail rejects addresses whose domain can't receive mail. Lookup failures let the address through,
+// so a DNS outage doesn't block registration.
+func (a *Auth) checkEmail(ctx context.Context, email string, log *slog.Logger) error {
+	if a.emailChecker == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailCheckTimeout)
+	defer cancel()
+
+	err := a.emailChecker.Check(ctx, email)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, validate.ErrNoMailServer) {
+		log.WarnContext(ctx, "email domain has no mail server")
+		return ErrEmailUndeliverable
+	}
+
+	log.WarnContext(ctx, "failed to check email domain, skipping", sl.Err(err))
+	return nil
+}
+
+// Login authenticates the user by an email, a username or a phone number.
+// The result has the token and, if the user has to accept the terms of service, their version.
+// If the app requires additional login steps, Login returns ChallengeRequiredError with the session
+// token to continue with ContinueLogin.
+func (a *Auth) Login(ctx context.Context, login string, password string, appCode string) (LoginResult, error) {
 	const op = "Auth.Login"
 
-	log := a.log.With(
-		slog.String("op", op),
-		slog.String("email", email),
-		slog.String("app_code", appCode),
-	)
+	res, err := a.BeginLogin(ctx, login, password, appCode)
+	if err != nil {
+		return LoginResult{}, err
+	}
 
-	log.Info("attempting to login user")
+	// Одношаговый Login доступен только приложениям без дополнительных шагов входа
+	if res.Token == "" {
+		a.log.With(slog.String("op", op)).WarnContext(ctx, "login requires additional steps",
+			slog.String("login", login),
+			slog.String("app_code", appCode),
+			slog.String("next_step", string(res.NextStep)),
+		)
+		return LoginResult{}, fmt.Errorf("%s: %w", op, &ChallengeRequiredError{SessionToken: res.SessionToken, NextStep: res.NextStep})
+	}
 
-	// Получение User
-	user, err := getUser(ctx, a.userProvider, email, log, op)
+	return res, nil
+}
+
+// authenticate checks the password and ensures the user has a user_app row for the app.
+// The login is an email, a username or a phone number.
+func (a *Auth) authenticate(
+	ctx context.Context,
+	login string,
+	password string,
+	appCode string,
+	log *slog.Logger,
+	op string,
+) (models.User, models.App, error) {
+	// Получение User по любому из идентификаторов
+	user, err := getUserByIdentifier(ctx, a.userProvider, identifier.Detect(login), log, op)
 	if err != nil {
-		return "", err
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.dummyCompare(ctx, password, log)
+		}
+		return models.User{}, models.App{}, err
 	}
 
 	// Проверка валидности пароля по хэшу
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		log.Error("invalid credentials", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	if err := a.comparePassword(ctx, user, password); err != nil {
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			log.ErrorContext(ctx, "failed to compare password hash", sl.Err(err))
+			return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.ErrorContext(ctx, "invalid credentials", sl.Err(err))
+		a.risk.countFailure(ctx, user, log)
+		return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 	}
 
+	// Блокировка проверяется после пароля, чтобы не раскрывать её без знания пароля
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked")
+		return models.User{}, models.App{}, fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	a.upgradePassHash(ctx, user, password, log)
+
+	app, err := a.admitUser(ctx, user, appCode, log, op)
+	if err != nil {
+		return models.User{}, models.App{}, err
+	}
+
+	return user, app, nil
+}
+
+// admitUser checks that the user who passed the first factor may log into the app
+// and ensures the user has a user_app row for it.
+func (a *Auth) admitUser(ctx context.Context, user models.User, appCode string, log *slog.Logger, op string) (models.App, error) {
 	// Получение App
 	app, err := getApp(ctx, a.appProvider, appCode, log, op)
 	if err != nil {
-		return "", err
+		return models.App{}, err
 	}
 
-	// Получение UserApp, если нет - создаём новый с доступом, иначе включаем доступ
-	_, err = getUserApp(ctx, a.userAppProvider, user.ID, app.ID, log, op)
-	if err != nil && errors.Is(err, storage.ErrUserAppNotFound) {
-		err = saveUserApp(ctx, a.userAppSaver, user.ID, app.ID, true, log, op)
-		if err != nil {
-			return "", err
-		}
+	if err := a.checkMaintenance(ctx, app, log, op); err != nil {
+		return models.App{}, err
 	}
 
-	if err != nil {
-		log.Error("failed to get user app", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, err)
+	if err := a.checkAppDomain(ctx, user, app, log, op); err != nil {
+		return models.App{}, err
 	}
 
-	// Генерация токена
-	token, err = jwt.NewToken(user, app, a.tokenTTL)
-	if err != nil {
-		log.Error("failed to generate token", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, err)
+	if err := a.checkPolicy(ctx, user, app, policy.ActionLogin, log, op); err != nil {
+		return models.App{}, err
 	}
 
-	log.Info("user logged is successfully")
+	// Создание UserApp с доступом при первом входе, существующая запись не меняется
+	if _, err := a.userAppUpserter.UpsertUserApp(ctx, user.ID, app.ID, true); err != nil {
+		log.ErrorContext(ctx, "failed to upsert user app", sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
 
-	return token, nil
+	return app, nil
 }
 
-func (a *Auth) Logout(ctx context.Context, email string, appCode string) (isSuccess bool, err error) {
+// Logout revokes the token it is called with: the JWT is added to the revoked list until it expires,
+// the session of an opaque token is deleted. Other tokens of the user and the user's access to the app
+// are not affected. The token must belong to the user with the email.
+func (a *Auth) Logout(ctx context.Context, token string, email string, appCode string) (isSuccess bool, err error) {
 	const op = "Auth.Logout"
+
+	email = a.emails.Normalize(email)
+
 	log := a.log.With(
 		slog.String("op", op),
 		slog.String("email", email),
 		slog.String("app_code", appCode),
 	)
-	log.Info("attempting to logout user")
+	log.InfoContext(ctx, "attempting to logout user")
 
-	// Получение User
-	user, err := getUser(ctx, a.userProvider, email, log, op)
+	// Получение App
+	app, err := getApp(ctx, a.appProvider, appCode, log, op)
 	if err != nil {
 		return false, err
 	}
 
-	// Получение App
-	app, err := getApp(ctx, a.appProvider, appCode, log, op)
+	// Валидация токена
+	claims, err := a.parseToken(ctx, token, app, log, op)
 	if err != nil {
 		return false, err
 	}
 
-	// Получение UserApp
-	userApp, err := getUserApp(ctx, a.userAppProvider, user.ID, app.ID, log, op)
+	user, err := getUserByID(ctx, a.userProvider, claims.UID, log, op)
 	if err != nil {
-		log.Error("failed to get user app", sl.Err(err))
-		return false, fmt.Errorf("%s: %w", op, err)
+		return false, err
 	}
 
-	// Запрет доступа User к App
-	err = a.userAppUpdater.UpdateUserApp(ctx, userApp.UserID, userApp.AppID, false)
-	if err != nil {
+	if user.Email != email {
+		log.WarnContext(ctx, "token belongs to another user")
+		return false, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if err := a.revokeToken(ctx, token, claims, log, op); err != nil {
 		return false, err
 	}
 
+	log.InfoContext(ctx, "user logged out", slog.Int64("user_id", user.ID))
+
 	return true, nil
 }
 
@@ -205,35 +501,226 @@ func (a *Auth) ValidateToken(ctx context.Context, token string, appCode string)
 	log := a.log.With(
 		slog.String("op", op),
 	)
-	log.Info("validating token")
+	log.InfoContext(ctx, "validating token")
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return "", err
+	}
+	log.InfoContext(ctx, "token validated is successfully")
+
+	return user.Email, nil
+}
 
+// validateToken validates the token of the app and checks its user still may use the app.
+func (a *Auth) validateToken(
+	ctx context.Context,
+	token string,
+	appCode string,
+	log *slog.Logger,
+	op string,
+) (models.User, models.App, jwt.Claims, error) {
 	// Получение App
 	app, err := getApp(ctx, a.appProvider, appCode, log, op)
 	if err != nil {
-		return "", err
+		return models.User{}, models.App{}, jwt.Claims{}, err
 	}
 
 	// Валидация токена
-	email, err = jwt.ValidateToken(token, app.Secret)
+	claims, err := a.parseToken(ctx, token, app, log, op)
 	if err != nil {
-		log.Error("failed to validate token", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.User{}, models.App{}, jwt.Claims{}, err
 	}
 
-	// Получение User
-	user, err := getUser(ctx, a.userProvider, email, log, op)
+	// Получение User по uid из токена, без поиска по email
+	user, err := getUserByID(ctx, a.userProvider, claims.UID, log, op)
 	if err != nil {
-		return "", err
+		return models.User{}, models.App{}, jwt.Claims{}, err
+	}
+
+	if err := checkTokenUser(ctx, user, claims, log, op); err != nil {
+		return models.User{}, models.App{}, jwt.Claims{}, err
 	}
 
 	// Проверка доступа User к App
 	err = isAccessAllowed(ctx, a.userAppProvider, user.ID, app.ID, log, op)
 	if err != nil {
+		return models.User{}, models.App{}, jwt.Claims{}, err
+	}
+
+	if err := a.checkPolicy(ctx, user, app, policy.ActionValidate, log, op); err != nil {
+		return models.User{}, models.App{}, jwt.Claims{}, err
+	}
+
+	return user, app, claims, nil
+}
+
+// Claims returns the extra claims of the token: embedded ones or, for tokens issued
+// with a reference claim, the claim set stored server-side.
+func (a *Auth) Claims(ctx context.Context, token string, appCode string) (map[string]any, error) {
+	const op = "Auth.Claims"
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	// Получение App
+	app, err := getApp(ctx, a.appProvider, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	// Валидация токена
+	claims, err := a.parseToken(ctx, token, app, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.extraClaims(ctx, app, claims, log, op)
+}
+
+// extraClaims resolves the extra claims of a parsed token, following the reference claim if there is one.
+func (a *Auth) extraClaims(
+	ctx context.Context,
+	app models.App,
+	claims jwt.Claims,
+	log *slog.Logger,
+	op string,
+) (map[string]any, error) {
+	ref, ok := claims.Extra[jwt.ClaimsRefKey].(string)
+	if !ok {
+		return claims.Extra, nil
+	}
+
+	// Получение claims по ссылке
+	stored, err := a.claimsProvider.TokenClaims(ctx, ref)
+	if err != nil {
+		if errors.Is(err, storage.ErrClaimsNotFound) {
+			log.WarnContext(ctx, "claims not found", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, ErrClaimsNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to get claims", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if stored.AppID != app.ID || stored.UserID != claims.UID || time.Now().After(stored.ExpiresAt) {
+		log.WarnContext(ctx, "claims do not match token")
+		return nil, fmt.Errorf("%s: %w", op, ErrClaimsNotFound)
+	}
+
+	extra := make(map[string]any)
+	if err := json.Unmarshal(stored.Claims, &extra); err != nil {
+		log.ErrorContext(ctx, "failed to decode claims", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return extra, nil
+}
+
+// issueToken generates a token in the format of the app with the claims of its claims template.
+// JWTs are checked against the token size budget.
+func (a *Auth) issueToken(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	extra map[string]any,
+	log *slog.Logger,
+	op string,
+) (string, error) {
+	extra, err := a.templateClaims(ctx, user, app, extra, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	if app.TokenFormat == models.TokenFormatOpaque {
+		return a.issueOpaqueToken(ctx, user, app, extra, log, op)
+	}
+
+	key, err := a.signingKey(ctx, app, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := jwt.NewToken(user, app, key, a.tokenTTL, extra)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate token", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	sizeErr := jwt.CheckSize(token, a.tokenOpts.MaxSize)
+	if sizeErr == nil {
+		return token, nil
+	}
+
+	if !a.tokenOpts.ClaimsByRef || len(extra) == 0 {
+		log.ErrorContext(ctx, "token exceeds size limit", sl.Err(sizeErr))
+		return "", fmt.Errorf("%s: %w", op, sizeErr)
+	}
+
+	// Замена extra claims ссылкой на набор, сохранённый на сервере
+	ref, err := newClaimsRef()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate claims ref", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	encoded, err := json.Marshal(extra)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to encode claims", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.claimsSaver.SaveTokenClaims(ctx, models.TokenClaims{
+		Ref:       ref,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		Claims:    encoded,
+		ExpiresAt: time.Now().Add(a.tokenTTL),
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save claims", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err = jwt.NewToken(user, app, key, a.tokenTTL, map[string]any{jwt.ClaimsRefKey: ref})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate token", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := jwt.CheckSize(token, a.tokenOpts.MaxSize); err != nil {
+		log.ErrorContext(ctx, "token exceeds size limit", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "token claims replaced with reference", slog.Int("claims_size", len(encoded)))
+
+	return token, nil
+}
+
+func newClaimsRef() (string, error) {
+	b := make([]byte, claimsRefBytes)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	log.Info("token validated is successfully")
 
-	return email, nil
+	return hex.EncodeToString(b), nil
+}
+
+// checkTokenUser rejects tokens of blocked users and tokens issued before the user's token version was bumped.
+func checkTokenUser(ctx context.Context, user models.User, claims jwt.Claims, log *slog.Logger, op string) error {
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked")
+		return fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	if user.ID != claims.UID || user.TokenVersion != claims.TokenVersion {
+		log.WarnContext(ctx, "token revoked", slog.Int64("token_version", claims.TokenVersion))
+		return fmt.Errorf("%s: %w", op, ErrTokenRevoked)
+	}
+
+	return nil
 }
 
 func getUser(
@@ -246,11 +733,53 @@ func getUser(
 	user, err := userProvider.User(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", sl.Err(err))
+			log.WarnContext(ctx, "user not found", sl.Err(err))
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+
+		log.ErrorContext(ctx, "failed to get user", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func getUserByIdentifier(
+	ctx context.Context,
+	userProvider UserProvider,
+	id identifier.Identifier,
+	log *slog.Logger,
+	op string,
+) (models.User, error) {
+	user, err := userProvider.UserByIdentifier(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.WarnContext(ctx, "user not found", slog.String("kind", string(id.Kind)))
 			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 
-		log.Error("failed to get user", sl.Err(err))
+		log.ErrorContext(ctx, "failed to get user", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func getUserByID(
+	ctx context.Context,
+	userProvider UserProvider,
+	userID int64,
+	log *slog.Logger,
+	op string,
+) (models.User, error) {
+	user, err := userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.WarnContext(ctx, "user not found", slog.Int64("user_id", userID))
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		log.ErrorContext(ctx, "failed to get user", sl.Err(err))
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -267,10 +796,10 @@ func getApp(
 	app, err := appProvider.App(ctx, appCode)
 	if err != nil {
 		if errors.Is(err, storage.ErrAppNotFound) {
-			log.Warn("app not found", sl.Err(err))
+			log.WarnContext(ctx, "app not found", sl.Err(err))
 			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
 		}
-		log.Error("failed to get app", sl.Err(err))
+		log.ErrorContext(ctx, "failed to get app", sl.Err(err))
 		return models.App{}, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -288,7 +817,7 @@ func getUserApp(
 	userApp, err := userAppProvider.UserApp(ctx, userID, appID)
 	if err != nil {
 		if errors.Is(err, storage.ErrAppNotFound) {
-			log.Error("user app not found")
+			log.ErrorContext(ctx, "user app not found")
 			return models.UserApp{}, fmt.Errorf("%s: %w", op, ErrUserAppNotEnabled)
 		}
 
@@ -298,24 +827,6 @@ func getUserApp(
 	return userApp, nil
 }
 
-func saveUserApp(
-	ctx context.Context,
-	userAppSaver UserAppSaver,
-	userID int64,
-	appID int32,
-	isEnabled bool,
-	log *slog.Logger,
-	op string,
-) error {
-	_, err := userAppSaver.SaveUserApp(ctx, userID, appID, isEnabled)
-	if err != nil {
-		log.Error("failed to save user app", sl.Err(err))
-		return fmt.Errorf("%s: %w", op, err)
-	}
-
-	return nil
-}
-
 func isAccessAllowed(
 	ctx context.Context,
 	userAppProvider UserAppProvider,
@@ -330,7 +841,7 @@ func isAccessAllowed(
 	}
 
 	if !userApp.IsEnabled {
-		log.Error("user app is not enabled")
+		log.ErrorContext(ctx, "user app is not enabled")
 		return fmt.Errorf("%s: %w", op, ErrUserAppNotEnabled)
 	}
 
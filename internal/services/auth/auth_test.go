@@ -0,0 +1,673 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/geoip"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/identifier"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger"
+	"sso/internal/lib/reqctx"
+	"sso/internal/lib/requestid"
+	"sso/internal/lib/risk"
+	"sso/internal/notify"
+	"sso/internal/services/auth"
+	"sso/internal/services/auth/mocks"
+	"sso/internal/storage"
+	"sso/internal/storage/cache"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testEmail    = "user@example.com"
+	testPassword = "correct-password"
+)
+
+var _ auth.Storage = (*mocks.Storage)(nil)
+
+var testApp = models.App{ID: 1, Code: "web", Secret: "test-secret"}
+
+func newAuth(t *testing.T, st *mocks.Storage) *auth.Auth {
+	t.Helper()
+
+	return newAuthWithPasswordOptions(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost})
+}
+
+func newAuthWithPasswordOptions(t *testing.T, st *mocks.Storage, passOpts auth.PasswordOptions) *auth.Auth {
+	t.Helper()
+
+	return buildAuth(t, st, passOpts, auth.TokenOptions{}, auth.EmailOTPOptions{}, auth.PhoneOptions{}, nil)
+}
+
+func buildAuth(
+	t *testing.T,
+	st *mocks.Storage,
+	passOpts auth.PasswordOptions,
+	tokenOpts auth.TokenOptions,
+	emailOTP auth.EmailOTPOptions,
+	phone auth.PhoneOptions,
+	riskScorer *auth.RiskScorer,
+) *auth.Auth {
+	t.Helper()
+
+	return buildAuthWithLog(t, slog.New(slog.NewTextHandler(io.Discard, nil)), st, nil, nil, passOpts, tokenOpts, emailOTP, phone, riskScorer)
+}
+
+func buildAuthWithLog(
+	t *testing.T,
+	log *slog.Logger,
+	st *mocks.Storage,
+	loginSessions auth.LoginSessionStore,
+	challenges []auth.Challenge,
+	passOpts auth.PasswordOptions,
+	tokenOpts auth.TokenOptions,
+	emailOTP auth.EmailOTPOptions,
+	phone auth.PhoneOptions,
+	riskScorer *auth.RiskScorer,
+) *auth.Auth {
+	t.Helper()
+
+	return buildAuthWithUsers(t, log, st, st, st, cache.NewInvalidator(log, nil, nil),
+		loginSessions, challenges, passOpts, tokenOpts, emailOTP, phone, riskScorer)
+}
+
+// newCachedAuth serves the users and user_app rows through a cache in front of st, as the service does
+// with user_cache.ttl set. The returned invalidator drops entries of that cache.
+func newCachedAuth(t *testing.T, st *mocks.Storage) (*auth.Auth, *cache.Invalidator) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	users := cache.New(st, st, st, cache.Options{TTL: time.Minute, MaxEntries: 100})
+	invalidator := cache.NewInvalidator(log, users, nil)
+
+	return buildAuthWithUsers(t, log, st, users, users, invalidator,
+		nil, nil, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{}, auth.EmailOTPOptions{}, auth.PhoneOptions{}, nil), invalidator
+}
+
+func buildAuthWithUsers(
+	t *testing.T,
+	log *slog.Logger,
+	st *mocks.Storage,
+	users auth.UserProvider,
+	userApps auth.UserAppProvider,
+	invalidator auth.UserInvalidator,
+	loginSessions auth.LoginSessionStore,
+	challenges []auth.Challenge,
+	passOpts auth.PasswordOptions,
+	tokenOpts auth.TokenOptions,
+	emailOTP auth.EmailOTPOptions,
+	phone auth.PhoneOptions,
+	riskScorer *auth.RiskScorer,
+) *auth.Auth {
+	t.Helper()
+
+	return auth.New(
+		log,
+		hasher.New(1, 1),
+		passOpts,
+		st,
+		users,
+		userApps,
+		st,
+		nil,
+		nil,
+		loginSessions,
+		challenges,
+		nil,
+		time.Hour,
+		tokenOpts,
+		time.Minute,
+		email.Normalizer{},
+		nil,
+		nil,
+		nil,
+		st,
+		nil,
+		"",
+		auth.AttributeOptions{},
+		auth.RecoveryOptions{},
+		emailOTP,
+		phone,
+		riskScorer,
+		invalidator,
+	)
+}
+
+func newUser(t *testing.T) models.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	return models.User{ID: 42, Email: testEmail, PassHash: hash}
+}
+
+// expectApp sets up the app lookups of a login that passes all app checks.
+func expectApp(st *mocks.Storage) {
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("ActiveMaintenanceWindow", mock.Anything, testApp.ID, mock.Anything).
+		Return(models.MaintenanceWindow{}, storage.ErrMaintenanceNotFound)
+	st.On("AppDomains", mock.Anything, testApp.ID).Return(nil, nil)
+}
+
+func TestLogin_HappyPath(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	user := newUser(t)
+
+	st.On("UserByIdentifier", mock.Anything, identifier.Identifier{Kind: identifier.Email, Value: testEmail}).
+		Return(user, nil)
+	expectApp(st)
+	st.On("UpsertUserApp", mock.Anything, user.ID, testApp.ID, true).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+	st.On("ActiveSigningKey", mock.Anything, testApp.ID).Return(models.SigningKey{}, storage.ErrSigningKeyNotFound)
+	st.On("UserDevice", mock.Anything, user.ID, mock.Anything).Return(models.UserDevice{}, storage.ErrDeviceNotFound)
+	st.On("UserDeviceCount", mock.Anything, user.ID).Return(0, nil)
+	st.On("SaveUserDevice", mock.Anything, mock.Anything).Return(nil)
+
+	a := newAuth(t, st)
+
+	res, err := a.Login(ctx, " User@Example.com ", testPassword, testApp.Code)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Token)
+	require.Empty(t, res.TermsVersion)
+
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil)
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+
+	gotEmail, err := a.ValidateToken(ctx, res.Token, testApp.Code)
+	require.NoError(t, err)
+	require.Equal(t, testEmail, gotEmail)
+}
+
+func TestLogin_ByUsername(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	st.On("UserByIdentifier", mock.Anything, identifier.Identifier{Kind: identifier.Username, Value: "alice"}).
+		Return(models.User{}, storage.ErrUserNotFound)
+
+	_, err := newAuth(t, st).Login(context.Background(), "Alice", testPassword, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestLogin_LogsRequestID(t *testing.T) {
+	st := mocks.NewStorage(t)
+	st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(models.User{}, storage.ErrUserNotFound)
+
+	var buf bytes.Buffer
+	log := slog.New(logger.NewContextHandler(slog.NewTextHandler(&buf, nil)))
+	a := buildAuthWithLog(t, log, st, nil, nil, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{},
+		auth.EmailOTPOptions{}, auth.PhoneOptions{}, nil)
+
+	ctx := requestid.NewContext(context.Background(), "req-42")
+	_, err := a.Login(ctx, testEmail, testPassword, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+
+	require.Contains(t, buf.String(), `msg="user not found"`)
+	require.Contains(t, buf.String(), "request_id=req-42")
+}
+
+func TestLogin_FailCases(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		setup       func(st *mocks.Storage, user models.User)
+		expectedErr error
+	}{
+		{
+			name:     "user not found",
+			password: testPassword,
+			setup: func(st *mocks.Storage, _ models.User) {
+				st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(models.User{}, storage.ErrUserNotFound)
+			},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			name:     "wrong password",
+			password: "wrong-password",
+			setup: func(st *mocks.Storage, user models.User) {
+				st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(user, nil)
+			},
+			expectedErr: auth.ErrInvalidCredentials,
+		},
+		{
+			name:     "user is blocked",
+			password: testPassword,
+			setup: func(st *mocks.Storage, user models.User) {
+				user.Blocked = true
+				st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(user, nil)
+			},
+			expectedErr: auth.ErrUserBlocked,
+		},
+		{
+			name:     "app not found",
+			password: testPassword,
+			setup: func(st *mocks.Storage, user models.User) {
+				st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(user, nil)
+				st.On("App", mock.Anything, testApp.Code).Return(models.App{}, storage.ErrAppNotFound)
+			},
+			expectedErr: auth.ErrAppNotFound,
+		},
+		{
+			name:     "app is under maintenance",
+			password: testPassword,
+			setup: func(st *mocks.Storage, user models.User) {
+				st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(user, nil)
+				st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+				st.On("ActiveMaintenanceWindow", mock.Anything, testApp.ID, mock.Anything).
+					Return(models.MaintenanceWindow{EndsAt: time.Now().Add(time.Hour)}, nil)
+			},
+			expectedErr: auth.ErrAppMaintenance,
+		},
+		{
+			name:     "email domain is not allowed",
+			password: testPassword,
+			setup: func(st *mocks.Storage, user models.User) {
+				st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(user, nil)
+				st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+				st.On("ActiveMaintenanceWindow", mock.Anything, testApp.ID, mock.Anything).
+					Return(models.MaintenanceWindow{}, storage.ErrMaintenanceNotFound)
+				st.On("AppDomains", mock.Anything, testApp.ID).Return([]string{"corp.example.com"}, nil)
+			},
+			expectedErr: auth.ErrEmailDomainNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := mocks.NewStorage(t)
+			tt.setup(st, newUser(t))
+
+			_, err := newAuth(t, st).Login(context.Background(), testEmail, tt.password, testApp.Code)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestRegisterNewUser(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	st.On("SaveUser", mock.Anything, testEmail, mock.Anything, "").Return(int64(7), nil)
+
+	id, err := newAuth(t, st).RegisterNewUser(context.Background(), "USER@example.com", testPassword)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), id)
+
+	passHash := st.Calls[0].Arguments.Get(2).([]byte)
+	require.NoError(t, bcrypt.CompareHashAndPassword(passHash, []byte(testPassword)))
+}
+
+func TestRegisterNewUser_UserExists(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	st.On("SaveUser", mock.Anything, testEmail, mock.Anything, "").Return(int64(0), storage.ErrUserExists)
+
+	_, err := newAuth(t, st).RegisterNewUser(context.Background(), testEmail, testPassword)
+	require.ErrorIs(t, err, storage.ErrUserExists)
+}
+
+func TestRegisterNewUser_WeakPassword(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	a := newAuthWithPasswordOptions(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost, MinScore: 3})
+
+	_, err := a.RegisterNewUser(context.Background(), testEmail, "password1")
+	require.ErrorIs(t, err, auth.ErrWeakPassword)
+
+	var weakErr *auth.WeakPasswordError
+	require.ErrorAs(t, err, &weakErr)
+	require.NotEmpty(t, weakErr.Suggestions)
+}
+
+func TestBeginRecovery_Unavailable(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	_, err := newAuth(t, st).BeginRecovery(context.Background(), testEmail)
+	require.ErrorIs(t, err, auth.ErrRecoveryUnavailable)
+}
+
+func TestRegisterNewUser_UserExistsAntiEnumeration(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	st.On("SaveUser", mock.Anything, testEmail, mock.Anything, "").Return(int64(0), storage.ErrUserExists)
+
+	a := newAuthWithPasswordOptions(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost, AntiEnumeration: true})
+
+	id, err := a.RegisterNewUser(context.Background(), testEmail, testPassword)
+	require.NoError(t, err)
+	require.Zero(t, id)
+}
+
+func TestWhoami(t *testing.T) {
+	st := mocks.NewStorage(t)
+	user := newUser(t)
+	user.Username = "alice"
+
+	token, err := jwt.NewToken(user, testApp, jwt.Key{Secret: testApp.Secret}, time.Hour, map[string]any{
+		"roles": []string{"admin", "auditor"},
+		"scope": "read write",
+	})
+	require.NoError(t, err)
+
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil)
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+
+	identity, err := newAuth(t, st).Whoami(context.Background(), token, testApp.Code)
+	require.NoError(t, err)
+
+	require.Equal(t, user.ID, identity.UserID)
+	require.Equal(t, testEmail, identity.Email)
+	require.Equal(t, "alice", identity.Username)
+	require.Equal(t, []string{"admin", "auditor"}, identity.Roles)
+	require.Equal(t, []string{"read", "write"}, identity.Scopes)
+	require.WithinDuration(t, time.Now().Add(time.Hour), identity.ExpiresAt, time.Minute)
+}
+
+func TestExchangeToken(t *testing.T) {
+	billing := models.App{ID: 2, Code: "billing", Secret: "billing-secret"}
+	user := newUser(t)
+
+	token, err := jwt.NewToken(user, testApp, jwt.Key{Secret: testApp.Secret}, time.Hour, map[string]any{
+		"act": map[string]any{"sub": "mobile"},
+	})
+	require.NoError(t, err)
+
+	st := mocks.NewStorage(t)
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("App", mock.Anything, billing.Code).Return(billing, nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil)
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+	st.On("UserApp", mock.Anything, user.ID, billing.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: billing.ID, IsEnabled: true}, nil)
+	st.On("ActiveMaintenanceWindow", mock.Anything, billing.ID, mock.Anything).
+		Return(models.MaintenanceWindow{}, storage.ErrMaintenanceNotFound)
+	st.On("AppDomains", mock.Anything, billing.ID).Return(nil, nil)
+	st.On("ActiveSigningKey", mock.Anything, billing.ID).Return(models.SigningKey{}, storage.ErrSigningKeyNotFound)
+
+	a := buildAuth(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{
+		Delegations: map[string][]string{testApp.Code: {billing.Code}},
+	}, auth.EmailOTPOptions{}, auth.PhoneOptions{}, nil)
+
+	exchanged, err := a.ExchangeToken(context.Background(), token, testApp.Code, billing.Code)
+	require.NoError(t, err)
+
+	claims, err := jwt.Parse(exchanged, func(string) (string, error) { return billing.Secret, nil }, 0)
+	require.NoError(t, err)
+	require.Equal(t, user.ID, claims.UID)
+	require.Equal(t, billing.Code, claims.AppCode)
+	require.Equal(t, map[string]any{"sub": testApp.Code, "act": map[string]any{"sub": "mobile"}}, claims.Extra["act"])
+
+	// Обратный обмен не разрешён
+	_, err = a.ExchangeToken(context.Background(), exchanged, billing.Code, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrExchangeNotAllowed)
+}
+
+func TestExchangeToken_NoAccess(t *testing.T) {
+	billing := models.App{ID: 2, Code: "billing", Secret: "billing-secret"}
+	user := newUser(t)
+
+	token, err := jwt.NewToken(user, testApp, jwt.Key{Secret: testApp.Secret}, time.Hour, nil)
+	require.NoError(t, err)
+
+	st := mocks.NewStorage(t)
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("App", mock.Anything, billing.Code).Return(billing, nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil)
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+	st.On("UserApp", mock.Anything, user.ID, billing.ID).Return(models.UserApp{}, storage.ErrAppNotFound)
+	st.On("ActiveMaintenanceWindow", mock.Anything, billing.ID, mock.Anything).
+		Return(models.MaintenanceWindow{}, storage.ErrMaintenanceNotFound)
+	st.On("AppDomains", mock.Anything, billing.ID).Return(nil, nil)
+
+	a := buildAuth(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{
+		Delegations: map[string][]string{testApp.Code: {billing.Code}},
+	}, auth.EmailOTPOptions{}, auth.PhoneOptions{}, nil)
+
+	_, err = a.ExchangeToken(context.Background(), token, testApp.Code, billing.Code)
+	require.ErrorIs(t, err, auth.ErrUserAppNotEnabled)
+}
+
+// memoryCodes is an in-memory VerificationCodeStore.
+type memoryCodes map[string]models.VerificationCode
+
+func (m memoryCodes) SaveVerificationCode(_ context.Context, key string, code models.VerificationCode) error {
+	m[key] = code
+	return nil
+}
+
+func (m memoryCodes) VerificationCode(_ context.Context, key string) (models.VerificationCode, error) {
+	code, ok := m[key]
+	if !ok {
+		return models.VerificationCode{}, storage.ErrCodeNotFound
+	}
+	return code, nil
+}
+
+func (m memoryCodes) DeleteVerificationCode(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+// codeNotifier keeps the last sent one-time code and its recipient.
+type codeNotifier struct {
+	to   string
+	code string
+}
+
+func (n *codeNotifier) Notify(_ context.Context, _ notify.Event, _ string, to string, data any) error {
+	n.to = to
+	n.code = data.(notify.CodeData).Code
+	return nil
+}
+
+func TestEmailOTP(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	user := newUser(t)
+
+	st.On("User", mock.Anything, testEmail).Return(user, nil)
+
+	notifier := &codeNotifier{}
+	a := buildAuth(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{}, auth.EmailOTPOptions{
+		Codes:          memoryCodes{},
+		Notifier:       notifier,
+		CodeTTL:        5 * time.Minute,
+		ResendInterval: time.Minute,
+	}, auth.PhoneOptions{}, nil)
+
+	require.NoError(t, a.RequestEmailOTP(ctx, testEmail, testApp.Code))
+	require.Len(t, notifier.code, 6)
+
+	// Повторный запрос до истечения интервала отклоняется
+	require.ErrorIs(t, a.RequestEmailOTP(ctx, testEmail, testApp.Code), auth.ErrEmailOTPTooFrequent)
+
+	_, err := a.VerifyEmailOTP(ctx, testEmail, "wrong", testApp.Code)
+	require.ErrorIs(t, err, auth.ErrInvalidCode)
+
+	expectApp(st)
+	st.On("UpsertUserApp", mock.Anything, user.ID, testApp.ID, true).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+	st.On("ActiveSigningKey", mock.Anything, testApp.ID).Return(models.SigningKey{}, storage.ErrSigningKeyNotFound)
+	st.On("UserDevice", mock.Anything, user.ID, mock.Anything).Return(models.UserDevice{}, storage.ErrDeviceNotFound)
+	st.On("UserDeviceCount", mock.Anything, user.ID).Return(0, nil)
+	st.On("SaveUserDevice", mock.Anything, mock.Anything).Return(nil)
+
+	res, err := a.VerifyEmailOTP(ctx, testEmail, notifier.code, testApp.Code)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Token)
+
+	// Код одноразовый
+	_, err = a.VerifyEmailOTP(ctx, testEmail, notifier.code, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrInvalidCode)
+}
+
+func TestEmailOTP_UnknownUser(t *testing.T) {
+	st := mocks.NewStorage(t)
+
+	st.On("User", mock.Anything, testEmail).Return(models.User{}, storage.ErrUserNotFound)
+
+	notifier := &codeNotifier{}
+	a := buildAuth(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{}, auth.EmailOTPOptions{
+		Codes:    memoryCodes{},
+		Notifier: notifier,
+		CodeTTL:  5 * time.Minute,
+	}, auth.PhoneOptions{}, nil)
+
+	require.NoError(t, a.RequestEmailOTP(context.Background(), testEmail, testApp.Code))
+	require.Empty(t, notifier.code)
+}
+
+func TestPhoneOTP(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	user := newUser(t)
+	user.Phone = "+79990000000"
+
+	st.On("UserByIdentifier", mock.Anything, identifier.Identifier{Kind: identifier.Phone, Value: user.Phone}).
+		Return(user, nil)
+
+	texter := &codeNotifier{}
+	a := buildAuth(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{}, auth.EmailOTPOptions{}, auth.PhoneOptions{
+		Codes:          memoryCodes{},
+		Texter:         texter,
+		CodeTTL:        5 * time.Minute,
+		ResendInterval: time.Minute,
+	}, nil)
+
+	require.ErrorIs(t, a.RequestPhoneOTP(ctx, "not a phone", testApp.Code), auth.ErrInvalidPhone)
+
+	require.NoError(t, a.RequestPhoneOTP(ctx, "+7 (999) 000-00-00", testApp.Code))
+	require.Equal(t, user.Phone, texter.to)
+	require.Len(t, texter.code, 6)
+
+	require.ErrorIs(t, a.RequestPhoneOTP(ctx, user.Phone, testApp.Code), auth.ErrPhoneCodeTooFrequent)
+
+	expectApp(st)
+	st.On("UpsertUserApp", mock.Anything, user.ID, testApp.ID, true).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+	st.On("ActiveSigningKey", mock.Anything, testApp.ID).Return(models.SigningKey{}, storage.ErrSigningKeyNotFound)
+	st.On("UserDevice", mock.Anything, user.ID, mock.Anything).Return(models.UserDevice{}, storage.ErrDeviceNotFound)
+	st.On("UserDeviceCount", mock.Anything, user.ID).Return(0, nil)
+	st.On("SaveUserDevice", mock.Anything, mock.Anything).Return(nil)
+
+	res, err := a.VerifyPhoneOTP(ctx, user.Phone, texter.code, testApp.Code)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Token)
+}
+
+// fixedGeo locates every address at loc.
+type fixedGeo struct {
+	loc geoip.Location
+}
+
+func (g fixedGeo) Lookup(string) geoip.Location {
+	return g.loc
+}
+
+// loginHistory is an in-memory LoginHistoryProvider, newest login first.
+type loginHistory []models.Login
+
+func (h loginHistory) LoginHistory(_ context.Context, _ int64, limit int) ([]models.Login, error) {
+	return h[:min(limit, len(h))], nil
+}
+
+func (h loginHistory) LoginIPSeen(_ context.Context, _ int64, ip string) (bool, error) {
+	for _, login := range h {
+		if login.IP == ip {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// memoryFailures is an in-memory FailureCounter ignoring the window.
+type memoryFailures map[string]int64
+
+func (m memoryFailures) FailedAttempts(_ context.Context, key string) (int64, error) {
+	return m[key], nil
+}
+
+func (m memoryFailures) AddFailedAttempt(_ context.Context, key string, _ time.Duration) error {
+	m[key]++
+	return nil
+}
+
+func TestRiskScorer(t *testing.T) {
+	user := newUser(t)
+	weights := risk.Weights{FailedAttempt: 10, MaxFailedAttempts: 5, NewIP: 20, ImpossibleTravel: 70, Datacenter: 30}
+	// Вход из Москвы полчаса назад
+	history := loginHistory{{
+		IP:        "10.0.0.1",
+		Latitude:  55.75,
+		Longitude: 37.62,
+		CreatedAt: time.Now().Add(-30 * time.Minute),
+	}}
+	berlin := geoip.Location{Country: "DE", ASN: 64500, Latitude: 52.52, Longitude: 13.40}
+
+	tests := []struct {
+		name    string
+		ip      string
+		loc     geoip.Location
+		history loginHistory
+		want    int
+		signals []string
+	}{
+		{"known ip", "10.0.0.1", geoip.Location{Latitude: 55.75, Longitude: 37.62}, history, 0, nil},
+		{"first login", "10.0.0.2", berlin, nil, 0, nil},
+		{"new ip far away", "10.0.0.2", berlin, history, 90, []string{"new_ip", "impossible_travel"}},
+		{"datacenter", "10.0.0.1", geoip.Location{ASN: 16509}, history, 30, []string{"datacenter"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := auth.NewRiskScorer(slog.New(slog.NewTextHandler(io.Discard, nil)), fixedGeo{tt.loc}, tt.history, nil,
+				auth.RiskOptions{Weights: weights, MaxTravelSpeed: 1000})
+
+			ctx := reqctx.NewContext(context.Background(), reqctx.Info{IP: tt.ip})
+			score, signals, err := scorer.Score(ctx, user)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, score)
+			require.Equal(t, tt.signals, signals.Names())
+		})
+	}
+}
+
+func TestRiskScorer_FailedAttempts(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	user := newUser(t)
+
+	st.On("UserByIdentifier", mock.Anything, identifier.Identifier{Kind: identifier.Email, Value: testEmail}).
+		Return(user, nil)
+
+	failures := memoryFailures{}
+	scorer := auth.NewRiskScorer(slog.New(slog.NewTextHandler(io.Discard, nil)), fixedGeo{}, loginHistory{}, failures,
+		auth.RiskOptions{Weights: risk.Weights{FailedAttempt: 10, MaxFailedAttempts: 2}, FailureWindow: time.Hour})
+
+	a := buildAuth(t, st, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{}, auth.EmailOTPOptions{}, auth.PhoneOptions{}, scorer)
+
+	for range 3 {
+		_, err := a.Login(ctx, testEmail, "wrong-password", testApp.Code)
+		require.ErrorIs(t, err, auth.ErrInvalidCredentials)
+	}
+
+	// Учитывается не больше max_failed_attempts попыток
+	score, _, err := scorer.Score(ctx, user)
+	require.NoError(t, err)
+	require.Equal(t, 20, score)
+}
@@ -0,0 +1,57 @@
+package auth_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/jwt"
+	"sso/internal/services/admin"
+	adminmocks "sso/internal/services/admin/mocks"
+	"sso/internal/services/auth"
+	"sso/internal/services/auth/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockUser_CachedUser(t *testing.T) {
+	ctx := context.Background()
+	user := newUser(t)
+
+	token, err := jwt.NewToken(user, testApp, jwt.Key{Secret: testApp.Secret}, time.Hour, nil)
+	require.NoError(t, err)
+
+	st := mocks.NewStorage(t)
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+
+	a, invalidator := newCachedAuth(t, st)
+
+	// Проверка кладёт пользователя в кэш
+	_, err = a.ValidateToken(ctx, token, testApp.Code)
+	require.NoError(t, err)
+
+	adminSt := adminmocks.NewStorage(t)
+	adminSt.On("User", mock.Anything, testEmail).Return(user, nil)
+	adminSt.On("SetUserBlocked", mock.Anything, user.ID, true).Return(nil)
+
+	adm := admin.New(slog.New(slog.NewTextHandler(io.Discard, nil)), adminSt, email.Normalizer{}, nil, invalidator)
+	require.NoError(t, adm.BlockUser(ctx, testEmail))
+
+	blocked := user
+	blocked.Blocked = true
+	st.On("UserByID", mock.Anything, user.ID).Return(blocked, nil)
+	st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(blocked, nil)
+
+	_, err = a.ValidateToken(ctx, token, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrUserBlocked)
+
+	_, err = a.Login(ctx, testEmail, testPassword, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrUserBlocked)
+}
@@ -0,0 +1,383 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+var (
+	ErrChallengeRequired   = errors.New("additional login steps required")
+	ErrChallengeFailed     = errors.New("login step failed")
+	ErrInvalidLoginSession = errors.New("invalid login session")
+)
+
+// LoginStep is a step of the progressive login flow.
+type LoginStep string
+
+const (
+	StepPassword LoginStep = "password"
+	StepMFA      LoginStep = "mfa"
+	StepConsent  LoginStep = "consent"
+)
+
+// loginSessionIDBytes is the length of random login session ids.
+const loginSessionIDBytes = 32
+
+// loginStepMaxAttempts is the number of answers to a step after which the login session is discarded.
+const loginStepMaxAttempts = 5
+
+// ChallengeRequiredError is returned by Login when the app requires additional login steps.
+// The login continues with ContinueLogin and the session token. It matches ErrChallengeRequired.
+type ChallengeRequiredError struct {
+	SessionToken string
+	NextStep     LoginStep
+}
+
+func (e *ChallengeRequiredError) Error() string {
+	return fmt.Sprintf("%s: next step %s", ErrChallengeRequired, e.NextStep)
+}
+
+func (e *ChallengeRequiredError) Is(target error) bool {
+	return target == ErrChallengeRequired
+}
+
+// Challenge is an additional login step performed after the password check.
+type Challenge interface {
+	Step() LoginStep
+	// Required reports whether the user has to pass the step to log into the app.
+	Required(ctx context.Context, user models.User, app models.App) (bool, error)
+	// Verify checks the user's answer to the step of the login session.
+	Verify(ctx context.Context, sessionID string, user models.User, app models.App, answer string) error
+}
+
+// SecondFactor is implemented by challenges proving the identity of the user, e.g. with a one-time code.
+// A remembered device skips them, see LoginResult.DeviceToken.
+type SecondFactor interface {
+	SecondFactor()
+}
+
+// ChallengeStarter is implemented by challenges that have to prepare the step
+// when the login session reaches it, e.g. send a code to the user.
+type ChallengeStarter interface {
+	Start(ctx context.Context, sessionID string, user models.User, app models.App) error
+}
+
+type LoginSessionStore interface {
+	SaveLoginSession(ctx context.Context, session models.LoginSession) error
+	LoginSession(ctx context.Context, id string) (models.LoginSession, error)
+	DeleteLoginSession(ctx context.Context, id string) error
+	// TakeLoginSession returns the session and deletes it atomically, so it is used up only once.
+	TakeLoginSession(ctx context.Context, id string) (models.LoginSession, error)
+	// AddLoginStepAttempt counts an answer to the step and returns the number of answers so far.
+	AddLoginStepAttempt(ctx context.Context, id string, step string, expiresAt time.Time) (int64, error)
+}
+
+// LoginResult is the outcome of a login step: either a token when all steps are passed,
+// or a login session token to continue with the next step.
+type LoginResult struct {
+	Token        string
+	SessionToken string
+	NextStep     LoginStep
+	// DeviceToken is issued with Token when the user asked to remember the device.
+	// Sent back in x-device-token, it skips second factors until it expires or the device is revoked.
+	DeviceToken string
+	// TermsVersion is set with Token to the current version of the terms of service
+	// when the user has not accepted it yet, see AcceptTerms.
+	TermsVersion string
+}
+
+// BeginLogin performs the password step and either issues a token right away
+// or starts a login session when the app requires further steps.
+// The login is an email, a username or a phone number.
+func (a *Auth) BeginLogin(ctx context.Context, login string, password string, appCode string) (LoginResult, error) {
+	const op = "Auth.BeginLogin"
+
+	login = a.emails.Normalize(login)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("login", login),
+		slog.String("app_code", appCode),
+	)
+
+	log.InfoContext(ctx, "attempting to login user")
+
+	user, app, err := a.authenticate(ctx, login, password, appCode, log, op)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.recordLoginFailure(ctx, appCode, log)
+		}
+		return LoginResult{}, err
+	}
+
+	return a.beginSteps(ctx, user, app, log, op)
+}
+
+// beginSteps continues the login of the user who passed the first factor: issues a token right away
+// or starts a login session with the additional steps the app requires.
+func (a *Auth) beginSteps(ctx context.Context, user models.User, app models.App, log *slog.Logger, op string) (LoginResult, error) {
+	trusted := a.deviceTrusted(ctx, user, log)
+
+	// Определение дополнительных шагов входа
+	var pending []string
+	for _, ch := range a.challenges {
+		if _, ok := ch.(SecondFactor); ok && trusted {
+			continue
+		}
+
+		required, err := ch.Required(ctx, user, app)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to check login step", slog.String("step", string(ch.Step())), sl.Err(err))
+			return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if required {
+			pending = append(pending, string(ch.Step()))
+		}
+	}
+
+	if len(pending) == 0 {
+		token, err := a.issueToken(ctx, user, app, nil, log, op)
+		if err != nil {
+			return LoginResult{}, err
+		}
+
+		a.rememberDevice(ctx, user, app, log)
+		a.recordLogin(ctx, user, app, log)
+
+		log.InfoContext(ctx, "user logged is successfully")
+
+		return LoginResult{Token: token, TermsVersion: a.termsPending(ctx, user, log)}, nil
+	}
+
+	if a.loginSessions == nil {
+		log.ErrorContext(ctx, "login session store is not configured")
+		return LoginResult{}, fmt.Errorf("%s: login session store is not configured", op)
+	}
+
+	id, err := newLoginSessionID()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate login session id", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session := models.LoginSession{
+		ID:        id,
+		UserID:    user.ID,
+		Email:     user.Email,
+		AppCode:   app.Code,
+		Pending:   pending,
+		ExpiresAt: time.Now().Add(a.loginSessionTTL),
+	}
+
+	if err := a.loginSessions.SaveLoginSession(ctx, session); err != nil {
+		log.ErrorContext(ctx, "failed to save login session", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.startChallenge(ctx, session, user, app, log, op); err != nil {
+		return LoginResult{}, err
+	}
+
+	log.InfoContext(ctx, "login session started", slog.Any("pending", pending))
+
+	return LoginResult{SessionToken: id, NextStep: LoginStep(pending[0])}, nil
+}
+
+// ContinueLogin verifies the answer to the current step of the login session
+// and either issues a token or returns the next step. rememberDevice passed with the answer
+// to a second factor issues a device token with the token, see LoginResult.DeviceToken.
+func (a *Auth) ContinueLogin(ctx context.Context, sessionToken string, answer string, rememberDevice bool) (LoginResult, error) {
+	const op = "Auth.ContinueLogin"
+
+	log := a.log.With(slog.String("op", op))
+
+	if a.loginSessions == nil {
+		log.ErrorContext(ctx, "login session store is not configured")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+	}
+
+	session, err := a.loginSessions.LoginSession(ctx, sessionToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrLoginSessionNotFound) {
+			log.WarnContext(ctx, "login session not found")
+			return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+		}
+
+		log.ErrorContext(ctx, "failed to get login session", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(session.Pending) == 0 || time.Now().After(session.ExpiresAt) {
+		log.WarnContext(ctx, "login session is expired or complete")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+	}
+
+	log = log.With(
+		slog.String("email", session.Email),
+		slog.String("app_code", session.AppCode),
+		slog.String("step", session.Pending[0]),
+	)
+
+	// По ID, а не по email: за время сессии email могут сменить или отдать другому пользователю
+	user, err := getUserByID(ctx, a.userProvider, session.UserID, log, op)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+		}
+		return LoginResult{}, err
+	}
+
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	app, err := getApp(ctx, a.appProvider, session.AppCode, log, op)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if err := a.checkMaintenance(ctx, app, log, op); err != nil {
+		return LoginResult{}, err
+	}
+
+	challenge, ok := a.challenge(LoginStep(session.Pending[0]))
+	if !ok {
+		log.ErrorContext(ctx, "unknown login step")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+	}
+
+	// Ответ засчитывается до проверки, чтобы параллельные запросы не обходили лимит попыток
+	attempts, err := a.loginSessions.AddLoginStepAttempt(ctx, session.ID, session.Pending[0], session.ExpiresAt)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to count login step attempt", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if attempts > loginStepMaxAttempts {
+		log.WarnContext(ctx, "login step attempts exhausted")
+		a.discardLoginSession(ctx, session.ID, log)
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+	}
+
+	if err := challenge.Verify(ctx, session.ID, user, app, answer); err != nil {
+		log.WarnContext(ctx, "login step failed", sl.Err(err), slog.Int64("attempts", attempts))
+		a.recordLoginFailure(ctx, app.Code, log)
+		if attempts == loginStepMaxAttempts {
+			a.discardLoginSession(ctx, session.ID, log)
+		}
+		return LoginResult{}, fmt.Errorf("%s: %w: %w", op, ErrChallengeFailed, err)
+	}
+
+	if _, ok := challenge.(SecondFactor); ok && rememberDevice {
+		session.RememberDevice = true
+	}
+
+	session.Pending = session.Pending[1:]
+
+	if len(session.Pending) > 0 {
+		if err := a.loginSessions.SaveLoginSession(ctx, session); err != nil {
+			log.ErrorContext(ctx, "failed to save login session", sl.Err(err))
+			return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := a.startChallenge(ctx, session, user, app, log, op); err != nil {
+			return LoginResult{}, err
+		}
+
+		return LoginResult{SessionToken: session.ID, NextStep: LoginStep(session.Pending[0])}, nil
+	}
+
+	// Сессия одноразовая: из параллельных верных ответов токен получает только забравший её
+	if _, err := a.loginSessions.TakeLoginSession(ctx, session.ID); err != nil {
+		if errors.Is(err, storage.ErrLoginSessionNotFound) {
+			log.WarnContext(ctx, "login session is already used")
+			return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+		}
+
+		log.ErrorContext(ctx, "failed to take login session", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := a.issueToken(ctx, user, app, nil, log, op)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	a.rememberDevice(ctx, user, app, log)
+	a.recordLogin(ctx, user, app, log)
+
+	var deviceToken string
+	if session.RememberDevice {
+		deviceToken = a.trustDevice(ctx, user, log)
+	}
+
+	log.InfoContext(ctx, "user logged is successfully")
+
+	return LoginResult{
+		Token:        token,
+		DeviceToken:  deviceToken,
+		TermsVersion: a.termsPending(ctx, user, log),
+	}, nil
+}
+
+// startChallenge prepares the current step of the login session if the step requires it.
+func (a *Auth) startChallenge(
+	ctx context.Context,
+	session models.LoginSession,
+	user models.User,
+	app models.App,
+	log *slog.Logger,
+	op string,
+) error {
+	challenge, ok := a.challenge(LoginStep(session.Pending[0]))
+	if !ok {
+		return nil
+	}
+
+	starter, ok := challenge.(ChallengeStarter)
+	if !ok {
+		return nil
+	}
+
+	if err := starter.Start(ctx, session.ID, user, app); err != nil {
+		log.ErrorContext(ctx, "failed to start login step", slog.String("step", session.Pending[0]), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// discardLoginSession deletes the login session, the user has to log in again.
+func (a *Auth) discardLoginSession(ctx context.Context, id string, log *slog.Logger) {
+	if err := a.loginSessions.DeleteLoginSession(ctx, id); err != nil {
+		log.ErrorContext(ctx, "failed to delete login session", sl.Err(err))
+	}
+}
+
+func (a *Auth) challenge(step LoginStep) (Challenge, bool) {
+	for _, ch := range a.challenges {
+		if ch.Step() == step {
+			return ch, true
+		}
+	}
+
+	return nil, false
+}
+
+func newLoginSessionID() (string, error) {
+	b := make([]byte, loginSessionIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
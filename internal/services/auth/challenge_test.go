@@ -0,0 +1,211 @@
+package auth_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/services/auth"
+	"sso/internal/services/auth/mocks"
+	"sso/internal/storage"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memoryLoginSessions struct {
+	mu       sync.Mutex
+	sessions map[string]models.LoginSession
+	attempts map[string]int64
+}
+
+func newMemoryLoginSessions() *memoryLoginSessions {
+	return &memoryLoginSessions{
+		sessions: map[string]models.LoginSession{},
+		attempts: map[string]int64{},
+	}
+}
+
+func (m *memoryLoginSessions) SaveLoginSession(_ context.Context, session models.LoginSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *memoryLoginSessions) LoginSession(_ context.Context, id string) (models.LoginSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return models.LoginSession{}, storage.ErrLoginSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *memoryLoginSessions) DeleteLoginSession(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memoryLoginSessions) TakeLoginSession(_ context.Context, id string) (models.LoginSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return models.LoginSession{}, storage.ErrLoginSessionNotFound
+	}
+	delete(m.sessions, id)
+	return session, nil
+}
+
+func (m *memoryLoginSessions) AddLoginStepAttempt(_ context.Context, id string, step string, _ time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts[id+":"+step]++
+	return m.attempts[id+":"+step], nil
+}
+
+// answerChallenge is a login step passed with a fixed answer.
+type answerChallenge struct {
+	answer string
+}
+
+func (c answerChallenge) Step() auth.LoginStep { return auth.StepMFA }
+
+func (c answerChallenge) Required(context.Context, models.User, models.App) (bool, error) {
+	return true, nil
+}
+
+func (c answerChallenge) Verify(_ context.Context, _ string, _ models.User, _ models.App, answer string) error {
+	if answer != c.answer {
+		return auth.ErrInvalidCode
+	}
+	return nil
+}
+
+// beginChallengeLogin logs the user in to an app with the mfa step and returns the session token.
+func beginChallengeLogin(t *testing.T, st *mocks.Storage, sessions *memoryLoginSessions) (*auth.Auth, string) {
+	t.Helper()
+
+	user := newUser(t)
+	st.On("UserByIdentifier", mock.Anything, mock.Anything).Return(user, nil)
+	expectApp(st)
+	st.On("UpsertUserApp", mock.Anything, user.ID, testApp.ID, true).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+
+	a := buildAuthWithLog(t, slog.New(slog.NewTextHandler(io.Discard, nil)), st, sessions,
+		[]auth.Challenge{answerChallenge{answer: "42"}}, auth.PasswordOptions{Cost: bcrypt.MinCost}, auth.TokenOptions{},
+		auth.EmailOTPOptions{}, auth.PhoneOptions{}, nil)
+
+	_, err := a.Login(context.Background(), testEmail, testPassword, testApp.Code)
+
+	var challengeErr *auth.ChallengeRequiredError
+	require.ErrorAs(t, err, &challengeErr)
+	require.ErrorIs(t, err, auth.ErrChallengeRequired)
+	require.Equal(t, auth.StepMFA, challengeErr.NextStep)
+	require.NotEmpty(t, challengeErr.SessionToken)
+
+	return a, challengeErr.SessionToken
+}
+
+func TestContinueLogin_AttemptsExhausted(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	sessions := newMemoryLoginSessions()
+
+	a, session := beginChallengeLogin(t, st, sessions)
+	st.On("UserByID", mock.Anything, newUser(t).ID).Return(newUser(t), nil)
+
+	for range 5 {
+		_, err := a.ContinueLogin(ctx, session, "wrong", false)
+		require.ErrorIs(t, err, auth.ErrChallengeFailed)
+	}
+
+	// После пятой ошибки сессия удалена, верный ответ уже не принимается
+	_, err := a.ContinueLogin(ctx, session, "42", false)
+	require.ErrorIs(t, err, auth.ErrInvalidLoginSession)
+}
+
+func TestContinueLogin_UsedOnce(t *testing.T) {
+	ctx := context.Background()
+	st := mocks.NewStorage(t)
+	sessions := newMemoryLoginSessions()
+
+	a, session := beginChallengeLogin(t, st, sessions)
+
+	st.On("UserByID", mock.Anything, newUser(t).ID).Return(newUser(t), nil)
+	st.On("ActiveSigningKey", mock.Anything, testApp.ID).Return(models.SigningKey{}, storage.ErrSigningKeyNotFound)
+	st.On("UserDevice", mock.Anything, mock.Anything, mock.Anything).Return(models.UserDevice{}, storage.ErrDeviceNotFound).Maybe()
+	st.On("UserDeviceCount", mock.Anything, mock.Anything).Return(0, nil).Maybe()
+	st.On("SaveUserDevice", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	const callers = 4
+
+	var wg sync.WaitGroup
+	tokens := make(chan string, callers)
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := a.ContinueLogin(ctx, session, "42", false)
+			if err != nil {
+				errs <- err
+				return
+			}
+			tokens <- res.Token
+		}()
+	}
+	wg.Wait()
+	close(tokens)
+	close(errs)
+
+	// Из параллельных верных ответов токен получает только один
+	require.Len(t, tokens, 1)
+	for err := range errs {
+		require.ErrorIs(t, err, auth.ErrInvalidLoginSession)
+	}
+}
+
+func TestContinueLogin_EmailChanged(t *testing.T) {
+	st := mocks.NewStorage(t)
+	sessions := newMemoryLoginSessions()
+
+	a, session := beginChallengeLogin(t, st, sessions)
+
+	// Пользователь ищется по ID из сессии, поиск по старому email упал бы на моке
+	user := newUser(t)
+	user.Email = "renamed@example.com"
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil)
+	st.On("ActiveSigningKey", mock.Anything, testApp.ID).Return(models.SigningKey{}, storage.ErrSigningKeyNotFound)
+	st.On("UserDevice", mock.Anything, mock.Anything, mock.Anything).Return(models.UserDevice{}, storage.ErrDeviceNotFound).Maybe()
+	st.On("UserDeviceCount", mock.Anything, mock.Anything).Return(0, nil).Maybe()
+	st.On("SaveUserDevice", mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	res, err := a.ContinueLogin(context.Background(), session, "42", false)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Token)
+}
+
+func TestContinueLogin_UserDeleted(t *testing.T) {
+	st := mocks.NewStorage(t)
+	sessions := newMemoryLoginSessions()
+
+	a, session := beginChallengeLogin(t, st, sessions)
+	st.On("UserByID", mock.Anything, newUser(t).ID).Return(models.User{}, storage.ErrUserNotFound)
+
+	_, err := a.ContinueLogin(context.Background(), session, "42", false)
+	require.ErrorIs(t, err, auth.ErrInvalidLoginSession)
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/notify"
+	"sso/internal/storage"
+	"time"
+)
+
+var ErrInvalidCode = errors.New("invalid verification code")
+
+// codeMaxAttempts is the number of wrong answers after which a code is discarded.
+const codeMaxAttempts = 5
+
+type VerificationCodeStore interface {
+	SaveVerificationCode(ctx context.Context, key string, code models.VerificationCode) error
+	VerificationCode(ctx context.Context, key string) (models.VerificationCode, error)
+	DeleteVerificationCode(ctx context.Context, key string) error
+}
+
+// oneTimeCode sends one-time codes of a login step through the notifier, by email or SMS,
+// and checks the answers.
+type oneTimeCode struct {
+	log      *slog.Logger
+	step     LoginStep
+	event    notify.Event
+	codes    VerificationCodeStore
+	notifier Notifier
+	codeTTL  time.Duration
+}
+
+// start sends a new code of the login session to the email or phone number, data is completed with the code.
+func (c oneTimeCode) start(ctx context.Context, sessionID string, to string, data notify.CodeData) error {
+	const op = "oneTimeCode.start"
+
+	log := c.log.With(
+		slog.String("op", op),
+		slog.String("step", string(c.step)),
+		slog.String("to", to),
+	)
+
+	code, err := newVerificationCode()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate verification code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash := sha256.Sum256([]byte(code))
+	err = c.codes.SaveVerificationCode(ctx, c.key(sessionID), models.VerificationCode{
+		Hash:      hash[:],
+		ExpiresAt: time.Now().Add(c.codeTTL),
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save verification code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	data.Code = code
+	data.TTLMinutes = int(c.codeTTL.Minutes())
+
+	if err := c.notifier.Notify(ctx, c.event, "", to, data); err != nil {
+		log.ErrorContext(ctx, "failed to send verification code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// verify checks the answer against the code of the login session.
+func (c oneTimeCode) verify(ctx context.Context, sessionID string, answer string) error {
+	const op = "oneTimeCode.verify"
+
+	key := c.key(sessionID)
+
+	stored, err := c.codes.VerificationCode(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash := sha256.Sum256([]byte(answer))
+	if subtle.ConstantTimeCompare(hash[:], stored.Hash) == 1 {
+		if err := c.codes.DeleteVerificationCode(ctx, key); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	// Код сбрасывается после исчерпания попыток, чтобы исключить перебор
+	stored.Attempts++
+	if stored.Attempts >= codeMaxAttempts {
+		err = c.codes.DeleteVerificationCode(ctx, key)
+	} else {
+		err = c.codes.SaveVerificationCode(ctx, key, stored)
+	}
+	if err != nil && !errors.Is(err, storage.ErrCodeNotFound) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+}
+
+// sentWithin reports whether a code of the login session was sent less than interval ago.
+func (c oneTimeCode) sentWithin(ctx context.Context, sessionID string, interval time.Duration) (bool, error) {
+	stored, err := c.codes.VerificationCode(ctx, c.key(sessionID))
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return time.Until(stored.ExpiresAt) > c.codeTTL-interval, nil
+}
+
+func (c oneTimeCode) key(sessionID string) string {
+	return string(c.step) + ":" + sessionID
+}
+
+// newVerificationCode returns a random 6-digit code.
+func newVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
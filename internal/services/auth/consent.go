@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+// ConsentAccept is the answer to the consent step granting the consent.
+const ConsentAccept = "accept"
+
+var (
+	ErrConsentDeclined = errors.New("consent declined")
+	ErrConsentNotFound = errors.New("consent not found")
+)
+
+// ConsentStorage keeps the consents of users to third-party apps.
+type ConsentStorage interface {
+	SaveConsent(ctx context.Context, consent models.Consent) error
+	Consent(ctx context.Context, userID int64, appID int32) (models.Consent, error)
+	DeleteConsent(ctx context.Context, userID int64, appID int32) error
+}
+
+// ConsentChallenge is a login step asking the user to consent to sharing their identity
+// with a third-party app. It is required until the user accepts the current consent version of the app.
+type ConsentChallenge struct {
+	log      *slog.Logger
+	consents ConsentStorage
+}
+
+func NewConsentChallenge(log *slog.Logger, consents ConsentStorage) *ConsentChallenge {
+	return &ConsentChallenge{
+		log:      log,
+		consents: consents,
+	}
+}
+
+func (c *ConsentChallenge) Step() LoginStep {
+	return StepConsent
+}
+
+// Required reports whether the app is third-party and the user has not consented to its current version.
+func (c *ConsentChallenge) Required(ctx context.Context, user models.User, app models.App) (bool, error) {
+	const op = "ConsentChallenge.Required"
+
+	if !app.ThirdParty {
+		return false, nil
+	}
+
+	consent, err := c.consents.Consent(ctx, user.ID, app.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			return true, nil
+		}
+
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consent.Version < app.ConsentVersion, nil
+}
+
+// Verify records the consent if the answer is ConsentAccept.
+func (c *ConsentChallenge) Verify(ctx context.Context, _ string, user models.User, app models.App, answer string) error {
+	const op = "ConsentChallenge.Verify"
+
+	log := c.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+		slog.String("app_code", app.Code),
+	)
+
+	if answer != ConsentAccept {
+		log.InfoContext(ctx, "consent declined")
+		return fmt.Errorf("%s: %w", op, ErrConsentDeclined)
+	}
+
+	err := c.consents.SaveConsent(ctx, models.Consent{
+		UserID:    user.ID,
+		AppID:     app.ID,
+		Version:   app.ConsentVersion,
+		GrantedAt: time.Now(),
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save consent", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "consent granted", slog.Int("version", app.ConsentVersion))
+
+	return nil
+}
+
+// RevokeConsent revokes the consent of the token's user to the third-party app consentAppCode,
+// the next login into it asks for consent again. Tokens already issued to the app stay valid until they expire.
+func (a *Auth) RevokeConsent(ctx context.Context, token string, appCode string, consentAppCode string) error {
+	const op = "Auth.RevokeConsent"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.String("consent_app_code", consentAppCode),
+	)
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	app, err := getApp(ctx, a.appProvider, consentAppCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.consents.DeleteConsent(ctx, user.ID, app.ID); err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			log.WarnContext(ctx, "consent not found")
+			return fmt.Errorf("%s: %w", op, ErrConsentNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to delete consent", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "consent revoked", slog.Int64("user_id", user.ID))
+
+	return nil
+}
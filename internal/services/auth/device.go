@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/reqctx"
+	"sso/internal/notify"
+	"sso/internal/storage"
+	"time"
+)
+
+const StepNewDevice LoginStep = "new_device"
+
+// notifyTimeout bounds background delivery of login notifications.
+const notifyTimeout = 30 * time.Second
+
+type DeviceStorage interface {
+	UserDevice(ctx context.Context, userID int64, fingerprint string) (models.UserDevice, error)
+	SaveUserDevice(ctx context.Context, device models.UserDevice) error
+	UserDeviceCount(ctx context.Context, userID int64) (int, error)
+	UserDevices(ctx context.Context, userID int64) ([]models.UserDevice, error)
+	DeleteUserDevice(ctx context.Context, userID int64, deviceID int64) error
+	TrustUserDevice(ctx context.Context, userID int64, fingerprint string, tokenHash []byte, until time.Time) error
+	TrustedUserDevice(ctx context.Context, tokenHash []byte) (models.UserDevice, error)
+}
+
+// Notifier delivers notification events to users.
+type Notifier interface {
+	Notify(ctx context.Context, event notify.Event, locale string, to string, data any) error
+}
+
+// rememberDevice records the device of a completed login and notifies the user
+// when it is a device not seen before. Failures are logged and do not fail the login.
+func (a *Auth) rememberDevice(ctx context.Context, user models.User, app models.App, log *slog.Logger) {
+	if a.devices == nil {
+		return
+	}
+
+	info := reqctx.FromContext(ctx).Device()
+	fingerprint := info.Fingerprint()
+
+	known := true
+	_, err := a.devices.UserDevice(ctx, user.ID, fingerprint)
+	if err != nil {
+		if !errors.Is(err, storage.ErrDeviceNotFound) {
+			log.ErrorContext(ctx, "failed to get user device", sl.Err(err))
+			return
+		}
+		known = false
+	}
+
+	// Первое устройство пользователя новым не считается
+	first := false
+	if !known {
+		count, err := a.devices.UserDeviceCount(ctx, user.ID)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to count user devices", sl.Err(err))
+			return
+		}
+		first = count == 0
+	}
+
+	now := time.Now()
+	err = a.devices.SaveUserDevice(ctx, models.UserDevice{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   info.UserAgent,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save user device", sl.Err(err))
+		return
+	}
+
+	if known || first {
+		return
+	}
+
+	log.InfoContext(ctx, "login from new device", slog.String("user_agent", info.UserAgent), slog.String("ip", info.IP))
+
+	if a.notifier == nil {
+		return
+	}
+
+	data := notify.NewDeviceData{
+		AppCode:   app.Code,
+		UserAgent: info.UserAgent,
+		IP:        info.IP,
+		Time:      now,
+	}
+
+	// Уведомление отправляется в фоне, чтобы не задерживать ответ
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+		defer cancel()
+
+		if err := a.notifier.Notify(ctx, notify.EventNewDevice, "", user.Email, data); err != nil {
+			log.ErrorContext(ctx, "failed to send new device notification", sl.Err(err))
+		}
+	}()
+}
+
+// NewDeviceChallenge is a login step requiring a one-time code sent by email
+// when the user logs in from a device not seen before.
+type NewDeviceChallenge struct {
+	devices DeviceStorage
+	code    oneTimeCode
+}
+
+func NewNewDeviceChallenge(
+	log *slog.Logger,
+	devices DeviceStorage,
+	codes VerificationCodeStore,
+	notifier Notifier,
+	codeTTL time.Duration,
+) *NewDeviceChallenge {
+	return &NewDeviceChallenge{
+		devices: devices,
+		code: oneTimeCode{
+			log:      log,
+			step:     StepNewDevice,
+			event:    notify.EventNewDeviceCode,
+			codes:    codes,
+			notifier: notifier,
+			codeTTL:  codeTTL,
+		},
+	}
+}
+
+func (c *NewDeviceChallenge) Step() LoginStep {
+	return StepNewDevice
+}
+
+func (c *NewDeviceChallenge) SecondFactor() {}
+
+func (c *NewDeviceChallenge) Required(ctx context.Context, user models.User, _ models.App) (bool, error) {
+	const op = "NewDeviceChallenge.Required"
+
+	_, err := c.devices.UserDevice(ctx, user.ID, reqctx.FromContext(ctx).Device().Fingerprint())
+	if err == nil {
+		return false, nil
+	}
+
+	if !errors.Is(err, storage.ErrDeviceNotFound) {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Подтверждение не требуется при самом первом входе пользователя
+	count, err := c.devices.UserDeviceCount(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count > 0, nil
+}
+
+// Start sends a new verification code to the user's email.
+func (c *NewDeviceChallenge) Start(ctx context.Context, sessionID string, user models.User, app models.App) error {
+	return c.code.start(ctx, sessionID, user.Email, notify.CodeData{AppCode: app.Code})
+}
+
+func (c *NewDeviceChallenge) Verify(ctx context.Context, sessionID string, _ models.User, _ models.App, answer string) error {
+	return c.code.verify(ctx, sessionID, answer)
+}
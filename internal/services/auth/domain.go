@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/logger/sl"
+)
+
+var ErrEmailDomainNotAllowed = errors.New("email domain is not allowed in the app")
+
+type AppDomainProvider interface {
+	AppDomains(ctx context.Context, appID int32) ([]string, error)
+}
+
+// checkAppDomain rejects users whose email domain is not in the app's allowed list.
+func (a *Auth) checkAppDomain(ctx context.Context, user models.User, app models.App, log *slog.Logger, op string) error {
+	if a.appDomains == nil {
+		return nil
+	}
+
+	domains, err := a.appDomains.AppDomains(ctx, app.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get app domains", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !email.DomainAllowed(user.Email, domains) {
+		log.WarnContext(ctx, "email domain is not allowed in the app")
+		return fmt.Errorf("%s: %w", op, ErrEmailDomainNotAllowed)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+)
+
+// dummyPassword is hashed once to compare passwords of unknown users against.
+const dummyPassword = "sso-dummy-password"
+
+// dummyCompare spends the time of a password check on a login of an unknown user,
+// so that it can't be told apart from a wrong password by the response time.
+// The dummy hash has the configured cost, so the compare takes as long as a real one.
+func (a *Auth) dummyCompare(ctx context.Context, password string, log *slog.Logger) {
+	a.dummyOnce.Do(func() {
+		hash, err := a.hasher.Hash(ctx, []byte(dummyPassword), a.passOpts.Cost)
+		if err != nil {
+			log.WarnContext(ctx, "failed to generate dummy password hash", sl.Err(err))
+			return
+		}
+		a.dummyHash = hash
+	})
+
+	if a.dummyHash == nil {
+		return
+	}
+
+	// Результат не важен: сравнение нужно только ради времени
+	_ = a.hasher.Compare(ctx, a.dummyHash, []byte(password))
+}
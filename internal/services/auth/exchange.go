@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/policy"
+)
+
+// actClaim names the party acting on behalf of the user, as in RFC 8693.
+const actClaim = "act"
+
+var ErrExchangeNotAllowed = errors.New("token exchange is not allowed between the apps")
+
+// ExchangeToken exchanges a valid token of the app for a token of the target app, in the spirit
+// of RFC 8693 token exchange. The app must be allowed to delegate to the target app by
+// TokenOptions.Delegations and the user must have access to the target app: unlike a login,
+// the exchange doesn't grant it. The new token carries the act claim naming the app, nested
+// with the act claim of the exchanged token if it has one.
+func (a *Auth) ExchangeToken(ctx context.Context, token string, appCode string, targetAppCode string) (string, error) {
+	const op = "Auth.ExchangeToken"
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.String("target_app_code", targetAppCode),
+	)
+
+	// Без разрешения токен даже не проверяется
+	if !slices.Contains(a.tokenOpts.Delegations[appCode], targetAppCode) {
+		log.WarnContext(ctx, "token exchange is not allowed")
+		return "", fmt.Errorf("%s: %w", op, ErrExchangeNotAllowed)
+	}
+
+	user, app, claims, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	extra, err := a.extraClaims(ctx, app, claims, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := getApp(ctx, a.appProvider, targetAppCode, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	// Проверки те же, что при входе в целевое приложение
+	if err := a.checkMaintenance(ctx, target, log, op); err != nil {
+		return "", err
+	}
+
+	if err := a.checkAppDomain(ctx, user, target, log, op); err != nil {
+		return "", err
+	}
+
+	if err := a.checkPolicy(ctx, user, target, policy.ActionLogin, log, op); err != nil {
+		return "", err
+	}
+
+	if err := isAccessAllowed(ctx, a.userAppProvider, user.ID, target.ID, log, op); err != nil {
+		return "", err
+	}
+
+	// Согласие на передачу данных стороннему приложению даётся только при входе в него
+	consentRequired, err := NewConsentChallenge(a.log, a.consents).Required(ctx, user, target)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to check consent", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if consentRequired {
+		log.WarnContext(ctx, "consent to the target app is required")
+		return "", fmt.Errorf("%s: %w", op, ErrChallengeRequired)
+	}
+
+	act := map[string]any{"sub": app.Code}
+	if prev, ok := extra[actClaim]; ok {
+		act[actClaim] = prev
+	}
+
+	exchanged, err := a.issueToken(ctx, user, target, map[string]any{actClaim: act}, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	log.InfoContext(ctx, "token exchanged", slog.Int64("user_id", user.ID))
+
+	return exchanged, nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/lib/geoip"
+	"sso/internal/lib/reqctx"
+	"sso/internal/notify"
+	"time"
+)
+
+const StepNewCountry LoginStep = "new_country"
+
+// GeoLocator resolves the country and the autonomous system of an IP address.
+type GeoLocator interface {
+	Lookup(ip string) geoip.Location
+}
+
+// LoginCountryProvider returns the countries a user has logged in from.
+type LoginCountryProvider interface {
+	LoginCountries(ctx context.Context, userID int64) ([]string, error)
+}
+
+// locate returns the location of the IP address, the zero Location without a locator.
+func (a *Auth) locate(ip string) geoip.Location {
+	if a.geo == nil {
+		return geoip.Location{}
+	}
+
+	return a.geo.Lookup(ip)
+}
+
+// isNewCountry reports whether country is not among the countries of past logins.
+// The first login with a known country is not new: there is nothing to compare it with.
+func isNewCountry(countries []string, country string) bool {
+	return len(countries) > 0 && !slices.Contains(countries, country)
+}
+
+// NewCountryChallenge is a login step requiring a one-time code sent by email
+// when the user logs in from a country not seen in the login history.
+type NewCountryChallenge struct {
+	geo    GeoLocator
+	logins LoginCountryProvider
+	code   oneTimeCode
+}
+
+func NewNewCountryChallenge(
+	log *slog.Logger,
+	geo GeoLocator,
+	logins LoginCountryProvider,
+	codes VerificationCodeStore,
+	notifier Notifier,
+	codeTTL time.Duration,
+) *NewCountryChallenge {
+	return &NewCountryChallenge{
+		geo:    geo,
+		logins: logins,
+		code: oneTimeCode{
+			log:      log,
+			step:     StepNewCountry,
+			event:    notify.EventNewCountryCode,
+			codes:    codes,
+			notifier: notifier,
+			codeTTL:  codeTTL,
+		},
+	}
+}
+
+func (c *NewCountryChallenge) Step() LoginStep {
+	return StepNewCountry
+}
+
+func (c *NewCountryChallenge) SecondFactor() {}
+
+// Required reports whether the country of the caller is new to the user.
+// Addresses without a known country never require the step.
+func (c *NewCountryChallenge) Required(ctx context.Context, user models.User, _ models.App) (bool, error) {
+	const op = "NewCountryChallenge.Required"
+
+	country := c.geo.Lookup(reqctx.FromContext(ctx).IP).Country
+	if country == "" {
+		return false, nil
+	}
+
+	countries, err := c.logins.LoginCountries(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return isNewCountry(countries, country), nil
+}
+
+// Start sends a new verification code to the user's email.
+func (c *NewCountryChallenge) Start(ctx context.Context, sessionID string, user models.User, app models.App) error {
+	return c.code.start(ctx, sessionID, user.Email, notify.CodeData{
+		AppCode: app.Code,
+		Country: c.geo.Lookup(reqctx.FromContext(ctx).IP).Country,
+	})
+}
+
+func (c *NewCountryChallenge) Verify(ctx context.Context, sessionID string, _ models.User, _ models.App, answer string) error {
+	return c.code.verify(ctx, sessionID, answer)
+}
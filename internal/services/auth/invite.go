@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/invite"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+var ErrInvalidInvite = errors.New("invite is invalid, used or expired")
+
+type InviteProvider interface {
+	Invite(ctx context.Context, tokenHash string) (models.Invite, error)
+	ConsumeInvite(ctx context.Context, inviteID int64, passHash []byte, pepperID string, at time.Time) (int64, error)
+}
+
+// RegisterWithInvite registers the user invited by the token and grants access to the apps of the invite.
+// The email must be the one the invite was created for; the invite can be used once.
+func (a *Auth) RegisterWithInvite(ctx context.Context, token string, email string, password string) (int64, error) {
+	const op = "Auth.RegisterWithInvite"
+
+	email = a.emails.Normalize(email)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+	log.InfoContext(ctx, "registering invited user")
+
+	inv, err := a.invites.Invite(ctx, invite.Hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrInviteNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvite)
+		}
+
+		log.ErrorContext(ctx, "failed to get invite", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Приглашение на другой email не раскрывается: ответ тот же, что для неизвестного токена
+	if inv.Email != email || !inv.UsedAt.IsZero() || !time.Now().Before(inv.ExpiresAt) {
+		log.WarnContext(ctx, "invite does not match or is no longer valid", slog.Int64("invite_id", inv.ID))
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvite)
+	}
+
+	if err := a.checkPasswordStrength(ctx, password, email, log); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, pepperID, err := a.hashPassword(ctx, password)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate password hash", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := a.invites.ConsumeInvite(ctx, inv.ID, passHash, pepperID, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrInviteNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvite)
+		}
+
+		log.ErrorContext(ctx, "failed to consume invite", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "invited user registered", slog.Int64("user_id", id), slog.Int("apps", len(inv.AppIDs)))
+
+	return id, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+var ErrUnknownSigningKey = errors.New("unknown or expired signing key")
+
+// SigningKeyProvider is the key ring of app signing keys.
+type SigningKeyProvider interface {
+	// ActiveSigningKey returns the newest not retired key of the app.
+	ActiveSigningKey(ctx context.Context, appID int32) (models.SigningKey, error)
+	SigningKey(ctx context.Context, kid string) (models.SigningKey, error)
+}
+
+// signingKey returns the key new tokens of the app are signed with:
+// the active key of the ring or, for apps without keys, the app secret.
+func (a *Auth) signingKey(ctx context.Context, app models.App, log *slog.Logger, op string) (jwt.Key, error) {
+	if a.signingKeys == nil {
+		return jwt.Key{Secret: app.Secret}, nil
+	}
+
+	key, err := a.signingKeys.ActiveSigningKey(ctx, app.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSigningKeyNotFound) {
+			return jwt.Key{Secret: app.Secret}, nil
+		}
+
+		log.ErrorContext(ctx, "failed to get signing key", sl.Err(err))
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jwt.Key{ID: key.ID, Secret: key.Secret}, nil
+}
+
+// verificationKeys resolves the secret of a token of the app by its kid. Tokens without kid
+// are checked with the app secret, retired keys are accepted until they expire.
+func (a *Auth) verificationKeys(ctx context.Context, app models.App) jwt.KeyFunc {
+	return func(kid string) (string, error) {
+		if kid == "" {
+			return app.Secret, nil
+		}
+
+		if a.signingKeys == nil {
+			return "", ErrUnknownSigningKey
+		}
+
+		key, err := a.signingKeys.SigningKey(ctx, kid)
+		if err != nil {
+			if errors.Is(err, storage.ErrSigningKeyNotFound) {
+				return "", ErrUnknownSigningKey
+			}
+			return "", err
+		}
+
+		if key.AppID != app.ID || (!key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt)) {
+			return "", ErrUnknownSigningKey
+		}
+
+		return key.Secret, nil
+	}
+}
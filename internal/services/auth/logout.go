@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+// ErrTokenNotRevocable is returned by Logout for tokens issued before jti was added:
+// they can't be revoked one by one and stay valid until they expire.
+var ErrTokenNotRevocable = errors.New("token can't be revoked")
+
+type TokenRevoker interface {
+	RevokeUserTokens(ctx context.Context, userID int64) error
+}
+
+// RevokedTokenStore keeps the jti of JWTs revoked on logout until they expire.
+type RevokedTokenStore interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	TokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// LogoutAll revokes every token and session of the token's user in all apps by bumping
+// the user's token version. The token itself is revoked too.
+func (a *Auth) LogoutAll(ctx context.Context, token string, appCode string) error {
+	const op = "Auth.LogoutAll"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+	log.InfoContext(ctx, "logging out user everywhere")
+
+	// Получение App
+	app, err := getApp(ctx, a.appProvider, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	// Валидация токена
+	claims, err := a.parseToken(ctx, token, app, log, op)
+	if err != nil {
+		return err
+	}
+
+	user, err := getUserByID(ctx, a.userProvider, claims.UID, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := checkTokenUser(ctx, user, claims, log, op); err != nil {
+		return err
+	}
+
+	if err := a.tokenRevoker.RevokeUserTokens(ctx, user.ID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		log.ErrorContext(ctx, "failed to revoke tokens", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Иначе реплики проверяют токены по закэшированной старой версии до конца TTL
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	log.InfoContext(ctx, "user logged out everywhere", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+// revokeToken revokes a single token: deletes the session of an opaque token or adds the jti
+// of a JWT to the revoked list. The jti is kept past exp by the leeway the token is accepted with.
+func (a *Auth) revokeToken(ctx context.Context, token string, claims jwt.Claims, log *slog.Logger, op string) error {
+	if !isJWT(token) {
+		if err := a.sessions.DeleteSession(ctx, sessionID(token)); err != nil {
+			log.ErrorContext(ctx, "failed to delete session", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		return nil
+	}
+
+	if claims.ID == "" {
+		log.WarnContext(ctx, "token has no jti")
+		return fmt.Errorf("%s: %w", op, ErrTokenNotRevocable)
+	}
+
+	if err := a.revokedTokens.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Add(a.tokenOpts.Leeway)); err != nil {
+		log.ErrorContext(ctx, "failed to revoke token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// checkTokenRevoked rejects JWTs revoked on logout.
+func (a *Auth) checkTokenRevoked(ctx context.Context, claims jwt.Claims, log *slog.Logger, op string) error {
+	if claims.ID == "" || a.revokedTokens == nil {
+		return nil
+	}
+
+	revoked, err := a.revokedTokens.TokenRevoked(ctx, claims.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to check token revocation", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if revoked {
+		log.WarnContext(ctx, "token revoked on logout")
+		return fmt.Errorf("%s: %w", op, ErrTokenRevoked)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"context"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/services/auth"
+	"sso/internal/services/auth/mocks"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogoutAll_CachedUser(t *testing.T) {
+	ctx := context.Background()
+	user := newUser(t)
+
+	token, err := jwt.NewToken(user, testApp, jwt.Key{Secret: testApp.Secret}, time.Hour, nil)
+	require.NoError(t, err)
+
+	st := mocks.NewStorage(t)
+	st.On("App", mock.Anything, testApp.Code).Return(testApp, nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	st.On("UserApp", mock.Anything, user.ID, testApp.ID).
+		Return(models.UserApp{UserID: user.ID, AppID: testApp.ID, IsEnabled: true}, nil)
+
+	a, _ := newCachedAuth(t, st)
+
+	// Проверка кладёт пользователя в кэш
+	_, err = a.ValidateToken(ctx, token, testApp.Code)
+	require.NoError(t, err)
+
+	revoked := user
+	revoked.TokenVersion++
+	st.On("RevokeUserTokens", mock.Anything, user.ID).Return(nil)
+	st.On("UserByID", mock.Anything, user.ID).Return(revoked, nil)
+
+	require.NoError(t, a.LogoutAll(ctx, token, testApp.Code))
+
+	_, err = a.ValidateToken(ctx, token, testApp.Code)
+	require.ErrorIs(t, err, auth.ErrTokenRevoked)
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+var ErrAppMaintenance = errors.New("app is under maintenance")
+
+type MaintenanceProvider interface {
+	ActiveMaintenanceWindow(ctx context.Context, appID int32, now time.Time) (models.MaintenanceWindow, error)
+}
+
+// MaintenanceError is returned for logins to an app during its maintenance window.
+// It matches ErrAppMaintenance.
+type MaintenanceError struct {
+	EndsAt time.Time
+	Reason string
+}
+
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrAppMaintenance, e.EndsAt.UTC().Format(time.RFC3339))
+}
+
+func (e *MaintenanceError) Is(target error) bool {
+	return target == ErrAppMaintenance
+}
+
+// checkMaintenance returns MaintenanceError if logins to the app are suspended right now.
+func (a *Auth) checkMaintenance(ctx context.Context, app models.App, log *slog.Logger, op string) error {
+	if a.maintenance == nil {
+		return nil
+	}
+
+	window, err := a.maintenance.ActiveMaintenanceWindow(ctx, app.ID, time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrMaintenanceNotFound) {
+			return nil
+		}
+
+		log.ErrorContext(ctx, "failed to get maintenance window", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.WarnContext(ctx, "app is under maintenance", slog.Time("ends_at", window.EndsAt))
+
+	return fmt.Errorf("%s: %w", op, &MaintenanceError{EndsAt: window.EndsAt, Reason: window.Reason})
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/notify"
+	"time"
+)
+
+var (
+	ErrEmailOTPUnavailable = errors.New("email one-time codes are not available")
+	ErrEmailOTPTooFrequent = errors.New("email one-time code requested too often")
+)
+
+// StepEmailOTP keys the one-time login codes sent by email.
+const StepEmailOTP LoginStep = "email_otp"
+
+// EmailOTPOptions configures passwordless login with one-time codes sent by email.
+type EmailOTPOptions struct {
+	// Codes keeps the sent codes, nil disables the login by email codes.
+	Codes    VerificationCodeStore
+	Notifier Notifier
+	// CodeTTL is the lifetime of a code.
+	CodeTTL time.Duration
+	// ResendInterval is the least time between codes for the same email and app.
+	// Together with the attempts per code it bounds how fast codes can be guessed.
+	ResendInterval time.Duration
+}
+
+// RequestEmailOTP sends a 6-digit login code to the email. Unknown and blocked users get no code
+// but the same response, so the call doesn't reveal whether the email is registered.
+func (a *Auth) RequestEmailOTP(ctx context.Context, email string, appCode string) error {
+	const op = "Auth.RequestEmailOTP"
+
+	email = a.emails.Normalize(email)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.String("app_code", appCode),
+	)
+
+	if a.emailOTP.Codes == nil {
+		log.WarnContext(ctx, "email one-time codes are disabled")
+		return fmt.Errorf("%s: %w", op, ErrEmailOTPUnavailable)
+	}
+
+	code := a.emailOTPCode()
+	subject := emailOTPSubject(email, appCode)
+
+	// Пока действует недавний код, новый не отправляется: иначе попытки сбрасывались бы с каждым запросом
+	recent, err := code.sentWithin(ctx, subject, a.emailOTP.ResendInterval)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get email code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if recent {
+		log.WarnContext(ctx, "email code requested too often")
+		return fmt.Errorf("%s: %w", op, ErrEmailOTPTooFrequent)
+	}
+
+	user, err := getUser(ctx, a.userProvider, email, log, op)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil
+		}
+		return err
+	}
+
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked, code is not sent")
+		return nil
+	}
+
+	if err := code.start(ctx, subject, user.Email, notify.CodeData{AppCode: appCode}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "email code sent")
+
+	return nil
+}
+
+// VerifyEmailOTP logs the user in with the code sent by RequestEmailOTP instead of the password.
+// The code is a first factor: the app's additional login steps follow as after BeginLogin.
+// A code is discarded after a few wrong answers.
+func (a *Auth) VerifyEmailOTP(ctx context.Context, email string, answer string, appCode string) (LoginResult, error) {
+	const op = "Auth.VerifyEmailOTP"
+
+	email = a.emails.Normalize(email)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.String("app_code", appCode),
+	)
+
+	if a.emailOTP.Codes == nil {
+		log.WarnContext(ctx, "email one-time codes are disabled")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrEmailOTPUnavailable)
+	}
+
+	if err := a.emailOTPCode().verify(ctx, emailOTPSubject(email, appCode), answer); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			log.WarnContext(ctx, "invalid email code")
+			a.recordLoginFailure(ctx, appCode, log)
+			return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidCode)
+		}
+
+		log.ErrorContext(ctx, "failed to verify email code", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := getUser(ctx, a.userProvider, email, log, op)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	app, err := a.admitUser(ctx, user, appCode, log, op)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return a.beginSteps(ctx, user, app, log, op)
+}
+
+func (a *Auth) emailOTPCode() oneTimeCode {
+	return oneTimeCode{
+		log:      a.log,
+		step:     StepEmailOTP,
+		event:    notify.EventLoginCode,
+		codes:    a.emailOTP.Codes,
+		notifier: a.emailOTP.Notifier,
+		codeTTL:  a.emailOTP.CodeTTL,
+	}
+}
+
+// emailOTPSubject keys the code of the email for the app: a code requested for one app
+// doesn't log into another.
+func emailOTPSubject(email string, appCode string) string {
+	return appCode + ":" + email
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/hasher"
+	"sso/internal/lib/logger/sl"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownPepper = errors.New("unknown password pepper")
+
+// hashPassword hashes the password with the current pepper and cost.
+func (a *Auth) hashPassword(ctx context.Context, password string) (passHash []byte, pepperID string, err error) {
+	return HashPassword(ctx, a.hasher, a.passOpts, password)
+}
+
+// HashPassword hashes the password as registration does: with the current pepper and cost of opts.
+// It returns the hash and the id of its pepper, e.g. for tools creating users outside the service.
+func HashPassword(ctx context.Context, hasher PasswordHasher, opts PasswordOptions, password string) ([]byte, string, error) {
+	peppered, err := pepper(opts, password, opts.PepperID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	passHash, err := hasher.Hash(ctx, peppered, opts.Cost)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return passHash, opts.PepperID, nil
+}
+
+// comparePassword checks the password against the user's hash, it returns
+// bcrypt.ErrMismatchedHashAndPassword if they don't match.
+func (a *Auth) comparePassword(ctx context.Context, user models.User, password string) error {
+	peppered, err := pepper(a.passOpts, password, user.PepperID)
+	if err != nil {
+		return err
+	}
+
+	return a.hasher.Compare(ctx, user.PassHash, peppered)
+}
+
+func pepper(opts PasswordOptions, password string, pepperID string) ([]byte, error) {
+	if pepperID == "" {
+		return []byte(password), nil
+	}
+
+	key, ok := opts.Peppers[pepperID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPepper, pepperID)
+	}
+
+	return hasher.Pepper([]byte(password), key), nil
+}
+
+// upgradePassHash re-hashes the password if the stored hash has a lower cost
+// or another pepper than configured. Failures are logged and do not fail the login,
+// the upgrade is retried on the next one.
+func (a *Auth) upgradePassHash(ctx context.Context, user models.User, password string, log *slog.Logger) {
+	cost, err := bcrypt.Cost(user.PassHash)
+	if err != nil || (cost >= a.passOpts.Cost && user.PepperID == a.passOpts.PepperID) {
+		return
+	}
+
+	passHash, pepperID, err := a.hashPassword(ctx, password)
+	if err != nil {
+		log.WarnContext(ctx, "failed to upgrade password hash", sl.Err(err))
+		return
+	}
+
+	if err := a.passHashUpdater.UpdateUserPassHash(ctx, user.ID, passHash, pepperID); err != nil {
+		log.WarnContext(ctx, "failed to save upgraded password hash", sl.Err(err))
+		return
+	}
+
+	log.InfoContext(ctx, "password hash upgraded",
+		slog.Int("from_cost", cost),
+		slog.Int("to_cost", a.passOpts.Cost),
+		slog.String("from_pepper", user.PepperID),
+		slog.String("to_pepper", pepperID),
+	)
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/identifier"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/notify"
+	"sso/internal/storage"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrPhoneCodesUnavailable = errors.New("sms codes are not available")
+	ErrPhoneCodeTooFrequent  = errors.New("sms code requested too often")
+	ErrInvalidPhone          = errors.New("invalid phone number")
+	ErrPhoneTaken            = errors.New("phone number is taken by another user")
+)
+
+// Login steps keying the one-time codes sent by SMS.
+const (
+	StepPhoneOTP    LoginStep = "phone_otp"
+	StepPhoneVerify LoginStep = "phone_verify"
+)
+
+// PhoneSetter sets the phone number of the user, see storage.SetUserIdentifier.
+type PhoneSetter interface {
+	SetUserIdentifier(ctx context.Context, userID int64, kind identifier.Kind, value string) error
+}
+
+// UserInvalidator drops the cached entries of a changed user on all instances.
+type UserInvalidator interface {
+	InvalidateUser(ctx context.Context, userID int64, email string)
+}
+
+// PhoneOptions configures the one-time codes sent by SMS: login by phone number
+// and the verification of a phone number added by the user.
+type PhoneOptions struct {
+	// Codes keeps the sent codes, nil disables the codes by SMS.
+	Codes VerificationCodeStore
+	// Texter delivers the codes by SMS, see notify.Texter.
+	Texter  Notifier
+	CodeTTL time.Duration
+	// ResendInterval is the least time between codes for the same phone number.
+	ResendInterval time.Duration
+}
+
+// RequestPhoneOTP sends a 6-digit login code by SMS to the phone number of a user. Unknown
+// and blocked users get no code but the same response, so the call doesn't reveal whether
+// the number belongs to an account.
+func (a *Auth) RequestPhoneOTP(ctx context.Context, phone string, appCode string) error {
+	const op = "Auth.RequestPhoneOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	if a.phone.Codes == nil {
+		log.WarnContext(ctx, "sms codes are disabled")
+		return fmt.Errorf("%s: %w", op, ErrPhoneCodesUnavailable)
+	}
+
+	phone, err := identifier.NormalizePhone(phone)
+	if err != nil {
+		log.WarnContext(ctx, "invalid phone number")
+		return fmt.Errorf("%s: %w", op, ErrInvalidPhone)
+	}
+
+	code := a.phoneCode(StepPhoneOTP, notify.EventPhoneLoginCode)
+	subject := appCode + ":" + phone
+
+	// Каждая SMS стоит денег, поэтому частоту ограничиваем так же, как для email
+	recent, err := code.sentWithin(ctx, subject, a.phone.ResendInterval)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get sms code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if recent {
+		log.WarnContext(ctx, "sms code requested too often")
+		return fmt.Errorf("%s: %w", op, ErrPhoneCodeTooFrequent)
+	}
+
+	user, err := getUserByIdentifier(ctx, a.userProvider, identifier.Identifier{Kind: identifier.Phone, Value: phone}, log, op)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil
+		}
+		return err
+	}
+
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked, code is not sent")
+		return nil
+	}
+
+	if err := code.start(ctx, subject, phone, notify.CodeData{AppCode: appCode}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "sms code sent", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+// VerifyPhoneOTP logs the user in with the code sent by RequestPhoneOTP instead of the password.
+// As with VerifyEmailOTP, the app's additional login steps follow.
+func (a *Auth) VerifyPhoneOTP(ctx context.Context, phone string, answer string, appCode string) (LoginResult, error) {
+	const op = "Auth.VerifyPhoneOTP"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	if a.phone.Codes == nil {
+		log.WarnContext(ctx, "sms codes are disabled")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrPhoneCodesUnavailable)
+	}
+
+	phone, err := identifier.NormalizePhone(phone)
+	if err != nil {
+		log.WarnContext(ctx, "invalid phone number")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidCode)
+	}
+
+	code := a.phoneCode(StepPhoneOTP, notify.EventPhoneLoginCode)
+	if err := code.verify(ctx, appCode+":"+phone, answer); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			log.WarnContext(ctx, "invalid sms code")
+			a.recordLoginFailure(ctx, appCode, log)
+			return LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidCode)
+		}
+
+		log.ErrorContext(ctx, "failed to verify sms code", sl.Err(err))
+		return LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := getUserByIdentifier(ctx, a.userProvider, identifier.Identifier{Kind: identifier.Phone, Value: phone}, log, op)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked")
+		return LoginResult{}, fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	app, err := a.admitUser(ctx, user, appCode, log, op)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return a.beginSteps(ctx, user, app, log, op)
+}
+
+// RequestPhoneVerification sends a code by SMS to the phone number the token's user wants
+// to add to the account. The number is set by VerifyPhone once the code is confirmed.
+func (a *Auth) RequestPhoneVerification(ctx context.Context, token string, appCode string, phone string) error {
+	const op = "Auth.RequestPhoneVerification"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	if a.phone.Codes == nil {
+		log.WarnContext(ctx, "sms codes are disabled")
+		return fmt.Errorf("%s: %w", op, ErrPhoneCodesUnavailable)
+	}
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	phone, err = identifier.NormalizePhone(phone)
+	if err != nil {
+		log.WarnContext(ctx, "invalid phone number")
+		return fmt.Errorf("%s: %w", op, ErrInvalidPhone)
+	}
+
+	code := a.phoneCode(StepPhoneVerify, notify.EventPhoneVerifyCode)
+	subject := phoneVerifySubject(user.ID, phone)
+
+	recent, err := code.sentWithin(ctx, subject, a.phone.ResendInterval)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get sms code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if recent {
+		log.WarnContext(ctx, "sms code requested too often")
+		return fmt.Errorf("%s: %w", op, ErrPhoneCodeTooFrequent)
+	}
+
+	if err := code.start(ctx, subject, phone, notify.CodeData{AppCode: appCode}); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "phone verification code sent", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+// VerifyPhone sets the phone number of the token's user after checking the code sent
+// by RequestPhoneVerification. The number then serves as a login identifier.
+func (a *Auth) VerifyPhone(ctx context.Context, token string, appCode string, phone string, answer string) error {
+	const op = "Auth.VerifyPhone"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	if a.phone.Codes == nil {
+		log.WarnContext(ctx, "sms codes are disabled")
+		return fmt.Errorf("%s: %w", op, ErrPhoneCodesUnavailable)
+	}
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	phone, err = identifier.NormalizePhone(phone)
+	if err != nil {
+		log.WarnContext(ctx, "invalid phone number")
+		return fmt.Errorf("%s: %w", op, ErrInvalidPhone)
+	}
+
+	// Код привязан к пользователю и номеру: подтверждение не переносится на другой номер
+	code := a.phoneCode(StepPhoneVerify, notify.EventPhoneVerifyCode)
+	if err := code.verify(ctx, phoneVerifySubject(user.ID, phone), answer); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			log.WarnContext(ctx, "invalid sms code")
+			return fmt.Errorf("%s: %w", op, ErrInvalidCode)
+		}
+
+		log.ErrorContext(ctx, "failed to verify sms code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.phoneSetter.SetUserIdentifier(ctx, user.ID, identifier.Phone, phone); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		if errors.Is(err, storage.ErrIdentifierTaken) {
+			log.WarnContext(ctx, "phone number is taken")
+			return fmt.Errorf("%s: %w", op, ErrPhoneTaken)
+		}
+
+		log.ErrorContext(ctx, "failed to set phone number", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	log.InfoContext(ctx, "phone number verified", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+func (a *Auth) phoneCode(step LoginStep, event notify.Event) oneTimeCode {
+	return oneTimeCode{
+		log:      a.log,
+		step:     step,
+		event:    event,
+		codes:    a.phone.Codes,
+		notifier: a.phone.Texter,
+		codeTTL:  a.phone.CodeTTL,
+	}
+}
+
+func phoneVerifySubject(userID int64, phone string) string {
+	return strconv.FormatInt(userID, 10) + ":" + phone
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/policy"
+)
+
+var ErrPolicyDenied = errors.New("access denied by policy")
+
+// PolicyDecider delegates access decisions to the policy engine of the app.
+type PolicyDecider interface {
+	Decide(ctx context.Context, req policy.Request) (bool, error)
+}
+
+// checkPolicy asks the policy engine whether the user may perform the action in the app.
+func (a *Auth) checkPolicy(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	action string,
+	log *slog.Logger,
+	op string,
+) error {
+	if a.policy == nil {
+		return nil
+	}
+
+	allowed, err := a.policy.Decide(ctx, policy.Request{
+		Subject: user.Email,
+		UserID:  user.ID,
+		App:     app.Code,
+		Action:  action,
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get policy decision", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !allowed {
+		log.WarnContext(ctx, "access denied by policy", slog.String("action", action))
+		return fmt.Errorf("%s: %w", op, ErrPolicyDenied)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+var (
+	ErrTokenUsed      = errors.New("token already used")
+	ErrUnknownPurpose = errors.New("unknown token purpose")
+)
+
+type TokenUseStorage interface {
+	UseToken(ctx context.Context, jti string, purpose string, expiresAt time.Time) error
+}
+
+// IssuePurposeToken issues a single-use token authorizing the purpose action of the user,
+// to be embedded into an email or SMS link.
+func (a *Auth) IssuePurposeToken(ctx context.Context, email string, appCode string, purpose jwt.Purpose) (string, error) {
+	const op = "Auth.IssuePurposeToken"
+
+	email = a.emails.Normalize(email)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.String("app_code", appCode),
+		slog.String("purpose", string(purpose)),
+	)
+
+	ttl, ok := a.tokenOpts.PurposeTTL[purpose]
+	if !ok {
+		log.ErrorContext(ctx, "unknown token purpose")
+		return "", fmt.Errorf("%s: %w", op, ErrUnknownPurpose)
+	}
+
+	user, err := getUser(ctx, a.userProvider, email, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	app, err := getApp(ctx, a.appProvider, appCode, log, op)
+	if err != nil {
+		return "", err
+	}
+
+	token, _, err := jwt.NewPurposeToken(user, app, purpose, ttl)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate token", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// ConsumePurposeToken validates the purpose token, marks it as used and returns its user.
+// A token can be consumed only once.
+func (a *Auth) ConsumePurposeToken(ctx context.Context, token string, appCode string, purpose jwt.Purpose) (models.User, error) {
+	const op = "Auth.ConsumePurposeToken"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.String("purpose", string(purpose)),
+	)
+
+	app, err := getApp(ctx, a.appProvider, appCode, log, op)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	claims, err := jwt.ParsePurpose(token, app.Secret, purpose, a.tokenOpts.Leeway)
+	if err != nil {
+		log.WarnContext(ctx, "failed to validate token", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := getUser(ctx, a.userProvider, claims.Email, log, op)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Аккаунт мог быть удалён и создан заново с тем же email
+	if user.ID != claims.UID {
+		log.WarnContext(ctx, "token user does not match")
+		return models.User{}, fmt.Errorf("%s: %w", op, jwt.ErrTokenInvalid)
+	}
+
+	if err := a.tokenUses.UseToken(ctx, claims.ID, string(purpose), claims.ExpiresAt); err != nil {
+		if errors.Is(err, storage.ErrTokenUsed) {
+			log.WarnContext(ctx, "token already used")
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrTokenUsed)
+		}
+
+		log.ErrorContext(ctx, "failed to mark token as used", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
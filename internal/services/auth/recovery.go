@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/audit"
+	"sso/internal/lib/logger/sl"
+	libvalidate "sso/internal/lib/validate"
+	"sso/internal/notify"
+	"sso/internal/storage"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRecoveryUnavailable  = errors.New("account recovery is not available")
+	ErrRecoveryFailed       = errors.New("account recovery failed")
+	ErrInvalidRecoveryEmail = errors.New("invalid recovery email")
+)
+
+// StepRecovery marks login sessions of the account recovery flow, ContinueLogin doesn't accept them.
+const StepRecovery LoginStep = "recovery"
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued at once.
+	recoveryCodeCount = 10
+	// recoveryCodeBytes gives codes of 16 base32 characters, shown in groups of four.
+	recoveryCodeBytes = 10
+)
+
+// recoveryEncoding writes recovery codes in lowercase without padding, so they are easy to type.
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type RecoveryStorage interface {
+	RecoveryEmail(ctx context.Context, userID int64) (string, error)
+	SetRecoveryEmail(ctx context.Context, userID int64, email string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte, at time.Time) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash []byte, at time.Time) error
+}
+
+// Auditor records security-relevant changes.
+type Auditor interface {
+	Audit(ctx context.Context, e audit.Event)
+}
+
+// RecoveryOptions configures account recovery for users who lost both the password and the second factor.
+type RecoveryOptions struct {
+	// Codes keeps the codes sent to recovery emails. Without it and a LoginSessionStore recovery is unavailable.
+	Codes    VerificationCodeStore
+	Notifier Notifier
+	// CodeTTL is the lifetime of the code sent to the recovery email and of the recovery session.
+	CodeTTL time.Duration
+	// Auditor records every recovery attempt and every change of the recovery settings.
+	Auditor Auditor
+}
+
+// SetRecoveryEmail sets the recovery email of the token's user, an empty email removes it.
+// The recovery email must differ from the login email.
+func (a *Auth) SetRecoveryEmail(ctx context.Context, token string, appCode string, recoveryEmail string) error {
+	const op = "Auth.SetRecoveryEmail"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	user, app, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	if recoveryEmail != "" {
+		recoveryEmail = a.emails.Normalize(recoveryEmail)
+		if libvalidate.Email(recoveryEmail) != nil || recoveryEmail == user.Email {
+			log.WarnContext(ctx, "invalid recovery email")
+			return fmt.Errorf("%s: %w", op, ErrInvalidRecoveryEmail)
+		}
+	}
+
+	if err := a.recoveryStore.SetRecoveryEmail(ctx, user.ID, recoveryEmail); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		log.ErrorContext(ctx, "failed to set recovery email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.auditRecovery(ctx, audit.ActionRecoveryEmailSet, user, app.Code, "")
+
+	log.InfoContext(ctx, "recovery email set", slog.Int64("user_id", user.ID), slog.Bool("removed", recoveryEmail == ""))
+
+	return nil
+}
+
+// GenerateRecoveryCodes issues new one-time recovery codes to the token's user, invalidating the previous ones.
+// Only hashes are stored, the codes are shown to the user once.
+func (a *Auth) GenerateRecoveryCodes(ctx context.Context, token string, appCode string) ([]string, error) {
+	const op = "Auth.GenerateRecoveryCodes"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	user, app, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			log.ErrorContext(ctx, "failed to generate recovery code", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, recoveryCodeHash(code))
+	}
+
+	if err := a.recoveryStore.ReplaceRecoveryCodes(ctx, user.ID, hashes, time.Now()); err != nil {
+		log.ErrorContext(ctx, "failed to save recovery codes", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.auditRecovery(ctx, audit.ActionRecoveryCodesIssued, user, app.Code, "")
+
+	log.InfoContext(ctx, "recovery codes generated", slog.Int64("user_id", user.ID))
+
+	return codes, nil
+}
+
+// BeginRecovery starts the recovery of the account with the email: a code is sent to its recovery email.
+// The returned recovery session token is completed with CompleteRecovery. Unknown users and users
+// without a recovery email get the same ErrRecoveryUnavailable.
+func (a *Auth) BeginRecovery(ctx context.Context, email string) (string, error) {
+	const op = "Auth.BeginRecovery"
+
+	email = a.emails.Normalize(email)
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+	log.InfoContext(ctx, "starting account recovery")
+
+	if a.loginSessions == nil || a.recovery.Codes == nil {
+		log.ErrorContext(ctx, "recovery requires login session and code stores")
+		return "", fmt.Errorf("%s: %w", op, ErrRecoveryUnavailable)
+	}
+
+	user, err := getUser(ctx, a.userProvider, email, log, op)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.auditRecovery(ctx, audit.ActionRecoveryFailed, models.User{Email: email}, "", "unknown user")
+			return "", fmt.Errorf("%s: %w", op, ErrRecoveryUnavailable)
+		}
+		return "", err
+	}
+
+	if user.Blocked {
+		log.WarnContext(ctx, "user is blocked")
+		a.auditRecovery(ctx, audit.ActionRecoveryFailed, user, "", "user blocked")
+		return "", fmt.Errorf("%s: %w", op, ErrUserBlocked)
+	}
+
+	recoveryEmail, err := a.recoveryStore.RecoveryEmail(ctx, user.ID)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		log.ErrorContext(ctx, "failed to get recovery email", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if recoveryEmail == "" {
+		log.WarnContext(ctx, "recovery email is not set")
+		a.auditRecovery(ctx, audit.ActionRecoveryFailed, user, "", "no recovery email")
+		return "", fmt.Errorf("%s: %w", op, ErrRecoveryUnavailable)
+	}
+
+	id, err := newLoginSessionID()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate recovery session id", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	session := models.LoginSession{
+		ID:        id,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Pending:   []string{string(StepRecovery)},
+		ExpiresAt: time.Now().Add(a.recovery.CodeTTL),
+	}
+
+	if err := a.loginSessions.SaveLoginSession(ctx, session); err != nil {
+		log.ErrorContext(ctx, "failed to save recovery session", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Код уходит на резервный адрес, а не на основной
+	if err := a.recoveryCode().start(ctx, session.ID, recoveryEmail, notify.CodeData{}); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.auditRecovery(ctx, audit.ActionRecoveryStarted, user, "", "")
+
+	log.InfoContext(ctx, "recovery code sent", slog.Int64("user_id", user.ID))
+
+	return session.ID, nil
+}
+
+// CompleteRecovery finishes the recovery session with two proofs: the code sent to the recovery email
+// and one of the recovery codes of the user. It sets the new password and revokes all tokens of the user.
+// Any failure ends the session, the recovery has to be started over.
+func (a *Auth) CompleteRecovery(
+	ctx context.Context,
+	sessionToken string,
+	emailCode string,
+	recoveryCode string,
+	newPassword string,
+) error {
+	const op = "Auth.CompleteRecovery"
+
+	log := a.log.With(slog.String("op", op))
+
+	if a.loginSessions == nil || a.recovery.Codes == nil {
+		log.ErrorContext(ctx, "recovery requires login session and code stores")
+		return fmt.Errorf("%s: %w", op, ErrRecoveryUnavailable)
+	}
+
+	// Сессия одноразовая: забирается сразу, неудачная попытка не даёт перебирать коды восстановления
+	session, err := a.loginSessions.TakeLoginSession(ctx, sessionToken)
+	if err != nil {
+		if errors.Is(err, storage.ErrLoginSessionNotFound) {
+			log.WarnContext(ctx, "recovery session not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+		}
+
+		log.ErrorContext(ctx, "failed to take recovery session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(session.Pending) != 1 || session.Pending[0] != string(StepRecovery) || time.Now().After(session.ExpiresAt) {
+		log.WarnContext(ctx, "not a recovery session or expired")
+		return fmt.Errorf("%s: %w", op, ErrInvalidLoginSession)
+	}
+
+	log = log.With(slog.String("email", session.Email))
+
+	user, err := getUserByID(ctx, a.userProvider, session.UserID, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.recoveryCode().verify(ctx, session.ID, emailCode); err != nil {
+		log.WarnContext(ctx, "invalid recovery email code", sl.Err(err))
+		a.auditRecovery(ctx, audit.ActionRecoveryFailed, user, "", "invalid email code")
+		return fmt.Errorf("%s: %w", op, ErrRecoveryFailed)
+	}
+
+	if err := a.recoveryStore.UseRecoveryCode(ctx, user.ID, recoveryCodeHash(recoveryCode), time.Now()); err != nil {
+		if !errors.Is(err, storage.ErrRecoveryCodeInvalid) {
+			log.ErrorContext(ctx, "failed to use recovery code", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.WarnContext(ctx, "invalid recovery code")
+		a.auditRecovery(ctx, audit.ActionRecoveryFailed, user, "", "invalid recovery code")
+		return fmt.Errorf("%s: %w", op, ErrRecoveryFailed)
+	}
+
+	if err := a.checkPasswordStrength(ctx, newPassword, user.Email, log); err != nil {
+		a.auditRecovery(ctx, audit.ActionRecoveryFailed, user, "", "weak password")
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, pepperID, err := a.hashPassword(ctx, newPassword)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to generate password hash", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.passHashUpdater.UpdateUserPassHash(ctx, user.ID, passHash, pepperID); err != nil {
+		log.ErrorContext(ctx, "failed to save password hash", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Токены, выданные до восстановления, могут быть у того, кто завладел аккаунтом
+	if err := a.tokenRevoker.RevokeUserTokens(ctx, user.ID); err != nil {
+		log.ErrorContext(ctx, "failed to revoke tokens", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Закэшированная запись со старой версией токенов продлила бы им жизнь до конца TTL
+	a.invalidator.InvalidateUser(ctx, user.ID, user.Email)
+
+	a.auditRecovery(ctx, audit.ActionRecoveryCompleted, user, "", "")
+
+	log.InfoContext(ctx, "account recovered", slog.Int64("user_id", user.ID))
+
+	return nil
+}
+
+func (a *Auth) recoveryCode() oneTimeCode {
+	return oneTimeCode{
+		log:      a.log,
+		step:     StepRecovery,
+		event:    notify.EventRecoveryCode,
+		codes:    a.recovery.Codes,
+		notifier: a.recovery.Notifier,
+		codeTTL:  a.recovery.CodeTTL,
+	}
+}
+
+// auditRecovery records a recovery event of the user, the user is its own actor.
+func (a *Auth) auditRecovery(ctx context.Context, action string, user models.User, appCode string, detail string) {
+	if a.recovery.Auditor == nil {
+		return
+	}
+
+	a.recovery.Auditor.Audit(ctx, audit.Event{
+		Action:  action,
+		Actor:   user.Email,
+		Email:   user.Email,
+		AppCode: appCode,
+		Detail:  detail,
+	})
+}
+
+// newRecoveryCode returns a random code formatted as xxxx-xxxx-xxxx-xxxx.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := recoveryEncoding.EncodeToString(b)
+
+	groups := make([]string, 0, len(raw)/4)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+// recoveryCodeHash hashes the code ignoring case, spaces and dashes the user may type it with.
+func recoveryCodeHash(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
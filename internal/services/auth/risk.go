@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/reqctx"
+	"sso/internal/lib/risk"
+	"sso/internal/notify"
+	"strconv"
+	"time"
+)
+
+// Login steps required by the risk score of a login.
+const (
+	StepCaptcha  LoginStep = "captcha"
+	StepRiskCode LoginStep = "risk_code"
+)
+
+// riskFailuresKeyPrefix keys the failed password attempts of a user in the FailureCounter.
+const riskFailuresKeyPrefix = "risk:failures:"
+
+// LoginHistoryProvider returns the past logins of a user.
+type LoginHistoryProvider interface {
+	LoginHistory(ctx context.Context, userID int64, limit int) ([]models.Login, error)
+	LoginIPSeen(ctx context.Context, userID int64, ip string) (bool, error)
+}
+
+// FailureCounter counts failed attempts per key within a window.
+type FailureCounter interface {
+	FailedAttempts(ctx context.Context, key string) (int64, error)
+	AddFailedAttempt(ctx context.Context, key string, window time.Duration) error
+}
+
+// CaptchaVerifier checks a CAPTCHA token solved by the client, see captcha.Verifier.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token string, remoteIP string) error
+}
+
+// RiskOptions configures the risk scoring of logins.
+type RiskOptions struct {
+	Weights risk.Weights
+	// FailureWindow is how long a failed password attempt counts.
+	FailureWindow time.Duration
+	// MaxTravelSpeed is the speed in km/h from which the travel between two logins is impossible,
+	// zero disables the signal. Coordinates need a GeoIP city database.
+	MaxTravelSpeed float64
+	// DatacenterASNs are the autonomous systems of hosting providers, empty uses risk.DatacenterASNs.
+	DatacenterASNs []uint32
+}
+
+// RiskScorer scores logins by their signals of account takeover, see risk.Signals.
+// The challenges built on it require a CAPTCHA or a code from the logins scored high enough.
+type RiskScorer struct {
+	log         *slog.Logger
+	geo         GeoLocator
+	history     LoginHistoryProvider
+	failures    FailureCounter
+	opts        RiskOptions
+	datacenters map[uint32]struct{}
+}
+
+// NewRiskScorer creates the scorer. failures may be nil to not count failed attempts.
+func NewRiskScorer(
+	log *slog.Logger,
+	geo GeoLocator,
+	history LoginHistoryProvider,
+	failures FailureCounter,
+	opts RiskOptions,
+) *RiskScorer {
+	asns := opts.DatacenterASNs
+	if len(asns) == 0 {
+		asns = risk.DatacenterASNs
+	}
+
+	datacenters := make(map[uint32]struct{}, len(asns))
+	for _, asn := range asns {
+		datacenters[asn] = struct{}{}
+	}
+
+	return &RiskScorer{
+		log:         log,
+		geo:         geo,
+		history:     history,
+		failures:    failures,
+		opts:        opts,
+		datacenters: datacenters,
+	}
+}
+
+// Score returns the risk score of the user's login by the caller of ctx and the signals behind it.
+func (s *RiskScorer) Score(ctx context.Context, user models.User) (int, risk.Signals, error) {
+	const op = "RiskScorer.Score"
+
+	var signals risk.Signals
+
+	ip := reqctx.FromContext(ctx).IP
+	loc := s.geo.Lookup(ip)
+
+	if s.failures != nil {
+		n, err := s.failures.FailedAttempts(ctx, failuresKey(user.ID))
+		if err != nil {
+			return 0, risk.Signals{}, fmt.Errorf("%s: %w", op, err)
+		}
+		signals.FailedAttempts = int(n)
+	}
+
+	_, signals.Datacenter = s.datacenters[loc.ASN]
+
+	last, err := s.history.LoginHistory(ctx, user.ID, 1)
+	if err != nil {
+		return 0, risk.Signals{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Первый вход сравнивать не с чем: адрес не считается новым
+	if len(last) > 0 && ip != "" {
+		seen, err := s.history.LoginIPSeen(ctx, user.ID, ip)
+		if err != nil {
+			return 0, risk.Signals{}, fmt.Errorf("%s: %w", op, err)
+		}
+		signals.NewIP = !seen
+
+		signals.ImpossibleTravel = risk.ImpossibleTravel(
+			risk.Point{Latitude: last[0].Latitude, Longitude: last[0].Longitude},
+			risk.Point{Latitude: loc.Latitude, Longitude: loc.Longitude},
+			time.Since(last[0].CreatedAt),
+			s.opts.MaxTravelSpeed,
+		)
+	}
+
+	score := risk.Score(signals, s.opts.Weights)
+
+	if score > 0 {
+		s.log.Info("login risk scored",
+			slog.String("op", op),
+			slog.Int64("user_id", user.ID),
+			slog.Int("score", score),
+			slog.Any("signals", signals.Names()),
+		)
+	}
+
+	return score, signals, nil
+}
+
+// countFailure counts a failed password attempt of the user. A nil scorer counts nothing.
+func (s *RiskScorer) countFailure(ctx context.Context, user models.User, log *slog.Logger) {
+	if s == nil || s.failures == nil {
+		return
+	}
+
+	if err := s.failures.AddFailedAttempt(ctx, failuresKey(user.ID), s.opts.FailureWindow); err != nil {
+		log.ErrorContext(ctx, "failed to count failed attempt", sl.Err(err))
+	}
+}
+
+// exceeds reports whether the login scores at least threshold, a zero threshold is never reached.
+func (s *RiskScorer) exceeds(ctx context.Context, user models.User, threshold int) (bool, error) {
+	if threshold <= 0 {
+		return false, nil
+	}
+
+	score, _, err := s.Score(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	return score >= threshold, nil
+}
+
+func failuresKey(userID int64) string {
+	return riskFailuresKeyPrefix + strconv.FormatInt(userID, 10)
+}
+
+// RiskCaptchaChallenge is a login step requiring a solved CAPTCHA, its token being the answer,
+// when the risk score of the login reaches the threshold.
+type RiskCaptchaChallenge struct {
+	scorer    *RiskScorer
+	verifier  CaptchaVerifier
+	threshold int
+}
+
+func NewRiskCaptchaChallenge(scorer *RiskScorer, verifier CaptchaVerifier, threshold int) *RiskCaptchaChallenge {
+	return &RiskCaptchaChallenge{
+		scorer:    scorer,
+		verifier:  verifier,
+		threshold: threshold,
+	}
+}
+
+func (c *RiskCaptchaChallenge) Step() LoginStep {
+	return StepCaptcha
+}
+
+func (c *RiskCaptchaChallenge) Required(ctx context.Context, user models.User, _ models.App) (bool, error) {
+	const op = "RiskCaptchaChallenge.Required"
+
+	required, err := c.scorer.exceeds(ctx, user, c.threshold)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return required, nil
+}
+
+func (c *RiskCaptchaChallenge) Verify(ctx context.Context, _ string, _ models.User, _ models.App, answer string) error {
+	const op = "RiskCaptchaChallenge.Verify"
+
+	if err := c.verifier.Verify(ctx, answer, reqctx.FromContext(ctx).IP); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RiskCodeChallenge is a login step requiring a one-time code sent by email when the risk
+// score of the login reaches the threshold, for users without a second factor as well.
+type RiskCodeChallenge struct {
+	scorer    *RiskScorer
+	threshold int
+	code      oneTimeCode
+}
+
+func NewRiskCodeChallenge(
+	log *slog.Logger,
+	scorer *RiskScorer,
+	threshold int,
+	codes VerificationCodeStore,
+	notifier Notifier,
+	codeTTL time.Duration,
+) *RiskCodeChallenge {
+	return &RiskCodeChallenge{
+		scorer:    scorer,
+		threshold: threshold,
+		code: oneTimeCode{
+			log:      log,
+			step:     StepRiskCode,
+			event:    notify.EventRiskCode,
+			codes:    codes,
+			notifier: notifier,
+			codeTTL:  codeTTL,
+		},
+	}
+}
+
+func (c *RiskCodeChallenge) Step() LoginStep {
+	return StepRiskCode
+}
+
+func (c *RiskCodeChallenge) SecondFactor() {}
+
+func (c *RiskCodeChallenge) Required(ctx context.Context, user models.User, _ models.App) (bool, error) {
+	const op = "RiskCodeChallenge.Required"
+
+	required, err := c.scorer.exceeds(ctx, user, c.threshold)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return required, nil
+}
+
+// Start sends a new verification code to the user's email.
+func (c *RiskCodeChallenge) Start(ctx context.Context, sessionID string, user models.User, app models.App) error {
+	return c.code.start(ctx, sessionID, user.Email, notify.CodeData{AppCode: app.Code})
+}
+
+func (c *RiskCodeChallenge) Verify(ctx context.Context, sessionID string, _ models.User, _ models.App, answer string) error {
+	return c.code.verify(ctx, sessionID, answer)
+}
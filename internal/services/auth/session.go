@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"strings"
+	"time"
+)
+
+// opaqueTokenBytes is the length of random opaque tokens.
+const opaqueTokenBytes = 32
+
+// SessionStore keeps the server-side sessions of opaque tokens.
+type SessionStore interface {
+	SaveSession(ctx context.Context, session models.Session) error
+	Session(ctx context.Context, id string) (models.Session, error)
+	DeleteSession(ctx context.Context, id string) error
+}
+
+// issueOpaqueToken generates a random token and stores the session it resolves to.
+// Only the hash of the token is stored.
+func (a *Auth) issueOpaqueToken(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	extra map[string]any,
+	log *slog.Logger,
+	op string,
+) (string, error) {
+	if a.sessions == nil {
+		log.ErrorContext(ctx, "opaque tokens are not configured")
+		return "", fmt.Errorf("%s: opaque tokens are not configured", op)
+	}
+
+	b := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		log.ErrorContext(ctx, "failed to generate token", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	token := hex.EncodeToString(b)
+
+	if extra == nil {
+		extra = map[string]any{}
+	}
+
+	encoded, err := json.Marshal(extra)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to encode claims", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.sessions.SaveSession(ctx, models.Session{
+		ID:           sessionID(token),
+		UserID:       user.ID,
+		AppID:        app.ID,
+		TokenVersion: user.TokenVersion,
+		Claims:       encoded,
+		ExpiresAt:    time.Now().Add(a.tokenTTL),
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to save session", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// parseToken validates the token of the app and returns its claims. Opaque tokens are resolved
+// to their sessions; JWTs are accepted regardless of the app format, so tokens issued before
+// the format was switched stay valid until they expire. JWTs revoked on logout are rejected.
+func (a *Auth) parseToken(ctx context.Context, token string, app models.App, log *slog.Logger, op string) (jwt.Claims, error) {
+	if isJWT(token) {
+		claims, err := jwt.Parse(token, a.verificationKeys(ctx, app), a.tokenOpts.Leeway)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to validate token", sl.Err(err))
+			return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := a.checkTokenRevoked(ctx, claims, log, op); err != nil {
+			return jwt.Claims{}, err
+		}
+
+		return claims, nil
+	}
+
+	if a.sessions == nil {
+		log.WarnContext(ctx, "opaque tokens are not configured")
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	session, err := a.sessions.Session(ctx, sessionID(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+
+		log.ErrorContext(ctx, "failed to get session", sl.Err(err))
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if session.AppID != app.ID {
+		log.WarnContext(ctx, "session of another app")
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, jwt.ErrTokenExpired)
+	}
+
+	extra := make(map[string]any)
+	if err := json.Unmarshal(session.Claims, &extra); err != nil {
+		log.ErrorContext(ctx, "failed to decode claims", sl.Err(err))
+		return jwt.Claims{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jwt.Claims{
+		UID:          session.UserID,
+		AppCode:      app.Code,
+		ExpiresAt:    session.ExpiresAt,
+		TokenVersion: session.TokenVersion,
+		Extra:        extra,
+	}, nil
+}
+
+// sessionID is the storage key of the session of an opaque token.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isJWT tells JWTs from opaque tokens, which are hex and have no dots.
+func isJWT(token string) bool {
+	return strings.Contains(token, ".")
+}
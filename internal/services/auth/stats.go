@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/reqctx"
+	"time"
+)
+
+// LoginRecorder counts successful and failed logins for statistics and keeps the login history.
+type LoginRecorder interface {
+	LoginCountryProvider
+	RecordLogin(ctx context.Context, login models.Login) error
+	RecordLoginFailure(ctx context.Context, appID int32, at time.Time) error
+}
+
+// recordLogin counts the login and adds it to the login history with the location of the caller,
+// flagging a login from a new country. Its failure doesn't fail the login.
+func (a *Auth) recordLogin(ctx context.Context, user models.User, app models.App, log *slog.Logger) {
+	if a.loginStats == nil {
+		return
+	}
+
+	caller := reqctx.FromContext(ctx)
+	loc := a.locate(caller.IP)
+
+	login := models.Login{
+		UserID:    user.ID,
+		AppID:     app.ID,
+		IP:        caller.IP,
+		UserAgent: caller.UserAgent,
+		Country:   loc.Country,
+		ASN:       loc.ASN,
+		Latitude:  loc.Latitude,
+		Longitude: loc.Longitude,
+		CreatedAt: time.Now(),
+	}
+
+	if loc.Country != "" {
+		countries, err := a.loginStats.LoginCountries(ctx, user.ID)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to get login countries", sl.Err(err))
+		}
+		login.NewCountry = err == nil && isNewCountry(countries, loc.Country)
+	}
+
+	if login.NewCountry {
+		log.WarnContext(ctx, "login from new country",
+			slog.String("country", loc.Country),
+			slog.Any("asn", loc.ASN),
+			slog.String("ip", caller.IP),
+		)
+	}
+
+	if err := a.loginStats.RecordLogin(ctx, login); err != nil {
+		log.ErrorContext(ctx, "failed to record login", sl.Err(err))
+	}
+}
+
+// recordLoginFailure counts a failed attempt to log in to the app with the code.
+// Attempts to unknown apps are not counted.
+func (a *Auth) recordLoginFailure(ctx context.Context, appCode string, log *slog.Logger) {
+	if a.loginStats == nil {
+		return
+	}
+
+	app, err := a.appProvider.App(ctx, appCode)
+	if err != nil {
+		return
+	}
+
+	if err := a.loginStats.RecordLoginFailure(ctx, app.ID, time.Now()); err != nil {
+		log.ErrorContext(ctx, "failed to record login failure", sl.Err(err))
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/strength"
+)
+
+var ErrWeakPassword = errors.New("password is too weak")
+
+// WeakPasswordError is returned for new passwords scored below PasswordOptions.MinScore,
+// with the feedback to show to the user. It matches ErrWeakPassword.
+type WeakPasswordError struct {
+	strength.Result
+}
+
+func (e *WeakPasswordError) Error() string {
+	return fmt.Sprintf("%s: score %d", ErrWeakPassword, e.Score)
+}
+
+func (e *WeakPasswordError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// CheckPasswordStrength estimates the password the same way registration does, so frontends
+// can show feedback as the user types. The email and other user inputs, e.g. the name,
+// count as known to an attacker.
+func (a *Auth) CheckPasswordStrength(ctx context.Context, password string, userInputs ...string) strength.Result {
+	return strength.Estimate(password, userInputs...)
+}
+
+// checkPasswordStrength returns WeakPasswordError if the new password of the user with the email
+// scores below PasswordOptions.MinScore.
+func (a *Auth) checkPasswordStrength(ctx context.Context, password string, email string, log *slog.Logger) error {
+	if a.passOpts.MinScore <= 0 {
+		return nil
+	}
+
+	res := strength.Estimate(password, email)
+	if res.Score < a.passOpts.MinScore {
+		log.WarnContext(ctx, "password is too weak", slog.Int("score", res.Score), slog.Int("min_score", a.passOpts.MinScore))
+		return &WeakPasswordError{Result: res}
+	}
+
+	return nil
+}
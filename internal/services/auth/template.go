@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+)
+
+// RoleProvider returns the roles of a user in the access policy of an app.
+type RoleProvider interface {
+	Roles(ctx context.Context, app string, subject string) ([]string, error)
+}
+
+// templateClaims adds the roles and the attributes of the user selected by the claims template
+// of the app to extra. The profile fields and the renames of the template are applied by jwt.NewToken.
+func (a *Auth) templateClaims(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	extra map[string]any,
+	log *slog.Logger,
+	op string,
+) (map[string]any, error) {
+	tmpl := app.Claims
+	if !tmpl.Roles && len(tmpl.Attributes) == 0 {
+		return extra, nil
+	}
+
+	claims := make(map[string]any, len(extra)+len(tmpl.Attributes)+1)
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	if roles, ok := a.policy.(RoleProvider); ok && tmpl.Roles {
+		list, err := roles.Roles(ctx, app.Code, user.Email)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to get user roles", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if len(list) > 0 {
+			claims[rolesClaim] = list
+		}
+	}
+
+	if len(tmpl.Attributes) > 0 {
+		attrs, err := a.attributes.UserAttributes(ctx, user.ID)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to get user attributes", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, key := range tmpl.Attributes {
+			if v, ok := attrs[key]; ok {
+				claims[key] = v
+			}
+		}
+	}
+
+	return claims, nil
+}
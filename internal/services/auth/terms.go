@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+// ErrTermsVersionMismatch is returned when the accepted version of the terms of service is not the current one.
+var ErrTermsVersionMismatch = errors.New("terms version mismatch")
+
+// TermsStorage keeps the acceptances of versions of the terms of service.
+type TermsStorage interface {
+	AcceptTerms(ctx context.Context, acceptance models.TermsAcceptance) error
+	TermsAcceptance(ctx context.Context, userID int64, version string) (models.TermsAcceptance, error)
+}
+
+// termsPending returns the current version of the terms of service if the user has not accepted it,
+// empty otherwise or when no version is configured. Failures are logged and do not fail the login.
+func (a *Auth) termsPending(ctx context.Context, user models.User, log *slog.Logger) string {
+	if a.termsVersion == "" {
+		return ""
+	}
+
+	_, err := a.terms.TermsAcceptance(ctx, user.ID, a.termsVersion)
+	if err == nil {
+		return ""
+	}
+
+	if !errors.Is(err, storage.ErrTermsNotAccepted) {
+		log.ErrorContext(ctx, "failed to get terms acceptance", sl.Err(err))
+		return ""
+	}
+
+	log.InfoContext(ctx, "terms acceptance required", slog.String("terms_version", a.termsVersion))
+
+	return a.termsVersion
+}
+
+// AcceptTerms records that the token's user accepted the version of the terms of service.
+// Only the current version can be accepted: a client showing stale terms gets ErrTermsVersionMismatch.
+func (a *Auth) AcceptTerms(ctx context.Context, token string, appCode string, version string) error {
+	const op = "Auth.AcceptTerms"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.String("version", version),
+	)
+
+	if a.termsVersion == "" || version != a.termsVersion {
+		log.WarnContext(ctx, "not the current terms version", slog.String("current", a.termsVersion))
+		return fmt.Errorf("%s: %w", op, ErrTermsVersionMismatch)
+	}
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	err = a.terms.AcceptTerms(ctx, models.TermsAcceptance{
+		UserID:     user.ID,
+		Version:    version,
+		AcceptedAt: time.Now(),
+	})
+	if err != nil {
+		log.ErrorContext(ctx, "failed to accept terms", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "terms accepted", slog.Int64("user_id", user.ID))
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/reqctx"
+	"sso/internal/storage"
+	"time"
+)
+
+var ErrDeviceNotFound = errors.New("device not found")
+
+// deviceTokenBytes is the length of random device tokens.
+const deviceTokenBytes = 32
+
+// deviceTrusted reports whether the request carries the device token of a remembered device of the user.
+func (a *Auth) deviceTrusted(ctx context.Context, user models.User, log *slog.Logger) bool {
+	token := reqctx.FromContext(ctx).DeviceToken
+	if token == "" || a.devices == nil || a.tokenOpts.DeviceTrustTTL <= 0 {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	device, err := a.devices.TrustedUserDevice(ctx, hash[:])
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceNotFound) {
+			log.WarnContext(ctx, "unknown device token")
+		} else {
+			log.ErrorContext(ctx, "failed to get trusted device", sl.Err(err))
+		}
+		return false
+	}
+
+	// Токен чужого устройства не даёт доверия
+	if device.UserID != user.ID || !device.Trusted(time.Now()) {
+		log.WarnContext(ctx, "device token is expired or belongs to another user", slog.Int64("device_id", device.ID))
+		return false
+	}
+
+	return true
+}
+
+// trustDevice remembers the device of a completed login and returns its new device token,
+// empty if remembering is disabled or failed. Failures don't fail the login.
+func (a *Auth) trustDevice(ctx context.Context, user models.User, log *slog.Logger) string {
+	if a.devices == nil || a.tokenOpts.DeviceTrustTTL <= 0 {
+		return ""
+	}
+
+	b := make([]byte, deviceTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		log.ErrorContext(ctx, "failed to generate device token", sl.Err(err))
+		return ""
+	}
+	token := hex.EncodeToString(b)
+
+	hash := sha256.Sum256([]byte(token))
+	fingerprint := reqctx.FromContext(ctx).Device().Fingerprint()
+	until := time.Now().Add(a.tokenOpts.DeviceTrustTTL)
+
+	if err := a.devices.TrustUserDevice(ctx, user.ID, fingerprint, hash[:], until); err != nil {
+		log.ErrorContext(ctx, "failed to trust device", sl.Err(err))
+		return ""
+	}
+
+	log.InfoContext(ctx, "device remembered", slog.Time("trusted_until", until))
+
+	return token
+}
+
+// ListDevices returns the devices the token's user has logged in from, most recently seen first.
+// Remembered devices have TrustedUntil set.
+func (a *Auth) ListDevices(ctx context.Context, token string, appCode string) ([]models.UserDevice, error) {
+	const op = "Auth.ListDevices"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := a.devices.UserDevices(ctx, user.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get user devices", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return devices, nil
+}
+
+// RevokeDevice forgets a device of the token's user: its device token stops skipping second factors
+// and the next login from it is a login from a new device.
+func (a *Auth) RevokeDevice(ctx context.Context, token string, appCode string, deviceID int64) error {
+	const op = "Auth.RevokeDevice"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+		slog.Int64("device_id", deviceID),
+	)
+
+	user, _, _, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return err
+	}
+
+	if err := a.devices.DeleteUserDevice(ctx, user.ID, deviceID); err != nil {
+		if errors.Is(err, storage.ErrDeviceNotFound) {
+			log.WarnContext(ctx, "device not found")
+			return fmt.Errorf("%s: %w", op, ErrDeviceNotFound)
+		}
+
+		log.ErrorContext(ctx, "failed to delete user device", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.InfoContext(ctx, "device revoked", slog.Int64("user_id", user.ID))
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// rolesClaim is a list of role names.
+	rolesClaim = "roles"
+	// scopeClaim is a space-separated list of scopes, as in OAuth 2.0.
+	scopeClaim = "scope"
+)
+
+// Identity is everything a token resolves to, see Whoami.
+type Identity struct {
+	UserID int64
+	Email  string
+	// Username and Phone are empty if not set.
+	Username string
+	Phone    string
+	// Roles and Scopes come from the roles and scope claims of the token, empty without them.
+	Roles     []string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+// Whoami validates the token like ValidateToken and returns the full identity of its user,
+// so clients don't need a separate call for the profile and the claims.
+func (a *Auth) Whoami(ctx context.Context, token string, appCode string) (Identity, error) {
+	const op = "Auth.Whoami"
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	user, app, claims, err := a.validateToken(ctx, token, appCode, log, op)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	extra, err := a.extraClaims(ctx, app, claims, log, op)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Username:  user.Username,
+		Phone:     user.Phone,
+		Roles:     stringList(extra[rolesClaim]),
+		Scopes:    strings.Fields(stringValue(extra[scopeClaim])),
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+// stringList returns the string elements of a claim decoded from JSON, ignoring the others.
+func stringList(v any) []string {
+	items, _ := v.([]any)
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
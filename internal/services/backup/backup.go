@@ -0,0 +1,127 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sso/internal/lib/logger/sl"
+	"strings"
+	"time"
+)
+
+const (
+	filePrefix = "sso-"
+	fileSuffix = ".db"
+	// timeLayout sorts lexicographically in time order, so snapshots are pruned by name.
+	timeLayout = "20060102T150405Z"
+)
+
+// Snapshotter writes a consistent copy of the database to a new file.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// Backup writes timestamped database snapshots to a directory and keeps the latest of them.
+type Backup struct {
+	log     *slog.Logger
+	storage Snapshotter
+	dir     string
+	keep    int
+}
+
+// New creates the backup service, keep <= 0 keeps all snapshots.
+func New(log *slog.Logger, storage Snapshotter, dir string, keep int) *Backup {
+	return &Backup{
+		log:     log,
+		storage: storage,
+		dir:     dir,
+		keep:    keep,
+	}
+}
+
+// Create writes a snapshot named sso-<UTC time>.db and removes the oldest snapshots beyond keep.
+// It returns the path of the snapshot.
+func (b *Backup) Create(ctx context.Context) (string, error) {
+	const op = "Backup.Create"
+
+	log := b.log.With(slog.String("op", op), slog.String("dir", b.dir))
+
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		log.Error("failed to create backup directory", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	path := filepath.Join(b.dir, filePrefix+time.Now().UTC().Format(timeLayout)+fileSuffix)
+
+	// Недописанный снимок не должен выглядеть готовым: пишем во временный файл и переименовываем
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+
+	if err := b.storage.Snapshot(ctx, tmp); err != nil {
+		_ = os.Remove(tmp)
+		log.Error("failed to snapshot database", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		log.Error("failed to save snapshot", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("database backed up", slog.String("path", path))
+
+	if err := b.prune(); err != nil {
+		// Снимок уже записан, старые удалятся при следующем запуске
+		log.Error("failed to remove old snapshots", sl.Err(err))
+	}
+
+	return path, nil
+}
+
+// Snapshots returns the paths of the snapshots in the directory, the oldest first.
+func (b *Backup) Snapshots() ([]string, error) {
+	const op = "Backup.Snapshots"
+
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			paths = append(paths, filepath.Join(b.dir, name))
+		}
+	}
+	slices.Sort(paths)
+
+	return paths, nil
+}
+
+func (b *Backup) prune() error {
+	if b.keep <= 0 {
+		return nil
+	}
+
+	paths, err := b.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	for len(paths) > b.keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats, the same as the import accepts.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Encoder writes records of the selected fields.
+type Encoder interface {
+	Encode(rec Record) error
+	// Flush writes buffered records.
+	Flush() error
+}
+
+// NewEncoder returns the encoder of the format writing the fields in order.
+// CSV starts with a header, lists are joined with ";", times are RFC 3339; JSONL has an object per line.
+func NewEncoder(format string, w io.Writer, fields []string) (Encoder, error) {
+	const op = "exporter.NewEncoder"
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(fields); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return &csvEncoder{w: cw, fields: fields}, nil
+	case FormatJSONL:
+		return &jsonlEncoder{enc: json.NewEncoder(w), fields: fields}, nil
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrUnknownFormat, format)
+	}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	fields []string
+}
+
+func (e *csvEncoder) Encode(rec Record) error {
+	values := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		switch v := rec[field].(type) {
+		case string:
+			values[i] = v
+		case int64:
+			values[i] = strconv.FormatInt(v, 10)
+		case bool:
+			values[i] = strconv.FormatBool(v)
+		case time.Time:
+			if !v.IsZero() {
+				values[i] = v.UTC().Format(time.RFC3339)
+			}
+		case []string:
+			values[i] = strings.Join(v, ";")
+		}
+	}
+
+	return e.w.Write(values)
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlEncoder struct {
+	enc    *json.Encoder
+	fields []string
+}
+
+func (e *jsonlEncoder) Encode(rec Record) error {
+	// Порядок полей в объекте — как в выборке
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, field := range e.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(field)
+		value := rec[field]
+		if t, ok := value.(time.Time); ok && t.IsZero() {
+			value = nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(data)
+	}
+	b.WriteByte('}')
+
+	return e.enc.Encode(json.RawMessage(b.String()))
+}
+
+func (e *jsonlEncoder) Flush() error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// Fields of exported users.
+const (
+	FieldID       = "id"
+	FieldEmail    = "email"
+	FieldUsername = "username"
+	FieldPhone    = "phone"
+	// FieldPassHash and FieldPepperID are exported only on request: the hash is a credential.
+	FieldPassHash  = "pass_hash"
+	FieldPepperID  = "pepper_id"
+	FieldBlocked   = "blocked"
+	FieldCreatedAt = "created_at"
+	// FieldApps lists the codes of the apps the user has access to, FieldDisabledApps those with access revoked.
+	FieldApps         = "apps"
+	FieldDisabledApps = "disabled_apps"
+)
+
+// Fields are all exportable fields in their default order.
+var Fields = []string{
+	FieldID, FieldEmail, FieldUsername, FieldPhone, FieldPassHash, FieldPepperID,
+	FieldBlocked, FieldCreatedAt, FieldApps, FieldDisabledApps,
+}
+
+// DefaultFields are exported when no fields are selected.
+var DefaultFields = []string{FieldEmail, FieldUsername, FieldPhone, FieldBlocked, FieldCreatedAt, FieldApps, FieldDisabledApps}
+
+var ErrUnknownField = errors.New("unknown export field")
+
+// Record is an exported user by field.
+type Record map[string]any
+
+type UserLister interface {
+	ListUsers(ctx context.Context, filter storage.UserFilter, opts storage.ListOptions) ([]models.User, string, error)
+	AppGrants(ctx context.Context, userIDs []int64) ([]models.AppGrant, error)
+}
+
+// Exporter writes users with their app grants page by page, without loading all of them into memory.
+type Exporter struct {
+	log   *slog.Logger
+	users UserLister
+}
+
+func New(log *slog.Logger, users UserLister) *Exporter {
+	return &Exporter{
+		log:   log,
+		users: users,
+	}
+}
+
+// CheckFields returns ErrUnknownField if any of the fields can't be exported.
+func CheckFields(fields []string) error {
+	for _, field := range fields {
+		if !slices.Contains(Fields, field) {
+			return fmt.Errorf("%w: %q", ErrUnknownField, field)
+		}
+	}
+
+	return nil
+}
+
+// Export writes the users matching the filter in the order of their ids and returns their number.
+// Deleted users are not exported.
+func (e *Exporter) Export(ctx context.Context, enc Encoder, filter storage.UserFilter) (int, error) {
+	const op = "Exporter.Export"
+
+	log := e.log.With(slog.String("op", op))
+
+	exported := 0
+	opts := storage.ListOptions{Limit: storage.MaxListLimit}
+	for {
+		users, next, err := e.users.ListUsers(ctx, filter, opts)
+		if err != nil {
+			log.Error("failed to list users", sl.Err(err))
+			return exported, fmt.Errorf("%s: %w", op, err)
+		}
+
+		ids := make([]int64, len(users))
+		for i, user := range users {
+			ids[i] = user.ID
+		}
+
+		grants, err := e.users.AppGrants(ctx, ids)
+		if err != nil {
+			log.Error("failed to get app grants", sl.Err(err))
+			return exported, fmt.Errorf("%s: %w", op, err)
+		}
+
+		byUser := make(map[int64][]models.AppGrant, len(users))
+		for _, g := range grants {
+			byUser[g.UserID] = append(byUser[g.UserID], g)
+		}
+
+		for _, user := range users {
+			if err := enc.Encode(record(user, byUser[user.ID])); err != nil {
+				log.Error("failed to write user", sl.Err(err))
+				return exported, fmt.Errorf("%s: %w", op, err)
+			}
+			exported++
+		}
+
+		if next == "" {
+			break
+		}
+		opts.Cursor = next
+	}
+
+	if err := enc.Flush(); err != nil {
+		log.Error("failed to write users", sl.Err(err))
+		return exported, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("users exported", slog.Int("count", exported))
+
+	return exported, nil
+}
+
+func record(user models.User, grants []models.AppGrant) Record {
+	apps := []string{}
+	disabled := []string{}
+	for _, g := range grants {
+		if g.IsEnabled {
+			apps = append(apps, g.AppCode)
+		} else {
+			disabled = append(disabled, g.AppCode)
+		}
+	}
+
+	return Record{
+		FieldID:           user.ID,
+		FieldEmail:        user.Email,
+		FieldUsername:     user.Username,
+		FieldPhone:        user.Phone,
+		FieldPassHash:     string(user.PassHash),
+		FieldPepperID:     user.PepperID,
+		FieldBlocked:      user.Blocked,
+		FieldCreatedAt:    user.CreatedAt,
+		FieldApps:         apps,
+		FieldDisabledApps: disabled,
+	}
+}
@@ -0,0 +1,172 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Input formats.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// maxLineSize bounds a JSONL line.
+const maxLineSize = 1 << 20
+
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Row is a user to import. Exactly one of Password and PassHash is set:
+// a plaintext password is hashed like on registration, a bcrypt hash is stored as is.
+type Row struct {
+	// Line is the line of the row in the input, starting with 1, for error reports.
+	Line     int    `json:"-"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	PassHash string `json:"pass_hash"`
+	// PepperID is the pepper of PassHash, e.g. in an export of this service.
+	PepperID string `json:"pepper_id"`
+}
+
+// Decoder reads rows from the input. Next returns io.EOF after the last row;
+// a *RowError for a malformed row, after which reading continues.
+type Decoder interface {
+	Next() (Row, error)
+}
+
+// FormatOf returns the format of the file by its extension, empty if unknown.
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	default:
+		return ""
+	}
+}
+
+// NewDecoder returns the decoder of the format.
+// CSV needs a header with the email column and the password or pass_hash column, other columns are ignored.
+// JSONL has an object per line with the email and the password or pass_hash fields.
+func NewDecoder(format string, r io.Reader) (Decoder, error) {
+	const op = "importer.NewDecoder"
+
+	switch format {
+	case FormatCSV:
+		d, err := newCSVDecoder(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return d, nil
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		return &jsonlDecoder{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrUnknownFormat, format)
+	}
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("header has no email column")
+	}
+	_, hasPassword := columns["password"]
+	_, hasHash := columns["pass_hash"]
+	if !hasPassword && !hasHash {
+		return nil, errors.New("header has neither password nor pass_hash column")
+	}
+
+	return &csvDecoder{r: cr, columns: columns}, nil
+}
+
+func (d *csvDecoder) Next() (Row, error) {
+	record, err := d.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return Row{}, io.EOF
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Row{}, &RowError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+
+		return Row{}, err
+	}
+
+	line, _ := d.r.FieldPos(0)
+
+	field := func(name string) string {
+		i, ok := d.columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	return Row{
+		Line:     line,
+		Email:    field("email"),
+		Password: field("password"),
+		PassHash: strings.TrimSpace(field("pass_hash")),
+		PepperID: strings.TrimSpace(field("pepper_id")),
+	}, nil
+}
+
+type jsonlDecoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (d *jsonlDecoder) Next() (Row, error) {
+	for d.scanner.Scan() {
+		d.line++
+
+		data := d.scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		var row Row
+		if err := json.Unmarshal(data, &row); err != nil {
+			return Row{}, &RowError{Line: d.line, Err: err}
+		}
+		row.Line = d.line
+
+		return row, nil
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return Row{}, err
+	}
+
+	return Row{}, io.EOF
+}
@@ -0,0 +1,222 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sso/internal/domain/models"
+	"sso/internal/lib/email"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/validate"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordMinLen is the minimal length of plaintext passwords, as on registration.
+const passwordMinLen = 8
+
+var (
+	ErrNoPassword        = errors.New("either password or pass_hash is required")
+	ErrBothPasswords     = errors.New("password and pass_hash are mutually exclusive")
+	ErrPasswordTooShort  = fmt.Errorf("password is shorter than %d characters", passwordMinLen)
+	ErrInvalidHash       = errors.New("pass_hash is not a bcrypt hash")
+	ErrPepperWithoutHash = errors.New("pepper_id is set without pass_hash")
+)
+
+// RowError is the reason a row was not imported.
+type RowError struct {
+	Line  int
+	Email string
+	Err   error
+}
+
+func (e *RowError) Error() string {
+	if e.Email == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d (%s): %v", e.Line, e.Email, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Report is the outcome of an import.
+type Report struct {
+	Imported int
+	Failed   []*RowError
+}
+
+// PasswordHasher hashes a plaintext password like registration does and returns the id of its pepper.
+type PasswordHasher interface {
+	HashPassword(ctx context.Context, password string) ([]byte, string, error)
+}
+
+// UserSaver inserts a batch of users, see sqlite.Storage.SaveUsers.
+type UserSaver interface {
+	SaveUsers(ctx context.Context, users []models.User) ([]error, error)
+}
+
+// Importer creates users from a file in batches, each batch in one transaction.
+type Importer struct {
+	log         *slog.Logger
+	hasher      PasswordHasher
+	users       UserSaver
+	emails      email.Normalizer
+	batch       int
+	parallelism int
+}
+
+// New creates the importer. Plaintext passwords of a batch are hashed by parallelism goroutines.
+func New(log *slog.Logger, hasher PasswordHasher, users UserSaver, emails email.Normalizer, batch int, parallelism int) *Importer {
+	return &Importer{
+		log:         log,
+		hasher:      hasher,
+		users:       users,
+		emails:      emails,
+		batch:       max(batch, 1),
+		parallelism: max(parallelism, 1),
+	}
+}
+
+// Import reads all rows of the decoder and saves the valid ones. Invalid rows and rows with taken emails
+// are reported and skipped. An error is returned only if reading or a batch transaction fails;
+// the batches saved before it stay.
+func (i *Importer) Import(ctx context.Context, dec Decoder) (Report, error) {
+	const op = "Importer.Import"
+
+	log := i.log.With(slog.String("op", op))
+
+	var report Report
+	batch := make([]Row, 0, i.batch)
+
+	for {
+		row, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var rowErr *RowError
+			if errors.As(err, &rowErr) {
+				report.Failed = append(report.Failed, rowErr)
+				continue
+			}
+
+			log.Error("failed to read input", sl.Err(err))
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		row.Email = i.emails.Normalize(row.Email)
+		if err := validateRow(row); err != nil {
+			report.Failed = append(report.Failed, &RowError{Line: row.Line, Email: row.Email, Err: err})
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) < i.batch {
+			continue
+		}
+
+		if err := i.save(ctx, batch, &report); err != nil {
+			log.Error("failed to import batch", sl.Err(err))
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+		batch = batch[:0]
+	}
+
+	if len(batch) > 0 {
+		if err := i.save(ctx, batch, &report); err != nil {
+			log.Error("failed to import batch", sl.Err(err))
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// Строки с ошибками хэширования и сохранения добавлены в отчёт позже ошибок чтения
+	slices.SortStableFunc(report.Failed, func(a, b *RowError) int { return a.Line - b.Line })
+
+	log.Info("users imported", slog.Int("imported", report.Imported), slog.Int("failed", len(report.Failed)))
+
+	return report, nil
+}
+
+func validateRow(row Row) error {
+	if err := validate.Email(row.Email); err != nil {
+		return err
+	}
+
+	switch {
+	case row.Password == "" && row.PassHash == "":
+		return ErrNoPassword
+	case row.Password != "" && row.PassHash != "":
+		return ErrBothPasswords
+	case row.PepperID != "" && row.PassHash == "":
+		return ErrPepperWithoutHash
+	case row.PassHash != "":
+		if _, err := bcrypt.Cost([]byte(row.PassHash)); err != nil {
+			return ErrInvalidHash
+		}
+	case len([]rune(row.Password)) < passwordMinLen:
+		return ErrPasswordTooShort
+	}
+
+	return nil
+}
+
+// save hashes the plaintext passwords of the batch and inserts its users.
+func (i *Importer) save(ctx context.Context, batch []Row, report *Report) error {
+	users := make([]models.User, len(batch))
+	hashErrs := make([]error, len(batch))
+
+	// bcrypt намеренно медленный: пароли пачки хэшируются параллельно
+	sem := make(chan struct{}, i.parallelism)
+	var wg sync.WaitGroup
+	for n, row := range batch {
+		users[n] = models.User{Email: row.Email, PassHash: []byte(row.PassHash), PepperID: row.PepperID}
+		if row.Password == "" {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			users[n].PassHash, users[n].PepperID, hashErrs[n] = i.hasher.HashPassword(ctx, row.Password)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	valid := make([]models.User, 0, len(users))
+	rows := make([]Row, 0, len(users))
+	for n, err := range hashErrs {
+		if err != nil {
+			report.Failed = append(report.Failed, &RowError{Line: batch[n].Line, Email: batch[n].Email, Err: err})
+			continue
+		}
+		valid = append(valid, users[n])
+		rows = append(rows, batch[n])
+	}
+
+	errs, err := i.users.SaveUsers(ctx, valid)
+	if err != nil {
+		return err
+	}
+
+	for n, err := range errs {
+		if err == nil {
+			report.Imported++
+			continue
+		}
+		report.Failed = append(report.Failed, &RowError{Line: rows[n].Line, Email: rows[n].Email, Err: err})
+	}
+
+	return nil
+}
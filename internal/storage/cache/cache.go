@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"sso/internal/domain/models"
+	"sso/internal/lib/identifier"
+	"sync"
+	"time"
+)
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
+	UserByIdentifier(ctx context.Context, id identifier.Identifier) (models.User, error)
+}
+
+type UserAppProvider interface {
+	UserApp(ctx context.Context, userID int64, appID int32) (models.UserApp, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appCode string) (models.App, error)
+}
+
+// Options sets the TTLs of the cached lookups, a zero TTL passes the lookups through.
+type Options struct {
+	// TTL of users by ID and user_app rows.
+	TTL time.Duration
+	// AppTTL of apps by code.
+	AppTTL time.Duration
+	// MaxEntries bounds each map, expired entries are swept when it is reached.
+	MaxEntries int
+}
+
+type entry[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+type userAppKey struct {
+	userID int64
+	appID  int32
+}
+
+// Storage caches the lookups of the token validation path, users by ID, user_app rows and apps by code,
+// for a short TTL. Changes made by other instances or bypassing the cache become visible within the TTL.
+// Errors are not cached, lookups by email and other login identifiers are passed through.
+type Storage struct {
+	users      UserProvider
+	userApps   UserAppProvider
+	apps       AppProvider
+	ttl        time.Duration
+	appTTL     time.Duration
+	maxEntries int
+
+	mu          sync.Mutex
+	usersByID   map[int64]entry[models.User]
+	userAppsMap map[userAppKey]entry[models.UserApp]
+	appsByCode  map[string]entry[models.App]
+	// usersGen and appsGen change with every invalidation of users and apps, so a load started
+	// before it is not cached.
+	usersGen uint64
+	appsGen  uint64
+
+	// Одновременные промахи по одному приложению идут в хранилище одним запросом
+	appLoads flight[string, models.App]
+}
+
+func New(users UserProvider, userApps UserAppProvider, apps AppProvider, opts Options) *Storage {
+	return &Storage{
+		users:       users,
+		userApps:    userApps,
+		apps:        apps,
+		ttl:         opts.TTL,
+		appTTL:      opts.AppTTL,
+		maxEntries:  opts.MaxEntries,
+		usersByID:   make(map[int64]entry[models.User]),
+		userAppsMap: make(map[userAppKey]entry[models.UserApp]),
+		appsByCode:  make(map[string]entry[models.App]),
+	}
+}
+
+func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
+	return s.users.User(ctx, email)
+}
+
+func (s *Storage) UserByIdentifier(ctx context.Context, id identifier.Identifier) (models.User, error) {
+	return s.users.UserByIdentifier(ctx, id)
+}
+
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	if s.ttl <= 0 {
+		return s.users.UserByID(ctx, userID)
+	}
+
+	if user, ok := get(s, s.usersByID, userID); ok {
+		return user, nil
+	}
+
+	gen := s.generation(&s.usersGen)
+
+	user, err := s.users.UserByID(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Пользователь, заблокированный во время запроса, не попадает в кэш прежним
+	put(s, s.usersByID, userID, user, s.ttl, &s.usersGen, gen)
+
+	return user, nil
+}
+
+func (s *Storage) UserApp(ctx context.Context, userID int64, appID int32) (models.UserApp, error) {
+	if s.ttl <= 0 {
+		return s.userApps.UserApp(ctx, userID, appID)
+	}
+
+	key := userAppKey{userID: userID, appID: appID}
+
+	if userApp, ok := get(s, s.userAppsMap, key); ok {
+		return userApp, nil
+	}
+
+	gen := s.generation(&s.usersGen)
+
+	userApp, err := s.userApps.UserApp(ctx, userID, appID)
+	if err != nil {
+		return models.UserApp{}, err
+	}
+
+	put(s, s.userAppsMap, key, userApp, s.ttl, &s.usersGen, gen)
+
+	return userApp, nil
+}
+
+// App returns the app by code. Concurrent misses for the same code share one storage lookup,
+// which is not canceled with the context of the caller that started it.
+func (s *Storage) App(ctx context.Context, appCode string) (models.App, error) {
+	if s.appTTL <= 0 {
+		return s.apps.App(ctx, appCode)
+	}
+
+	if app, ok := get(s, s.appsByCode, appCode); ok {
+		return app, nil
+	}
+
+	return s.appLoads.do(ctx, appCode, func(ctx context.Context) (models.App, error) {
+		gen := s.generation(&s.appsGen)
+
+		app, err := s.apps.App(ctx, appCode)
+		if err != nil {
+			return models.App{}, err
+		}
+
+		put(s, s.appsByCode, appCode, app, s.appTTL, &s.appsGen, gen)
+
+		return app, nil
+	})
+}
+
+// generation returns the current value of the invalidation counter gen.
+func (s *Storage) generation(gen *uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *gen
+}
+
+func get[K comparable, V any](s *Storage, m map[K]entry[V], key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := m[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+// put caches the value loaded when the counter gen was loadedGen, unless an invalidation changed it since.
+func put[K comparable, V any](
+	s *Storage, m map[K]entry[V], key K, value V, ttl time.Duration, gen *uint64, loadedGen uint64,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if *gen != loadedGen {
+		return
+	}
+
+	now := time.Now()
+
+	if len(m) >= s.maxEntries {
+		for k, e := range m {
+			if now.After(e.expiresAt) {
+				delete(m, k)
+			}
+		}
+
+		// Все записи ещё живы: кэш не растёт, запрос просто идёт в хранилище
+		if len(m) >= s.maxEntries {
+			return
+		}
+	}
+
+	m[key] = entry[V]{value: value, expiresAt: now.Add(ttl)}
+}
@@ -0,0 +1,196 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sso/internal/domain/models"
+	"sso/internal/lib/identifier"
+	"sso/internal/storage/cache"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// slowApps returns apps once release is closed and counts the lookups.
+type slowApps struct {
+	release chan struct{}
+	calls   atomic.Int32
+	err     error
+}
+
+func (s *slowApps) App(_ context.Context, appCode string) (models.App, error) {
+	s.calls.Add(1)
+	<-s.release
+
+	if s.err != nil {
+		return models.App{}, s.err
+	}
+
+	return models.App{ID: 1, Code: appCode}, nil
+}
+
+func newCache(apps cache.AppProvider, ttl time.Duration) *cache.Storage {
+	return cache.New(nil, nil, apps, cache.Options{AppTTL: ttl, MaxEntries: 100})
+}
+
+func TestApp_ConcurrentMisses(t *testing.T) {
+	apps := &slowApps{release: make(chan struct{})}
+	c := newCache(apps, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			app, err := c.App(context.Background(), "web")
+			require.NoError(t, err)
+			require.Equal(t, "web", app.Code)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(apps.release)
+	wg.Wait()
+
+	require.EqualValues(t, 1, apps.calls.Load())
+
+	_, err := c.App(context.Background(), "web")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, apps.calls.Load())
+}
+
+func TestApp_CanceledCaller(t *testing.T) {
+	apps := &slowApps{release: make(chan struct{})}
+	c := newCache(apps, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.App(ctx, "web")
+		errc <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-errc, context.Canceled)
+
+	// Запрос, начатый отменённым вызовом, продолжается для остальных
+	close(apps.release)
+	app, err := c.App(context.Background(), "web")
+	require.NoError(t, err)
+	require.Equal(t, "web", app.Code)
+	require.EqualValues(t, 1, apps.calls.Load())
+}
+
+func TestApp_ErrorNotCached(t *testing.T) {
+	apps := &slowApps{release: make(chan struct{}), err: errors.New("boom")}
+	close(apps.release)
+	c := newCache(apps, time.Minute)
+
+	for range 2 {
+		_, err := c.App(context.Background(), "web")
+		require.ErrorIs(t, err, apps.err)
+	}
+	require.EqualValues(t, 2, apps.calls.Load())
+}
+
+func TestApp_TTLAndInvalidation(t *testing.T) {
+	apps := &slowApps{release: make(chan struct{})}
+	close(apps.release)
+	c := newCache(apps, 30*time.Millisecond)
+	ctx := context.Background()
+
+	_, err := c.App(ctx, "web")
+	require.NoError(t, err)
+	_, err = c.App(ctx, "web")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, apps.calls.Load())
+
+	c.Invalidate(cache.Invalidation{Kind: cache.KindApp, Key: "web"})
+	_, err = c.App(ctx, "web")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, apps.calls.Load())
+
+	time.Sleep(40 * time.Millisecond)
+	_, err = c.App(ctx, "web")
+	require.NoError(t, err)
+	require.EqualValues(t, 3, apps.calls.Load())
+}
+
+func TestApp_Disabled(t *testing.T) {
+	apps := &slowApps{release: make(chan struct{})}
+	close(apps.release)
+	c := newCache(apps, 0)
+
+	for range 2 {
+		_, err := c.App(context.Background(), "web")
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 2, apps.calls.Load())
+}
+
+// slowUsers reads the user when called and returns it once release is closed, like a query
+// that sees the row before a concurrent update.
+type slowUsers struct {
+	mu      sync.Mutex
+	user    models.User
+	release chan struct{}
+	started chan struct{}
+}
+
+func (s *slowUsers) User(context.Context, string) (models.User, error) {
+	panic("not used")
+}
+
+func (s *slowUsers) UserByIdentifier(context.Context, identifier.Identifier) (models.User, error) {
+	panic("not used")
+}
+
+func (s *slowUsers) UserByID(context.Context, int64) (models.User, error) {
+	s.mu.Lock()
+	user := s.user
+	s.mu.Unlock()
+
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+
+	return user, nil
+}
+
+func TestUserByID_InvalidatedWhileLoading(t *testing.T) {
+	users := &slowUsers{
+		user:    models.User{ID: 1, Email: "user@example.com"},
+		release: make(chan struct{}),
+		started: make(chan struct{}, 1),
+	}
+	c := cache.New(users, nil, nil, cache.Options{TTL: time.Minute, MaxEntries: 100})
+	ctx := context.Background()
+
+	loaded := make(chan models.User, 1)
+	go func() {
+		user, err := c.UserByID(ctx, 1)
+		require.NoError(t, err)
+		loaded <- user
+	}()
+	<-users.started
+
+	// Пользователя блокируют, пока идёт запрос: устаревшая строка не должна попасть в кэш
+	users.mu.Lock()
+	users.user.Blocked = true
+	users.mu.Unlock()
+	c.Invalidate(cache.Invalidation{Kind: cache.KindUser, Key: "user@example.com", UserID: 1})
+
+	close(users.release)
+	require.False(t, (<-loaded).Blocked)
+
+	user, err := c.UserByID(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, user.Blocked)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"sync"
+)
+
+// flight deduplicates concurrent loads of the same key, like golang.org/x/sync/singleflight:
+// the first miss starts the load and every caller for the key waits for its result.
+// The load runs detached from the callers' cancellation, so one canceled caller doesn't fail the others;
+// each caller still stops waiting when its own context is done.
+type flight[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*flightCall[V]
+}
+
+type flightCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+func (f *flight[K, V]) do(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[K]*flightCall[V])
+	}
+
+	c, ok := f.calls[key]
+	if !ok {
+		c = &flightCall[V]{done: make(chan struct{})}
+		f.calls[key] = c
+
+		go func() {
+			c.value, c.err = load(context.WithoutCancel(ctx))
+
+			f.mu.Lock()
+			delete(f.calls, key)
+			f.mu.Unlock()
+
+			close(c.done)
+		}()
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
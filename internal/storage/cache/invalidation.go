@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+)
+
+// Kinds of invalidated entries.
+const (
+	// KindUser invalidates a user by email and ID with all of its user_app rows.
+	KindUser = "user"
+	// KindApp invalidates an app by code.
+	KindApp = "app"
+	// KindAll drops the whole cache, e.g. when invalidations could have been missed.
+	KindAll = "all"
+)
+
+// Invalidation tells that the cached entries of a user or an app are stale.
+type Invalidation struct {
+	Kind string `json:"kind"`
+	// Key is the normalized email of a user or the code of an app.
+	Key string `json:"key"`
+	// UserID is set for users: their user_app rows are cached by ID and can outlive the user entry.
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+// Publisher delivers invalidations to all instances, including the publishing one.
+type Publisher interface {
+	PublishInvalidation(ctx context.Context, inv Invalidation) error
+}
+
+// Invalidator drops cache entries changed by this instance here and, through the publisher, on the others.
+// Without a publisher only the local cache is invalidated, other instances notice changes within the TTL.
+// Failures are logged and not returned: the change itself is already saved, and the TTL bounds staleness.
+type Invalidator struct {
+	log       *slog.Logger
+	local     *Storage
+	publisher Publisher
+}
+
+// NewInvalidator returns an invalidator, local is nil without the cache and publisher is nil without Redis.
+func NewInvalidator(log *slog.Logger, local *Storage, publisher Publisher) *Invalidator {
+	return &Invalidator{
+		log:       log,
+		local:     local,
+		publisher: publisher,
+	}
+}
+
+// InvalidateUser drops the user and its user_app rows.
+func (i *Invalidator) InvalidateUser(ctx context.Context, userID int64, email string) {
+	i.invalidate(ctx, Invalidation{Kind: KindUser, Key: email, UserID: userID})
+}
+
+// InvalidateApp drops the app with the code.
+func (i *Invalidator) InvalidateApp(ctx context.Context, appCode string) {
+	i.invalidate(ctx, Invalidation{Kind: KindApp, Key: appCode})
+}
+
+func (i *Invalidator) invalidate(ctx context.Context, inv Invalidation) {
+	const op = "cache.Invalidator.invalidate"
+
+	// Локально сразу: не зависит от доставки сообщения через Redis
+	i.local.Invalidate(inv)
+
+	if i.publisher == nil {
+		return
+	}
+
+	if err := i.publisher.PublishInvalidation(ctx, inv); err != nil {
+		i.log.With(slog.String("op", op)).ErrorContext(ctx, "failed to publish invalidation",
+			slog.String("kind", inv.Kind), slog.String("key", inv.Key), sl.Err(err))
+	}
+}
+
+// Invalidate drops the entries of inv from this instance, e.g. on an invalidation published by another one.
+func (s *Storage) Invalidate(inv Invalidation) {
+	if s == nil {
+		return
+	}
+
+	switch inv.Kind {
+	case KindUser:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		ids := map[int64]bool{inv.UserID: true}
+		for id, e := range s.usersByID {
+			if ids[id] || (inv.Key != "" && e.value.Email == inv.Key) {
+				ids[id] = true
+				delete(s.usersByID, id)
+			}
+		}
+
+		for key := range s.userAppsMap {
+			if ids[key.userID] {
+				delete(s.userAppsMap, key)
+			}
+		}
+		s.usersGen++
+	case KindApp:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.appsByCode, inv.Key)
+		s.appsGen++
+	case KindAll:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		clear(s.usersByID)
+		clear(s.userAppsMap)
+		clear(s.appsByCode)
+		s.usersGen++
+		s.appsGen++
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Sort orders of listings, each listing supports a subset of them.
+const (
+	SortID        = "id"
+	SortEmail     = "email"
+	SortCode      = "code"
+	SortCreatedAt = "created_at"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort order")
+)
+
+// ListOptions selects a page of a listing. Pages are addressed by a cursor, the sort key of the last row,
+// rather than by an offset, so rows added or deleted meanwhile don't shift the pages.
+type ListOptions struct {
+	// Limit is the page size, DefaultListLimit if 0, at most MaxListLimit.
+	Limit int
+	// Cursor is the next cursor returned with the previous page, empty for the first page.
+	// It is valid only with the same Sort and Desc.
+	Cursor string
+	// Sort is one of the Sort constants supported by the listing, SortID if empty.
+	Sort string
+	Desc bool
+}
+
+// PageLimit returns the page size to use.
+func (o ListOptions) PageLimit() int {
+	switch {
+	case o.Limit <= 0:
+		return DefaultListLimit
+	case o.Limit > MaxListLimit:
+		return MaxListLimit
+	default:
+		return o.Limit
+	}
+}
+
+// UserFilter narrows ListUsers, zero fields don't filter. Deleted users are never listed.
+type UserFilter struct {
+	EmailPrefix string
+	// CreatedFrom and CreatedTo bound the registration time as [from, to),
+	// users registered before it was recorded don't match them.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Enabled selects active (true) or blocked (false) users, nil selects both.
+	Enabled *bool
+}
+
+// AppFilter narrows ListApps, zero fields don't filter.
+type AppFilter struct {
+	CodePrefix string
+}
+
+// Cursor is the position after the last row of a page.
+type Cursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	// Value is the sort key of the row, empty when sorting by ID.
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// EncodeCursor returns the opaque form of the cursor passed to clients.
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor of a listing with the options, ErrInvalidCursor if it is malformed
+// or was returned for another sort order.
+func DecodeCursor(s string, opts ListOptions, sort string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	if c.Sort != sort || c.Desc != opts.Desc {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
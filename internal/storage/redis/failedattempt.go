@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const failedAttemptsPrefix = "failed_attempts:"
+
+// FailedAttempts returns the number of failed attempts counted for the key, 0 if none.
+func (s *Storage) FailedAttempts(ctx context.Context, key string) (int64, error) {
+	const op = "storage.redis.FailedAttempts"
+
+	n, err := s.client.Get(ctx, failedAttemptsPrefix+key).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+
+		s.log.With(slog.String("op", op)).Error("failed to get failed attempts", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n, nil
+}
+
+// AddFailedAttempt counts a failed attempt. The counter expires window after the last failure.
+func (s *Storage) AddFailedAttempt(ctx context.Context, key string, window time.Duration) error {
+	const op = "storage.redis.AddFailedAttempt"
+
+	pipe := s.client.TxPipeline()
+	pipe.Incr(ctx, failedAttemptsPrefix+key)
+	pipe.Expire(ctx, failedAttemptsPrefix+key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to add failed attempt", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ResetFailedAttempts(ctx context.Context, key string) error {
+	const op = "storage.redis.ResetFailedAttempts"
+
+	if err := s.client.Del(ctx, failedAttemptsPrefix+key).Err(); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to reset failed attempts", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReserveIdempotencyKey saves the record of the idempotency key unless the key exists,
+// otherwise returns the existing record and false.
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, key string, record models.IdempotencyRecord, ttl time.Duration) (models.IdempotencyRecord, bool, error) {
+	const op = "storage.redis.ReserveIdempotencyKey"
+
+	log := s.log.With(slog.String("op", op))
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Error("failed to encode idempotency record", sl.Err(err))
+		return models.IdempotencyRecord{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reserved, err := s.client.SetNX(ctx, key, data, ttl).Result()
+	if err != nil {
+		log.Error("failed to reserve idempotency key", sl.Err(err))
+		return models.IdempotencyRecord{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if reserved {
+		return record, true, nil
+	}
+
+	data, err = s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		// Ключ истёк или освобождён между SETNX и GET
+		if errors.Is(err, redis.Nil) {
+			return s.ReserveIdempotencyKey(ctx, key, record, ttl)
+		}
+
+		log.Error("failed to get idempotency record", sl.Err(err))
+		return models.IdempotencyRecord{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var existing models.IdempotencyRecord
+	if err := json.Unmarshal(data, &existing); err != nil {
+		log.Error("failed to decode idempotency record", sl.Err(err))
+		return models.IdempotencyRecord{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return existing, false, nil
+}
+
+func (s *Storage) SaveIdempotencyRecord(ctx context.Context, key string, record models.IdempotencyRecord, ttl time.Duration) error {
+	const op = "storage.redis.SaveIdempotencyRecord"
+
+	log := s.log.With(slog.String("op", op))
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Error("failed to encode idempotency record", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.client.Set(ctx, key, data, ttl).Err(); err != nil {
+		log.Error("failed to save idempotency record", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	const op = "storage.redis.ReleaseIdempotencyKey"
+
+	if err := s.client.Del(ctx, key).Err(); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to release idempotency key", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
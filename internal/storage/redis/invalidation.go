@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage/cache"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InvalidationChannel is the pub/sub channel of cache invalidations, after the key prefix.
+const InvalidationChannel = "invalidate"
+
+// Invalidations carries cache invalidations between instances over Redis pub/sub.
+// Pub/sub channels are not keys, so the key prefix is a part of channel.
+type Invalidations struct {
+	client  *redis.Client
+	channel string
+	log     *slog.Logger
+}
+
+func NewInvalidations(client *redis.Client, channel string, log *slog.Logger) *Invalidations {
+	return &Invalidations{
+		client:  client,
+		channel: channel,
+		log:     log,
+	}
+}
+
+func (i *Invalidations) PublishInvalidation(ctx context.Context, inv cache.Invalidation) error {
+	const op = "storage.redis.PublishInvalidation"
+
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := i.client.Publish(ctx, i.channel, data).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Subscribe passes the invalidations published by all instances to handle until ctx is done.
+// Messages published while the connection is lost are missed, so after each (re)subscription
+// handle gets a cache.KindAll invalidation.
+func (i *Invalidations) Subscribe(ctx context.Context, handle func(cache.Invalidation)) {
+	const op = "storage.redis.SubscribeInvalidations"
+
+	log := i.log.With(slog.String("op", op), slog.String("channel", i.channel))
+
+	pubsub := i.client.Subscribe(ctx, i.channel)
+	defer func() { _ = pubsub.Close() }()
+
+	// Переподключается и переподписывается сам, сообщая об этом *redis.Subscription
+	messages := pubsub.ChannelWithSubscriptions()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			switch msg := msg.(type) {
+			case *redis.Subscription:
+				log.Info("subscribed to invalidations")
+				handle(cache.Invalidation{Kind: cache.KindAll})
+			case *redis.Message:
+				var inv cache.Invalidation
+				if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+					log.Error("failed to decode invalidation", sl.Err(err))
+					continue
+				}
+				handle(inv)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const loginSessionPrefix = "login_session:"
+
+func (s *Storage) SaveLoginSession(ctx context.Context, session models.LoginSession) error {
+	const op = "storage.redis.SaveLoginSession"
+
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", session.UserID))
+
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		log.Warn("login session is already expired")
+		return fmt.Errorf("%s: %w", op, storage.ErrLoginSessionNotFound)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Error("failed to encode login session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.client.Set(ctx, loginSessionPrefix+session.ID, data, ttl).Err(); err != nil {
+		log.Error("failed to save login session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) LoginSession(ctx context.Context, id string) (models.LoginSession, error) {
+	const op = "storage.redis.LoginSession"
+
+	log := s.log.With(slog.String("op", op))
+
+	data, err := s.client.Get(ctx, loginSessionPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			log.Warn("login session not found")
+			return models.LoginSession{}, fmt.Errorf("%s: %w", op, storage.ErrLoginSessionNotFound)
+		}
+
+		log.Error("failed to get login session", sl.Err(err))
+		return models.LoginSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var session models.LoginSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		log.Error("failed to decode login session", sl.Err(err))
+		return models.LoginSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) DeleteLoginSession(ctx context.Context, id string) error {
+	const op = "storage.redis.DeleteLoginSession"
+
+	if err := s.client.Del(ctx, loginSessionPrefix+id).Err(); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to delete login session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeLoginSession returns the login session and deletes it in one step, so only one of concurrent callers gets it.
+func (s *Storage) TakeLoginSession(ctx context.Context, id string) (models.LoginSession, error) {
+	const op = "storage.redis.TakeLoginSession"
+
+	log := s.log.With(slog.String("op", op))
+
+	data, err := s.client.GetDel(ctx, loginSessionPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			log.Warn("login session not found")
+			return models.LoginSession{}, fmt.Errorf("%s: %w", op, storage.ErrLoginSessionNotFound)
+		}
+
+		log.Error("failed to take login session", sl.Err(err))
+		return models.LoginSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var session models.LoginSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		log.Error("failed to decode login session", sl.Err(err))
+		return models.LoginSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+// AddLoginStepAttempt counts an answer to the step of the login session and returns the number
+// of answers so far. The counter expires with the session.
+func (s *Storage) AddLoginStepAttempt(ctx context.Context, id string, step string, expiresAt time.Time) (int64, error) {
+	const op = "storage.redis.AddLoginStepAttempt"
+
+	key := loginSessionPrefix + id + ":attempts:" + step
+
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, expiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to add login step attempt", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return incr.Val(), nil
+}
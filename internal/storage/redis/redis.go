@@ -0,0 +1,20 @@
+package redis
+
+import (
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Storage keeps short-lived state shared between SSO instances.
+type Storage struct {
+	client redis.Cmdable
+	log    *slog.Logger
+}
+
+func New(client redis.Cmdable, log *slog.Logger) *Storage {
+	return &Storage{
+		client: client,
+		log:    log,
+	}
+}
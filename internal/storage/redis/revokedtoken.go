@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"time"
+)
+
+const revokedTokenPrefix = "revoked_token:"
+
+// RevokeToken marks the access token as revoked until it expires.
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.redis.RevokeToken"
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := s.client.Set(ctx, revokedTokenPrefix+jti, 1, ttl).Err(); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to revoke token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.redis.TokenRevoked"
+
+	n, err := s.client.Exists(ctx, revokedTokenPrefix+jti).Result()
+	if err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to check token", sl.Err(err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return n > 0, nil
+}
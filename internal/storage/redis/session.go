@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const sessionPrefix = "session:"
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.redis.SaveSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", session.UserID),
+		slog.Int("app_id", int(session.AppID)),
+	)
+
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		log.Warn("session is already expired")
+		return fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		log.Error("failed to encode session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.client.Set(ctx, sessionPrefix+session.ID, data, ttl).Err(); err != nil {
+		log.Error("failed to save session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, id string) (models.Session, error) {
+	const op = "storage.redis.Session"
+
+	log := s.log.With(slog.String("op", op))
+
+	data, err := s.client.Get(ctx, sessionPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			log.Warn("session not found")
+			return models.Session{}, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+
+		log.Error("failed to get session", sl.Err(err))
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var session models.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		log.Error("failed to decode session", sl.Err(err))
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id string) error {
+	const op = "storage.redis.DeleteSession"
+
+	if err := s.client.Del(ctx, sessionPrefix+id).Err(); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to delete session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
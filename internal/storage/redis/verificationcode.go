@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const verificationCodePrefix = "verification_code:"
+
+func (s *Storage) SaveVerificationCode(ctx context.Context, key string, code models.VerificationCode) error {
+	const op = "storage.redis.SaveVerificationCode"
+
+	log := s.log.With(slog.String("op", op))
+
+	ttl := time.Until(code.ExpiresAt)
+	if ttl <= 0 {
+		log.Warn("verification code is already expired")
+		return fmt.Errorf("%s: %w", op, storage.ErrCodeNotFound)
+	}
+
+	data, err := json.Marshal(code)
+	if err != nil {
+		log.Error("failed to encode verification code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.client.Set(ctx, verificationCodePrefix+key, data, ttl).Err(); err != nil {
+		log.Error("failed to save verification code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) VerificationCode(ctx context.Context, key string) (models.VerificationCode, error) {
+	const op = "storage.redis.VerificationCode"
+
+	log := s.log.With(slog.String("op", op))
+
+	data, err := s.client.Get(ctx, verificationCodePrefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			log.Warn("verification code not found")
+			return models.VerificationCode{}, fmt.Errorf("%s: %w", op, storage.ErrCodeNotFound)
+		}
+
+		log.Error("failed to get verification code", sl.Err(err))
+		return models.VerificationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var code models.VerificationCode
+	if err := json.Unmarshal(data, &code); err != nil {
+		log.Error("failed to decode verification code", sl.Err(err))
+		return models.VerificationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+func (s *Storage) DeleteVerificationCode(ctx context.Context, key string) error {
+	const op = "storage.redis.DeleteVerificationCode"
+
+	if err := s.client.Del(ctx, verificationCodePrefix+key).Err(); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to delete verification code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+const (
+	queryUserAttributes = "SELECT attributes FROM users WHERE id = ? AND deleted_at IS NULL"
+	// json_patch применяет RFC 7386 merge patch: null удаляет ключ, объекты сливаются рекурсивно
+	queryUserAttributesPatch = `UPDATE users SET attributes = json_patch(attributes, ?1)
+		WHERE id = ?2 AND deleted_at IS NULL AND length(json_patch(attributes, ?1)) <= ?3
+		RETURNING attributes`
+)
+
+// UserAttributes returns the custom attributes of the user.
+func (s *Storage) UserAttributes(ctx context.Context, userID int64) (map[string]json.RawMessage, error) {
+	const op = "storage.sqlite.UserAttributes"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	var raw string
+	err := s.stmts.queryRow(ctx, queryUserAttributes, []any{userID}, &raw)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("user not found")
+			return nil, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		log.Error("failed to get user attributes", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	attrs, err := decodeAttributes(raw)
+	if err != nil {
+		log.Error("failed to decode user attributes", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attrs, nil
+}
+
+// PatchUserAttributes merges patch into the attributes of the user, null values delete the keys,
+// and returns the result. Attributes that would exceed maxSize bytes of JSON are left intact.
+func (s *Storage) PatchUserAttributes(
+	ctx context.Context,
+	userID int64,
+	patch map[string]json.RawMessage,
+	maxSize int,
+) (map[string]json.RawMessage, error) {
+	const op = "storage.sqlite.PatchUserAttributes"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var raw string
+	err = s.stmts.queryRow(ctx, queryUserAttributesPatch, []any{string(b), userID, maxSize}, &raw)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Error("failed to patch user attributes", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Строка не обновлена: пользователя нет или атрибуты превысили бы лимит
+		if _, err := s.UserAttributes(ctx, userID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Warn("user attributes too large")
+		return nil, fmt.Errorf("%s: %w", op, storage.ErrAttributesTooLarge)
+	}
+
+	attrs, err := decodeAttributes(raw)
+	if err != nil {
+		log.Error("failed to decode user attributes", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attrs, nil
+}
+
+func decodeAttributes(raw string) (map[string]json.RawMessage, error) {
+	attrs := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(raw), &attrs); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
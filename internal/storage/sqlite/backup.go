@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshot writes a consistent copy of the database to path with VACUUM INTO, without blocking writers
+// for longer than the copy of a page. path must not exist.
+func (s *Storage) Snapshot(ctx context.Context, path string) error {
+	const op = "storage.sqlite.Snapshot"
+
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Restore replaces the database at storagePath with the snapshot after checking its integrity.
+// The current database is kept next to it as <storagePath>.before-restore-<time>.
+// The service must be stopped: open connections would keep writing to the replaced file.
+// key is the storage key of an encrypted database, the snapshot is checked with it.
+func Restore(snapshot string, storagePath string, key string) (string, error) {
+	const op = "storage.sqlite.Restore"
+
+	if err := checkSnapshot(snapshot, key); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Копия рядом с базой: rename атомарен только в пределах одной файловой системы
+	tmp := storagePath + ".restore"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	previous := ""
+	if _, err := os.Stat(storagePath); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", storagePath, time.Now().UTC().Format("20060102T150405Z"))
+
+		// WAL и shared memory уходят вместе со старой базой и не применяются к восстановленной
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Rename(storagePath+suffix, previous+suffix)
+			if err != nil && !(suffix != "" && errors.Is(err, os.ErrNotExist)) {
+				_ = os.Remove(tmp)
+				return "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	if err := os.Rename(tmp, storagePath); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return previous, nil
+}
+
+// checkSnapshot opens the snapshot read-only and checks it is an intact database with the SSO schema.
+func checkSnapshot(path string, key string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	dsn, err := keyedDSN("file:"+abs+"?mode=ro", key)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("snapshot is corrupted: %s", result)
+	}
+
+	var version int64
+	var dirty bool
+	if err := db.QueryRow("SELECT version, dirty FROM "+migrationsTable+" LIMIT 1").Scan(&version, &dirty); err != nil {
+		return fmt.Errorf("snapshot has no sso schema: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("snapshot was taken during a failed migration %d", version)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrCipherUnsupported is returned for a storage key when the binary is built without the sqlcipher tag.
+var ErrCipherUnsupported = errors.New("storage key is set but the binary is built without sqlcipher support")
+
+// keyedDSN adds the SQLCipher key to the data source name, go-sqlcipher applies it to every new connection
+// before any other statement. key is a passphrase or a raw key written as x'<64 hex digits>'.
+func keyedDSN(storagePath string, key string) (string, error) {
+	if key == "" {
+		return storagePath, nil
+	}
+
+	if !cipherSupported {
+		return "", ErrCipherUnsupported
+	}
+
+	sep := "?"
+	if strings.Contains(storagePath, "?") {
+		sep = "&"
+	}
+
+	return storagePath + sep + "_pragma_key=" + url.QueryEscape(key), nil
+}
+
+// Open opens the database file with the key, as New does, for tools that work with the database
+// directly, e.g. cmd/migrator. An empty key opens a plaintext database.
+func Open(storagePath string, key string) (*sql.DB, error) {
+	const op = "storage.sqlite.Open"
+
+	dsn, err := keyedDSN(storagePath, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if key != "" {
+		if err := checkKey(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: wrong storage key or plaintext database: %w", op, err)
+		}
+	}
+
+	return db, nil
+}
+
+// checkKey reads the schema, which fails with "file is not a database" if the key is wrong
+// or the file is not encrypted: SQLCipher decrypts pages lazily and Ping does not read any.
+func checkKey(db *sql.DB) error {
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&tables); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+//go:build sqlcipher
+
+package sqlite_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sso/internal/storage/sqlite"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlcipher"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/stretchr/testify/require"
+)
+
+const storageKey = "correct horse battery staple"
+
+// Так же, как cmd/migrator собранный с тегом sqlcipher
+func migrateEncrypted(t *testing.T, storagePath string, key string) {
+	t.Helper()
+
+	db, err := sqlite.Open(storagePath, key)
+	require.NoError(t, err)
+
+	driver, err := sqlcipher.WithInstance(db, &sqlcipher.Config{MigrationsTable: "migrations"})
+	require.NoError(t, err)
+
+	_, file, _, _ := runtime.Caller(0)
+	m, err := migrate.NewWithDatabaseInstance(
+		"file://"+filepath.Join(filepath.Dir(file), "..", "..", "..", "migrations"), "sqlcipher", driver,
+	)
+	require.NoError(t, err)
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "sso.db")
+
+	migrateEncrypted(t, path, storageKey)
+
+	st, err := sqlite.New(path, sqlite.PoolOptions{Key: storageKey}, log)
+	require.NoError(t, err)
+	require.NoError(t, st.CheckMigrations(ctx))
+
+	_, err = st.SaveUser(ctx, "user@example.com", []byte("hash"), "")
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+
+	st, err = sqlite.New(path, sqlite.PoolOptions{Key: storageKey}, log)
+	require.NoError(t, err)
+	defer st.Close()
+
+	user, err := st.User(ctx, "user@example.com")
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", user.Email)
+
+	// Без ключа и с чужим ключом файл не читается
+	_, err = sqlite.New(path, sqlite.PoolOptions{Key: "wrong key"}, log)
+	require.Error(t, err)
+
+	db, err := sqlite.Open(path, "")
+	require.NoError(t, err)
+	defer db.Close()
+	require.Error(t, db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(new(int)))
+}
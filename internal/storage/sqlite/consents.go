@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+const (
+	queryConsentUpsert = `INSERT INTO user_consents (user_id, app_id, version, granted_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, app_id) DO UPDATE SET version = excluded.version, granted_at = excluded.granted_at`
+	queryConsentByUserApp = "SELECT user_id, app_id, version, granted_at FROM user_consents WHERE user_id = ? AND app_id = ?"
+	queryConsentDelete    = "DELETE FROM user_consents WHERE user_id = ? AND app_id = ?"
+)
+
+// SaveConsent records the consent of the user to the app, replacing an earlier one.
+func (s *Storage) SaveConsent(ctx context.Context, consent models.Consent) error {
+	const op = "storage.sqlite.SaveConsent"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", consent.UserID),
+		slog.Int("app_id", int(consent.AppID)),
+	)
+
+	_, err := s.stmts.exec(ctx, queryConsentUpsert,
+		consent.UserID, consent.AppID, consent.Version, consent.GrantedAt.Unix())
+	if err != nil {
+		log.Error("failed to save consent", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Consent returns the consent of the user to the app.
+func (s *Storage) Consent(ctx context.Context, userID int64, appID int32) (models.Consent, error) {
+	const op = "storage.sqlite.Consent"
+
+	var consent models.Consent
+	var grantedAt int64
+
+	err := s.stmts.queryRow(ctx, queryConsentByUserApp, []any{userID, appID},
+		&consent.UserID, &consent.AppID, &consent.Version, &grantedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Consent{}, fmt.Errorf("%s: %w", op, storage.ErrConsentNotFound)
+		}
+
+		s.log.With(slog.String("op", op)).Error("failed to get consent", sl.Err(err))
+		return models.Consent{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	consent.GrantedAt = time.Unix(grantedAt, 0)
+
+	return consent, nil
+}
+
+// DeleteConsent revokes the consent of the user to the app.
+func (s *Storage) DeleteConsent(ctx context.Context, userID int64, appID int32) error {
+	const op = "storage.sqlite.DeleteConsent"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", int(appID)),
+	)
+
+	res, err := s.stmts.exec(ctx, queryConsentDelete, userID, appID)
+	if err != nil {
+		log.Error("failed to delete consent", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrConsentNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+const (
+	queryUserDeviceTrust = `UPDATE user_devices SET trust_hash = ?, trusted_until = ?
+		WHERE user_id = ? AND fingerprint = ?`
+	queryUserDeviceByTrustHash = `SELECT id, user_id, fingerprint, user_agent, first_seen_at, last_seen_at, trusted_until
+		FROM user_devices WHERE trust_hash = ?`
+	queryUserDevicesByUser = `SELECT id, user_id, fingerprint, user_agent, first_seen_at, last_seen_at, trusted_until
+		FROM user_devices WHERE user_id = ? ORDER BY last_seen_at DESC, id DESC`
+	queryUserDeviceDelete = "DELETE FROM user_devices WHERE id = ? AND user_id = ?"
+)
+
+// TrustUserDevice remembers the known device of the user: its device token, stored as tokenHash,
+// skips second factors until the time. A new token replaces the previous one of the device.
+func (s *Storage) TrustUserDevice(ctx context.Context, userID int64, fingerprint string, tokenHash []byte, until time.Time) error {
+	const op = "storage.sqlite.TrustUserDevice"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	res, err := s.stmts.exec(ctx, queryUserDeviceTrust, tokenHash, until.Unix(), userID, fingerprint)
+	if err != nil {
+		log.Error("failed to trust user device", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceNotFound)
+	}
+
+	return nil
+}
+
+// TrustedUserDevice returns the device remembered with the device token hash, expired or not.
+func (s *Storage) TrustedUserDevice(ctx context.Context, tokenHash []byte) (models.UserDevice, error) {
+	const op = "storage.sqlite.TrustedUserDevice"
+
+	var row deviceRow
+	err := s.stmts.queryRow(ctx, queryUserDeviceByTrustHash, []any{tokenHash}, row.dest()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserDevice{}, fmt.Errorf("%s: %w", op, storage.ErrDeviceNotFound)
+		}
+
+		s.log.With(slog.String("op", op)).Error("failed to get trusted device", sl.Err(err))
+		return models.UserDevice{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return row.device(), nil
+}
+
+// UserDevices returns the known devices of the user, most recently seen first.
+func (s *Storage) UserDevices(ctx context.Context, userID int64) ([]models.UserDevice, error) {
+	const op = "storage.sqlite.UserDevices"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryUserDevicesByUser, userID)
+	if err != nil {
+		log.Error("failed to get user devices", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var devices []models.UserDevice
+	for rows.Next() {
+		var row deviceRow
+		if err := rows.Scan(row.dest()...); err != nil {
+			log.Error("failed to scan user device", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		devices = append(devices, row.device())
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("failed to get user devices", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return devices, nil
+}
+
+// DeleteUserDevice forgets the device of the user together with its device token.
+// The next login from it counts as a login from a new device.
+func (s *Storage) DeleteUserDevice(ctx context.Context, userID int64, deviceID int64) error {
+	const op = "storage.sqlite.DeleteUserDevice"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int64("device_id", deviceID),
+	)
+
+	res, err := s.stmts.exec(ctx, queryUserDeviceDelete, deviceID, userID)
+	if err != nil {
+		log.Error("failed to delete user device", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceNotFound)
+	}
+
+	return nil
+}
+
+// deviceRow scans the columns of user_devices selected by the device queries.
+type deviceRow struct {
+	models.UserDevice
+	firstSeenAt, lastSeenAt int64
+	trustedUntil            sql.NullInt64
+}
+
+func (r *deviceRow) dest() []any {
+	return []any{&r.ID, &r.UserID, &r.Fingerprint, &r.UserAgent, &r.firstSeenAt, &r.lastSeenAt, &r.trustedUntil}
+}
+
+func (r *deviceRow) device() models.UserDevice {
+	device := r.UserDevice
+	device.FirstSeenAt = time.Unix(r.firstSeenAt, 0)
+	device.LastSeenAt = time.Unix(r.lastSeenAt, 0)
+	if r.trustedUntil.Valid {
+		device.TrustedUntil = time.Unix(r.trustedUntil.Int64, 0)
+	}
+
+	return device
+}
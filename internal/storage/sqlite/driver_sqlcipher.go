@@ -0,0 +1,34 @@
+//go:build sqlcipher
+
+package sqlite
+
+import (
+	"errors"
+
+	// Форк mattn/go-sqlite3 со встроенным SQLCipher: тот же API и то же имя драйвера "sqlite3",
+	// поэтому собирается вместо него, а не вместе с ним
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+// cipherSupported reports whether the binary can open encrypted databases.
+const cipherSupported = true
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func isPrimaryKeyViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+func isSchemaChanged(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrSchema
+}
+
+func isReadOnly(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly
+}
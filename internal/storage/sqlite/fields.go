@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+)
+
+// columnPhone is authenticated with the encrypted phone numbers, see fieldcrypt.Keyring.Encrypt.
+const columnPhone = "users.phone"
+
+const (
+	// Номера, зашифрованные не текущим ключом или записанные до включения шифрования
+	queryPhonesToRotate = `SELECT id, phone FROM users
+		WHERE phone IS NOT NULL AND substr(phone, 1, ?) != ? ORDER BY id LIMIT ?`
+	queryPhoneRotate = "UPDATE users SET phone = ?, phone_index = ? WHERE id = ? AND phone = ?"
+)
+
+// RotateFieldKeys re-encrypts up to limit encrypted column values not encrypted with the current field key,
+// including values written before encryption was enabled, and returns how many were re-encrypted.
+// Without field keys there is nothing to do.
+func (s *Storage) RotateFieldKeys(ctx context.Context, limit int) (int, error) {
+	const op = "storage.sqlite.RotateFieldKeys"
+
+	log := s.log.With(slog.String("op", op))
+
+	if s.fields == nil {
+		return 0, nil
+	}
+
+	current := s.fields.CurrentPrefix()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, queryPhonesToRotate, len(current), current, limit)
+	if err != nil {
+		log.Error("failed to select phones", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	type stored struct {
+		id    int64
+		phone string
+	}
+
+	var phones []stored
+	for rows.Next() {
+		var p stored
+		if err := rows.Scan(&p.id, &p.phone); err != nil {
+			rows.Close()
+			log.Error("failed to scan phone", sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		phones = append(phones, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Error("failed to select phones", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, p := range phones {
+		phone, err := s.fields.Decrypt(columnPhone, p.phone)
+		if err != nil {
+			log.Error("failed to decrypt phone", slog.Int64("user_id", p.id), sl.Err(err))
+			return 0, fmt.Errorf("%s: user %d: %w", op, p.id, err)
+		}
+
+		enc, err := s.fields.Encrypt(columnPhone, phone)
+		if err != nil {
+			log.Error("failed to encrypt phone", slog.Int64("user_id", p.id), sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Слепой индекс пересчитывается тоже: у незашифрованных строк индексом был сам номер
+		_, err = tx.ExecContext(ctx, queryPhoneRotate, enc, s.fields.Index(columnPhone, phone), p.id, p.phone)
+		if err != nil {
+			log.Error("failed to update phone", slog.Int64("user_id", p.id), sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return len(phones), nil
+}
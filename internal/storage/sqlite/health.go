@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sso/internal/storage"
+)
+
+// RequiredMigrationVersion is the latest migration the code relies on, bump it with every new migration.
+const RequiredMigrationVersion = 28
+
+// migrationsTable is the table golang-migrate records the applied version in, see cmd/migrator.
+const migrationsTable = "migrations"
+
+// Ping checks the database is reachable.
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.sqlite.Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CheckMigrations returns an error unless the schema is at RequiredMigrationVersion or later
+// and the last migration completed.
+func (s *Storage) CheckMigrations(ctx context.Context) error {
+	const op = "storage.sqlite.CheckMigrations"
+
+	var version int64
+	var dirty bool
+	err := s.db.QueryRowContext(ctx, "SELECT version, dirty FROM "+migrationsTable+" LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if dirty {
+		return fmt.Errorf("%s: migration %d failed, the schema is dirty", op, version)
+	}
+
+	if version < RequiredMigrationVersion {
+		return fmt.Errorf("%s: schema version is %d, %d is required", op, version, RequiredMigrationVersion)
+	}
+
+	return nil
+}
+
+// CheckWritable returns storage.ErrReadOnly if the database no longer accepts writes, e.g. after
+// its volume was remounted read-only. It rewrites the schema version row with the same values.
+func (s *Storage) CheckWritable(ctx context.Context) error {
+	const op = "storage.sqlite.CheckWritable"
+
+	if _, err := s.db.ExecContext(ctx, "UPDATE "+migrationsTable+" SET dirty = dirty"); err != nil {
+		if isReadOnly(err) {
+			return fmt.Errorf("%s: %w", op, storage.ErrReadOnly)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
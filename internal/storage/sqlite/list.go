@@ -0,0 +1,320 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"strconv"
+	"strings"
+)
+
+// sortKey is a column or expression a listing can be ordered by.
+type sortKey struct {
+	expr string
+	// numeric keys are compared as integers: in SQLite any integer sorts before any text.
+	numeric bool
+}
+
+var (
+	userSortKeys = map[string]sortKey{
+		storage.SortID:        {expr: "id"},
+		storage.SortEmail:     {expr: "email"},
+		storage.SortCreatedAt: {expr: "COALESCE(created_at, 0)", numeric: true},
+	}
+	appSortKeys = map[string]sortKey{
+		storage.SortID:   {expr: "id"},
+		storage.SortCode: {expr: "code"},
+	}
+)
+
+// ListUsers returns a page of users matching the filter and the cursor of the next page, empty after the last page.
+// Users can be sorted by storage.SortID, storage.SortEmail and storage.SortCreatedAt.
+func (s *Storage) ListUsers(ctx context.Context, filter storage.UserFilter, opts storage.ListOptions) ([]models.User, string, error) {
+	const op = "storage.sqlite.ListUsers"
+
+	log := s.log.With(slog.String("op", op))
+
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+
+	if filter.EmailPrefix != "" {
+		where, args = appendPrefix(where, args, "email", filter.EmailPrefix)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.Unix())
+	}
+	if !filter.CreatedTo.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.CreatedTo.Unix())
+	}
+	if filter.Enabled != nil {
+		where = append(where, "blocked = ?")
+		args = append(args, !*filter.Enabled)
+	}
+
+	query, args, sort, err := pageQuery(queryUserSelect, where, args, userSortKeys, opts)
+	if err != nil {
+		log.Warn("invalid list options", sl.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error("failed to list users", sl.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		var createdAt int64
+		if err := rows.Scan(userFields(&user, &createdAt)...); err != nil {
+			log.Error("failed to scan user", sl.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		if err := s.openUser(&user, createdAt); err != nil {
+			log.Error("failed to decrypt user", sl.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("failed to list users", sl.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	users, last, ok := cutPage(users, opts.PageLimit())
+	if !ok {
+		return users, "", nil
+	}
+
+	cursor := storage.Cursor{Sort: sort, Desc: opts.Desc, ID: last.ID}
+	switch sort {
+	case storage.SortEmail:
+		cursor.Value = last.Email
+	case storage.SortCreatedAt:
+		cursor.Value = strconv.FormatInt(max(last.CreatedAt.Unix(), 0), 10)
+	}
+
+	return users, storage.EncodeCursor(cursor), nil
+}
+
+// ListApps returns a page of apps matching the filter and the cursor of the next page, empty after the last page.
+// Apps can be sorted by storage.SortID and storage.SortCode.
+func (s *Storage) ListApps(ctx context.Context, filter storage.AppFilter, opts storage.ListOptions) ([]models.App, string, error) {
+	const op = "storage.sqlite.ListApps"
+
+	log := s.log.With(slog.String("op", op))
+
+	var where []string
+	var args []any
+
+	if filter.CodePrefix != "" {
+		where, args = appendPrefix(where, args, "code", filter.CodePrefix)
+	}
+
+	query, args, sort, err := pageQuery(queryAppSelect, where, args, appSortKeys, opts)
+	if err != nil {
+		log.Warn("invalid list options", sl.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error("failed to list apps", sl.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		var app models.App
+		var claims string
+		if err := rows.Scan(appFields(&app, &claims)...); err != nil {
+			log.Error("failed to scan app", sl.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		if err := openApp(&app, claims); err != nil {
+			log.Error("failed to decode app claims template", sl.Err(err))
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("failed to list apps", sl.Err(err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	apps, last, ok := cutPage(apps, opts.PageLimit())
+	if !ok {
+		return apps, "", nil
+	}
+
+	cursor := storage.Cursor{Sort: sort, Desc: opts.Desc, ID: int64(last.ID)}
+	if sort == storage.SortCode {
+		cursor.Value = last.Code
+	}
+
+	return apps, storage.EncodeCursor(cursor), nil
+}
+
+// AppGrants returns the user_app rows of the users with the codes of their apps, ordered by user and app code.
+func (s *Storage) AppGrants(ctx context.Context, userIDs []int64) ([]models.AppGrant, error) {
+	const op = "storage.sqlite.AppGrants"
+
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	log := s.log.With(slog.String("op", op))
+
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+
+	query := `SELECT ua.user_id, ua.app_id, a.code, ua.is_enabled FROM user_app ua JOIN apps a ON a.id = ua.app_id
+		WHERE ua.user_id IN (?` + strings.Repeat(", ?", len(userIDs)-1) + `) ORDER BY ua.user_id, a.code`
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error("failed to get app grants", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var grants []models.AppGrant
+	for rows.Next() {
+		var g models.AppGrant
+		if err := rows.Scan(&g.UserID, &g.AppID, &g.AppCode, &g.IsEnabled); err != nil {
+			log.Error("failed to scan app grant", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		grants = append(grants, g)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("failed to get app grants", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return grants, nil
+}
+
+// pageQuery completes the select with the filter, the position of the cursor, the order and the limit.
+// One row more than the page is selected to tell whether there is a next page.
+func pageQuery(
+	selectQuery string,
+	where []string,
+	args []any,
+	keys map[string]sortKey,
+	opts storage.ListOptions,
+) (string, []any, string, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = storage.SortID
+	}
+
+	key, ok := keys[sort]
+	if !ok {
+		return "", nil, "", storage.ErrInvalidSort
+	}
+
+	cmp, dir := ">", "ASC"
+	if opts.Desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := storage.DecodeCursor(opts.Cursor, opts, sort)
+		if err != nil {
+			return "", nil, "", err
+		}
+
+		if sort == storage.SortID {
+			where = append(where, "id "+cmp+" ?")
+			args = append(args, cursor.ID)
+		} else {
+			var value any = cursor.Value
+			if key.numeric {
+				n, err := strconv.ParseInt(cursor.Value, 10, 64)
+				if err != nil {
+					return "", nil, "", storage.ErrInvalidCursor
+				}
+				value = n
+			}
+
+			// id различает строки с одинаковым ключом сортировки
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", key.expr, cmp))
+			args = append(args, value, value, cursor.ID)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(selectQuery)
+	if len(where) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(where, " AND "))
+	}
+	if sort == storage.SortID {
+		fmt.Fprintf(&b, " ORDER BY id %s", dir)
+	} else {
+		fmt.Fprintf(&b, " ORDER BY %s %s, id %s", key.expr, dir, dir)
+	}
+	b.WriteString(" LIMIT ?")
+	args = append(args, opts.PageLimit()+1)
+
+	return b.String(), args, sort, nil
+}
+
+// appendPrefix filters the column by the prefix with a range, unlike LIKE it uses the index of the column.
+func appendPrefix(where []string, args []any, column string, prefix string) ([]string, []any) {
+	where = append(where, column+" >= ?")
+	args = append(args, prefix)
+
+	if upper, ok := prefixUpperBound(prefix); ok {
+		where = append(where, column+" < ?")
+		args = append(args, upper)
+	}
+
+	return where, args
+}
+
+// prefixUpperBound returns the least string greater than all strings with the prefix, false if there is none.
+func prefixUpperBound(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+
+	return "", false
+}
+
+// cutPage drops the extra row selected by pageQuery and returns the last row of the page
+// if there is a next page.
+func cutPage[T any](rows []T, limit int) ([]T, T, bool) {
+	var last T
+	if len(rows) <= limit {
+		return rows, last, false
+	}
+
+	rows = rows[:limit]
+
+	return rows, rows[limit-1], true
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+const (
+	queryRecoveryEmail    = "SELECT recovery_email FROM users WHERE id = ? AND deleted_at IS NULL"
+	queryRecoveryEmailSet = "UPDATE users SET recovery_email = ? WHERE id = ? AND deleted_at IS NULL"
+	queryRecoveryCodeAdd  = "INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)"
+	queryRecoveryCodeUse  = `UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+)
+
+// RecoveryEmail returns the recovery email of the user, empty if it is not set.
+func (s *Storage) RecoveryEmail(ctx context.Context, userID int64) (string, error) {
+	const op = "storage.sqlite.RecoveryEmail"
+
+	var email sql.NullString
+	err := s.stmts.queryRow(ctx, queryRecoveryEmail, []any{userID}, &email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		s.log.With(slog.String("op", op)).Error("failed to get recovery email", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return email.String, nil
+}
+
+// SetRecoveryEmail sets the recovery email of the user, an empty email removes it.
+func (s *Storage) SetRecoveryEmail(ctx context.Context, userID int64, email string) error {
+	const op = "storage.sqlite.SetRecoveryEmail"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	res, err := s.stmts.exec(ctx, queryRecoveryEmailSet, sql.NullString{String: email, Valid: email != ""}, userID)
+	if err != nil {
+		log.Error("failed to set recovery email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes of the user, used or not, with new ones stored as hashes.
+func (s *Storage) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte, at time.Time) error {
+	const op = "storage.sqlite.ReplaceRecoveryCodes"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, queryRecoveryCodesUserDelete, userID); err != nil {
+		log.Error("failed to delete recovery codes", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, queryRecoveryCodeAdd, userID, hash, at.Unix()); err != nil {
+			log.Error("failed to save recovery code", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the unused recovery code of the user with the hash as used.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, hash []byte, at time.Time) error {
+	const op = "storage.sqlite.UseRecoveryCode"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	res, err := s.stmts.exec(ctx, queryRecoveryCodeUse, at.Unix(), userID, hash)
+	if err != nil {
+		log.Error("failed to use recovery code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRecoveryCodeInvalid)
+	}
+
+	return nil
+}
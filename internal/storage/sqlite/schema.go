@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sso/internal/lib/logger/sl"
+	"sso/migrations"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSchema is returned for a database no migrations were applied to, e.g. a new empty file.
+var ErrNoSchema = errors.New("database has no schema: apply the migrations with cmd/migrator or set auto_migrate")
+
+// migration is an up migration of the embedded migrations.
+type migration struct {
+	version int64
+	name    string
+}
+
+// CheckSchema returns ErrNoSchema unless migrations were applied to the database.
+// Whether they are the latest ones is up to CheckMigrations.
+func (s *Storage) CheckSchema(ctx context.Context) error {
+	const op = "storage.sqlite.CheckSchema"
+
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", migrationsTable,
+	).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrNoSchema)
+	}
+
+	return nil
+}
+
+// Migrate applies the embedded migrations newer than the schema version and returns how many
+// were applied. The version is recorded in the table of cmd/migrator, so both can be used on
+// the same database. Each migration runs in its own transaction, a failed one leaves the schema
+// at the previous version.
+func (s *Storage) Migrate(ctx context.Context) (int, error) {
+	const op = "storage.sqlite.Migrate"
+
+	log := s.log.With(slog.String("op", op))
+
+	// Та же таблица версий, что создаёт golang-migrate
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (version uint64, dirty bool);
+		CREATE UNIQUE INDEX IF NOT EXISTS version_unique ON %s (version);`,
+		migrationsTable, migrationsTable))
+	if err != nil {
+		log.Error("failed to create migrations table", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var current int64
+	var dirty bool
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM "+migrationsTable+" LIMIT 1").Scan(&current, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error("failed to get schema version", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if dirty {
+		return 0, fmt.Errorf("%s: migration %d failed, the schema is dirty", op, current)
+	}
+
+	pending, err := upMigrations(current)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i, m := range pending {
+		if err := s.applyMigration(ctx, m); err != nil {
+			log.Error("failed to apply migration", slog.String("migration", m.name), sl.Err(err))
+			return i, fmt.Errorf("%s: %s: %w", op, m.name, err)
+		}
+
+		log.Info("migration applied", slog.String("migration", m.name))
+	}
+
+	return len(pending), nil
+}
+
+func (s *Storage) applyMigration(ctx context.Context, m migration) error {
+	query, err := fs.ReadFile(migrations.FS, m.name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, string(query)); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+migrationsTable); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO "+migrationsTable+" (version, dirty) VALUES (?, ?)", m.version, false); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// upMigrations returns the embedded up migrations newer than version, in order.
+func upMigrations(version int64) ([]migration, error) {
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []migration
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: no version prefix", name)
+		}
+
+		v, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", name, err)
+		}
+
+		if v > version {
+			pending = append(pending, migration{version: v, name: name})
+		}
+	}
+
+	slices.SortFunc(pending, func(a, b migration) int {
+		return int(a.version - b.version)
+	})
+
+	return pending, nil
+}
@@ -3,42 +3,146 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"sso/internal/domain/models"
+	"sso/internal/lib/fieldcrypt"
+	"sso/internal/lib/identifier"
 	"sso/internal/lib/logger/sl"
 	"sso/internal/storage"
 	"time"
+)
 
-	"github.com/mattn/go-sqlite3"
+const (
+	queryUserSelect = `SELECT id, email, COALESCE(username, ''), COALESCE(phone, ''), pass_hash, pepper_id, blocked, token_version,
+		COALESCE(created_at, 0) FROM users`
+	queryUserInsert         = "INSERT INTO users(email, pass_hash, pepper_id, created_at) VALUES(?, ?, ?, ?)"
+	queryUserByEmail        = queryUserSelect + " WHERE email = ? AND deleted_at IS NULL"
+	queryUserByID           = queryUserSelect + " WHERE id = ? AND deleted_at IS NULL"
+	queryUserByUsername     = queryUserSelect + " WHERE username = ? AND deleted_at IS NULL"
+	queryUserByPhone        = queryUserSelect + " WHERE phone_index IN (?, ?) AND deleted_at IS NULL"
+	queryUserUsernameUpdate = "UPDATE users SET username = ? WHERE id = ? AND deleted_at IS NULL"
+	queryUserPhoneUpdate    = "UPDATE users SET phone = ?, phone_index = ? WHERE id = ? AND deleted_at IS NULL"
+	queryUserPassHashUpdate = "UPDATE users SET pass_hash = ?, pepper_id = ? WHERE id = ?"
+	queryUserBlockedUpdate  = "UPDATE users SET blocked = ?, token_version = token_version + 1 WHERE id = ?"
+	queryUserTokensRevoke   = "UPDATE users SET token_version = token_version + 1 WHERE id = ? AND deleted_at IS NULL"
+	queryUserSoftDelete     = `UPDATE users SET deleted_at = ?, token_version = token_version + 1
+		WHERE id = ? AND deleted_at IS NULL`
+	queryUsersDeletedBefore = `SELECT id FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < ? AND anonymized_at IS NULL ORDER BY deleted_at LIMIT ?`
+	queryUserAnonymize = `UPDATE users SET email = 'deleted-' || id || '@invalid', username = NULL, phone = NULL,
+		phone_index = NULL, pass_hash = x'', pepper_id = '', attributes = '{}', recovery_email = NULL,
+		anonymized_at = ? WHERE id = ? AND deleted_at IS NOT NULL`
+	queryUserDevicesDelete       = "DELETE FROM user_devices WHERE user_id = ?"
+	queryTokenClaimsUserDelete   = "DELETE FROM token_claims WHERE user_id = ?"
+	querySessionsUserDelete      = "DELETE FROM sessions WHERE user_id = ?"
+	queryLoginHistoryUserDelete  = "DELETE FROM login_history WHERE user_id = ?"
+	queryConsentsUserDelete      = "DELETE FROM user_consents WHERE user_id = ?"
+	queryRecoveryCodesUserDelete = "DELETE FROM recovery_codes WHERE user_id = ?"
+	queryAppSelect               = "SELECT id, code, secret, token_format, third_party, consent_version, claims_template, webhook_url FROM apps"
+	queryAppByCode               = queryAppSelect + " WHERE code = ?"
+	queryUserAppByUserIdAndAppId = "SELECT user_id, app_id, is_enabled FROM user_app WHERE user_id = ? AND app_id = ?"
+	queryUserAppInsert           = "INSERT INTO user_app (user_id, app_id, is_enabled) VALUES (?, ?, ?)"
+	queryUserAppUpdate           = "UPDATE user_app SET is_enabled = ? WHERE user_id = ? AND app_id = ?"
+	// DO UPDATE без изменений вместо DO NOTHING, чтобы RETURNING вернул существующую строку
+	queryUserAppUpsert = `INSERT INTO user_app (user_id, app_id, is_enabled) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, app_id) DO UPDATE SET is_enabled = is_enabled
+		RETURNING user_id, app_id, is_enabled`
+	queryTokenClaimsInsert       = "INSERT INTO token_claims (ref, user_id, app_id, claims, expires_at) VALUES (?, ?, ?, ?, ?)"
+	queryTokenClaimsByRef        = "SELECT ref, user_id, app_id, claims, expires_at FROM token_claims WHERE ref = ?"
+	queryUserDeviceByFingerprint = `SELECT id, user_id, fingerprint, user_agent, first_seen_at, last_seen_at, trusted_until
+		FROM user_devices WHERE user_id = ? AND fingerprint = ?`
+	queryUserDeviceUpsert = `INSERT INTO user_devices (user_id, fingerprint, user_agent, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, fingerprint) DO UPDATE SET user_agent = excluded.user_agent, last_seen_at = excluded.last_seen_at`
+	queryUserDeviceCount   = "SELECT COUNT(*) FROM user_devices WHERE user_id = ?"
+	queryTokenUseInsert    = "INSERT INTO token_uses (jti, purpose, expires_at) VALUES (?, ?, ?)"
+	queryMaintenanceInsert = "INSERT INTO app_maintenance (app_id, starts_at, ends_at, reason) VALUES (?, ?, ?, ?)"
+	queryMaintenanceDelete = "DELETE FROM app_maintenance WHERE id = ?"
+	queryMaintenanceActive = `SELECT id, app_id, starts_at, ends_at, reason FROM app_maintenance
+		WHERE app_id = ? AND starts_at <= ? AND ends_at > ? ORDER BY ends_at DESC LIMIT 1`
+	queryMaintenanceUpcoming = `SELECT id, app_id, starts_at, ends_at, reason FROM app_maintenance
+		WHERE app_id = ? AND ends_at > ? ORDER BY starts_at`
+	queryAppDomains       = "SELECT domain FROM app_domains WHERE app_id = ? ORDER BY domain"
+	queryAppDomainInsert  = "INSERT INTO app_domains (app_id, domain) VALUES (?, ?)"
+	queryAppDomainDelete  = "DELETE FROM app_domains WHERE app_id = ? AND domain = ?"
+	querySigningKeyActive = `SELECT kid, app_id, secret, created_at, expires_at FROM signing_keys
+		WHERE app_id = ? AND expires_at IS NULL ORDER BY created_at DESC, rowid DESC LIMIT 1`
+	querySigningKeyByKid   = "SELECT kid, app_id, secret, created_at, expires_at FROM signing_keys WHERE kid = ?"
+	querySigningKeysRetire = "UPDATE signing_keys SET expires_at = ? WHERE app_id = ? AND expires_at IS NULL"
+	querySigningKeyInsert  = "INSERT INTO signing_keys (kid, app_id, secret, created_at) VALUES (?, ?, ?, ?)"
+	querySessionInsert     = `INSERT INTO sessions (id, user_id, app_id, token_version, claims, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	querySessionByID        = "SELECT id, user_id, app_id, token_version, claims, expires_at FROM sessions WHERE id = ?"
+	querySessionDelete      = "DELETE FROM sessions WHERE id = ?"
+	queryRevokedTokenInsert = "INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	queryRevokedTokenByJTI  = "SELECT 1 FROM revoked_tokens WHERE jti = ?"
+	queryInviteInsert       = "INSERT INTO invites (token_hash, email, created_at, expires_at) VALUES (?, ?, ?, ?)"
+	queryInviteAppInsert    = "INSERT INTO invite_apps (invite_id, app_id) VALUES (?, ?)"
+	queryInviteByTokenHash  = `SELECT id, token_hash, email, created_at, expires_at, used_at
+		FROM invites WHERE token_hash = ?`
+	queryInviteApps = "SELECT app_id FROM invite_apps WHERE invite_id = ? ORDER BY app_id"
+	queryInviteUse  = `UPDATE invites SET used_at = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING email`
+	queryInviteUserApps = `INSERT INTO user_app (user_id, app_id, is_enabled)
+		SELECT ?, app_id, 1 FROM invite_apps WHERE invite_id = ?`
+	queryInviteAppsExpiredDelete = `DELETE FROM invite_apps
+		WHERE invite_id IN (SELECT id FROM invites WHERE expires_at < ?)`
+	queryInvitesExpiredDelete = "DELETE FROM invites WHERE expires_at < ?"
 )
 
+// expiredDeletes remove rows needed only until their token expires.
+var expiredDeletes = []string{
+	"DELETE FROM sessions WHERE expires_at < ?",
+	"DELETE FROM token_uses WHERE expires_at < ?",
+	"DELETE FROM token_claims WHERE expires_at < ?",
+	"DELETE FROM revoked_tokens WHERE expires_at < ?",
+}
+
 type Storage struct {
-	db                          *sql.DB
-	userInsertStmt              *sql.Stmt
-	userByEmailStmt             *sql.Stmt
-	appByCodeStmt               *sql.Stmt
-	userAppByUserIdAndAppIdStmt *sql.Stmt
-	userAppInsertStmt           *sql.Stmt
-	userAppUpdateStmt           *sql.Stmt
-	log                         *slog.Logger
+	db     *sql.DB
+	stmts  *stmtRegistry
+	fields *fieldcrypt.Keyring
+	log    *slog.Logger
+}
+
+// PoolOptions configures the connection pool of the database.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// Key is the SQLCipher key of the database file, empty for a plaintext one.
+	// Every connection of the pool is opened with it, see keyedDSN.
+	Key string
+	// Fields encrypts the sensitive columns, nil stores them as is.
+	Fields *fieldcrypt.Keyring
+	// Timeouts bound the queries and transactions of the storage methods. Backups, vacuum,
+	// migrations, field key rotation and DeleteExpired are maintenance and run unbounded.
+	Timeouts Timeouts
 }
 
-func New(storagePath string, log *slog.Logger) (storage *Storage, err error) {
+func New(storagePath string, pool PoolOptions, log *slog.Logger) (*Storage, error) {
 	const op = "storage.sqlite.New"
 	opLog := log.With(slog.String("op", op))
 
-	db, err := sql.Open("sqlite3", storagePath)
+	dsn, err := keyedDSN(storagePath, pool.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		opLog.Error("failed to open database", sl.Err(err))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	db.SetConnMaxIdleTime(10 * time.Minute)
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 
 	if err := db.Ping(); err != nil {
 		db.Close()
@@ -46,82 +150,23 @@ func New(storagePath string, log *slog.Logger) (storage *Storage, err error) {
 		return nil, fmt.Errorf("%s: ping failed: %w", op, err)
 	}
 
-	var stmts []*sql.Stmt
-	defer func() {
-		if err != nil {
-			for _, stmt := range stmts {
-				if stmt != nil {
-					stmt.Close()
-				}
-			}
+	if pool.Key != "" {
+		if err := checkKey(db); err != nil {
 			db.Close()
+			opLog.Error("failed to decrypt database, check the storage key", sl.Err(err))
+			return nil, fmt.Errorf("%s: wrong storage key or plaintext database: %w", op, err)
 		}
-	}()
-
-	userInsertStmt, err := db.Prepare("INSERT INTO users(email, pass_hash) VALUES(?, ?)")
-	if err != nil {
-		opLog.Error("failed to prepare user insert statement", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	stmts = append(stmts, userInsertStmt)
-
-	userByEmailStmt, err := db.Prepare("SELECT id, email, pass_hash FROM users WHERE email = ?")
-	if err != nil {
-		opLog.Error("failed to prepare user by email statement", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	stmts = append(stmts, userByEmailStmt)
-
-	appByCodeStmt, err := db.Prepare("SELECT id, code, secret FROM apps WHERE code = ?")
-	if err != nil {
-		opLog.Error("failed to prepare app by code statement", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	stmts = append(stmts, appByCodeStmt)
-
-	userAppByUserIdAndAppIdStmt, err := db.Prepare(`
-		SELECT user_id, app_id, is_enabled 
-		FROM user_app 
-		WHERE user_id = ? AND app_id = ?`)
-	if err != nil {
-		opLog.Error("failed to prepare userApp by user id and app id statement", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	stmts = append(stmts, userAppByUserIdAndAppIdStmt)
-
-	userAppInsertStmt, err := db.Prepare(`
-		INSERT INTO user_app (user_id, app_id, is_enabled) VALUES (?, ?, ?)
-	`)
-	if err != nil {
-		opLog.Error("failed to prepare userApp insert statement", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	stmts = append(stmts, userAppInsertStmt)
-
-	userAppUpdateStmt, err := db.Prepare(`
-		UPDATE user_app SET is_enabled = ? WHERE user_id = ? AND app_id = ?
-	`)
-	if err != nil {
-		opLog.Error("failed to prepare userApp update statement", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	stmts = append(stmts, userAppUpdateStmt)
-
-	storage = &Storage{
-		db:                          db,
-		userInsertStmt:              userInsertStmt,
-		userByEmailStmt:             userByEmailStmt,
-		appByCodeStmt:               appByCodeStmt,
-		userAppByUserIdAndAppIdStmt: userAppByUserIdAndAppIdStmt,
-		userAppInsertStmt:           userAppInsertStmt,
-		userAppUpdateStmt:           userAppUpdateStmt,
-		log:                         log,
 	}
 
-	return storage, nil
+	return &Storage{
+		db:     db,
+		stmts:  newStmtRegistry(db, log.With(slog.String("op", "storage.sqlite.stmts")), pool.Timeouts),
+		fields: pool.Fields,
+		log:    log,
+	}, nil
 }
 
-func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (int64, error) {
+func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte, pepperID string) (int64, error) {
 	const op = "storage.sqlite.SaveUser"
 
 	log := s.log.With(
@@ -129,7 +174,7 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 		slog.String("email", email),
 	)
 
-	res, err := s.userInsertStmt.ExecContext(ctx, email, passHash)
+	res, err := s.stmts.exec(ctx, queryUserInsert, email, passHash, pepperID, time.Now().Unix())
 	if err != nil {
 		if ctx.Err() != nil {
 			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
@@ -137,8 +182,7 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 			return 0, err
 		}
 
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		if isUniqueViolation(err) {
 			log.Warn("failed to save user: user already exists")
 			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
 		}
@@ -156,6 +200,64 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 	return id, nil
 }
 
+// SaveUsers inserts the users in one transaction. A user that can't be inserted, e.g. with a taken email,
+// doesn't abort the others: its error is returned at its index, storage.ErrUserExists for a taken email.
+// The returned error is set if the transaction failed and nothing was saved.
+func (s *Storage) SaveUsers(ctx context.Context, users []models.User) ([]error, error) {
+	const op = "storage.sqlite.SaveUsers"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("count", len(users)),
+	)
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := s.stmts.inTx(ctx, tx, queryUserInsert)
+	if err != nil {
+		log.Error("failed to prepare statement", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().Unix()
+	errs := make([]error, len(users))
+	for i, user := range users {
+		// Ошибка ограничения откатывает только эту вставку, транзакция продолжается
+		_, err := stmt.ExecContext(ctx, user.Email, user.PassHash, user.PepperID, now)
+		if err == nil {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			log.Error("failed to save users: context error", sl.Err(err))
+			return nil, fmt.Errorf("%s: context error: %w", op, ctx.Err())
+		}
+
+		if isUniqueViolation(err) {
+			errs[i] = storage.ErrUserExists
+			continue
+		}
+
+		errs[i] = err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return errs, nil
+}
+
 func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.sqlite.User"
 
@@ -164,9 +266,49 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 		slog.String("email", email),
 	)
 
+	return s.user(ctx, queryUserByEmail, []any{email}, log, op)
+}
+
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.sqlite.UserByID"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	return s.user(ctx, queryUserByID, []any{userID}, log, op)
+}
+
+// UserByIdentifier looks the user up by an email, a username or a phone number.
+// The value is expected in the stored form, see identifier.Detect.
+func (s *Storage) UserByIdentifier(ctx context.Context, id identifier.Identifier) (models.User, error) {
+	const op = "storage.sqlite.UserByIdentifier"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("kind", string(id.Kind)),
+	)
+
+	switch id.Kind {
+	case identifier.Email:
+		return s.user(ctx, queryUserByEmail, []any{id.Value}, log, op)
+	case identifier.Username:
+		return s.user(ctx, queryUserByUsername, []any{id.Value}, log, op)
+	case identifier.Phone:
+		// Номер как есть находит строки, ещё не зашифрованные задачей rotate_field_keys
+		return s.user(ctx, queryUserByPhone, []any{s.fields.Index(columnPhone, id.Value), id.Value}, log, op)
+	default:
+		log.Error("unknown identifier kind")
+		return models.User{}, fmt.Errorf("%s: unknown identifier kind %q", op, id.Kind)
+	}
+}
+
+func (s *Storage) user(ctx context.Context, query string, args []any, log *slog.Logger, op string) (models.User, error) {
 	var user models.User
+	var createdAt int64
 
-	err := s.userByEmailStmt.QueryRowContext(ctx, email).Scan(&user.ID, &user.Email, &user.PassHash)
+	err := s.stmts.queryRow(ctx, query, args, userFields(&user, &createdAt)...)
 	if err != nil {
 		if ctx.Err() != nil {
 			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
@@ -183,131 +325,201 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := s.openUser(&user, createdAt); err != nil {
+		log.Error("failed to decrypt user", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return user, nil
 }
 
-func (s *Storage) App(ctx context.Context, appCode string) (models.App, error) {
-	const op = "storage.sqlite.App"
+// userFields returns the scan destinations of queryUserSelect columns.
+func userFields(user *models.User, createdAt *int64) []any {
+	return []any{&user.ID, &user.Email, &user.Username, &user.Phone, &user.PassHash, &user.PepperID,
+		&user.Blocked, &user.TokenVersion, createdAt}
+}
+
+// openUser finishes a user scanned with userFields: converts the creation time and decrypts the encrypted columns.
+func (s *Storage) openUser(user *models.User, createdAt int64) error {
+	user.CreatedAt = unixTime(createdAt)
+
+	phone, err := s.fields.Decrypt(columnPhone, user.Phone)
+	if err != nil {
+		return err
+	}
+	user.Phone = phone
+
+	return nil
+}
+
+// unixTime converts stored unix seconds to time, 0 to the zero time.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// SetUserIdentifier sets the username or the phone number of the user, an empty value clears it.
+func (s *Storage) SetUserIdentifier(ctx context.Context, userID int64, kind identifier.Kind, value string) error {
+	const op = "storage.sqlite.SetUserIdentifier"
 
 	log := s.log.With(
 		slog.String("op", op),
-		slog.String("app_code", appCode),
+		slog.Int64("user_id", userID),
+		slog.String("kind", string(kind)),
 	)
 
-	var app models.App
+	var query string
+	switch kind {
+	case identifier.Username:
+		query = queryUserUsernameUpdate
+	case identifier.Phone:
+		query = queryUserPhoneUpdate
+	default:
+		log.Error("identifier kind can not be set")
+		return fmt.Errorf("%s: identifier kind %q can not be set", op, kind)
+	}
+
+	// Пустое значение хранится как NULL, чтобы не нарушать уникальность
+	args := []any{nil, userID}
+	if kind == identifier.Phone {
+		args = []any{nil, nil, userID}
+	}
 
-	err := s.appByCodeStmt.QueryRowContext(ctx, appCode).Scan(&app.ID, &app.Code, &app.Secret)
+	if value != "" {
+		args[0] = value
+		if kind == identifier.Phone {
+			enc, err := s.fields.Encrypt(columnPhone, value)
+			if err != nil {
+				log.Error("failed to encrypt phone", sl.Err(err))
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			args[0], args[1] = enc, s.fields.Index(columnPhone, value)
+		}
+	}
+
+	res, err := s.stmts.exec(ctx, query, args...)
 	if err != nil {
 		if ctx.Err() != nil {
 			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
-			log.Error("failed to get app: context error", sl.Err(err))
-			return models.App{}, err
+			log.Error("failed to set identifier: context error", sl.Err(err))
+			return err
 		}
 
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Warn("app not found")
-			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		if isUniqueViolation(err) {
+			log.Warn("identifier is taken")
+			return fmt.Errorf("%s: %w", op, storage.ErrIdentifierTaken)
 		}
 
-		log.Error("failed to get app", sl.Err(err))
-		return models.App{}, fmt.Errorf("%s: %w", op, err)
+		log.Error("failed to set identifier", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return app, nil
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("user not found for update")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
 }
 
-func (s *Storage) UserApp(ctx context.Context, userID int64, appID int32) (models.UserApp, error) {
-	const op = "storage.sqlite.UserApp"
+// UpdateUserPassHash replaces the password hash of the user and the id of its pepper.
+func (s *Storage) UpdateUserPassHash(ctx context.Context, userID int64, passHash []byte, pepperID string) error {
+	const op = "storage.sqlite.UpdateUserPassHash"
 
 	log := s.log.With(
 		slog.String("op", op),
 		slog.Int64("user_id", userID),
-		slog.Int("app_id", int(appID)),
 	)
 
-	var userApp models.UserApp
-
-	err := s.userAppByUserIdAndAppIdStmt.QueryRowContext(ctx, userID, appID).
-		Scan(&userApp.UserID, &userApp.AppID, &userApp.IsEnabled)
+	res, err := s.stmts.exec(ctx, queryUserPassHashUpdate, passHash, pepperID, userID)
 	if err != nil {
 		if ctx.Err() != nil {
 			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
-			log.Error("failed to get userApp: context error", sl.Err(err))
-			return models.UserApp{}, err
+			log.Error("failed to update password hash: context error", sl.Err(err))
+			return err
 		}
 
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Warn("userApp not found")
-			return models.UserApp{}, fmt.Errorf("%s: %w", op, storage.ErrUserAppNotFound)
-		}
+		log.Error("failed to update password hash", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-		log.Error("failed to get userApp", sl.Err(err))
-		return models.UserApp{}, fmt.Errorf("%s: %w", op, err)
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return userApp, nil
+	if rowsAffected == 0 {
+		log.Warn("user not found for update")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
 }
 
-func (s *Storage) SaveUserApp(
-	ctx context.Context,
-	userID int64,
-	appID int32,
-	isEnabled bool,
-) (int64, error) {
-	const op = "storage.sqlite.SaveUserApp"
+// SetUserBlocked blocks or unblocks the user. Either way the token version is bumped,
+// so tokens issued before are no longer valid.
+func (s *Storage) SetUserBlocked(ctx context.Context, userID int64, blocked bool) error {
+	const op = "storage.sqlite.SetUserBlocked"
 
 	log := s.log.With(
 		slog.String("op", op),
 		slog.Int64("user_id", userID),
-		slog.Int("app_id", int(appID)),
+		slog.Bool("blocked", blocked),
 	)
 
-	res, err := s.userAppInsertStmt.ExecContext(ctx, userID, appID, isEnabled)
+	res, err := s.stmts.exec(ctx, queryUserBlockedUpdate, blocked, userID)
 	if err != nil {
 		if ctx.Err() != nil {
 			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
-			log.Error("failed to save userApp: context error", sl.Err(err))
-			return 0, err
-		}
-
-		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-			log.Warn("failed to save userApp: userApp already exists")
-			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserAppExists)
+			log.Error("failed to update user: context error", sl.Err(err))
+			return err
 		}
 
-		log.Error("failed to save userApp", sl.Err(err))
-		return 0, fmt.Errorf("%s: %w", op, err)
+		log.Error("failed to update user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	id, err := res.LastInsertId()
+	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		log.Error("failed to get last insert id", sl.Err(err))
-		return 0, fmt.Errorf("%s: %w", op, err)
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return id, nil
+	if rowsAffected == 0 {
+		log.Warn("user not found for update")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
 }
 
-func (s *Storage) UpdateUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) error {
-	const op = "storage.sqlite.UpdateUserApp"
+// RevokeUserTokens bumps the user's token version: tokens and sessions issued before stop validating.
+func (s *Storage) RevokeUserTokens(ctx context.Context, userID int64) error {
+	const op = "storage.sqlite.RevokeUserTokens"
 
 	log := s.log.With(
 		slog.String("op", op),
 		slog.Int64("user_id", userID),
-		slog.Int("app_id", int(appID)),
-		slog.Bool("is_enabled", isEnabled),
 	)
 
-	res, err := s.userAppUpdateStmt.ExecContext(ctx, isEnabled, userID, appID)
+	res, err := s.stmts.exec(ctx, queryUserTokensRevoke, userID)
 	if err != nil {
 		if ctx.Err() != nil {
 			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
-			log.Error("failed to update userApp: context error", sl.Err(err))
+			log.Error("failed to update user: context error", sl.Err(err))
 			return err
 		}
 
-		log.Error("failed to update userApp", sl.Err(err))
+		log.Error("failed to update user", sl.Err(err))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -318,82 +530,1304 @@ func (s *Storage) UpdateUserApp(ctx context.Context, userID int64, appID int32,
 	}
 
 	if rowsAffected == 0 {
-		log.Warn("userApp not found for update")
-		return fmt.Errorf("%s: %w", op, storage.ErrUserAppNotFound)
+		log.Warn("user not found for update")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 	}
 
-	log.Info("userApp updated successfully")
 	return nil
 }
 
-func (s *Storage) Close() error {
-	const op = "storage.sqlite.Close"
+// SoftDeleteUser marks the user as deleted: the account can no longer be found by email
+// and its tokens are revoked. Personal data stays until AnonymizeUser.
+func (s *Storage) SoftDeleteUser(ctx context.Context, userID int64, at time.Time) error {
+	const op = "storage.sqlite.SoftDeleteUser"
 
-	if s == nil {
-		return nil
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	res, err := s.stmts.exec(ctx, queryUserSoftDelete, at.Unix(), userID)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to delete user: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to delete user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if rowsAffected == 0 {
+		log.Warn("user not found for delete")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// DeletedUsersBefore returns up to limit ids of users soft-deleted before the time and not anonymized yet.
+func (s *Storage) DeletedUsersBefore(ctx context.Context, before time.Time, limit int) ([]int64, error) {
+	const op = "storage.sqlite.DeletedUsersBefore"
+
 	log := s.log.With(slog.String("op", op))
-	var errs []error
 
-	if s.userAppUpdateStmt != nil {
-		if err := s.userAppUpdateStmt.Close(); err != nil {
-			log.Error("failed to close userApp update statement", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close userAppUpdateStmt: %w", err))
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryUsersDeletedBefore, before.Unix(), limit)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get deleted users: context error", sl.Err(err))
+			return nil, err
+		}
+
+		log.Error("failed to get deleted users", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Error("failed to scan user id", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		s.userAppUpdateStmt = nil
+		ids = append(ids, id)
 	}
 
-	if s.userAppInsertStmt != nil {
-		if err := s.userAppInsertStmt.Close(); err != nil {
-			log.Error("failed to close userApp insert statement", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close userAppInsertStmt: %w", err))
-		}
-		s.userAppInsertStmt = nil
+	if err := rows.Err(); err != nil {
+		log.Error("failed to iterate deleted users", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if s.userAppByUserIdAndAppIdStmt != nil {
-		if err := s.userAppByUserIdAndAppIdStmt.Close(); err != nil {
-			log.Error("failed to close app by id statement", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close userAppByUserIdAndAppIdStmt: %w", err))
-		}
-		s.userAppByUserIdAndAppIdStmt = nil
+	return ids, nil
+}
+
+// AnonymizeUser erases personal data of a soft-deleted user. The user row and its
+// user_app records are kept with a placeholder email for audit.
+func (s *Storage) AnonymizeUser(ctx context.Context, userID int64, at time.Time) error {
+	const op = "storage.sqlite.AnonymizeUser"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	if s.appByCodeStmt != nil {
-		if err := s.appByCodeStmt.Close(); err != nil {
-			log.Error("failed to close app by id statement", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close appByCodeStmt: %w", err))
-		}
-		s.appByCodeStmt = nil
+	res, err := tx.ExecContext(ctx, queryUserAnonymize, at.Unix(), userID)
+	if err != nil {
+		log.Error("failed to anonymize user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if s.userByEmailStmt != nil {
-		if err := s.userByEmailStmt.Close(); err != nil {
-			log.Error("failed to close user by email statement", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close userByEmailStmt: %w", err))
-		}
-		s.userByEmailStmt = nil
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if s.userInsertStmt != nil {
-		if err := s.userInsertStmt.Close(); err != nil {
-			log.Error("failed to close user insert statement", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close userInsertStmt: %w", err))
-		}
-		s.userInsertStmt = nil
+	if rowsAffected == 0 {
+		log.Warn("deleted user not found")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
 	}
 
-	if s.db != nil {
-		if err := s.db.Close(); err != nil {
-			log.Error("failed to close database", sl.Err(err))
-			errs = append(errs, fmt.Errorf("close db: %w", err))
+	userData := []string{
+		queryUserDevicesDelete,
+		queryTokenClaimsUserDelete,
+		querySessionsUserDelete,
+		queryLoginHistoryUserDelete,
+		queryConsentsUserDelete,
+		queryRecoveryCodesUserDelete,
+	}
+	for _, query := range userData {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			log.Error("failed to delete user data", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
 		}
-		s.db = nil
 	}
 
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) App(ctx context.Context, appCode string) (models.App, error) {
+	const op = "storage.sqlite.App"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("app_code", appCode),
+	)
+
+	var app models.App
+	var claims string
+
+	err := s.stmts.queryRow(ctx, queryAppByCode, []any{appCode}, appFields(&app, &claims)...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get app: context error", sl.Err(err))
+			return models.App{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("app not found")
+			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
+		}
+
+		log.Error("failed to get app", sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := openApp(&app, claims); err != nil {
+		log.Error("failed to decode app claims template", sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// appFields returns the scan destinations of queryAppSelect columns.
+func appFields(app *models.App, claims *string) []any {
+	return []any{&app.ID, &app.Code, &app.Secret, &app.TokenFormat, &app.ThirdParty, &app.ConsentVersion, claims,
+		&app.WebhookURL}
+}
+
+// openApp finishes an app scanned with appFields: decodes the claims template, empty for none.
+func openApp(app *models.App, claims string) error {
+	if claims == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(claims), &app.Claims)
+}
+
+func (s *Storage) UserApp(ctx context.Context, userID int64, appID int32) (models.UserApp, error) {
+	const op = "storage.sqlite.UserApp"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", int(appID)),
+	)
+
+	var userApp models.UserApp
+
+	err := s.stmts.queryRow(ctx, queryUserAppByUserIdAndAppId, []any{userID, appID},
+		&userApp.UserID, &userApp.AppID, &userApp.IsEnabled)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get userApp: context error", sl.Err(err))
+			return models.UserApp{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("userApp not found")
+			return models.UserApp{}, fmt.Errorf("%s: %w", op, storage.ErrUserAppNotFound)
+		}
+
+		log.Error("failed to get userApp", sl.Err(err))
+		return models.UserApp{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userApp, nil
+}
+
+func (s *Storage) SaveUserApp(
+	ctx context.Context,
+	userID int64,
+	appID int32,
+	isEnabled bool,
+) (int64, error) {
+	const op = "storage.sqlite.SaveUserApp"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", int(appID)),
+	)
+
+	res, err := s.stmts.exec(ctx, queryUserAppInsert, userID, appID, isEnabled)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to save userApp: context error", sl.Err(err))
+			return 0, err
+		}
+
+		if isUniqueViolation(err) {
+			log.Warn("failed to save userApp: userApp already exists")
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserAppExists)
+		}
+
+		log.Error("failed to save userApp", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Error("failed to get last insert id", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UpsertUserApp returns the user_app row, creating it with isEnabled if it doesn't exist.
+// An existing row is returned unchanged.
+func (s *Storage) UpsertUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) (models.UserApp, error) {
+	const op = "storage.sqlite.UpsertUserApp"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", int(appID)),
+	)
+
+	var userApp models.UserApp
+
+	err := s.stmts.queryRow(ctx, queryUserAppUpsert, []any{userID, appID, isEnabled},
+		&userApp.UserID, &userApp.AppID, &userApp.IsEnabled)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to upsert userApp: context error", sl.Err(err))
+			return models.UserApp{}, err
+		}
+
+		log.Error("failed to upsert userApp", sl.Err(err))
+		return models.UserApp{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userApp, nil
+}
+
+func (s *Storage) UpdateUserApp(ctx context.Context, userID int64, appID int32, isEnabled bool) error {
+	const op = "storage.sqlite.UpdateUserApp"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", int(appID)),
+		slog.Bool("is_enabled", isEnabled),
+	)
+
+	res, err := s.stmts.exec(ctx, queryUserAppUpdate, isEnabled, userID, appID)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to update userApp: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to update userApp", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("userApp not found for update")
+		return fmt.Errorf("%s: %w", op, storage.ErrUserAppNotFound)
+	}
+
+	log.Info("userApp updated successfully")
+	return nil
+}
+
+func (s *Storage) SaveTokenClaims(ctx context.Context, claims models.TokenClaims) error {
+	const op = "storage.sqlite.SaveTokenClaims"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", claims.UserID),
+		slog.Int("app_id", int(claims.AppID)),
+	)
+
+	_, err := s.stmts.exec(ctx, queryTokenClaimsInsert,
+		claims.Ref, claims.UserID, claims.AppID, claims.Claims, claims.ExpiresAt.Unix())
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to save token claims: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to save token claims", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) TokenClaims(ctx context.Context, ref string) (models.TokenClaims, error) {
+	const op = "storage.sqlite.TokenClaims"
+
+	log := s.log.With(slog.String("op", op))
+
+	var (
+		claims    models.TokenClaims
+		expiresAt int64
+	)
+
+	err := s.stmts.queryRow(ctx, queryTokenClaimsByRef, []any{ref},
+		&claims.Ref, &claims.UserID, &claims.AppID, &claims.Claims, &expiresAt)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get token claims: context error", sl.Err(err))
+			return models.TokenClaims{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("token claims not found")
+			return models.TokenClaims{}, fmt.Errorf("%s: %w", op, storage.ErrClaimsNotFound)
+		}
+
+		log.Error("failed to get token claims", sl.Err(err))
+		return models.TokenClaims{}, fmt.Errorf("%s: %w", op, err)
+	}
+	claims.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return claims, nil
+}
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "storage.sqlite.SaveSession"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", session.UserID),
+		slog.Int("app_id", int(session.AppID)),
+	)
+
+	_, err := s.stmts.exec(ctx, querySessionInsert, session.ID, session.UserID, session.AppID,
+		session.TokenVersion, session.Claims, session.ExpiresAt.Unix())
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to save session: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to save session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, id string) (models.Session, error) {
+	const op = "storage.sqlite.Session"
+
+	log := s.log.With(slog.String("op", op))
+
+	var (
+		session   models.Session
+		expiresAt int64
+	)
+
+	err := s.stmts.queryRow(ctx, querySessionByID, []any{id},
+		&session.ID, &session.UserID, &session.AppID, &session.TokenVersion, &session.Claims, &expiresAt)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get session: context error", sl.Err(err))
+			return models.Session{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("session not found")
+			return models.Session{}, fmt.Errorf("%s: %w", op, storage.ErrSessionNotFound)
+		}
+
+		log.Error("failed to get session", sl.Err(err))
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return session, nil
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id string) error {
+	const op = "storage.sqlite.DeleteSession"
+
+	log := s.log.With(slog.String("op", op))
+
+	if _, err := s.stmts.exec(ctx, querySessionDelete, id); err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to delete session: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to delete session", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeToken marks the access token as revoked until it expires. Revoking twice is not an error.
+func (s *Storage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	const op = "storage.sqlite.RevokeToken"
+
+	log := s.log.With(slog.String("op", op))
+
+	if _, err := s.stmts.exec(ctx, queryRevokedTokenInsert, jti, expiresAt.Unix()); err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to revoke token: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to revoke token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	const op = "storage.sqlite.TokenRevoked"
+
+	log := s.log.With(slog.String("op", op))
+
+	var found int
+	if err := s.stmts.queryRow(ctx, queryRevokedTokenByJTI, []any{jti}, &found); err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to check token: context error", sl.Err(err))
+			return false, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		log.Error("failed to check token", sl.Err(err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+func (s *Storage) UserDevice(ctx context.Context, userID int64, fingerprint string) (models.UserDevice, error) {
+	const op = "storage.sqlite.UserDevice"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	var row deviceRow
+	err := s.stmts.queryRow(ctx, queryUserDeviceByFingerprint, []any{userID, fingerprint}, row.dest()...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get user device: context error", sl.Err(err))
+			return models.UserDevice{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.UserDevice{}, fmt.Errorf("%s: %w", op, storage.ErrDeviceNotFound)
+		}
+
+		log.Error("failed to get user device", sl.Err(err))
+		return models.UserDevice{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return row.device(), nil
+}
+
+// SaveUserDevice inserts the device or refreshes its last seen time if it is already known.
+func (s *Storage) SaveUserDevice(ctx context.Context, device models.UserDevice) error {
+	const op = "storage.sqlite.SaveUserDevice"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", device.UserID),
+	)
+
+	_, err := s.stmts.exec(ctx, queryUserDeviceUpsert,
+		device.UserID, device.Fingerprint, device.UserAgent, device.FirstSeenAt.Unix(), device.LastSeenAt.Unix())
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to save user device: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to save user device", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UserDeviceCount(ctx context.Context, userID int64) (int, error) {
+	const op = "storage.sqlite.UserDeviceCount"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	var count int
+
+	if err := s.stmts.queryRow(ctx, queryUserDeviceCount, []any{userID}, &count); err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to count user devices: context error", sl.Err(err))
+			return 0, err
+		}
+
+		log.Error("failed to count user devices", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, nil
+}
+
+// UseToken marks a single-use token as used. It returns storage.ErrTokenUsed
+// if the token has been used before.
+func (s *Storage) UseToken(ctx context.Context, jti string, purpose string, expiresAt time.Time) error {
+	const op = "storage.sqlite.UseToken"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("purpose", purpose),
+	)
+
+	_, err := s.stmts.exec(ctx, queryTokenUseInsert, jti, purpose, expiresAt.Unix())
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to use token: context error", sl.Err(err))
+			return err
+		}
+
+		if isPrimaryKeyViolation(err) {
+			log.Warn("failed to use token: token already used")
+			return fmt.Errorf("%s: %w", op, storage.ErrTokenUsed)
+		}
+
+		log.Error("failed to use token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveMaintenanceWindow schedules a maintenance window of the app.
+func (s *Storage) SaveMaintenanceWindow(ctx context.Context, window models.MaintenanceWindow) (int64, error) {
+	const op = "storage.sqlite.SaveMaintenanceWindow"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(window.AppID)),
+	)
+
+	res, err := s.stmts.exec(ctx, queryMaintenanceInsert,
+		window.AppID, window.StartsAt.Unix(), window.EndsAt.Unix(), window.Reason)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to save maintenance window: context error", sl.Err(err))
+			return 0, err
+		}
+
+		log.Error("failed to save maintenance window", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Error("failed to get last insert id", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) DeleteMaintenanceWindow(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.DeleteMaintenanceWindow"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("id", id),
+	)
+
+	res, err := s.stmts.exec(ctx, queryMaintenanceDelete, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to delete maintenance window: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to delete maintenance window", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get affected rows", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if affected == 0 {
+		log.Warn("maintenance window not found")
+		return fmt.Errorf("%s: %w", op, storage.ErrMaintenanceNotFound)
+	}
+
+	return nil
+}
+
+// ActiveMaintenanceWindow returns the maintenance window of the app in effect at now,
+// the one ending last if windows overlap.
+func (s *Storage) ActiveMaintenanceWindow(ctx context.Context, appID int32, now time.Time) (models.MaintenanceWindow, error) {
+	const op = "storage.sqlite.ActiveMaintenanceWindow"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(appID)),
+	)
+
+	var (
+		window           models.MaintenanceWindow
+		startsAt, endsAt int64
+	)
+
+	err := s.stmts.queryRow(ctx, queryMaintenanceActive, []any{appID, now.Unix(), now.Unix()},
+		&window.ID, &window.AppID, &startsAt, &endsAt, &window.Reason)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get maintenance window: context error", sl.Err(err))
+			return models.MaintenanceWindow{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MaintenanceWindow{}, fmt.Errorf("%s: %w", op, storage.ErrMaintenanceNotFound)
+		}
+
+		log.Error("failed to get maintenance window", sl.Err(err))
+		return models.MaintenanceWindow{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	window.StartsAt = time.Unix(startsAt, 0)
+	window.EndsAt = time.Unix(endsAt, 0)
+
+	return window, nil
+}
+
+// MaintenanceWindows returns the current and future maintenance windows of the app ordered by start.
+func (s *Storage) MaintenanceWindows(ctx context.Context, appID int32, now time.Time) ([]models.MaintenanceWindow, error) {
+	const op = "storage.sqlite.MaintenanceWindows"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(appID)),
+	)
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryMaintenanceUpcoming, appID, now.Unix())
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get maintenance windows: context error", sl.Err(err))
+			return nil, err
+		}
+
+		log.Error("failed to get maintenance windows", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var windows []models.MaintenanceWindow
+	for rows.Next() {
+		var (
+			window           models.MaintenanceWindow
+			startsAt, endsAt int64
+		)
+
+		if err := rows.Scan(&window.ID, &window.AppID, &startsAt, &endsAt, &window.Reason); err != nil {
+			log.Error("failed to scan maintenance window", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		window.StartsAt = time.Unix(startsAt, 0)
+		window.EndsAt = time.Unix(endsAt, 0)
+		windows = append(windows, window)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Error("failed to iterate maintenance windows", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return windows, nil
+}
+
+// AppDomains returns the email domains allowed in the app, empty if the app is unrestricted.
+func (s *Storage) AppDomains(ctx context.Context, appID int32) ([]string, error) {
+	const op = "storage.sqlite.AppDomains"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(appID)),
+	)
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryAppDomains, appID)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get app domains: context error", sl.Err(err))
+			return nil, err
+		}
+
+		log.Error("failed to get app domains", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			log.Error("failed to scan app domain", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		domains = append(domains, domain)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Error("failed to iterate app domains", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return domains, nil
+}
+
+func (s *Storage) SaveAppDomain(ctx context.Context, appID int32, domain string) error {
+	const op = "storage.sqlite.SaveAppDomain"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(appID)),
+		slog.String("domain", domain),
+	)
+
+	_, err := s.stmts.exec(ctx, queryAppDomainInsert, appID, domain)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to save app domain: context error", sl.Err(err))
+			return err
+		}
+
+		if isPrimaryKeyViolation(err) {
+			log.Warn("failed to save app domain: app domain already exists")
+			return fmt.Errorf("%s: %w", op, storage.ErrAppDomainExists)
+		}
+
+		log.Error("failed to save app domain", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteAppDomain(ctx context.Context, appID int32, domain string) error {
+	const op = "storage.sqlite.DeleteAppDomain"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(appID)),
+		slog.String("domain", domain),
+	)
+
+	res, err := s.stmts.exec(ctx, queryAppDomainDelete, appID, domain)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to delete app domain: context error", sl.Err(err))
+			return err
+		}
+
+		log.Error("failed to delete app domain", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("app domain not found")
+		return fmt.Errorf("%s: %w", op, storage.ErrAppDomainNotFound)
+	}
+
+	return nil
+}
+
+// ActiveSigningKey returns the newest not retired signing key of the app.
+func (s *Storage) ActiveSigningKey(ctx context.Context, appID int32) (models.SigningKey, error) {
+	const op = "storage.sqlite.ActiveSigningKey"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(appID)),
+	)
+
+	key, err := s.signingKey(ctx, querySigningKeyActive, appID)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get signing key: context error", sl.Err(err))
+			return models.SigningKey{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.SigningKey{}, fmt.Errorf("%s: %w", op, storage.ErrSigningKeyNotFound)
+		}
+
+		log.Error("failed to get signing key", sl.Err(err))
+		return models.SigningKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// SigningKey returns the signing key by its kid.
+func (s *Storage) SigningKey(ctx context.Context, kid string) (models.SigningKey, error) {
+	const op = "storage.sqlite.SigningKey"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("kid", kid),
+	)
+
+	key, err := s.signingKey(ctx, querySigningKeyByKid, kid)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get signing key: context error", sl.Err(err))
+			return models.SigningKey{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("signing key not found")
+			return models.SigningKey{}, fmt.Errorf("%s: %w", op, storage.ErrSigningKeyNotFound)
+		}
+
+		log.Error("failed to get signing key", sl.Err(err))
+		return models.SigningKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+func (s *Storage) signingKey(ctx context.Context, query string, arg any) (models.SigningKey, error) {
+	var (
+		key       models.SigningKey
+		createdAt int64
+		expiresAt sql.NullInt64
+	)
+
+	err := s.stmts.queryRow(ctx, query, []any{arg},
+		&key.ID, &key.AppID, &key.Secret, &createdAt, &expiresAt)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	key.CreatedAt = time.Unix(createdAt, 0)
+	if expiresAt.Valid {
+		key.ExpiresAt = time.Unix(expiresAt.Int64, 0)
+	}
+
+	return key, nil
+}
+
+// RotateSigningKey makes the key the active key of its app. Keys active before are retired:
+// they keep validating tokens until retireAt.
+func (s *Storage) RotateSigningKey(ctx context.Context, key models.SigningKey, retireAt time.Time) error {
+	const op = "storage.sqlite.RotateSigningKey"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", int(key.AppID)),
+		slog.String("kid", key.ID),
+	)
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, querySigningKeysRetire, retireAt.Unix(), key.AppID); err != nil {
+		log.Error("failed to retire signing keys", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, querySigningKeyInsert, key.ID, key.AppID, key.Secret, key.CreatedAt.Unix())
+	if err != nil {
+		log.Error("failed to save signing key", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveInvite saves the invite with its app grants and returns its id.
+func (s *Storage) SaveInvite(ctx context.Context, invite models.Invite) (int64, error) {
+	const op = "storage.sqlite.SaveInvite"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("email", invite.Email),
+	)
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, queryInviteInsert,
+		invite.TokenHash, invite.Email, invite.CreatedAt.Unix(), invite.ExpiresAt.Unix())
+	if err != nil {
+		log.Error("failed to save invite", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Error("failed to get last insert id", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, appID := range invite.AppIDs {
+		if _, err := tx.ExecContext(ctx, queryInviteAppInsert, id, appID); err != nil {
+			log.Error("failed to save invite app", slog.Int("app_id", int(appID)), sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// Invite returns the invite by the hash of its token, used and expired ones included.
+func (s *Storage) Invite(ctx context.Context, tokenHash string) (models.Invite, error) {
+	const op = "storage.sqlite.Invite"
+
+	log := s.log.With(slog.String("op", op))
+
+	var (
+		invite    models.Invite
+		createdAt int64
+		expiresAt int64
+		usedAt    sql.NullInt64
+	)
+
+	err := s.stmts.queryRow(ctx, queryInviteByTokenHash, []any{tokenHash},
+		&invite.ID, &invite.TokenHash, &invite.Email, &createdAt, &expiresAt, &usedAt)
+	if err != nil {
+		if ctx.Err() != nil {
+			err := fmt.Errorf("%s: context error: %w", op, ctx.Err())
+			log.Error("failed to get invite: context error", sl.Err(err))
+			return models.Invite{}, err
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("invite not found")
+			return models.Invite{}, fmt.Errorf("%s: %w", op, storage.ErrInviteNotFound)
+		}
+
+		log.Error("failed to get invite", sl.Err(err))
+		return models.Invite{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invite.CreatedAt = time.Unix(createdAt, 0)
+	invite.ExpiresAt = time.Unix(expiresAt, 0)
+	if usedAt.Valid {
+		invite.UsedAt = time.Unix(usedAt.Int64, 0)
+	}
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryInviteApps, invite.ID)
+	if err != nil {
+		log.Error("failed to get invite apps", sl.Err(err))
+		return models.Invite{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var appID int32
+		if err := rows.Scan(&appID); err != nil {
+			log.Error("failed to scan invite app", sl.Err(err))
+			return models.Invite{}, fmt.Errorf("%s: %w", op, err)
+		}
+		invite.AppIDs = append(invite.AppIDs, appID)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Error("failed to iterate invite apps", sl.Err(err))
+		return models.Invite{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return invite, nil
+}
+
+// ConsumeInvite marks the invite used, creates the user with its email and grants access to its apps,
+// all in one transaction. An invite used or expired by at is reported as not found.
+func (s *Storage) ConsumeInvite(
+	ctx context.Context,
+	inviteID int64,
+	passHash []byte,
+	pepperID string,
+	at time.Time,
+) (int64, error) {
+	const op = "storage.sqlite.ConsumeInvite"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("invite_id", inviteID),
+	)
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var email string
+	err = tx.QueryRowContext(ctx, queryInviteUse, at.Unix(), inviteID, at.Unix()).Scan(&email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Warn("invite is used or expired")
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrInviteNotFound)
+		}
+
+		log.Error("failed to use invite", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, queryUserInsert, email, passHash, pepperID, time.Now().Unix())
+	if err != nil {
+		if isUniqueViolation(err) {
+			log.Warn("failed to save user: user already exists")
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+		}
+
+		log.Error("failed to save user", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	userID, err := res.LastInsertId()
+	if err != nil {
+		log.Error("failed to get last insert id", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, queryInviteUserApps, userID, inviteID); err != nil {
+		log.Error("failed to grant invite apps", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// DeleteInvitesExpiredBefore deletes invites, used or not, that expired before the time
+// and returns the number of deleted invites.
+func (s *Storage) DeleteInvitesExpiredBefore(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.sqlite.DeleteInvitesExpiredBefore"
+
+	log := s.log.With(slog.String("op", op))
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Внешние ключи SQLite не включены, поэтому строки invite_apps удаляются явно
+	if _, err := tx.ExecContext(ctx, queryInviteAppsExpiredDelete, before.Unix()); err != nil {
+		log.Error("failed to delete invite apps", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, queryInvitesExpiredDelete, before.Unix())
+	if err != nil {
+		log.Error("failed to delete invites", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		log.Error("failed to get rows affected", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+// DeleteExpired deletes opaque-token sessions, one-time token uses, stored claims and revoked tokens
+// that expired before the time and returns the number of deleted rows.
+func (s *Storage) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.sqlite.DeleteExpired"
+
+	log := s.log.With(slog.String("op", op))
+
+	// Таблицы независимы: отдельные запросы не держат блокировку записи на всё время очистки
+	var deleted int64
+	for _, query := range expiredDeletes {
+		res, err := s.db.ExecContext(ctx, query, before.Unix())
+		if err != nil {
+			log.Error("failed to delete expired rows", sl.Err(err))
+			return deleted, fmt.Errorf("%s: %w", op, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			log.Error("failed to get rows affected", sl.Err(err))
+			return deleted, fmt.Errorf("%s: %w", op, err)
+		}
+		deleted += n
+	}
+
+	return deleted, nil
+}
+
+// Vacuum rebuilds the database file to return the space of deleted rows and refreshes the planner statistics.
+// Writers are blocked while it runs.
+func (s *Storage) Vacuum(ctx context.Context) error {
+	const op = "storage.sqlite.Vacuum"
+
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to vacuum database", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, "PRAGMA optimize"); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to optimize database", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// readTimeout bounds ctx of a method iterating query rows by the read timeout.
+func (s *Storage) readTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, s.stmts.timeouts.Read)
+}
+
+// writeTimeout bounds ctx of a method running a transaction by the write timeout.
+func (s *Storage) writeTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, s.stmts.timeouts.Write)
+}
+
+// Stats returns the connection pool statistics.
+func (s *Storage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+func (s *Storage) Close() error {
+	const op = "storage.sqlite.Close"
+
+	if s == nil || s.db == nil {
+		return nil
+	}
+
+	log := s.log.With(slog.String("op", op))
+	var errs []error
+
+	if err := s.stmts.close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := s.db.Close(); err != nil {
+		log.Error("failed to close database", sl.Err(err))
+		errs = append(errs, fmt.Errorf("close db: %w", err))
+	}
+	s.db = nil
+
 	if len(errs) > 0 {
-		return fmt.Errorf("errors closing storage: %v", errs)
+		return fmt.Errorf("%s: %w", op, errors.Join(errs...))
 	}
 
 	log.Info("storage closed successfully")
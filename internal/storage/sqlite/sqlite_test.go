@@ -0,0 +1,761 @@
+//go:build !sqlcipher
+
+// Драйвер sqlite3 golang-migrate тянет mattn/go-sqlite3, с тегом sqlcipher см. cipher_test.go
+
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sso/internal/domain/models"
+	"sso/internal/lib/identifier"
+	"sso/internal/storage"
+	"sso/internal/storage/sqlite"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/stretchr/testify/require"
+)
+
+// Приложения из тестовых сидов tests/migrations
+const (
+	testAppID   int32 = 1
+	testAppCode       = "test"
+	webAppID    int32 = 2
+)
+
+// newStorage opens a temporary database with all migrations and test seeds applied.
+func newStorage(t *testing.T) *sqlite.Storage {
+	t.Helper()
+
+	st, _ := newStorageAt(t)
+
+	return st
+}
+
+// newStorageAt is newStorage that also returns the database path, for checks the storage API can't make.
+func newStorageAt(t *testing.T) (*sqlite.Storage, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "sso.db")
+	root := repoRoot()
+
+	migrateUp(t, path, filepath.Join(root, "migrations"), "migrations")
+	migrateUp(t, path, filepath.Join(root, "tests", "migrations"), "migrations_seed")
+
+	st, err := sqlite.New(path, sqlite.PoolOptions{MaxOpenConns: 4}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = st.Close() })
+
+	return st, path
+}
+
+func migrateUp(t *testing.T, storagePath string, migrationsPath string, table string) {
+	t.Helper()
+
+	m, err := migrate.New(
+		"file://"+migrationsPath,
+		fmt.Sprintf("sqlite3://%s?x-migrations-table=%s", storagePath, table),
+	)
+	require.NoError(t, err)
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("%s: %v", migrationsPath, err)
+	}
+}
+
+func repoRoot() string {
+	_, file, _, _ := runtime.Caller(0)
+
+	return filepath.Join(filepath.Dir(file), "..", "..", "..")
+}
+
+func saveUser(t *testing.T, st *sqlite.Storage, email string) int64 {
+	t.Helper()
+
+	id, err := st.SaveUser(context.Background(), email, []byte("hash"), "")
+	require.NoError(t, err)
+
+	return id
+}
+
+func TestMigrations(t *testing.T) {
+	st := newStorage(t)
+
+	require.NoError(t, st.Ping(context.Background()))
+	require.NoError(t, st.CheckMigrations(context.Background()))
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	st, err := sqlite.New(filepath.Join(t.TempDir(), "sso.db"), sqlite.PoolOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer st.Close()
+
+	require.ErrorIs(t, st.CheckSchema(ctx), sqlite.ErrNoSchema)
+
+	n, err := st.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, sqlite.RequiredMigrationVersion, n)
+	require.NoError(t, st.CheckSchema(ctx))
+	require.NoError(t, st.CheckMigrations(ctx))
+
+	n, err = st.Migrate(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	_, err = st.SaveUser(ctx, "user@example.com", []byte("hash"), "")
+	require.NoError(t, err)
+}
+
+func TestMigrate_AfterMigrator(t *testing.T) {
+	// База, размеченная golang-migrate, уже актуальна
+	n, err := newStorage(t).Migrate(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestUsers(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	id, err := st.SaveUser(ctx, "user@example.com", []byte("hash"), "p1")
+	require.NoError(t, err)
+
+	_, err = st.SaveUser(ctx, "user@example.com", []byte("hash"), "")
+	require.ErrorIs(t, err, storage.ErrUserExists)
+
+	user, err := st.User(ctx, "user@example.com")
+	require.NoError(t, err)
+	require.Equal(t, id, user.ID)
+	require.Equal(t, []byte("hash"), user.PassHash)
+	require.Equal(t, "p1", user.PepperID)
+	require.False(t, user.CreatedAt.IsZero())
+
+	byID, err := st.UserByID(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, user, byID)
+
+	_, err = st.User(ctx, "missing@example.com")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = st.UserByID(ctx, id+100)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	require.NoError(t, st.UpdateUserPassHash(ctx, id, []byte("new"), "p2"))
+	user, err = st.UserByID(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new"), user.PassHash)
+	require.Equal(t, "p2", user.PepperID)
+	require.ErrorIs(t, st.UpdateUserPassHash(ctx, id+100, nil, ""), storage.ErrUserNotFound)
+
+	require.NoError(t, st.SetUserBlocked(ctx, id, true))
+	user, err = st.UserByID(ctx, id)
+	require.NoError(t, err)
+	require.True(t, user.Blocked)
+	require.ErrorIs(t, st.SetUserBlocked(ctx, id+100, true), storage.ErrUserNotFound)
+
+	require.NoError(t, st.RevokeUserTokens(ctx, id))
+	revoked, err := st.UserByID(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, user.TokenVersion+1, revoked.TokenVersion)
+	require.ErrorIs(t, st.RevokeUserTokens(ctx, id+100), storage.ErrUserNotFound)
+}
+
+func TestSaveUsers(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	saveUser(t, st, "taken@example.com")
+
+	errs, err := st.SaveUsers(ctx, []models.User{
+		{Email: "a@example.com", PassHash: []byte("hash")},
+		{Email: "taken@example.com", PassHash: []byte("hash")},
+		{Email: "a@example.com", PassHash: []byte("hash")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], storage.ErrUserExists)
+	require.ErrorIs(t, errs[2], storage.ErrUserExists)
+
+	_, err = st.User(ctx, "a@example.com")
+	require.NoError(t, err)
+}
+
+func TestUserIdentifiers(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	id := saveUser(t, st, "user@example.com")
+	other := saveUser(t, st, "other@example.com")
+
+	require.NoError(t, st.SetUserIdentifier(ctx, id, identifier.Phone, "+15550001111"))
+	require.NoError(t, st.SetUserIdentifier(ctx, id, identifier.Username, "user"))
+
+	user, err := st.UserByIdentifier(ctx, identifier.Identifier{Kind: identifier.Phone, Value: "+15550001111"})
+	require.NoError(t, err)
+	require.Equal(t, id, user.ID)
+	require.Equal(t, "user", user.Username)
+
+	user, err = st.UserByIdentifier(ctx, identifier.Identifier{Kind: identifier.Email, Value: "user@example.com"})
+	require.NoError(t, err)
+	require.Equal(t, id, user.ID)
+
+	_, err = st.UserByIdentifier(ctx, identifier.Identifier{Kind: identifier.Username, Value: "missing"})
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	err = st.SetUserIdentifier(ctx, other, identifier.Phone, "+15550001111")
+	require.ErrorIs(t, err, storage.ErrIdentifierTaken)
+	require.ErrorIs(t, st.SetUserIdentifier(ctx, id+100, identifier.Username, "x"), storage.ErrUserNotFound)
+}
+
+func TestDeleteUser(t *testing.T) {
+	st, path := newStorageAt(t)
+	ctx := context.Background()
+
+	id := saveUser(t, st, "user@example.com")
+	now := time.Now()
+
+	require.NoError(t, st.SetUserIdentifier(ctx, id, identifier.Phone, "+15550001111"))
+	require.NoError(t, st.SetUserIdentifier(ctx, id, identifier.Username, "user"))
+	_, err := st.SaveUserApp(ctx, id, testAppID, true)
+	require.NoError(t, err)
+	require.NoError(t, st.RecordLogin(ctx, models.Login{UserID: id, AppID: testAppID, IP: "192.0.2.1", CreatedAt: now}))
+
+	require.NoError(t, st.SoftDeleteUser(ctx, id, now.Add(-time.Hour)))
+	_, err = st.UserByID(ctx, id)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = st.UserByIdentifier(ctx, identifier.Identifier{Kind: identifier.Username, Value: "user"})
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+	require.ErrorIs(t, st.SoftDeleteUser(ctx, id, now), storage.ErrUserNotFound)
+
+	// До конца срока хранения данные не трогаются
+	ids, err := st.DeletedUsersBefore(ctx, now.Add(-2*time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	ids, err = st.DeletedUsersBefore(ctx, now, 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{id}, ids)
+
+	require.NoError(t, st.AnonymizeUser(ctx, id, now))
+
+	ids, err = st.DeletedUsersBefore(ctx, now, 10)
+	require.NoError(t, err)
+	require.Empty(t, ids)
+
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	var (
+		email    string
+		username sql.NullString
+		phone    sql.NullString
+		passHash []byte
+	)
+	err = db.QueryRowContext(ctx, "SELECT email, username, phone, pass_hash FROM users WHERE id = ?", id).
+		Scan(&email, &username, &phone, &passHash)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("deleted-%d@invalid", id), email)
+	require.False(t, username.Valid)
+	require.False(t, phone.Valid)
+	require.Empty(t, passHash)
+
+	history, err := st.LoginHistory(ctx, id, 10)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	// Привязки к приложениям остаются для аудита
+	userApp, err := st.UserApp(ctx, id, testAppID)
+	require.NoError(t, err)
+	require.Equal(t, id, userApp.UserID)
+
+	// Email удалённого пользователя снова свободен
+	saveUser(t, st, "user@example.com")
+}
+
+func TestApps(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	app, err := st.App(ctx, testAppCode)
+	require.NoError(t, err)
+	require.Equal(t, testAppID, app.ID)
+	require.Equal(t, "test-secret", app.Secret)
+
+	_, err = st.App(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrAppNotFound)
+
+	apps, next, err := st.ListApps(ctx, storage.AppFilter{CodePrefix: "te"}, storage.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, next)
+	require.Len(t, apps, 1)
+	require.Equal(t, testAppCode, apps[0].Code)
+}
+
+func TestUserApps(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+
+	_, err := st.UserApp(ctx, userID, testAppID)
+	require.ErrorIs(t, err, storage.ErrUserAppNotFound)
+
+	id, err := st.SaveUserApp(ctx, userID, testAppID, true)
+	require.NoError(t, err)
+	require.NotZero(t, id)
+
+	_, err = st.SaveUserApp(ctx, userID, testAppID, true)
+	require.ErrorIs(t, err, storage.ErrUserAppExists)
+
+	userApp, err := st.UserApp(ctx, userID, testAppID)
+	require.NoError(t, err)
+	require.Equal(t, models.UserApp{UserID: userID, AppID: testAppID, IsEnabled: true}, userApp)
+
+	require.NoError(t, st.UpdateUserApp(ctx, userID, testAppID, false))
+	userApp, err = st.UserApp(ctx, userID, testAppID)
+	require.NoError(t, err)
+	require.False(t, userApp.IsEnabled)
+	require.ErrorIs(t, st.UpdateUserApp(ctx, userID, webAppID, true), storage.ErrUserAppNotFound)
+
+	userApp, err = st.UpsertUserApp(ctx, userID, webAppID, true)
+	require.NoError(t, err)
+	require.True(t, userApp.IsEnabled)
+	// Существующая строка возвращается без изменений
+	userApp, err = st.UpsertUserApp(ctx, userID, webAppID, false)
+	require.NoError(t, err)
+	require.True(t, userApp.IsEnabled)
+
+	grants, err := st.AppGrants(ctx, []int64{userID})
+	require.NoError(t, err)
+	require.Len(t, grants, 2)
+}
+
+func TestListUsers(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@other.com"} {
+		saveUser(t, st, email)
+	}
+
+	users, next, err := st.ListUsers(ctx, storage.UserFilter{}, storage.ListOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	require.NotEmpty(t, next)
+
+	users, next, err = st.ListUsers(ctx, storage.UserFilter{}, storage.ListOptions{Limit: 2, Cursor: next})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Empty(t, next)
+
+	users, _, err = st.ListUsers(ctx, storage.UserFilter{EmailPrefix: "c@"}, storage.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "c@other.com", users[0].Email)
+}
+
+func TestTokens(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	claims := models.TokenClaims{Ref: "ref", UserID: userID, AppID: testAppID, Claims: []byte(`{"a":1}`), ExpiresAt: expiresAt}
+	require.NoError(t, st.SaveTokenClaims(ctx, claims))
+	got, err := st.TokenClaims(ctx, "ref")
+	require.NoError(t, err)
+	require.Equal(t, claims.Claims, got.Claims)
+	require.Equal(t, userID, got.UserID)
+	_, err = st.TokenClaims(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrClaimsNotFound)
+
+	session := models.Session{ID: "sid", UserID: userID, AppID: testAppID, Claims: []byte("{}"), ExpiresAt: expiresAt}
+	require.NoError(t, st.SaveSession(ctx, session))
+	gotSession, err := st.Session(ctx, "sid")
+	require.NoError(t, err)
+	require.Equal(t, userID, gotSession.UserID)
+	require.NoError(t, st.DeleteSession(ctx, "sid"))
+	_, err = st.Session(ctx, "sid")
+	require.ErrorIs(t, err, storage.ErrSessionNotFound)
+
+	revoked, err := st.TokenRevoked(ctx, "jti")
+	require.NoError(t, err)
+	require.False(t, revoked)
+	require.NoError(t, st.RevokeToken(ctx, "jti", expiresAt))
+	revoked, err = st.TokenRevoked(ctx, "jti")
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	require.NoError(t, st.UseToken(ctx, "once", "reset_password", expiresAt))
+	require.ErrorIs(t, st.UseToken(ctx, "once", "reset_password", expiresAt), storage.ErrTokenUsed)
+
+	// Всё выше истекает через час
+	n, err := st.DeleteExpired(ctx, expiresAt.Add(time.Second))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, n)
+}
+
+func TestDevices(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+	now := time.Now().Truncate(time.Second)
+
+	_, err := st.UserDevice(ctx, userID, "fp")
+	require.ErrorIs(t, err, storage.ErrDeviceNotFound)
+
+	require.NoError(t, st.SaveUserDevice(ctx, models.UserDevice{
+		UserID:      userID,
+		Fingerprint: "fp",
+		UserAgent:   "ua",
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}))
+
+	device, err := st.UserDevice(ctx, userID, "fp")
+	require.NoError(t, err)
+	require.Equal(t, "ua", device.UserAgent)
+
+	count, err := st.UserDeviceCount(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	require.NoError(t, st.TrustUserDevice(ctx, userID, "fp", []byte("token"), now.Add(time.Hour)))
+	trusted, err := st.TrustedUserDevice(ctx, []byte("token"))
+	require.NoError(t, err)
+	require.Equal(t, device.ID, trusted.ID)
+	require.True(t, trusted.Trusted(now))
+
+	devices, err := st.UserDevices(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+
+	require.NoError(t, st.DeleteUserDevice(ctx, userID, device.ID))
+	require.ErrorIs(t, st.DeleteUserDevice(ctx, userID, device.ID), storage.ErrDeviceNotFound)
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Second)
+
+	_, err := st.ActiveMaintenanceWindow(ctx, testAppID, now)
+	require.ErrorIs(t, err, storage.ErrMaintenanceNotFound)
+
+	id, err := st.SaveMaintenanceWindow(ctx, models.MaintenanceWindow{
+		AppID:    testAppID,
+		StartsAt: now.Add(-time.Minute),
+		EndsAt:   now.Add(time.Hour),
+		Reason:   "upgrade",
+	})
+	require.NoError(t, err)
+
+	window, err := st.ActiveMaintenanceWindow(ctx, testAppID, now)
+	require.NoError(t, err)
+	require.Equal(t, id, window.ID)
+	require.Equal(t, "upgrade", window.Reason)
+
+	windows, err := st.MaintenanceWindows(ctx, testAppID, now)
+	require.NoError(t, err)
+	require.Len(t, windows, 1)
+
+	require.NoError(t, st.DeleteMaintenanceWindow(ctx, id))
+	require.ErrorIs(t, st.DeleteMaintenanceWindow(ctx, id), storage.ErrMaintenanceNotFound)
+}
+
+func TestAppDomains(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, st.SaveAppDomain(ctx, testAppID, "example.com"))
+	require.ErrorIs(t, st.SaveAppDomain(ctx, testAppID, "example.com"), storage.ErrAppDomainExists)
+
+	domains, err := st.AppDomains(ctx, testAppID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"example.com"}, domains)
+
+	require.NoError(t, st.DeleteAppDomain(ctx, testAppID, "example.com"))
+	require.ErrorIs(t, st.DeleteAppDomain(ctx, testAppID, "example.com"), storage.ErrAppDomainNotFound)
+}
+
+func TestSigningKeys(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Second)
+
+	_, err := st.ActiveSigningKey(ctx, testAppID)
+	require.ErrorIs(t, err, storage.ErrSigningKeyNotFound)
+
+	require.NoError(t, st.RotateSigningKey(ctx, models.SigningKey{ID: "k1", AppID: testAppID, Secret: "s1", CreatedAt: now}, now))
+	require.NoError(t, st.RotateSigningKey(ctx, models.SigningKey{ID: "k2", AppID: testAppID, Secret: "s2", CreatedAt: now}, now.Add(time.Hour)))
+
+	key, err := st.ActiveSigningKey(ctx, testAppID)
+	require.NoError(t, err)
+	require.Equal(t, "k2", key.ID)
+
+	// Прежний ключ продолжает проверять подписи до retireAt
+	old, err := st.SigningKey(ctx, "k1")
+	require.NoError(t, err)
+	require.Equal(t, "s1", old.Secret)
+	require.Equal(t, now.Add(time.Hour).Unix(), old.ExpiresAt.Unix())
+
+	_, err = st.SigningKey(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrSigningKeyNotFound)
+}
+
+func TestInvites(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	now := time.Now().Truncate(time.Second)
+
+	id, err := st.SaveInvite(ctx, models.Invite{
+		TokenHash: "hash",
+		Email:     "invited@example.com",
+		AppIDs:    []int32{testAppID, webAppID},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	invite, err := st.Invite(ctx, "hash")
+	require.NoError(t, err)
+	require.Equal(t, id, invite.ID)
+	require.ElementsMatch(t, []int32{testAppID, webAppID}, invite.AppIDs)
+
+	_, err = st.Invite(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrInviteNotFound)
+
+	userID, err := st.ConsumeInvite(ctx, id, []byte("pass"), "", now)
+	require.NoError(t, err)
+
+	user, err := st.UserByID(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "invited@example.com", user.Email)
+
+	userApp, err := st.UserApp(ctx, userID, webAppID)
+	require.NoError(t, err)
+	require.True(t, userApp.IsEnabled)
+
+	_, err = st.ConsumeInvite(ctx, id, []byte("pass"), "", now)
+	require.Error(t, err)
+
+	n, err := st.DeleteInvitesExpiredBefore(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
+func TestConsents(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+
+	_, err := st.Consent(ctx, userID, testAppID)
+	require.ErrorIs(t, err, storage.ErrConsentNotFound)
+
+	require.NoError(t, st.SaveConsent(ctx, models.Consent{UserID: userID, AppID: testAppID, Version: 2, GrantedAt: time.Now()}))
+	consent, err := st.Consent(ctx, userID, testAppID)
+	require.NoError(t, err)
+	require.Equal(t, 2, consent.Version)
+
+	require.NoError(t, st.DeleteConsent(ctx, userID, testAppID))
+	require.ErrorIs(t, st.DeleteConsent(ctx, userID, testAppID), storage.ErrConsentNotFound)
+}
+
+func TestTerms(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+
+	_, err := st.TermsAcceptance(ctx, userID, "v1")
+	require.ErrorIs(t, err, storage.ErrTermsNotAccepted)
+
+	require.NoError(t, st.AcceptTerms(ctx, models.TermsAcceptance{UserID: userID, Version: "v1", AcceptedAt: time.Now()}))
+	acceptance, err := st.TermsAcceptance(ctx, userID, "v1")
+	require.NoError(t, err)
+	require.Equal(t, "v1", acceptance.Version)
+}
+
+func TestAttributes(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+
+	attrs, err := st.UserAttributes(ctx, userID)
+	require.NoError(t, err)
+	require.Empty(t, attrs)
+
+	attrs, err = st.PatchUserAttributes(ctx, userID, map[string]json.RawMessage{"a": json.RawMessage(`1`), "b": json.RawMessage(`"x"`)}, 1024)
+	require.NoError(t, err)
+	require.Len(t, attrs, 2)
+
+	// null удаляет атрибут
+	attrs, err = st.PatchUserAttributes(ctx, userID, map[string]json.RawMessage{"a": json.RawMessage(`null`)}, 1024)
+	require.NoError(t, err)
+	require.Equal(t, map[string]json.RawMessage{"b": json.RawMessage(`"x"`)}, attrs)
+
+	_, err = st.PatchUserAttributes(ctx, userID, map[string]json.RawMessage{"c": json.RawMessage(`"too large"`)}, 8)
+	require.ErrorIs(t, err, storage.ErrAttributesTooLarge)
+}
+
+func TestRecovery(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+	now := time.Now()
+
+	email, err := st.RecoveryEmail(ctx, userID)
+	require.NoError(t, err)
+	require.Empty(t, email)
+
+	require.NoError(t, st.SetRecoveryEmail(ctx, userID, "backup@example.com"))
+	email, err = st.RecoveryEmail(ctx, userID)
+	require.NoError(t, err)
+	require.Equal(t, "backup@example.com", email)
+	require.ErrorIs(t, st.SetRecoveryEmail(ctx, userID+100, "x@example.com"), storage.ErrUserNotFound)
+
+	require.NoError(t, st.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("c1"), []byte("c2")}, now))
+	require.NoError(t, st.UseRecoveryCode(ctx, userID, []byte("c1"), now))
+	require.ErrorIs(t, st.UseRecoveryCode(ctx, userID, []byte("c1"), now), storage.ErrRecoveryCodeInvalid)
+
+	// Новые коды заменяют прежние
+	require.NoError(t, st.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("c3")}, now))
+	require.ErrorIs(t, st.UseRecoveryCode(ctx, userID, []byte("c2"), now), storage.ErrRecoveryCodeInvalid)
+	require.NoError(t, st.UseRecoveryCode(ctx, userID, []byte("c3"), now))
+}
+
+func TestLoginHistory(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	userID := saveUser(t, st, "user@example.com")
+	now := time.Now().Truncate(time.Second)
+
+	require.NoError(t, st.RecordLogin(ctx, models.Login{
+		UserID:    userID,
+		AppID:     testAppID,
+		IP:        "192.0.2.1",
+		Country:   "DE",
+		Latitude:  52.5,
+		Longitude: 13.4,
+		CreatedAt: now.Add(-time.Hour),
+	}))
+	require.NoError(t, st.RecordLogin(ctx, models.Login{UserID: userID, AppID: testAppID, IP: "192.0.2.2", Country: "FR", CreatedAt: now}))
+	require.NoError(t, st.RecordLoginFailure(ctx, testAppID, now))
+
+	history, err := st.LoginHistory(ctx, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "192.0.2.2", history[0].IP)
+	require.Equal(t, 52.5, history[1].Latitude)
+
+	countries, err := st.LoginCountries(ctx, userID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"DE", "FR"}, countries)
+
+	seen, err := st.LoginIPSeen(ctx, userID, "192.0.2.1")
+	require.NoError(t, err)
+	require.True(t, seen)
+	seen, err = st.LoginIPSeen(ctx, userID, "192.0.2.3")
+	require.NoError(t, err)
+	require.False(t, seen)
+
+	stats, err := st.UsageStats(ctx, now, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stats.TotalUsers)
+
+	n, err := st.DeleteLoginHistoryBefore(ctx, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
+func TestHousekeeping(t *testing.T) {
+	st := newStorage(t)
+	ctx := context.Background()
+
+	saveUser(t, st, "user@example.com")
+
+	require.NoError(t, st.Vacuum(ctx))
+	require.NoError(t, st.Snapshot(ctx, filepath.Join(t.TempDir(), "snapshot.db")))
+
+	n, err := st.RotateFieldKeys(ctx, 100)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sso.db")
+	migrateUp(t, path, filepath.Join(repoRoot(), "migrations"), "migrations")
+
+	st, err := sqlite.New(path, sqlite.PoolOptions{
+		Timeouts: sqlite.Timeouts{Read: time.Nanosecond, Write: time.Nanosecond},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer st.Close()
+
+	// Таймаут хранилища срабатывает раньше дедлайна вызова
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err = st.SaveUser(ctx, "user@example.com", []byte("hash"), "")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = st.UserByID(ctx, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = st.UserDevices(ctx, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.ErrorIs(t, st.ReplaceRecoveryCodes(ctx, 1, nil, time.Now()), context.DeadlineExceeded)
+}
+
+func TestReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sso.db")
+	migrateUp(t, path, filepath.Join(repoRoot(), "migrations"), "migrations")
+	ctx := context.Background()
+
+	rw, err := sqlite.New(path, sqlite.PoolOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.NoError(t, rw.CheckWritable(ctx))
+	id := saveUser(t, rw, "user@example.com")
+	require.NoError(t, rw.Close())
+
+	ro, err := sqlite.New("file:"+path+"?mode=ro", sqlite.PoolOptions{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	defer ro.Close()
+
+	require.ErrorIs(t, ro.CheckWritable(ctx), storage.ErrReadOnly)
+
+	_, err = ro.SaveUser(ctx, "other@example.com", []byte("hash"), "")
+	require.ErrorIs(t, err, storage.ErrReadOnly)
+
+	_, err = ro.UpsertUserApp(ctx, id, testAppID, true)
+	require.ErrorIs(t, err, storage.ErrReadOnly)
+
+	// Чтение продолжает работать
+	user, err := ro.UserByID(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "user@example.com", user.Email)
+}
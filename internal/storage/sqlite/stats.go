@@ -0,0 +1,247 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"time"
+)
+
+const (
+	queryUserLastLoginUpdate = "UPDATE users SET last_login_at = ? WHERE id = ?"
+	queryLoginStatsSuccess   = `INSERT INTO login_stats (day, app_id, successes) VALUES (?, ?, 1)
+		ON CONFLICT (day, app_id) DO UPDATE SET successes = successes + 1`
+	queryLoginStatsFailure = `INSERT INTO login_stats (day, app_id, failures) VALUES (?, ?, 1)
+		ON CONFLICT (day, app_id) DO UPDATE SET failures = failures + 1`
+	queryUsersCount       = "SELECT COUNT(*) FROM users WHERE deleted_at IS NULL"
+	queryUsersActiveCount = "SELECT COUNT(*) FROM users WHERE last_login_at >= ? AND deleted_at IS NULL"
+	queryLoginStatsByApp  = `SELECT a.id, a.code, COALESCE(SUM(s.successes), 0), COALESCE(SUM(s.failures), 0)
+		FROM apps a LEFT JOIN login_stats s ON s.app_id = a.id AND s.day >= ?
+		GROUP BY a.id, a.code ORDER BY a.code`
+	queryLoginHistoryInsert = `INSERT INTO login_history (user_id, app_id, ip, user_agent, country, asn, latitude, longitude,
+		new_country, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	queryLoginHistoryByUser = `SELECT h.id, h.user_id, h.app_id, COALESCE(a.code, ''), h.ip, h.user_agent, h.country, h.asn,
+		h.latitude, h.longitude, h.new_country, h.created_at FROM login_history h LEFT JOIN apps a ON a.id = h.app_id
+		WHERE h.user_id = ? ORDER BY h.created_at DESC, h.id DESC LIMIT ?`
+	queryLoginCountriesByUser = "SELECT DISTINCT country FROM login_history WHERE user_id = ? AND country != ''"
+	queryLoginIPSeen          = "SELECT EXISTS (SELECT 1 FROM login_history WHERE user_id = ? AND ip = ?)"
+	queryLoginHistoryDelete   = "DELETE FROM login_history WHERE created_at < ?"
+)
+
+// RecordLogin records a successful login: counts it for statistics and adds it to the login history of the user.
+func (s *Storage) RecordLogin(ctx context.Context, login models.Login) error {
+	const op = "storage.sqlite.RecordLogin"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", login.UserID),
+		slog.Int("app_id", int(login.AppID)),
+	)
+
+	at := login.CreatedAt
+
+	ctx, cancel := s.writeTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error("failed to begin transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, queryUserLastLoginUpdate, at.Unix(), login.UserID); err != nil {
+		log.Error("failed to update last login", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, queryLoginStatsSuccess, statsDay(at), login.AppID); err != nil {
+		log.Error("failed to count login", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, queryLoginHistoryInsert,
+		login.UserID, login.AppID, login.IP, login.UserAgent, login.Country, login.ASN, login.Latitude, login.Longitude,
+		login.NewCountry, at.Unix(),
+	)
+	if err != nil {
+		log.Error("failed to save login history", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("failed to commit transaction", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RecordLoginFailure records a failed login attempt to the app.
+func (s *Storage) RecordLoginFailure(ctx context.Context, appID int32, at time.Time) error {
+	const op = "storage.sqlite.RecordLoginFailure"
+
+	if _, err := s.stmts.exec(ctx, queryLoginStatsFailure, statsDay(at), appID); err != nil {
+		s.log.With(slog.String("op", op), slog.Int("app_id", int(appID))).Error("failed to count login failure", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UsageStats counts users, users active before now, and logins per app since the UTC day of since.
+func (s *Storage) UsageStats(ctx context.Context, now time.Time, since time.Time) (models.Stats, error) {
+	const op = "storage.sqlite.UsageStats"
+
+	log := s.log.With(slog.String("op", op))
+
+	var stats models.Stats
+
+	counts := []struct {
+		dst   *int64
+		query string
+		args  []any
+	}{
+		{&stats.TotalUsers, queryUsersCount, nil},
+		{&stats.ActiveUsers24h, queryUsersActiveCount, []any{now.Add(-24 * time.Hour).Unix()}},
+		{&stats.ActiveUsers7d, queryUsersActiveCount, []any{now.Add(-7 * 24 * time.Hour).Unix()}},
+	}
+	for _, c := range counts {
+		if err := s.stmts.queryRow(ctx, c.query, c.args, c.dst); err != nil {
+			log.Error("failed to count users", sl.Err(err))
+			return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryLoginStatsByApp, statsDay(since))
+	if err != nil {
+		log.Error("failed to count logins", sl.Err(err))
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var app models.AppLoginStats
+		if err := rows.Scan(&app.AppID, &app.AppCode, &app.Logins, &app.FailedLogins); err != nil {
+			log.Error("failed to scan login stats", sl.Err(err))
+			return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+		}
+		stats.Apps = append(stats.Apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("failed to count logins", sl.Err(err))
+		return models.Stats{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+// statsDay returns the start of the UTC day of the time in unix seconds.
+func statsDay(t time.Time) int64 {
+	return t.UTC().Truncate(24 * time.Hour).Unix()
+}
+
+// LoginHistory returns the latest logins of the user, newest first.
+func (s *Storage) LoginHistory(ctx context.Context, userID int64, limit int) ([]models.Login, error) {
+	const op = "storage.sqlite.LoginHistory"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryLoginHistoryByUser, userID, limit)
+	if err != nil {
+		log.Error("failed to get login history", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var logins []models.Login
+	for rows.Next() {
+		var login models.Login
+		var createdAt int64
+		err := rows.Scan(&login.ID, &login.UserID, &login.AppID, &login.AppCode, &login.IP, &login.UserAgent,
+			&login.Country, &login.ASN, &login.Latitude, &login.Longitude, &login.NewCountry, &createdAt)
+		if err != nil {
+			log.Error("failed to scan login", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		login.CreatedAt = time.Unix(createdAt, 0)
+		logins = append(logins, login)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("failed to get login history", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return logins, nil
+}
+
+// LoginCountries returns the countries the user has logged in from, in no particular order.
+func (s *Storage) LoginCountries(ctx context.Context, userID int64) ([]string, error) {
+	const op = "storage.sqlite.LoginCountries"
+
+	ctx, cancel := s.readTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.stmts.query(ctx, queryLoginCountriesByUser, userID)
+	if err != nil {
+		s.log.With(slog.String("op", op), slog.Int64("user_id", userID)).Error("failed to get login countries", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var countries []string
+	for rows.Next() {
+		var country string
+		if err := rows.Scan(&country); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		countries = append(countries, country)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return countries, nil
+}
+
+// LoginIPSeen reports whether the user has logged in from the IP address before.
+func (s *Storage) LoginIPSeen(ctx context.Context, userID int64, ip string) (bool, error) {
+	const op = "storage.sqlite.LoginIPSeen"
+
+	var seen bool
+	if err := s.stmts.queryRow(ctx, queryLoginIPSeen, []any{userID, ip}, &seen); err != nil {
+		s.log.With(slog.String("op", op), slog.Int64("user_id", userID)).Error("failed to check login ip", sl.Err(err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return seen, nil
+}
+
+// DeleteLoginHistoryBefore deletes the logins made before the time and returns their number.
+func (s *Storage) DeleteLoginHistoryBefore(ctx context.Context, before time.Time) (int64, error) {
+	const op = "storage.sqlite.DeleteLoginHistoryBefore"
+
+	res, err := s.stmts.exec(ctx, queryLoginHistoryDelete, before.Unix())
+	if err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to delete login history", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timeouts bound the storage operations independently of the request deadline, so one slow
+// query doesn't use up the whole budget of a call. Zero disables a timeout.
+type Timeouts struct {
+	// Read bounds a query, including the iteration of its rows.
+	Read time.Duration
+	// Write bounds a statement changing data or a whole transaction.
+	Write time.Duration
+}
+
+// stmtRegistry prepares statements lazily on first use, keyed by query text.
+// A statement invalidated by a schema change is re-prepared and the call is retried once.
+// database/sql re-prepares a statement on every pooled connection it runs on, so connections
+// recycled by ConnMaxLifetime or ConnMaxIdleTime need no handling here.
+type stmtRegistry struct {
+	db       *sql.DB
+	log      *slog.Logger
+	timeouts Timeouts
+
+	mu    sync.RWMutex
+	stmts map[string]*cachedStmt
+}
+
+// cachedStmt counts the callers running the statement, so an invalidated statement
+// is closed only after the last of them is done with it.
+type cachedStmt struct {
+	stmt  *sql.Stmt
+	refs  atomic.Int64
+	stale atomic.Bool
+	once  sync.Once
+}
+
+// release ends a use of the statement and closes it if it was the last use of a stale one.
+func (c *cachedStmt) release() {
+	if c.refs.Add(-1) == 0 && c.stale.Load() {
+		c.close()
+	}
+}
+
+func (c *cachedStmt) close() {
+	c.once.Do(func() { _ = c.stmt.Close() })
+}
+
+func newStmtRegistry(db *sql.DB, log *slog.Logger, timeouts Timeouts) *stmtRegistry {
+	return &stmtRegistry{
+		db:       db,
+		log:      log,
+		timeouts: timeouts,
+		stmts:    make(map[string]*cachedStmt),
+	}
+}
+
+// exec runs a prepared statement that returns no rows within the write timeout.
+// A write rejected by a read-only database also matches storage.ErrReadOnly.
+func (r *stmtRegistry) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var res sql.Result
+
+	err := r.withStmt(ctx, query, func(stmt *sql.Stmt) error {
+		var err error
+		res, err = stmt.ExecContext(ctx, args...)
+		return err
+	})
+	if isReadOnly(err) {
+		return nil, fmt.Errorf("%w: %w", storage.ErrReadOnly, err)
+	}
+
+	return res, err
+}
+
+// queryRow runs a prepared statement and scans its single row into dest within the read timeout.
+func (r *stmtRegistry) queryRow(ctx context.Context, query string, args []any, dest ...any) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+
+	err := r.withStmt(ctx, query, func(stmt *sql.Stmt) error {
+		return stmt.QueryRowContext(ctx, args...).Scan(dest...)
+	})
+	// Вставки с RETURNING тоже выполняются через queryRow
+	if isReadOnly(err) {
+		return fmt.Errorf("%w: %w", storage.ErrReadOnly, err)
+	}
+
+	return err
+}
+
+// query runs a prepared statement returning multiple rows, the caller must close them.
+// The rows outlive the call, so the caller bounds ctx with Storage.readTimeout instead.
+func (r *stmtRegistry) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+
+	err := r.withStmt(ctx, query, func(stmt *sql.Stmt) error {
+		var err error
+		rows, err = stmt.QueryContext(ctx, args...)
+		return err
+	})
+
+	return rows, err
+}
+
+// inTx returns the prepared statement bound to the transaction, the caller must close it.
+func (r *stmtRegistry) inTx(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	cached, err := r.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	// Оператор транзакции не зависит от закрытия кэшированного после создания
+	defer cached.release()
+
+	return tx.StmtContext(ctx, cached.stmt), nil
+}
+
+// withTimeout bounds ctx by d, a zero d leaves it as is.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+func (r *stmtRegistry) withStmt(ctx context.Context, query string, fn func(stmt *sql.Stmt) error) error {
+	cached, err := r.acquire(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	err = fn(cached.stmt)
+	if !isSchemaChanged(err) {
+		cached.release()
+		return err
+	}
+
+	r.log.Warn("schema changed, re-preparing statement", slog.String("query", query))
+	r.invalidate(query, cached)
+	cached.release()
+
+	cached, err = r.acquire(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer cached.release()
+
+	return fn(cached.stmt)
+}
+
+// acquire returns the statement of the query, preparing it if needed. The caller must release it.
+func (r *stmtRegistry) acquire(ctx context.Context, query string) (*cachedStmt, error) {
+	r.mu.RLock()
+	cached, ok := r.stmts[query]
+	if ok {
+		// Счётчик увеличивается под блокировкой, чтобы invalidate не закрыл оператор между поиском и использованием
+		cached.refs.Add(1)
+	}
+	r.mu.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cached, ok := r.stmts[query]; ok {
+		cached.refs.Add(1)
+		return cached, nil
+	}
+
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		r.log.Error("failed to prepare statement", slog.String("query", query), sl.Err(err))
+		return nil, fmt.Errorf("prepare: %w", err)
+	}
+
+	cached = &cachedStmt{stmt: stmt}
+	cached.refs.Add(1)
+	r.stmts[query] = cached
+
+	return cached, nil
+}
+
+// invalidate removes the stale statement of the query, unless another caller has already replaced it.
+// The statement is closed once the callers still running it release it.
+func (r *stmtRegistry) invalidate(query string, stale *cachedStmt) {
+	r.mu.Lock()
+	if r.stmts[query] == stale {
+		delete(r.stmts, query)
+	}
+	r.mu.Unlock()
+
+	stale.stale.Store(true)
+	if stale.refs.Load() == 0 {
+		stale.close()
+	}
+}
+
+// close closes all prepared statements and returns the joined errors.
+func (r *stmtRegistry) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for query, cached := range r.stmts {
+		if err := cached.stmt.Close(); err != nil {
+			r.log.Error("failed to close statement", slog.String("query", query), sl.Err(err))
+			errs = append(errs, fmt.Errorf("close statement %q: %w", query, err))
+		}
+	}
+	r.stmts = make(map[string]*cachedStmt)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStmtRegistry_InvalidateWhileInUse(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "stmts.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	r := newStmtRegistry(db, slog.New(slog.NewTextHandler(io.Discard, nil)), Timeouts{})
+	t.Cleanup(func() { _ = r.close() })
+
+	const query = "SELECT 1"
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 2000 {
+				var one int
+				if err := r.queryRow(ctx, query, nil, &one); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	// Так withStmt сбрасывает оператор после смены схемы, пока другие вызовы его выполняют
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 2000 {
+				cached, err := r.acquire(ctx, query)
+				if err != nil {
+					errs <- err
+					return
+				}
+				r.invalidate(query, cached)
+				cached.release()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+	"time"
+)
+
+const (
+	// Повторное принятие той же версии сохраняет время первого
+	queryTermsAccept = `INSERT INTO terms_acceptances (user_id, version, accepted_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, version) DO NOTHING`
+	queryTermsAcceptance = `SELECT user_id, version, accepted_at FROM terms_acceptances
+		WHERE user_id = ? AND version = ?`
+)
+
+// AcceptTerms records that the user accepted the version of the terms of service.
+func (s *Storage) AcceptTerms(ctx context.Context, acceptance models.TermsAcceptance) error {
+	const op = "storage.sqlite.AcceptTerms"
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", acceptance.UserID),
+		slog.String("version", acceptance.Version),
+	)
+
+	_, err := s.stmts.exec(ctx, queryTermsAccept, acceptance.UserID, acceptance.Version, acceptance.AcceptedAt.Unix())
+	if err != nil {
+		log.Error("failed to save terms acceptance", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TermsAcceptance returns when the user accepted the version of the terms of service.
+func (s *Storage) TermsAcceptance(ctx context.Context, userID int64, version string) (models.TermsAcceptance, error) {
+	const op = "storage.sqlite.TermsAcceptance"
+
+	var acceptance models.TermsAcceptance
+	var acceptedAt int64
+
+	err := s.stmts.queryRow(ctx, queryTermsAcceptance, []any{userID, version},
+		&acceptance.UserID, &acceptance.Version, &acceptedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TermsAcceptance{}, fmt.Errorf("%s: %w", op, storage.ErrTermsNotAccepted)
+		}
+
+		s.log.With(slog.String("op", op)).Error("failed to get terms acceptance", sl.Err(err))
+		return models.TermsAcceptance{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	acceptance.AcceptedAt = time.Unix(acceptedAt, 0)
+
+	return acceptance, nil
+}
@@ -3,9 +3,28 @@ package storage
 import "errors"
 
 var (
-	ErrUserExists      = errors.New("user already exists")
-	ErrUserNotFound    = errors.New("user not found")
-	ErrAppNotFound     = errors.New("app not found")
-	ErrUserAppNotFound = errors.New("userApp not found")
-	ErrUserAppExists   = errors.New("userApp already exists")
+	ErrUserExists          = errors.New("user already exists")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrIdentifierTaken     = errors.New("identifier already taken")
+	ErrAppNotFound         = errors.New("app not found")
+	ErrUserAppNotFound     = errors.New("userApp not found")
+	ErrUserAppExists       = errors.New("userApp already exists")
+	ErrClaimsNotFound      = errors.New("token claims not found")
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrTokenUsed           = errors.New("token already used")
+	ErrMaintenanceNotFound = errors.New("maintenance window not found")
+	ErrAppDomainExists     = errors.New("app domain already exists")
+	ErrAppDomainNotFound   = errors.New("app domain not found")
+	ErrSigningKeyNotFound  = errors.New("signing key not found")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrConsentNotFound     = errors.New("consent not found")
+	ErrTermsNotAccepted    = errors.New("terms not accepted")
+	ErrAttributesTooLarge  = errors.New("user attributes too large")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid or used")
+	// ErrReadOnly is returned for writes while the database doesn't accept them, e.g. on a read-only volume.
+	ErrReadOnly = errors.New("storage is read-only")
+
+	ErrLoginSessionNotFound = errors.New("login session not found")
+	ErrCodeNotFound         = errors.New("verification code not found")
 )
@@ -0,0 +1,2 @@
+-- Нормализация адресов необратима, откатывается только отчёт о конфликтах
+DROP TABLE IF EXISTS user_email_conflicts;
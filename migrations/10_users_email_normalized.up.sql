@@ -0,0 +1,19 @@
+-- Адреса, которые после нормализации совпали бы с другим пользователем, не меняются и
+-- попадают в user_email_conflicts для ручного разбора. lower() в SQLite приводит только ASCII.
+CREATE TABLE IF NOT EXISTS user_email_conflicts
+(
+    user_id    INTEGER PRIMARY KEY,
+    email      TEXT NOT NULL,
+    normalized TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO user_email_conflicts (user_id, email, normalized)
+SELECT u.id, u.email, lower(trim(u.email))
+FROM users u
+WHERE u.email <> lower(trim(u.email))
+  AND EXISTS (SELECT 1 FROM users o WHERE o.id <> u.id AND lower(trim(o.email)) = lower(trim(u.email)));
+
+UPDATE users SET email = lower(trim(email))
+WHERE email <> lower(trim(email))
+  AND id NOT IN (SELECT user_id FROM user_email_conflicts);
@@ -0,0 +1,8 @@
+-- Разрешённые домены email приложения; нет строк — ограничений нет
+CREATE TABLE IF NOT EXISTS app_domains
+(
+    app_id INTEGER NOT NULL,
+    domain TEXT    NOT NULL,
+    PRIMARY KEY (app_id, domain),
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+-- Ключи подписи токенов; expires_at IS NULL — ключ не выведен из ротации
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    kid        TEXT PRIMARY KEY,
+    app_id     INTEGER NOT NULL,
+    secret     TEXT    NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER,
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_keys_app_id ON signing_keys (app_id, created_at);
@@ -0,0 +1,17 @@
+-- Формат токенов приложения: jwt или opaque
+ALTER TABLE apps ADD COLUMN token_format TEXT NOT NULL DEFAULT 'jwt';
+
+-- Сессии opaque-токенов; хранится хэш токена, а не сам токен
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id            TEXT    PRIMARY KEY,
+    user_id       INTEGER NOT NULL,
+    app_id        INTEGER NOT NULL,
+    token_version INTEGER NOT NULL,
+    claims        TEXT    NOT NULL,
+    expires_at    INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
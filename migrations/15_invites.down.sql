@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS invite_apps;
+DROP INDEX IF EXISTS idx_invites_expires_at;
+DROP TABLE IF EXISTS invites;
@@ -0,0 +1,22 @@
+-- Приглашения на регистрацию; хранится хэш токена приглашения
+CREATE TABLE IF NOT EXISTS invites
+(
+    id         INTEGER PRIMARY KEY,
+    token_hash TEXT    NOT NULL UNIQUE,
+    email      TEXT    NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    used_at    INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_invites_expires_at ON invites (expires_at);
+
+-- Приложения, доступ к которым выдаётся при регистрации по приглашению
+CREATE TABLE IF NOT EXISTS invite_apps
+(
+    invite_id INTEGER NOT NULL,
+    app_id    INTEGER NOT NULL,
+    PRIMARY KEY (invite_id, app_id),
+    FOREIGN KEY (invite_id) REFERENCES invites(id) ON DELETE CASCADE,
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
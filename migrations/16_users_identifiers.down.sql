@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_phone;
+DROP INDEX IF EXISTS idx_users_username;
+ALTER TABLE users DROP COLUMN phone;
+ALTER TABLE users DROP COLUMN username;
@@ -0,0 +1,6 @@
+-- Альтернативные идентификаторы для входа; NULL, если не заданы
+ALTER TABLE users ADD COLUMN username TEXT;
+ALTER TABLE users ADD COLUMN phone TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone ON users (phone);
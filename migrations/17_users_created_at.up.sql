@@ -0,0 +1,4 @@
+-- Время регистрации; NULL у пользователей, зарегистрированных до миграции
+ALTER TABLE users ADD COLUMN created_at INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (COALESCE(created_at, 0), id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS login_stats;
+DROP INDEX IF EXISTS idx_users_last_login_at;
+ALTER TABLE users DROP COLUMN last_login_at;
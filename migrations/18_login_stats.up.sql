@@ -0,0 +1,14 @@
+-- Время последнего успешного входа для подсчёта активных пользователей
+ALTER TABLE users ADD COLUMN last_login_at INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_users_last_login_at ON users (last_login_at) WHERE last_login_at IS NOT NULL;
+
+-- Счётчики входов по приложениям за сутки (UTC); day — unix-время начала суток
+CREATE TABLE IF NOT EXISTS login_stats
+(
+    day       INTEGER NOT NULL,
+    app_id    INTEGER NOT NULL,
+    successes INTEGER NOT NULL DEFAULT 0,
+    failures  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, app_id)
+);
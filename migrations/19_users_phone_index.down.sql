@@ -0,0 +1,5 @@
+-- Зашифрованные номера нужно расшифровать до отката: уникальность снова проверяется по phone
+DROP INDEX IF EXISTS idx_users_phone_index;
+ALTER TABLE users DROP COLUMN phone_index;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone ON users (phone);
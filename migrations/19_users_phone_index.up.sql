@@ -0,0 +1,7 @@
+-- Слепой индекс телефона: поиск и уникальность по нему, сам номер может храниться зашифрованным
+ALTER TABLE users ADD COLUMN phone_index TEXT;
+
+UPDATE users SET phone_index = phone WHERE phone IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_phone;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_index ON users (phone_index);
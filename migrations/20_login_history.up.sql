@@ -0,0 +1,17 @@
+-- История успешных входов: адрес, устройство и геоданные для обнаружения аномалий
+CREATE TABLE IF NOT EXISTS login_history
+(
+    id          INTEGER PRIMARY KEY,
+    user_id     INTEGER NOT NULL,
+    app_id      INTEGER NOT NULL,
+    ip          TEXT    NOT NULL DEFAULT '',
+    user_agent  TEXT    NOT NULL DEFAULT '',
+    country     TEXT    NOT NULL DEFAULT '',
+    asn         INTEGER NOT NULL DEFAULT 0,
+    new_country INTEGER NOT NULL DEFAULT 0,
+    created_at  INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_history_user_id ON login_history (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_history_created_at ON login_history (created_at);
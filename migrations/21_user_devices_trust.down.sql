@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_user_devices_trust_hash;
+ALTER TABLE user_devices DROP COLUMN trusted_until;
+ALTER TABLE user_devices DROP COLUMN trust_hash;
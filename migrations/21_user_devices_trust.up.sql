@@ -0,0 +1,5 @@
+-- Доверенные устройства («запомнить устройство»): SHA-256 токена устройства и срок доверия
+ALTER TABLE user_devices ADD COLUMN trust_hash BLOB;
+ALTER TABLE user_devices ADD COLUMN trusted_until INTEGER;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_devices_trust_hash ON user_devices (trust_hash) WHERE trust_hash IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_consents;
+ALTER TABLE apps DROP COLUMN consent_version;
+ALTER TABLE apps DROP COLUMN third_party;
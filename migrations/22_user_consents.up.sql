@@ -0,0 +1,15 @@
+-- Сторонние приложения требуют явного согласия пользователя на передачу его данных.
+-- Повышение consent_version запрашивает согласие заново
+ALTER TABLE apps ADD COLUMN third_party INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN consent_version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS user_consents
+(
+    user_id    INTEGER NOT NULL,
+    app_id     INTEGER NOT NULL,
+    version    INTEGER NOT NULL,
+    granted_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, app_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
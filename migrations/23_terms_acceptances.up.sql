@@ -0,0 +1,9 @@
+-- Принятие пользователями версий пользовательского соглашения
+CREATE TABLE IF NOT EXISTS terms_acceptances
+(
+    user_id     INTEGER NOT NULL,
+    version     TEXT    NOT NULL,
+    accepted_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, version),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
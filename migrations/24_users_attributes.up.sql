@@ -0,0 +1,2 @@
+-- Произвольные атрибуты пользователя (JSON-объект) для данных профиля приложений
+ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
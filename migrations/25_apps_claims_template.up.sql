@@ -0,0 +1,2 @@
+-- Шаблон claims токенов приложения (JSON): поля профиля, роли, атрибуты и переименования
+ALTER TABLE apps ADD COLUMN claims_template TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Адрес, на который приложению отправляются уведомления об изменении доступа пользователей
+ALTER TABLE apps ADD COLUMN webhook_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- Восстановление аккаунта при потере пароля и второго фактора: код на резервный email
+-- и один из заранее выданных кодов восстановления
+ALTER TABLE users ADD COLUMN recovery_email TEXT;
+
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    id         INTEGER PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    code_hash  BLOB    NOT NULL,
+    created_at INTEGER NOT NULL,
+    used_at    INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_login_history_user_ip;
+ALTER TABLE login_history DROP COLUMN longitude;
+ALTER TABLE login_history DROP COLUMN latitude;
@@ -0,0 +1,5 @@
+-- Координаты входа для обнаружения невозможных перемещений, известны только с городской базой GeoIP
+ALTER TABLE login_history ADD COLUMN latitude REAL NOT NULL DEFAULT 0;
+ALTER TABLE login_history ADD COLUMN longitude REAL NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_login_history_user_ip ON login_history (user_id, ip);
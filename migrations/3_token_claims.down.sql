@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_token_claims_expires_at;
+DROP TABLE IF EXISTS token_claims;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS token_claims
+(
+    ref        TEXT    PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    app_id     INTEGER NOT NULL,
+    claims     TEXT    NOT NULL,
+    expires_at INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_claims_expires_at ON token_claims (expires_at);
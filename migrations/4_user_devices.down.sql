@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_devices_user_id;
+DROP TABLE IF EXISTS user_devices;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_devices
+(
+    id            INTEGER PRIMARY KEY,
+    user_id       INTEGER NOT NULL,
+    fingerprint   TEXT    NOT NULL,
+    user_agent    TEXT    NOT NULL,
+    first_seen_at INTEGER NOT NULL,
+    last_seen_at  INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(user_id, fingerprint)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_devices_user_id ON user_devices (user_id);
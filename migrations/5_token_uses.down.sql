@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_token_uses_expires_at;
+DROP TABLE IF EXISTS token_uses;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS token_uses
+(
+    jti        TEXT    PRIMARY KEY,
+    purpose    TEXT    NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_uses_expires_at ON token_uses (expires_at);
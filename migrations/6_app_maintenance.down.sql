@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_app_maintenance_app_id_ends_at;
+DROP TABLE IF EXISTS app_maintenance;
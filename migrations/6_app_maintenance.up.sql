@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS app_maintenance
+(
+    id        INTEGER PRIMARY KEY,
+    app_id    INTEGER NOT NULL,
+    starts_at INTEGER NOT NULL,
+    ends_at   INTEGER NOT NULL,
+    reason    TEXT    NOT NULL DEFAULT '',
+    FOREIGN KEY (app_id) REFERENCES apps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_maintenance_app_id_ends_at ON app_maintenance (app_id, ends_at);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN pepper_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the schema, so the service can apply them
+// on startup and cmd/migrator works without the files next to the binary.
+package migrations
+
+import "embed"
+
+// FS holds the N_name.up.sql and N_name.down.sql files in golang-migrate's naming.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,3 @@
+from sso_client.client import SsoClient, SsoError
+
+__all__ = ["SsoClient", "SsoError"]
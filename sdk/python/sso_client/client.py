@@ -0,0 +1,77 @@
+"""Обёртка над сгенерированными gRPC-стабами Auth с привязкой к app_code."""
+
+from typing import Optional
+
+import grpc
+
+from sso_client.gen.sso import sso_pb2, sso_pb2_grpc
+
+
+class SsoError(Exception):
+    """Ошибка вызова SSO: gRPC-код и сообщение сервера."""
+
+    def __init__(self, code: grpc.StatusCode, message: str):
+        super().__init__(f"{code.name}: {message}")
+        self.code = code
+        self.message = message
+
+
+class SsoClient:
+    def __init__(
+        self,
+        target: str,
+        app_code: str,
+        timeout: Optional[float] = None,
+        credentials: Optional[grpc.ChannelCredentials] = None,
+    ):
+        if credentials is None:
+            self._channel = grpc.insecure_channel(target)
+        else:
+            self._channel = grpc.secure_channel(target, credentials)
+        self._stub = sso_pb2_grpc.AuthStub(self._channel)
+        self._app_code = app_code
+        self._timeout = timeout
+
+    def close(self) -> None:
+        self._channel.close()
+
+    def __enter__(self) -> "SsoClient":
+        return self
+
+    def __exit__(self, *exc) -> None:
+        self.close()
+
+    def register(self, email: str, password: str) -> int:
+        resp = self._call(
+            self._stub.Register,
+            sso_pb2.RegisterRequest(email=email, password=password),
+        )
+        return resp.user_id
+
+    def login(self, email: str, password: str) -> str:
+        resp = self._call(
+            self._stub.Login,
+            sso_pb2.LoginRequest(email=email, password=password, app_code=self._app_code),
+        )
+        return resp.token
+
+    def validate(self, token: str) -> str:
+        """Возвращает email владельца токена или бросает SsoError (UNAUTHENTICATED)."""
+        resp = self._call(
+            self._stub.Validate,
+            sso_pb2.ValidateTokenRequest(token=token, app_code=self._app_code),
+        )
+        return resp.email
+
+    def logout(self, email: str) -> bool:
+        resp = self._call(
+            self._stub.Logout,
+            sso_pb2.LogoutRequest(email=email, app_code=self._app_code),
+        )
+        return resp.success
+
+    def _call(self, method, request):
+        try:
+            return method(request, timeout=self._timeout)
+        except grpc.RpcError as err:
+            raise SsoError(err.code(), err.details()) from err
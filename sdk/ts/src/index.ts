@@ -0,0 +1,60 @@
+import { Code, ConnectError, createClient, type Client } from "@connectrpc/connect";
+import { createGrpcTransport } from "@connectrpc/connect-node";
+
+import { Auth } from "./gen/sso/sso_pb.js";
+
+export { Code, ConnectError };
+
+export interface SsoClientOptions {
+  /** Адрес SSO, например "http://localhost:8080". */
+  baseUrl: string;
+  /** Код приложения, от имени которого выполняются Login/Validate. */
+  appCode: string;
+  /** Таймаут одного вызова в миллисекундах. */
+  timeoutMs?: number;
+}
+
+/**
+ * Обёртка над сгенерированным клиентом Auth с привязкой к app_code.
+ */
+export class SsoClient {
+  private readonly client: Client<typeof Auth>;
+  private readonly appCode: string;
+  private readonly timeoutMs?: number;
+
+  constructor(opts: SsoClientOptions) {
+    this.client = createClient(Auth, createGrpcTransport({ baseUrl: opts.baseUrl }));
+    this.appCode = opts.appCode;
+    this.timeoutMs = opts.timeoutMs;
+  }
+
+  async register(email: string, password: string): Promise<bigint> {
+    const resp = await this.client.register({ email, password }, { timeoutMs: this.timeoutMs });
+    return resp.userId;
+  }
+
+  async login(email: string, password: string): Promise<string> {
+    const resp = await this.client.login(
+      { email, password, appCode: this.appCode },
+      { timeoutMs: this.timeoutMs },
+    );
+    return resp.token;
+  }
+
+  /** Возвращает email владельца токена или бросает ConnectError (Code.Unauthenticated). */
+  async validate(token: string): Promise<string> {
+    const resp = await this.client.validate(
+      { token, appCode: this.appCode },
+      { timeoutMs: this.timeoutMs },
+    );
+    return resp.email;
+  }
+
+  async logout(email: string): Promise<boolean> {
+    const resp = await this.client.logout(
+      { email, appCode: this.appCode },
+      { timeoutMs: this.timeoutMs },
+    );
+    return resp.success;
+  }
+}
@@ -1,12 +1,15 @@
 package tests
 
 import (
+	"context"
+	"sso/internal/grpc/apierr"
 	"sso/tests/suite"
 	"testing"
 
 	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestRegisterLoginLogout_Logout_HappyPath(t *testing.T) {
@@ -30,7 +33,16 @@ func TestRegisterLoginLogout_Logout_HappyPath(t *testing.T) {
 	require.NotEmpty(t, respLogin.GetToken())
 	token := respLogin.GetToken()
 
-	respLogout, err := st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+	// Второй токен того же пользователя не должен отзываться при выходе по первому
+	respOtherLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    email,
+		Password: pass,
+		AppCode:  appCode,
+	})
+	require.NoError(t, err)
+	otherToken := respOtherLogin.GetToken()
+
+	respLogout, err := st.AuthClient.Logout(withBearer(ctx, token), &ssov1.LogoutRequest{
 		Email:   email,
 		AppCode: appCode,
 	})
@@ -42,8 +54,27 @@ func TestRegisterLoginLogout_Logout_HappyPath(t *testing.T) {
 		AppCode: appCode,
 	})
 	require.False(t, respValidateToken.GetSuccess())
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "Access denied")
+	suite.RequireReason(t, err, apierr.ReasonTokenRevoked)
+
+	_, err = st.AuthClient.Validate(ctx, &ssov1.ValidateTokenRequest{
+		Token:   otherToken,
+		AppCode: appCode,
+	})
+	require.NoError(t, err)
+
+	// Выход не отзывает доступ к приложению
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    email,
+		Password: pass,
+		AppCode:  appCode,
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Validate(ctx, &ssov1.ValidateTokenRequest{
+		Token:   respLogin.GetToken(),
+		AppCode: appCode,
+	})
+	require.NoError(t, err)
 }
 
 func TestLogout_FailCases(t *testing.T) {
@@ -56,52 +87,86 @@ func TestLogout_FailCases(t *testing.T) {
 		Email:    email,
 		Password: pass,
 	})
-	_, _ = st.AuthClient.Login(ctx, &ssov1.LoginRequest{
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{
 		Email:    email,
 		Password: pass,
 		AppCode:  appCode,
 	})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
 
 	tests := []struct {
-		name        string
-		email       string
-		appCode     string
-		expectedErr string
+		name    string
+		token   string
+		email   string
+		appCode string
+		// expectedField is the violated field of INVALID_ARGUMENT, expectedReason is checked otherwise.
+		expectedField  string
+		expectedReason apierr.Reason
 	}{
 		{
-			name:        "email is empty",
-			email:       "",
-			appCode:     appCode,
-			expectedErr: "email is required",
+			name:          "email is empty",
+			token:         token,
+			email:         "",
+			appCode:       appCode,
+			expectedField: "email",
 		},
 		{
-			name:        "appCode is empty",
-			email:       email,
-			appCode:     "",
-			expectedErr: "app_code is required",
+			name:          "appCode is empty",
+			token:         token,
+			email:         email,
+			appCode:       "",
+			expectedField: "app_code",
 		},
 		{
-			name:        "email is not correct",
-			email:       "notExist@mail.ru",
-			appCode:     appCode,
-			expectedErr: "User not found",
+			name:          "token is empty",
+			token:         "",
+			email:         email,
+			appCode:       appCode,
+			expectedField: "authorization",
 		},
 		{
-			name:        "app is not found",
-			email:       email,
-			appCode:     "app1241232",
-			expectedErr: "App not found",
+			name:           "token is not correct",
+			token:          "not.a.token",
+			email:          email,
+			appCode:        appCode,
+			expectedReason: apierr.ReasonTokenInvalid,
+		},
+		{
+			name:           "email does not match token",
+			token:          token,
+			email:          "notExist@mail.ru",
+			appCode:        appCode,
+			expectedReason: apierr.ReasonTokenInvalid,
+		},
+		{
+			name:           "app is not found",
+			token:          token,
+			email:          email,
+			appCode:        "app1241232",
+			expectedReason: apierr.ReasonAppNotFound,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+			_, err := st.AuthClient.Logout(withBearer(ctx, tt.token), &ssov1.LogoutRequest{
 				Email:   tt.email,
 				AppCode: tt.appCode,
 			})
-			require.Error(t, err)
-			require.Contains(t, err.Error(), tt.expectedErr)
+			if tt.expectedField != "" {
+				suite.RequireFieldViolation(t, err, tt.expectedField)
+				return
+			}
+			suite.RequireReason(t, err, tt.expectedReason)
 		})
 	}
 }
+
+func withBearer(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"sso/internal/grpc/apierr"
 	"sso/tests/suite"
+	"strings"
 	"testing"
 	"time"
 
@@ -71,46 +73,48 @@ func TestRegister_FailCases(t *testing.T) {
 	ctx, st := suite.New(t)
 
 	tests := []struct {
-		name        string
-		email       string
-		password    string
-		appCode     string
-		expectedErr string
+		name     string
+		email    string
+		password string
+		appCode  string
+		// expectedField is the violated field of INVALID_ARGUMENT, expectedReason is checked otherwise.
+		expectedField  string
+		expectedReason apierr.Reason
 	}{
 		{
-			name:        "Login with Empty Password",
-			email:       gofakeit.Email(),
-			password:    "",
-			appCode:     appCode,
-			expectedErr: "password is required",
+			name:          "Login with Empty Password",
+			email:         gofakeit.Email(),
+			password:      "",
+			appCode:       appCode,
+			expectedField: "password",
 		},
 		{
-			name:        "Login with Empty Email",
-			email:       "",
-			password:    randomFakePassword(),
-			appCode:     appCode,
-			expectedErr: "email is required",
+			name:          "Login with Empty Email",
+			email:         "",
+			password:      randomFakePassword(),
+			appCode:       appCode,
+			expectedField: "email",
 		},
 		{
-			name:        "Login with Both Empty Email and Password",
-			email:       "",
-			password:    "",
-			appCode:     appCode,
-			expectedErr: "email is required",
+			name:          "Login with Both Empty Email and Password",
+			email:         "",
+			password:      "",
+			appCode:       appCode,
+			expectedField: "email",
 		},
 		{
-			name:        "Login with Non-Matching Password",
-			email:       gofakeit.Email(),
-			password:    randomFakePassword(),
-			appCode:     appCode,
-			expectedErr: "invalid email or password",
+			name:           "Login with Non-Matching Password",
+			email:          gofakeit.Email(),
+			password:       randomFakePassword(),
+			appCode:        appCode,
+			expectedReason: apierr.ReasonInvalidCredentials,
 		},
 		{
-			name:        "Login without AppCode",
-			email:       gofakeit.Email(),
-			password:    randomFakePassword(),
-			appCode:     emptyAppCode,
-			expectedErr: "app_code is required",
+			name:          "Login without AppCode",
+			email:         gofakeit.Email(),
+			password:      randomFakePassword(),
+			appCode:       emptyAppCode,
+			expectedField: "app_code",
 		},
 	}
 
@@ -127,8 +131,45 @@ func TestRegister_FailCases(t *testing.T) {
 				Password: tt.password,
 				AppCode:  tt.appCode,
 			})
-			require.Error(t, err)
-			require.Contains(t, err.Error(), tt.expectedErr)
+			if tt.expectedField != "" {
+				suite.RequireFieldViolation(t, err, tt.expectedField)
+				return
+			}
+			suite.RequireReason(t, err, tt.expectedReason)
+		})
+	}
+}
+
+func TestRegister_TooLongFields(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name          string
+		email         string
+		password      string
+		expectedField string
+	}{
+		{
+			name:          "Register with Too Long Email",
+			email:         strings.Repeat("a", 245) + "@example.com",
+			password:      randomFakePassword(),
+			expectedField: "email",
+		},
+		{
+			name:          "Register with Too Long Password",
+			email:         gofakeit.Email(),
+			password:      strings.Repeat("a", 73),
+			expectedField: "password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+				Email:    tt.email,
+				Password: tt.password,
+			})
+			suite.RequireFieldViolation(t, err, tt.expectedField)
 		})
 	}
 }
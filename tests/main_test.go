@@ -0,0 +1,11 @@
+package tests
+
+import (
+	"os"
+	"sso/tests/suite"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(suite.Main(m))
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"sso/internal/grpc/apierr"
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/require"
+)
+
+// Каждый шаг идёт в другую реплику: состояние должно быть общим через БД и Redis
+func TestMultiInstance_StateIsShared(t *testing.T) {
+	ctx, instances := suite.NewCluster(t, 2)
+	first, second := instances[0], instances[1]
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := first.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    email,
+		Password: pass,
+	})
+	require.NoError(t, err)
+
+	// Повторная регистрация на другой реплике видит пользователя
+	_, err = second.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    email,
+		Password: pass,
+	})
+	suite.RequireReason(t, err, apierr.ReasonUserExists)
+
+	respLogin, err := second.AuthClient.Login(ctx, &ssov1.LoginRequest{
+		Email:    email,
+		Password: pass,
+		AppCode:  appCode,
+	})
+	require.NoError(t, err)
+	token := respLogin.GetToken()
+
+	_, err = first.AuthClient.Validate(ctx, &ssov1.ValidateTokenRequest{
+		Token:   token,
+		AppCode: appCode,
+	})
+	require.NoError(t, err)
+
+	// Отзыв на одной реплике действует на другой: список отозванных токенов в Redis
+	_, err = second.AuthClient.Logout(withBearer(ctx, token), &ssov1.LogoutRequest{
+		Email:   email,
+		AppCode: appCode,
+	})
+	require.NoError(t, err)
+
+	_, err = first.AuthClient.Validate(ctx, &ssov1.ValidateTokenRequest{
+		Token:   token,
+		AppCode: appCode,
+	})
+	suite.RequireReason(t, err, apierr.ReasonTokenRevoked)
+}
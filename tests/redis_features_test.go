@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"sso/internal/grpc/apierr"
+	"sso/internal/grpc/idempotency"
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/Nafanyan/sso-proto/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+// lockoutThreshold is rate_limit.lockout.threshold of the test config.
+const lockoutThreshold = 5
+
+// Счётчик неудачных попыток живёт в Redis: после порога не пускает и с верным паролем
+func TestLogin_Lockout(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	for range lockoutThreshold {
+		_, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass + "x", AppCode: appCode})
+		suite.RequireReason(t, err, apierr.ReasonInvalidCredentials)
+	}
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppCode: appCode})
+	suite.RequireReason(t, err, apierr.ReasonLockedOut)
+}
+
+// Ответ на запрос с ключом идемпотентности запоминается в Redis: повтор не создаёт второго пользователя
+func TestRegister_Idempotent(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, idempotency.Key, gofakeit.UUID())
+	req := &ssov1.RegisterRequest{Email: gofakeit.Email(), Password: randomFakePassword()}
+
+	first, err := st.AuthClient.Register(ctx, req)
+	require.NoError(t, err)
+
+	second, err := st.AuthClient.Register(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, first.GetUserId(), second.GetUserId())
+}
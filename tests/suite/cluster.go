@@ -0,0 +1,63 @@
+package suite
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sso/internal/config"
+	"testing"
+)
+
+// NewCluster starts n instances in multi-instance mode sharing a fresh database and the Redis
+// of the shared server, and returns a client of each. The instances are stopped when the test ends.
+func NewCluster(t *testing.T, n int) (context.Context, []*Suite) {
+	t.Helper()
+	t.Parallel()
+
+	srv, err := sharedServer()
+	if err != nil {
+		t.Fatalf("failed to start sso server: %v", err)
+	}
+
+	dir, storagePath, err := prepareStorage()
+	if err != nil {
+		t.Fatalf("failed to prepare storage: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	var ctx context.Context
+	suites := make([]*Suite, 0, n)
+
+	for i := range n {
+		cfg := config.MustLoadPath(filepath.Join(repoRoot(), configFile))
+		cfg.StoragePath = storagePath
+		cfg.GRPC.Port = 0
+		cfg.Redis.Addr = srv.cfg.Redis.Addr
+		// Свой префикс: ключи кластера не пересекаются с ключами общего сервера
+		cfg.Redis.KeyPrefix = filepath.Base(dir) + ":"
+		cfg.Debug.Enabled = false
+		cfg.MultiInstance = true
+		cfg.InstanceID = fmt.Sprintf("instance-%d", i)
+
+		application, addr, err := startApp(cfg)
+		if err != nil {
+			t.Fatalf("failed to start instance %d: %v", i, err)
+		}
+		t.Cleanup(func() {
+			if err := application.Stop(); err != nil {
+				t.Errorf("failed to stop instance %d: %v", i, err)
+			}
+		})
+
+		var s *Suite
+		ctx, s = newSuite(t, ClientCfg{
+			Addr:     addr,
+			Timeout:  cfg.GRPC.Timeout,
+			TokenTTL: cfg.TokenTTL,
+		})
+		suites = append(suites, s)
+	}
+
+	return ctx, suites
+}
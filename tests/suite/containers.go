@@ -0,0 +1,43 @@
+//go:build containers
+
+package suite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+const (
+	redisImage = "redis:7-alpine"
+	// containerStartTimeout covers pulling the image on a clean CI runner.
+	containerStartTimeout = 2 * time.Minute
+)
+
+func init() {
+	startRedis = startRedisContainer
+}
+
+// startRedisContainer runs a throwaway Redis in Docker, so the tests cover the Redis-backed features.
+func startRedisContainer() (string, func(), error) {
+	const op = "suite.startRedisContainer"
+
+	ctx, cancel := context.WithTimeout(context.Background(), containerStartTimeout)
+	defer cancel()
+
+	container, err := tcredis.Run(ctx, redisImage)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	addr, err := container.Endpoint(ctx, "")
+	if err != nil {
+		_ = testcontainers.TerminateContainer(container)
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return addr, func() { _ = testcontainers.TerminateContainer(container) }, nil
+}
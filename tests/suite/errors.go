@@ -0,0 +1,45 @@
+package suite
+
+import (
+	"sso/internal/grpc/apierr"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// RequireReason fails the test unless err carries ErrorInfo with the reason.
+func RequireReason(t *testing.T, err error, reason apierr.Reason) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected error with reason %s, got nil", reason)
+	}
+
+	if got := apierr.ReasonOf(err); got != reason {
+		t.Fatalf("expected reason %s, got %q: %v", reason, got, err)
+	}
+}
+
+// RequireFieldViolation fails the test unless err is INVALID_ARGUMENT with a violation of the field.
+func RequireFieldViolation(t *testing.T, err error, field string) {
+	t.Helper()
+
+	RequireReason(t, err, apierr.ReasonInvalidArgument)
+
+	st, _ := status.FromError(err)
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+
+		for _, v := range badRequest.GetFieldViolations() {
+			if v.GetField() == field {
+				return
+			}
+		}
+	}
+
+	t.Fatalf("expected violation of field %q: %v", field, err)
+}
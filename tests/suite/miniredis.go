@@ -0,0 +1,25 @@
+//go:build !containers
+
+package suite
+
+import (
+	"fmt"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func init() {
+	startRedis = startMiniredis
+}
+
+// startMiniredis runs an in-process Redis, so go test ./... covers the Redis-backed features without Docker.
+func startMiniredis() (string, func(), error) {
+	const op = "suite.startMiniredis"
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mr.Addr(), mr.Close, nil
+}
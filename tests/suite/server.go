@@ -0,0 +1,196 @@
+package suite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sso/internal/app"
+	"sso/internal/config"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+const (
+	configFile = "config/config_local_tests.yaml"
+
+	// redisAddrEnv points the server to an existing Redis instead of the one the harness starts.
+	redisAddrEnv = "SSO_TEST_REDIS_ADDR"
+	// verboseEnv writes the server logs to stderr.
+	verboseEnv = "SSO_TEST_VERBOSE"
+)
+
+// server is the SSO instance shared by all tests of the binary.
+type server struct {
+	app  *app.App
+	addr string
+	cfg  *config.Config
+	dir  string
+	// stopRedis stops the Redis started by the harness, nil if the server doesn't own one.
+	stopRedis func()
+}
+
+// startRedis starts a Redis for the server: miniredis in process, or a container with the containers build tag.
+var startRedis func() (addr string, stop func(), err error)
+
+var (
+	serverOnce sync.Once
+	srv        *server
+	errServer  error
+)
+
+// Main runs the tests and stops the server and the containers started by them, call it from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(suite.Main(m))
+//	}
+func Main(m *testing.M) int {
+	code := m.Run()
+
+	if srv != nil {
+		if err := srv.app.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to stop sso server: %v\n", err)
+		}
+		if srv.stopRedis != nil {
+			srv.stopRedis()
+		}
+		_ = os.RemoveAll(srv.dir)
+	}
+
+	return code
+}
+
+// sharedServer starts the server on first use: a temporary SQLite file with all migrations
+// and test seeds applied, gRPC on a random localhost port.
+func sharedServer() (*server, error) {
+	serverOnce.Do(func() {
+		srv, errServer = startServer()
+	})
+
+	return srv, errServer
+}
+
+func startServer() (*server, error) {
+	const op = "suite.startServer"
+
+	dir, storagePath, err := prepareStorage()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Явно заданный Redis важнее поднятого харнессом
+	redisAddr := os.Getenv(redisAddrEnv)
+	var stopRedis func()
+	if redisAddr == "" {
+		redisAddr, stopRedis, err = startRedis()
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	cfg := config.MustLoadPath(filepath.Join(repoRoot(), configFile))
+	cfg.StoragePath = storagePath
+	cfg.GRPC.Port = 0
+	cfg.Redis.Addr = redisAddr
+	cfg.Debug.Enabled = false
+
+	application, addr, err := startApp(cfg)
+	if err != nil {
+		if stopRedis != nil {
+			stopRedis()
+		}
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &server{
+		app:  application,
+		addr: addr,
+		cfg:  cfg,
+		dir:  dir,
+
+		stopRedis: stopRedis,
+	}, nil
+}
+
+// prepareStorage creates a temporary SQLite file with all migrations and test seeds applied.
+// The caller removes dir.
+func prepareStorage() (dir string, storagePath string, err error) {
+	root := repoRoot()
+
+	dir, err = os.MkdirTemp("", "sso-test-")
+	if err != nil {
+		return "", "", err
+	}
+
+	storagePath = filepath.Join(dir, "sso.db")
+
+	// Схема и тестовые данные ведут отдельные таблицы версий, как при ручном запуске мигратора
+	if err := migrateUp(storagePath, filepath.Join(root, "migrations"), "migrations"); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", "", err
+	}
+	if err := migrateUp(storagePath, filepath.Join(root, "tests", "migrations"), "migrations_seed"); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", "", err
+	}
+
+	return dir, storagePath, nil
+}
+
+// startApp starts the app on a random localhost port and returns its address.
+func startApp(cfg *config.Config) (*app.App, string, error) {
+	application := app.New(serverLogger(), cfg)
+
+	addr, err := application.Listen()
+	if err != nil {
+		_ = application.Stop()
+		return nil, "", err
+	}
+
+	go application.MustRun()
+
+	return application, net.JoinHostPort("localhost", strconv.Itoa(addr.(*net.TCPAddr).Port)), nil
+}
+
+func migrateUp(storagePath string, migrationsPath string, table string) error {
+	m, err := migrate.New(
+		"file://"+migrationsPath,
+		fmt.Sprintf("sqlite3://%s?x-migrations-table=%s", storagePath, table),
+	)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("%s: %w", migrationsPath, err)
+	}
+
+	return nil
+}
+
+func serverLogger() *slog.Logger {
+	if os.Getenv(verboseEnv) != "" {
+		return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// repoRoot is resolved from this file, so the tests don't depend on the working directory.
+func repoRoot() string {
+	_, file, _, _ := runtime.Caller(0)
+
+	return filepath.Join(filepath.Dir(file), "..", "..")
+}
@@ -2,8 +2,6 @@ package suite
 
 import (
 	"context"
-	"net"
-	"strconv"
 	"testing"
 	"time"
 
@@ -14,7 +12,8 @@ import (
 
 // ClientCfg — только то, что нужно клиенту: куда стучаться и таймауты.
 type ClientCfg struct {
-	Port     int32
+	// Addr is the address of the in-process server, a random localhost port.
+	Addr     string
 	Timeout  time.Duration
 	TokenTTL time.Duration
 }
@@ -25,18 +24,26 @@ type Suite struct {
 	AuthClient ssov1.AuthClient
 }
 
-const (
-	grpcHost        = "localhost"
-	defaultPort     = 8080
-	defaultTimeout  = 60 * time.Second
-	defaultTokenTTL = time.Hour
-)
-
+// New returns the client of the server shared by all tests of the binary, starting it on first use.
+// The package tests must call Main from TestMain to stop the server.
 func New(t *testing.T) (context.Context, *Suite) {
 	t.Helper()
 	t.Parallel()
 
-	cfg := clientCfg()
+	srv, err := sharedServer()
+	if err != nil {
+		t.Fatalf("failed to start sso server: %v", err)
+	}
+
+	return newSuite(t, ClientCfg{
+		Addr:     srv.addr,
+		Timeout:  srv.cfg.GRPC.Timeout,
+		TokenTTL: srv.cfg.TokenTTL,
+	})
+}
+
+func newSuite(t *testing.T, cfg ClientCfg) (context.Context, *Suite) {
+	t.Helper()
 
 	ctx, cancelCtx := context.WithTimeout(context.Background(), cfg.Timeout)
 	t.Cleanup(func() {
@@ -45,7 +52,7 @@ func New(t *testing.T) (context.Context, *Suite) {
 	})
 
 	cc, err := grpc.DialContext(context.Background(),
-		net.JoinHostPort(grpcHost, strconv.Itoa(int(cfg.Port))),
+		cfg.Addr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		t.Fatalf("grpc server connection failed: %v", err)
@@ -58,13 +65,3 @@ func New(t *testing.T) (context.Context, *Suite) {
 		AuthClient: ssov1.NewAuthClient(cc),
 	}
 }
-
-func clientCfg() ClientCfg {
-	cfg := ClientCfg{
-		Port:     defaultPort,
-		Timeout:  defaultTimeout,
-		TokenTTL: defaultTokenTTL,
-	}
-
-	return cfg
-}